@@ -0,0 +1,311 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/fs"
+	"github.com/restic/restic/internal/restic"
+)
+
+// newChangeJournal returns the change journal of the platform, it is replaced
+// in tests.
+var newChangeJournal = fs.NewChangeJournal
+
+// changeJournalMaxEntries is the number of snapshots for which the journal
+// positions are kept in the state file.
+const changeJournalMaxEntries = 50
+
+// changeJournalEntry records the journal positions of all volumes containing
+// targets at the start of the backup which created a snapshot.
+type changeJournalEntry struct {
+	Snapshot  restic.ID            `json:"snapshot"`
+	Time      time.Time            `json:"time"`
+	Positions []fs.JournalPosition `json:"positions"`
+}
+
+// changeJournalState is stored in the cache directory of the repository, as
+// journal positions are only meaningful on the machine they were read on.
+type changeJournalState struct {
+	filename string
+	Entries  []changeJournalEntry `json:"entries"`
+}
+
+// loadChangeJournalState loads the state from filename. A missing or damaged
+// file results in an empty state.
+func loadChangeJournalState(filename string) (*changeJournalState, error) {
+	state := &changeJournalState{filename: filename}
+
+	buf, err := os.ReadFile(filename)
+	if errors.Is(err, os.ErrNotExist) {
+		return state, nil
+	}
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	if err := json.Unmarshal(buf, state); err != nil {
+		debug.Log("unable to parse change journal state %v, ignoring it: %v", filename, err)
+		return &changeJournalState{filename: filename}, nil
+	}
+	return state, nil
+}
+
+// positions returns the journal positions recorded for the snapshot id.
+func (s *changeJournalState) positions(id restic.ID) ([]fs.JournalPosition, bool) {
+	for _, e := range s.Entries {
+		if e.Snapshot.Equal(id) {
+			return e.Positions, true
+		}
+	}
+	return nil, false
+}
+
+// add records the positions for the snapshot id, only the newest entries are
+// kept.
+func (s *changeJournalState) add(id restic.ID, t time.Time, positions []fs.JournalPosition) {
+	s.Entries = append(s.Entries, changeJournalEntry{Snapshot: id, Time: t, Positions: positions})
+	sort.SliceStable(s.Entries, func(i, j int) bool {
+		return s.Entries[i].Time.After(s.Entries[j].Time)
+	})
+	if len(s.Entries) > changeJournalMaxEntries {
+		s.Entries = s.Entries[:changeJournalMaxEntries]
+	}
+}
+
+// save writes the state to disk.
+func (s *changeJournalState) save() error {
+	buf, err := json.Marshal(s)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	f, err := os.CreateTemp(filepath.Dir(s.filename), filepath.Base(s.filename)+"-tmp-")
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	_, err = f.Write(buf)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), s.filename)
+	}
+	if err != nil {
+		_ = os.Remove(f.Name())
+		return errors.WithStack(err)
+	}
+	return nil
+}
+
+// journalPositions returns the current position of the journal for each
+// volume containing one of the targets.
+func journalPositions(journal fs.ChangeJournal, targets []string) ([]fs.JournalPosition, error) {
+	var positions []fs.JournalPosition
+	seen := make(map[string]struct{})
+	for _, target := range targets {
+		pos, err := journal.Position(target)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := seen[pos.Volume]; ok {
+			continue
+		}
+		seen[pos.Volume] = struct{}{}
+		positions = append(positions, pos)
+	}
+	return positions, nil
+}
+
+// journalChanges returns all paths which changed since the previous
+// positions. Both lists must contain the same volumes, otherwise
+// fs.ErrJournalIncomplete is returned.
+func journalChanges(ctx context.Context, journal fs.ChangeJournal, previous, current []fs.JournalPosition) ([]string, error) {
+	var changed []string
+	for _, cur := range current {
+		found := false
+		for _, prev := range previous {
+			if prev.Volume != cur.Volume {
+				continue
+			}
+			found = true
+
+			paths, err := journal.Changes(ctx, prev)
+			if err != nil {
+				return nil, err
+			}
+			changed = append(changed, paths...)
+		}
+		if !found {
+			return nil, fs.ErrJournalIncomplete
+		}
+	}
+	return changed, nil
+}
+
+// pathWithin returns p with the prefix spelled as in target if p is target or
+// located below it. Paths are compared case-insensitively on Windows.
+func pathWithin(target, p string) (string, bool) {
+	target = filepath.Clean(target)
+	p = filepath.Clean(p)
+
+	if len(p) < len(target) {
+		return "", false
+	}
+	prefix := p[:len(target)]
+	if runtime.GOOS == "windows" {
+		if !strings.EqualFold(prefix, target) {
+			return "", false
+		}
+	} else if prefix != target {
+		return "", false
+	}
+
+	rest := p[len(target):]
+	switch {
+	case rest == "":
+		return target, true
+	case strings.HasSuffix(target, string(filepath.Separator)):
+		return target + rest, true
+	case rest[0] == filepath.Separator:
+		return target + rest, true
+	}
+	return "", false
+}
+
+// changedTargets returns the paths from changed which are located within one
+// of the targets, paths below another changed path are removed as they are
+// read again anyway.
+func changedTargets(targets []string, changed []string) []string {
+	set := make(map[string]struct{})
+	for _, p := range changed {
+		for _, target := range targets {
+			if item, ok := pathWithin(target, p); ok {
+				set[item] = struct{}{}
+				break
+			}
+		}
+	}
+
+	var result []string
+	for p := range set {
+		covered := false
+		for dir := filepath.Dir(p); ; dir = filepath.Dir(dir) {
+			if _, ok := set[dir]; ok {
+				covered = true
+				break
+			}
+			if dir == filepath.Dir(dir) {
+				break
+			}
+		}
+		if !covered {
+			result = append(result, p)
+		}
+	}
+	sort.Strings(result)
+	return result
+}
+
+// changeJournalBackup holds the journal state for a backup using
+// --use-change-journal.
+type changeJournalBackup struct {
+	state *changeJournalState
+	// positions are read at the start of the backup, they are recorded for
+	// the new snapshot.
+	positions []fs.JournalPosition
+	// changed lists the paths which must be read again, it is only valid if
+	// complete is set. Otherwise all targets must be read.
+	changed  []string
+	complete bool
+}
+
+// prepareChangeJournal reads the current journal positions of the volumes
+// containing the targets and determines the paths which changed since the
+// parent snapshot. Problems with the journal are reported via warn and all
+// files are read, if even the current positions are unavailable nil is
+// returned. The reason why all files are read in the regular case, e.g. the
+// first backup, is reported via verbose.
+func prepareChangeJournal(ctx context.Context, cacheDir string, targets []string, parent *restic.Snapshot, warn func(msg string), verbose func(msg string, args ...interface{})) (*changeJournalBackup, error) {
+	journal, err := newChangeJournal()
+	if errors.Is(err, fs.ErrJournalUnsupported) {
+		return nil, errors.Fatalf("--use-change-journal: %v", err)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if cacheDir == "" {
+		return nil, errors.Fatal("--use-change-journal requires the local cache")
+	}
+	for _, target := range targets {
+		if !filepath.IsAbs(target) {
+			return nil, errors.Fatalf("--use-change-journal requires absolute paths, %v is relative", target)
+		}
+	}
+
+	positions, err := journalPositions(journal, targets)
+	if err != nil {
+		warn(fmt.Sprintf("unable to read the change journal, reading all files: %v", err))
+		return nil, nil
+	}
+
+	state, err := loadChangeJournalState(filepath.Join(cacheDir, "change-journal"))
+	if err != nil {
+		return nil, err
+	}
+	jb := &changeJournalBackup{state: state, positions: positions}
+
+	if parent == nil {
+		return jb, nil
+	}
+	previous, ok := state.positions(*parent.ID())
+	if !ok {
+		verbose("no change journal positions recorded for parent snapshot %v, reading all files", parent.ID().Str())
+		return jb, nil
+	}
+
+	changed, err := journalChanges(ctx, journal, previous, positions)
+	if errors.Is(err, fs.ErrJournalIncomplete) {
+		warn(fmt.Sprintf("the change journal does not contain all changes since parent snapshot %v, reading all files", parent.ID().Str()))
+		return jb, nil
+	}
+	if err != nil {
+		warn(fmt.Sprintf("unable to read the change journal, reading all files: %v", err))
+		return jb, nil
+	}
+
+	jb.changed = changedTargets(targets, changed)
+	for _, item := range jb.changed {
+		for _, target := range targets {
+			if filepath.Clean(target) == item {
+				verbose("target %v changed, reading all files", target)
+				return jb, nil
+			}
+		}
+	}
+	jb.complete = true
+	debug.Log("change journal lists %d changed paths: %v", len(jb.changed), jb.changed)
+
+	return jb, nil
+}
+
+// record saves the positions read at the start of the backup for the
+// snapshot id.
+func (jb *changeJournalBackup) record(id restic.ID) error {
+	if jb == nil {
+		return nil
+	}
+	jb.state.add(id, time.Now(), jb.positions)
+	return jb.state.save()
+}
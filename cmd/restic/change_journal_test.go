@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/restic/restic/internal/fs"
+	"github.com/restic/restic/internal/restic"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func TestChangedTargets(t *testing.T) {
+	p := filepath.FromSlash
+	targets := []string{p("/home/user"), p("/etc/")}
+
+	changed := []string{
+		p("/home/user/a/b"),
+		p("/home/user/a"),
+		p("/home/user/a/c/d"),
+		p("/home/user/x y"),
+		p("/home/user/x/z"),
+		p("/home/username/file"),
+		p("/etc/passwd"),
+		p("/var/log/syslog"),
+		p("/home/user/x/z"),
+	}
+
+	want := []string{
+		p("/etc/passwd"),
+		p("/home/user/a"),
+		p("/home/user/x y"),
+		p("/home/user/x/z"),
+	}
+	rtest.Equals(t, want, changedTargets(targets, changed))
+	rtest.Equals(t, []string(nil), changedTargets(targets, nil))
+}
+
+func TestChangeJournalState(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "change-journal")
+
+	state, err := loadChangeJournalState(filename)
+	rtest.OK(t, err)
+	rtest.Equals(t, 0, len(state.Entries))
+
+	start := time.Now()
+	var ids restic.IDs
+	for i := 0; i < changeJournalMaxEntries+5; i++ {
+		id := restic.NewRandomID()
+		ids = append(ids, id)
+		state.add(id, start.Add(time.Duration(i)*time.Second), []fs.JournalPosition{{Volume: "/", JournalID: "test", Position: uint64(i)}})
+	}
+	rtest.OK(t, state.save())
+
+	state, err = loadChangeJournalState(filename)
+	rtest.OK(t, err)
+	rtest.Equals(t, changeJournalMaxEntries, len(state.Entries))
+
+	// the oldest entries have been removed
+	_, ok := state.positions(ids[0])
+	rtest.Assert(t, !ok, "oldest entry was not removed")
+	pos, ok := state.positions(ids[len(ids)-1])
+	rtest.Assert(t, ok, "newest entry is missing")
+	rtest.Equals(t, []fs.JournalPosition{{Volume: "/", JournalID: "test", Position: uint64(len(ids) - 1)}}, pos)
+
+	// a damaged file is ignored
+	rtest.OK(t, os.WriteFile(filename, []byte("foo"), 0600))
+	state, err = loadChangeJournalState(filename)
+	rtest.OK(t, err)
+	rtest.Equals(t, 0, len(state.Entries))
+}
+
+// testChangeJournal returns the paths in changes, the position is the number
+// of changes.
+type testChangeJournal struct {
+	id      string
+	changes []string
+}
+
+func (j *testChangeJournal) Position(path string) (fs.JournalPosition, error) {
+	return fs.JournalPosition{
+		Volume:    filepath.VolumeName(path) + string(filepath.Separator),
+		JournalID: j.id,
+		Position:  uint64(len(j.changes)),
+	}, nil
+}
+
+func (j *testChangeJournal) Changes(_ context.Context, pos fs.JournalPosition) ([]string, error) {
+	if pos.JournalID != j.id || pos.Position > uint64(len(j.changes)) {
+		return nil, fs.ErrJournalIncomplete
+	}
+	return j.changes[pos.Position:], nil
+}
+
+func TestBackupChangeJournal(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	journal := &testChangeJournal{id: "1"}
+	prev := newChangeJournal
+	newChangeJournal = func() (fs.ChangeJournal, error) {
+		return journal, nil
+	}
+	defer func() {
+		newChangeJournal = prev
+	}()
+
+	testSetupBackupData(t, env)
+	opts := BackupOptions{UseChangeJournal: true}
+
+	// relative targets cannot be matched with the journal
+	err := testRunBackupAssumeFailure(t, filepath.Dir(env.testdata), []string{"testdata"}, opts, env.gopts)
+	rtest.Assert(t, err != nil, "expected error for relative target")
+
+	testRunBackup(t, "", []string{env.testdata}, opts, env.gopts)
+	first, _ := testRunSnapshots(t, env.gopts)
+
+	rtest.OK(t, os.RemoveAll(filepath.Join(env.testdata, "0", "0", "9")))
+	rtest.OK(t, os.WriteFile(filepath.Join(env.testdata, "0", "new"), []byte("new file"), 0644))
+	journal.changes = append(journal.changes,
+		filepath.Join(env.testdata, "0", "0", "9", "0"),
+		filepath.Join(env.testdata, "0", "0", "9"),
+		filepath.Join(env.testdata, "0", "new"),
+		filepath.Join(env.base, "unrelated"),
+	)
+
+	testRunBackup(t, "", []string{env.testdata}, opts, env.gopts)
+	newest, snapshots := testRunSnapshots(t, env.gopts)
+	rtest.Equals(t, 2, len(snapshots))
+	rtest.Equals(t, first.Paths, newest.Paths)
+	rtest.Equals(t, *first.ID, *newest.Parent)
+	rtest.Equals(t, uint(1), newest.Summary.TotalFilesProcessed)
+
+	restoredir := filepath.Join(env.base, "restore")
+	testRunRestore(t, env.gopts, restoredir, *newest.ID)
+	// absolute targets are restored with their full path, the volume name is
+	// stored without the colon on Windows
+	vol := filepath.VolumeName(env.testdata)
+	restored := filepath.Join(restoredir, strings.TrimSuffix(vol, ":"), env.testdata[len(vol):])
+	diff := directoriesContentsDiff(env.testdata, restored)
+	rtest.Assert(t, diff == "", "directories are not equal: %v", diff)
+
+	// all files are read if the journal was recreated
+	journal.id = "2"
+	testRunBackup(t, "", []string{env.testdata}, opts, env.gopts)
+	latest, snapshots := testRunSnapshots(t, env.gopts)
+	rtest.Equals(t, 3, len(snapshots))
+	rtest.Assert(t, latest.Summary.TotalFilesProcessed > 1, "expected all files to be processed, got %d", latest.Summary.TotalFilesProcessed)
+
+	testRunCheck(t, env.gopts)
+}
@@ -10,7 +10,6 @@ import (
 	"path"
 	"path/filepath"
 	"runtime"
-	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -19,6 +18,7 @@ import (
 	"golang.org/x/sync/errgroup"
 
 	"github.com/restic/restic/internal/archiver"
+	"github.com/restic/restic/internal/backend"
 	"github.com/restic/restic/internal/debug"
 	"github.com/restic/restic/internal/errors"
 	"github.com/restic/restic/internal/fs"
@@ -42,6 +42,8 @@ EXIT STATUS
 Exit status is 0 if the command was successful.
 Exit status is 1 if there was a fatal error (no snapshot created).
 Exit status is 3 if some source data could not be read (incomplete snapshot created).
+Exit status is 4 if the backup completed, but warnings were reported and
+"--warning-exit-code" was specified.
 `,
 	PreRun: func(cmd *cobra.Command, args []string) {
 		if backupOptions.Host == "" {
@@ -79,27 +81,36 @@ Exit status is 3 if some source data could not be read (incomplete snapshot crea
 type BackupOptions struct {
 	excludePatternOptions
 
-	Parent            string
-	Force             bool
-	ExcludeOtherFS    bool
-	ExcludeIfPresent  []string
-	ExcludeCaches     bool
-	ExcludeLargerThan string
-	Stdin             bool
-	StdinFilename     string
-	Tags              restic.TagLists
-	Host              string
-	FilesFrom         []string
-	FilesFromVerbatim []string
-	FilesFromRaw      []string
-	TimeStamp         string
-	WithAtime         bool
-	IgnoreInode       bool
-	IgnoreCtime       bool
-	UseFsSnapshot     bool
-	DryRun            bool
-	ReadConcurrency   uint
-	NoScan            bool
+	Parent             string
+	Force              bool
+	Partial            bool
+	UseChangeJournal   bool
+	ExcludeOtherFS     bool
+	ExcludeIfPresent   []string
+	ExcludeCaches      bool
+	ExcludeLargerThan  string
+	ExcludeTimeMachine bool
+	Stdin              bool
+	StdinFilename      string
+	Tags               restic.TagLists
+	Host               string
+	FilesFrom          []string
+	FilesFromVerbatim  []string
+	FilesFromRaw       []string
+	TimeStamp          string
+	WithAtime          bool
+	AllowSpecial       bool
+	IgnoreInode        bool
+	IgnoreCtime        bool
+	NoChunkCache       bool
+	LazyIndex          bool
+	RecordStats        bool
+	UseFsSnapshot      bool
+	CrossSnapshots     bool
+	DryRun             bool
+	ReadConcurrency    uint
+	NoScan             bool
+	UseRepoExcludes    []string
 }
 
 var backupOptions BackupOptions
@@ -113,13 +124,18 @@ func init() {
 	f := cmdBackup.Flags()
 	f.StringVar(&backupOptions.Parent, "parent", "", "use this parent `snapshot` (default: last snapshot in the repository that has the same target files/directories, and is not newer than the snapshot time)")
 	f.BoolVarP(&backupOptions.Force, "force", "f", false, `force re-reading the target files/directories (overrides the "parent" flag)`)
+	f.BoolVar(&backupOptions.Partial, "partial", false, `only read the target files/directories and reuse everything else from the "parent" snapshot`)
+
+	f.BoolVar(&backupOptions.UseChangeJournal, "use-change-journal", false, `only read the files which the change journal of the file system (USN journal on Windows, fseventsd on macOS) lists as changed since the "parent" snapshot`)
 
 	initExcludePatternOptions(f, &backupOptions.excludePatternOptions)
 
 	f.BoolVarP(&backupOptions.ExcludeOtherFS, "one-file-system", "x", false, "exclude other file systems, don't cross filesystem boundaries and subvolumes")
 	f.StringArrayVar(&backupOptions.ExcludeIfPresent, "exclude-if-present", nil, "takes `filename[:header]`, exclude contents of directories containing filename (except filename itself) if header of that file is as provided (can be specified multiple times)")
 	f.BoolVar(&backupOptions.ExcludeCaches, "exclude-caches", false, `excludes cache directories that are marked with a CACHEDIR.TAG file. See https://bford.info/cachedir/ for the Cache Directory Tagging Standard`)
+	f.StringArrayVar(&backupOptions.UseRepoExcludes, "use-repo-excludes", nil, "apply the exclude policy `name` stored in the repository (can be specified multiple times)")
 	f.StringVar(&backupOptions.ExcludeLargerThan, "exclude-larger-than", "", "max `size` of the files to be backed up (allowed suffixes: k/K, m/M, g/G, t/T)")
+	f.BoolVar(&backupOptions.ExcludeTimeMachine, "exclude-time-machine", false, "exclude files and directories which are excluded from Time Machine backups on macOS")
 	f.BoolVar(&backupOptions.Stdin, "stdin", false, "read backup from stdin")
 	f.StringVar(&backupOptions.StdinFilename, "stdin-filename", "stdin", "`filename` to use when reading from stdin")
 	f.Var(&backupOptions.Tags, "tag", "add `tags` for the new snapshot in the format `tag[,tag,...]` (can be specified multiple times)")
@@ -136,17 +152,49 @@ func init() {
 	f.StringArrayVar(&backupOptions.FilesFromRaw, "files-from-raw", nil, "read the files to backup from `file` (can be combined with file args; can be specified multiple times)")
 	f.StringVar(&backupOptions.TimeStamp, "time", "", "`time` of the backup (ex. '2012-11-01 22:08:41') (default: now)")
 	f.BoolVar(&backupOptions.WithAtime, "with-atime", false, "store the atime for all files and directories")
+	f.BoolVar(&backupOptions.AllowSpecial, "allow-special", false, "store unix sockets as placeholders instead of skipping them")
 	f.BoolVar(&backupOptions.IgnoreInode, "ignore-inode", false, "ignore inode number changes when checking for modified files")
 	f.BoolVar(&backupOptions.IgnoreCtime, "ignore-ctime", false, "ignore ctime changes when checking for modified files")
+	f.BoolVar(&backupOptions.NoChunkCache, "no-chunk-cache", false, "do not use the local cache to find the content of large files which were moved or renamed")
+	f.BoolVar(&backupOptions.RecordStats, "record-stats", false, "save a statistics record about the repository in the local cache, listed by 'stats --history'")
+	f.BoolVar(&backupOptions.LazyIndex, "lazy-index", false, "only keep a filter of the data blobs in memory and load index files on demand (reduces memory usage for large repositories)")
 	f.BoolVarP(&backupOptions.DryRun, "dry-run", "n", false, "do not upload or write any data, just show what would be done")
 	f.BoolVar(&backupOptions.NoScan, "no-scan", false, "do not run scanner to estimate size of backup")
-	if runtime.GOOS == "windows" {
-		f.BoolVar(&backupOptions.UseFsSnapshot, "use-fs-snapshot", false, "use filesystem snapshot where possible (currently only Windows VSS)")
+	switch runtime.GOOS {
+	case "windows", "linux", "freebsd":
+		f.BoolVar(&backupOptions.UseFsSnapshot, "use-fs-snapshot", false, "use filesystem snapshots where possible (Windows VSS, ZFS, and UFS on FreeBSD)")
+	}
+	switch runtime.GOOS {
+	case "linux", "freebsd":
+		f.BoolVar(&backupOptions.CrossSnapshots, "cross-snapshotted-datasets", false, "with --one-file-system and --use-fs-snapshot, also include child datasets for which a snapshot was created")
 	}
 
 	// parse read concurrency from env, on error the default value will be used
-	readConcurrency, _ := strconv.ParseUint(os.Getenv("RESTIC_READ_CONCURRENCY"), 10, 32)
-	backupOptions.ReadConcurrency = uint(readConcurrency)
+	setFromEnv("RESTIC_READ_CONCURRENCY", func(*GlobalOptions) interface{} { return &backupOptions.ReadConcurrency })
+}
+
+// openFileReserve is the number of file descriptors which are kept available
+// for the repository, the cache and the backend when limiting the number of
+// concurrently read files.
+const openFileReserve = 64
+
+// limitReadConcurrency reduces the read concurrency n such that it fits into
+// the open file limit. A limit of zero means unlimited.
+func limitReadConcurrency(n uint, openFileLimit uint64) uint {
+	if openFileLimit == 0 || n == 0 {
+		// zero selects the default read concurrency of the archiver, which is
+		// low enough for any sane limit
+		return n
+	}
+
+	max := uint64(1)
+	if openFileLimit > openFileReserve+1 {
+		max = openFileLimit - openFileReserve
+	}
+	if uint64(n) > max {
+		return uint(max)
+	}
+	return n
 }
 
 // filterExisting returns a slice of all existing items, or an error if no
@@ -155,7 +203,7 @@ func filterExisting(items []string) (result []string, err error) {
 	for _, item := range items {
 		_, err := fs.Lstat(item)
 		if errors.Is(err, os.ErrNotExist) {
-			Warnf("%v does not exist, skipping\n", item)
+			Warningf("%v does not exist, skipping\n", item)
 			continue
 		}
 
@@ -291,6 +339,23 @@ func (opts BackupOptions) Check(gopts GlobalOptions, args []string) error {
 		}
 	}
 
+	if opts.Partial {
+		if opts.Parent == "" {
+			return errors.Fatal("--partial requires a snapshot specified via --parent")
+		}
+		if opts.Stdin || opts.Force {
+			return errors.Fatal("--partial cannot be used together with --stdin or --force")
+		}
+	}
+
+	if opts.UseChangeJournal && (opts.Stdin || opts.Force || opts.Partial) {
+		return errors.Fatal("--use-change-journal cannot be used together with --stdin, --force or --partial")
+	}
+
+	if opts.CrossSnapshots && (!opts.ExcludeOtherFS || !opts.UseFsSnapshot) {
+		return errors.Fatal("--cross-snapshotted-datasets requires --one-file-system and --use-fs-snapshot")
+	}
+
 	return nil
 }
 
@@ -331,14 +396,15 @@ func collectRejectByNameFuncs(opts BackupOptions, repo *repository.Repository, t
 
 // collectRejectFuncs returns a list of all functions which may reject data
 // from being saved in a snapshot based on path and file info
-func collectRejectFuncs(opts BackupOptions, repo *repository.Repository, targets []string) (fs []RejectFunc, err error) {
-	// allowed devices
-	if opts.ExcludeOtherFS && !opts.Stdin {
-		f, err := rejectByDevice(targets)
+func collectRejectFuncs(opts BackupOptions, repo *repository.Repository, targets []string) (funcs []RejectFunc, err error) {
+	// allowed devices, with --use-fs-snapshot they are read from the
+	// snapshots instead
+	if opts.ExcludeOtherFS && !opts.Stdin && !opts.UseFsSnapshot {
+		f, err := rejectByDevice(fs.Local{}, targets, nil)
 		if err != nil {
 			return nil, err
 		}
-		fs = append(fs, f)
+		funcs = append(funcs, f)
 	}
 
 	if len(opts.ExcludeLargerThan) != 0 && !opts.Stdin {
@@ -346,10 +412,14 @@ func collectRejectFuncs(opts BackupOptions, repo *repository.Repository, targets
 		if err != nil {
 			return nil, err
 		}
-		fs = append(fs, f)
+		funcs = append(funcs, f)
 	}
 
-	return fs, nil
+	if opts.ExcludeTimeMachine && !opts.Stdin {
+		funcs = append(funcs, rejectTimeMachineExcluded)
+	}
+
+	return funcs, nil
 }
 
 // collectTargets returns a list of target files/dirs from several sources.
@@ -377,7 +447,7 @@ func collectTargets(opts BackupOptions, args []string) (targets []string, err er
 				return nil, fmt.Errorf("pattern: %s: %w", line, err)
 			}
 			if len(expanded) == 0 {
-				Warnf("pattern %q does not match any files, skipping\n", line)
+				Warningf("pattern %q does not match any files, skipping\n", line)
 			}
 			targets = append(targets, expanded...)
 		}
@@ -411,6 +481,11 @@ func collectTargets(opts BackupOptions, args []string) (targets []string, err er
 		return nil, errors.Fatal("nothing to backup, please specify target files/dirs")
 	}
 
+	// targets which were removed are deleted from the parent snapshot
+	if opts.Partial {
+		return targets, nil
+	}
+
 	targets, err = filterExisting(targets)
 	if err != nil {
 		return nil, err
@@ -421,7 +496,7 @@ func collectTargets(opts BackupOptions, args []string) (targets []string, err er
 
 // parent returns the ID of the parent snapshot. If there is none, nil is
 // returned.
-func findParentSnapshot(ctx context.Context, repo restic.Repository, opts BackupOptions, targets []string, timeStampLimit time.Time) (*restic.Snapshot, error) {
+func findParentSnapshot(ctx context.Context, repo restic.Repository, snapshotLister restic.Lister, opts BackupOptions, targets []string, timeStampLimit time.Time) (*restic.Snapshot, error) {
 	if opts.Force {
 		return nil, nil
 	}
@@ -430,7 +505,13 @@ func findParentSnapshot(ctx context.Context, repo restic.Repository, opts Backup
 	if snName == "" {
 		snName = "latest"
 	}
-	sn, err := restic.FindFilteredSnapshot(ctx, repo.Backend(), repo, []string{opts.Host}, []restic.TagList{}, targets, &timeStampLimit, snName)
+	if opts.Partial {
+		// the targets are only a part of the parent snapshot
+		targets = nil
+	}
+	// only consider snapshots created at or before the time of this backup
+	timeRange := restic.TimeRange{Before: timeStampLimit.Add(time.Nanosecond)}
+	sn, err := restic.FindFilteredSnapshot(ctx, snapshotLister, repo, []string{opts.Host}, []restic.TagList{}, targets, timeRange, snName)
 	// Snapshot not found is ok if no explicit parent was set
 	if opts.Parent == "" && errors.Is(err, restic.ErrNoSnapshotFound) {
 		err = nil
@@ -500,6 +581,11 @@ func runBackup(ctx context.Context, opts BackupOptions, gopts GlobalOptions, ter
 		return err
 	}
 
+	err = loadRepoExcludes(repo, &opts.excludePatternOptions, opts.UseRepoExcludes)
+	if err != nil {
+		return err
+	}
+
 	// rejectByNameFuncs collect functions that can reject items from the backup based on path only
 	rejectByNameFuncs, err := collectRejectByNameFuncs(opts, repo, targets)
 	if err != nil {
@@ -512,9 +598,16 @@ func runBackup(ctx context.Context, opts BackupOptions, gopts GlobalOptions, ter
 		return err
 	}
 
+	// the snapshots are listed only once, they are also counted for the
+	// statistics record saved after the backup
+	snapshotLister, err := backend.MemorizeList(ctx, repo.Backend(), restic.SnapshotFile)
+	if err != nil {
+		return err
+	}
+
 	var parentSnapshot *restic.Snapshot
 	if !opts.Stdin {
-		parentSnapshot, err = findParentSnapshot(ctx, repo, opts, targets, timeStamp)
+		parentSnapshot, err = findParentSnapshot(ctx, repo, snapshotLister, opts, targets, timeStamp)
 		if err != nil {
 			return err
 		}
@@ -528,9 +621,32 @@ func runBackup(ctx context.Context, opts BackupOptions, gopts GlobalOptions, ter
 		}
 	}
 
+	// the journal positions must be read before any file is read, so that
+	// changes during the backup are returned again for the next backup
+	var journalBackup *changeJournalBackup
+	if opts.UseChangeJournal {
+		cacheDir := ""
+		if repo.Cache != nil {
+			cacheDir = repo.Cache.Path()
+		}
+		verbose := func(msg string, args ...interface{}) {
+			if !gopts.JSON {
+				progressPrinter.V(msg, args...)
+			}
+		}
+		journalBackup, err = prepareChangeJournal(ctx, cacheDir, targets, parentSnapshot,
+			func(msg string) { progressReporter.Warning("", msg) }, verbose)
+		if err != nil {
+			return err
+		}
+	}
+
 	if !gopts.JSON {
 		progressPrinter.V("load index files")
 	}
+	if opts.LazyIndex {
+		repo.SetLazyIndex(ctx)
+	}
 	err = repo.LoadIndex(ctx)
 	if err != nil {
 		return err
@@ -555,11 +671,7 @@ func runBackup(ctx context.Context, opts BackupOptions, gopts GlobalOptions, ter
 	}
 
 	var targetFS fs.FS = fs.Local{}
-	if runtime.GOOS == "windows" && opts.UseFsSnapshot {
-		if err = fs.HasSufficientPrivilegesForVSS(); err != nil {
-			return err
-		}
-
+	if opts.UseFsSnapshot {
 		errorHandler := func(item string, err error) error {
 			return progressReporter.Error(item, err)
 		}
@@ -570,9 +682,36 @@ func runBackup(ctx context.Context, opts BackupOptions, gopts GlobalOptions, ter
 			}
 		}
 
-		localVss := fs.NewLocalVss(errorHandler, messageHandler)
-		defer localVss.DeleteSnapshots()
-		targetFS = localVss
+		providers, err := fs.SnapshotProviders(errorHandler, messageHandler)
+		if err != nil {
+			return err
+		}
+
+		// snapshots of all file systems are deleted in the reverse order of
+		// their creation
+		localSnapshots := fs.NewLocalSnapshots(errorHandler, progressReporter, providers...)
+		defer localSnapshots.DeleteSnapshots()
+		targetFS = localSnapshots
+
+		if opts.ExcludeOtherFS && !opts.Stdin {
+			// child datasets are separate file systems, by default they are
+			// neither snapshotted nor included
+			var crossVolume func(item string) bool
+			if opts.CrossSnapshots {
+				crossVolume = func(item string) bool {
+					volume, ok := localSnapshots.SnapshotVolume(item)
+					return ok && filepath.Clean(volume) == filepath.Clean(item)
+				}
+			} else {
+				localSnapshots.LimitVolumes(targets)
+			}
+
+			f, err := rejectByDevice(localSnapshots, targets, crossVolume)
+			if err != nil {
+				return err
+			}
+			rejectFuncs = append(rejectFuncs, f)
+		}
 	}
 	if opts.Stdin {
 		if !gopts.JSON {
@@ -588,6 +727,16 @@ func runBackup(ctx context.Context, opts BackupOptions, gopts GlobalOptions, ter
 		targets = []string{filename}
 	}
 
+	partial := opts.Partial
+	backupTargets := targets
+	if journalBackup != nil && journalBackup.complete {
+		partial = true
+		backupTargets = journalBackup.changed
+		if !gopts.JSON {
+			progressPrinter.V("change journal lists %d changed files and directories", len(backupTargets))
+		}
+	}
+
 	if !opts.NoScan {
 		sc := archiver.NewScanner(targetFS)
 		sc.SelectByName = selectByNameFilter
@@ -595,16 +744,32 @@ func runBackup(ctx context.Context, opts BackupOptions, gopts GlobalOptions, ter
 		sc.Error = progressPrinter.ScannerError
 		sc.Result = progressReporter.ReportTotal
 
+		scanTargets := backupTargets
+		if partial {
+			scanTargets = nil
+			for _, target := range backupTargets {
+				if _, err := fs.Lstat(target); err == nil {
+					scanTargets = append(scanTargets, target)
+				}
+			}
+		}
+
 		if !gopts.JSON {
-			progressPrinter.V("start scan on %v", targets)
+			progressPrinter.V("start scan on %v", scanTargets)
 		}
-		wg.Go(func() error { return sc.Scan(cancelCtx, targets) })
+		wg.Go(func() error { return sc.Scan(cancelCtx, scanTargets) })
 	}
 
-	arch := archiver.New(repo, targetFS, archiver.Options{ReadConcurrency: backupOptions.ReadConcurrency})
+	readConcurrency := limitReadConcurrency(backupOptions.ReadConcurrency, gopts.openFileLimit)
+	if readConcurrency != backupOptions.ReadConcurrency && !gopts.JSON {
+		Verbosef("reading only %d files concurrently due to the open file limit of %d\n", readConcurrency, gopts.openFileLimit)
+	}
+
+	arch := archiver.New(repo, targetFS, archiver.Options{ReadConcurrency: readConcurrency})
 	arch.SelectByName = selectByNameFilter
 	arch.Select = selectFilter
 	arch.WithAtime = opts.WithAtime
+	arch.AllowSpecial = opts.AllowSpecial
 	success := true
 	arch.Error = func(item string, err error) error {
 		success = false
@@ -623,6 +788,15 @@ func runBackup(ctx context.Context, opts BackupOptions, gopts GlobalOptions, ter
 		arch.ChangeIgnoreFlags |= archiver.ChangeIgnoreCtime
 	}
 
+	// inode numbers are required to identify moved files, --force must read
+	// all files again
+	if !opts.NoChunkCache && !opts.IgnoreInode && !opts.Force && repo.Cache != nil {
+		arch.ChunkCache, err = archiver.LoadChunkCache(filepath.Join(repo.Cache.Path(), "chunks"), repo.Key())
+		if err != nil {
+			return err
+		}
+	}
+
 	snapshotOpts := archiver.SnapshotOptions{
 		Excludes:       opts.Excludes,
 		Tags:           opts.Tags.Flatten(),
@@ -634,7 +808,12 @@ func runBackup(ctx context.Context, opts BackupOptions, gopts GlobalOptions, ter
 	if !gopts.JSON {
 		progressPrinter.V("start backup on %v", targets)
 	}
-	_, id, err := arch.Snapshot(ctx, targets, snapshotOpts)
+	var id restic.ID
+	if partial {
+		_, id, err = arch.SnapshotPartial(ctx, backupTargets, snapshotOpts)
+	} else {
+		_, id, err = arch.Snapshot(ctx, targets, snapshotOpts)
+	}
 
 	// cleanly shutdown all running goroutines
 	cancel()
@@ -647,7 +826,36 @@ func runBackup(ctx context.Context, opts BackupOptions, gopts GlobalOptions, ter
 		return errors.Fatalf("unable to save snapshot: %v", err)
 	}
 
-	// Report finished execution
+	if !opts.DryRun {
+		if err := arch.ChunkCache.Save(); err != nil {
+			progressReporter.Warning("", fmt.Sprintf("unable to save chunk cache: %v", err))
+		}
+		if err := journalBackup.record(id); err != nil {
+			progressReporter.Warning("", fmt.Sprintf("unable to save change journal state: %v", err))
+		}
+
+	}
+	if !opts.DryRun && opts.RecordStats {
+		var snapshots uint
+		err := snapshotLister.List(ctx, restic.SnapshotFile, func(restic.FileInfo) error {
+			snapshots++
+			return nil
+		})
+		if err == nil {
+			// the new snapshot has not been listed
+			err = saveStatsRecord(repo, snapshots+1, "backup", opts.Host, nil)
+		}
+		if err != nil {
+			progressReporter.Warning("", fmt.Sprintf("unable to save statistics record: %v", err))
+		}
+	}
+
+	// Report finished execution, the summary includes the warnings reported
+	// by other means, e.g. for missing targets
+	reported := progressReporter.Warnings()
+	progressReporter.AddWarnings(warnings())
+	countWarnings(reported)
+	warningSummaryShown = true
 	progressReporter.Finish(id, opts.DryRun)
 	if !gopts.JSON && !opts.DryRun {
 		progressPrinter.P("snapshot %s saved\n", id.Str())
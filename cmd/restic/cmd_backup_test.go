@@ -110,3 +110,21 @@ func TestReadFilenamesRaw(t *testing.T) {
 	rtest.Assert(t, strings.Contains(err.Error(), "zero byte"),
 		"wrong error message: %v", err.Error())
 }
+
+func TestLimitReadConcurrency(t *testing.T) {
+	for _, test := range []struct {
+		n     uint
+		limit uint64
+		want  uint
+	}{
+		{0, 0, 0},
+		{0, 16, 0},
+		{100, 0, 100},
+		{100, 1024, 100},
+		{100, 128, 64},
+		{8, 64, 1},
+		{8, 10, 1},
+	} {
+		rtest.Equals(t, test.want, limitReadConcurrency(test.n, test.limit))
+	}
+}
@@ -89,7 +89,7 @@ func runCache(opts CacheOptions, gopts GlobalOptions, args []string) error {
 			dir := filepath.Join(cachedir, item.Name())
 			err = fs.RemoveAll(dir)
 			if err != nil {
-				Warnf("unable to remove %v: %v\n", dir, err)
+				Warningf("unable to remove %v: %v\n", dir, err)
 			}
 		}
 
@@ -4,6 +4,7 @@ import (
 	"context"
 	"math/rand"
 	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"sync"
@@ -15,6 +16,7 @@ import (
 	"github.com/restic/restic/internal/checker"
 	"github.com/restic/restic/internal/errors"
 	"github.com/restic/restic/internal/fs"
+	"github.com/restic/restic/internal/repository"
 	"github.com/restic/restic/internal/restic"
 )
 
@@ -28,6 +30,21 @@ finds. It can also be used to read all data and therefore simulate a restore.
 By default, the "check" command will always load all data directly from the
 repository and not use a local cache.
 
+The "check" command only creates a non-exclusive lock, so it can run while
+backups are in progress. Pack files uploaded by a running backup are not yet
+contained in an index and are therefore reported as additional files.
+
+The "--structure-only-deep" option additionally downloads only the headers of
+all pack files and verifies them against the index. This detects an index that
+does not match the pack files much faster than "--read-data", but does not
+verify the data stored in the pack files.
+
+If a check with "--read-data" or "--read-data-subset" is interrupted, running
+it again with the same options continues with the pack files which were not
+read yet. The progress is stored in the local cache directory, even if the
+check itself runs with a temporary cache. Use "--no-resume" to read all pack
+files again.
+
 EXIT STATUS
 ===========
 
@@ -44,10 +61,12 @@ Exit status is 0 if the command was successful, and non-zero if there was any er
 
 // CheckOptions bundles all options for the 'check' command.
 type CheckOptions struct {
-	ReadData       bool
-	ReadDataSubset string
-	CheckUnused    bool
-	WithCache      bool
+	ReadData          bool
+	ReadDataSubset    string
+	StructureOnlyDeep bool
+	CheckUnused       bool
+	WithCache         bool
+	NoResume          bool
 }
 
 var checkOptions CheckOptions
@@ -58,6 +77,7 @@ func init() {
 	f := cmdCheck.Flags()
 	f.BoolVar(&checkOptions.ReadData, "read-data", false, "read all data blobs")
 	f.StringVar(&checkOptions.ReadDataSubset, "read-data-subset", "", "read a `subset` of data packs, specified as 'n/t' for specific part, or either 'x%' or 'x.y%' or a size in bytes with suffixes k/K, m/M, g/G, t/T for a random subset")
+	f.BoolVar(&checkOptions.StructureOnlyDeep, "structure-only-deep", false, "read all pack headers and verify them against the index, without reading the data")
 	var ignored bool
 	f.BoolVar(&ignored, "check-unused", false, "find unused blobs")
 	err := f.MarkDeprecated("check-unused", "`--check-unused` is deprecated and will be ignored")
@@ -66,12 +86,19 @@ func init() {
 		panic(err)
 	}
 	f.BoolVar(&checkOptions.WithCache, "with-cache", false, "use the cache")
+	f.BoolVar(&checkOptions.NoResume, "no-resume", false, "read all data again instead of resuming an interrupted check")
 }
 
 func checkFlags(opts CheckOptions) error {
 	if opts.ReadData && opts.ReadDataSubset != "" {
 		return errors.Fatal("check flags --read-data and --read-data-subset cannot be used together")
 	}
+	if opts.NoResume && !opts.ReadData && opts.ReadDataSubset == "" {
+		return errors.Fatal("--no-resume requires --read-data or --read-data-subset")
+	}
+	if opts.StructureOnlyDeep && (opts.ReadData || opts.ReadDataSubset != "") {
+		return errors.Fatal("check flag --structure-only-deep cannot be used together with --read-data or --read-data-subset")
+	}
 	if opts.ReadDataSubset != "" {
 		dataSubset, err := stringToIntSlice(opts.ReadDataSubset)
 		argumentError := errors.Fatal("check flag --read-data-subset has invalid value, please see documentation")
@@ -174,7 +201,7 @@ func prepareCheckCache(opts CheckOptions, gopts *GlobalOptions) (cleanup func())
 	tempdir, err := os.MkdirTemp(cachedir, "restic-check-cache-")
 	if err != nil {
 		// if an error occurs, don't use any cache
-		Warnf("unable to create temporary directory for cache during check, disabling cache: %v\n", err)
+		Warningf("unable to create temporary directory for cache during check, disabling cache: %v\n", err)
 		gopts.NoCache = true
 		return cleanup
 	}
@@ -185,7 +212,7 @@ func prepareCheckCache(opts CheckOptions, gopts *GlobalOptions) (cleanup func())
 	cleanup = func() {
 		err := fs.RemoveAll(tempdir)
 		if err != nil {
-			Warnf("error removing temporary cache directory: %v\n", err)
+			Warningf("error removing temporary cache directory: %v\n", err)
 		}
 	}
 
@@ -197,6 +224,9 @@ func runCheck(ctx context.Context, opts CheckOptions, gopts GlobalOptions, args
 		return errors.Fatal("the check command expects no arguments, only options - please see `restic help check` for usage and flags")
 	}
 
+	// the progress of reading the data is kept in the regular cache directory
+	journalBaseDir := checkJournalBaseDir(gopts)
+
 	cleanup := prepareCheckCache(opts, &gopts)
 	AddCleanupHandler(func(code int) (int, error) {
 		cleanup()
@@ -208,10 +238,10 @@ func runCheck(ctx context.Context, opts CheckOptions, gopts GlobalOptions, args
 		return err
 	}
 
+	var lock *restic.Lock
 	if !gopts.NoLock {
-		Verbosef("create exclusive lock for repository\n")
-		var lock *restic.Lock
-		lock, ctx, err = lockRepoExclusive(ctx, repo)
+		Verbosef("create lock for repository\n")
+		lock, ctx, err = lockRepo(ctx, repo)
 		defer unlockRepo(lock)
 		if err != nil {
 			return err
@@ -277,7 +307,21 @@ func runCheck(ctx context.Context, opts CheckOptions, gopts GlobalOptions, args
 	}
 
 	if orphanedPacks > 0 {
-		Verbosef("%d additional files were found in the repo, which likely contain duplicate data.\nThis is non-critical, you can run `restic prune` to correct this.\n", orphanedPacks)
+		var otherLocks uint
+		if lock != nil {
+			otherLocks, err = lock.OtherLocks(ctx)
+			if err != nil {
+				Warningf("unable to list locks: %v\n", err)
+			}
+		}
+
+		if otherLocks > 0 {
+			// backups running concurrently upload pack files before adding
+			// them to an index
+			Verbosef("%d additional files were found in the repo, they may belong to one of the %d operations currently running on the repository.\nThis is non-critical.\n", orphanedPacks, otherLocks)
+		} else {
+			Verbosef("%d additional files were found in the repo, which likely contain duplicate data.\nThis is non-critical, you can run `restic prune` to correct this.\n", orphanedPacks)
+		}
 	}
 
 	Verbosef("check snapshots, trees and blobs\n")
@@ -320,7 +364,34 @@ func runCheck(ctx context.Context, opts CheckOptions, gopts GlobalOptions, args
 		}
 	}
 
+	var journal *repository.OperationJournal
+	if opts.ReadData || opts.ReadDataSubset != "" {
+		journal, err = openCheckJournal(opts, repo, journalBaseDir)
+		if err != nil {
+			return err
+		}
+		chkr.OnPackChecked(func(id restic.ID) {
+			if err := journal.MarkDone("read", id); err != nil {
+				Warningf("unable to save the check progress: %v\n", err)
+			}
+		})
+		AddCleanupHandler(func(code int) (int, error) {
+			return code, journal.Save()
+		})
+	}
+
 	doReadData := func(packs map[restic.ID]int64) {
+		if journal.Resumed() {
+			remaining := make(map[restic.ID]int64, len(packs))
+			for id, size := range packs {
+				if !journal.IsDone("read", id) {
+					remaining[id] = size
+				}
+			}
+			Verbosef("resuming the check started at %v, %d of %d packs were already read\n",
+				journal.Started().Format(TimeFormat), len(packs)-len(remaining), len(packs))
+			packs = remaining
+		}
 		packCount := uint64(len(packs))
 
 		p := newProgressMax(!gopts.Quiet, packCount, "packs")
@@ -333,9 +404,33 @@ func runCheck(ctx context.Context, opts CheckOptions, gopts GlobalOptions, args
 			Warnf("%v\n", err)
 		}
 		p.Done()
+
+		if ctx.Err() != nil {
+			// keep the progress to resume the interrupted check
+			if err := journal.Save(); err != nil {
+				Warningf("unable to save the check progress: %v\n", err)
+			}
+			return
+		}
+		if err := journal.Finish(); err != nil {
+			Warningf("unable to remove the check progress: %v\n", err)
+		}
 	}
 
 	switch {
+	case opts.StructureOnlyDeep:
+		Verbosef("read all pack headers\n")
+		packs := chkr.GetPacks()
+		p := newProgressMax(!gopts.Quiet, uint64(len(packs)), "pack headers")
+		errChan := make(chan error)
+
+		go chkr.ReadPackHeaders(ctx, packs, p, errChan)
+
+		for err := range errChan {
+			errorsFound = true
+			Warnf("%v\n", err)
+		}
+		p.Done()
 	case opts.ReadData:
 		Verbosef("read all data\n")
 		doReadData(selectPacksByBucket(chkr.GetPacks(), 1, 1))
@@ -351,7 +446,12 @@ func runCheck(ctx context.Context, opts CheckOptions, gopts GlobalOptions, args
 		} else if strings.HasSuffix(opts.ReadDataSubset, "%") {
 			percentage, err := parsePercentage(opts.ReadDataSubset)
 			if err == nil {
-				packs = selectRandomPacksByPercentage(chkr.GetPacks(), percentage)
+				packs, err = selectJournalPacks(journal, chkr.GetPacks(), func(allPacks map[restic.ID]int64) map[restic.ID]int64 {
+					return selectRandomPacksByPercentage(allPacks, percentage)
+				})
+				if err != nil {
+					return err
+				}
 				Verbosef("read %.1f%% of data packs\n", percentage)
 			}
 		} else {
@@ -367,7 +467,12 @@ func runCheck(ctx context.Context, opts CheckOptions, gopts GlobalOptions, args
 			if subsetSize > repoSize {
 				subsetSize = repoSize
 			}
-			packs = selectRandomPacksByFileSize(chkr.GetPacks(), subsetSize, repoSize)
+			packs, err = selectJournalPacks(journal, allPacks, func(allPacks map[restic.ID]int64) map[restic.ID]int64 {
+				return selectRandomPacksByFileSize(allPacks, subsetSize, repoSize)
+			})
+			if err != nil {
+				return err
+			}
 			Verbosef("read %d bytes of data packs\n", subsetSize)
 		}
 		if packs == nil {
@@ -376,6 +481,10 @@ func runCheck(ctx context.Context, opts CheckOptions, gopts GlobalOptions, args
 		doReadData(packs)
 	}
 
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
 	if errorsFound {
 		return errors.Fatal("repository contains errors")
 	}
@@ -385,6 +494,83 @@ func runCheck(ctx context.Context, opts CheckOptions, gopts GlobalOptions, args
 	return nil
 }
 
+// checkJournalParams are the options which determine the packs read by check.
+type checkJournalParams struct {
+	ReadData       bool   `json:"read_data"`
+	ReadDataSubset string `json:"read_data_subset"`
+}
+
+// checkJournalBaseDir returns the cache directory which contains the progress
+// of reading the data. It must be called before prepareCheckCache replaces
+// the cache directory with a temporary one.
+func checkJournalBaseDir(gopts GlobalOptions) string {
+	if gopts.NoCache {
+		return ""
+	}
+	if gopts.CacheDir != "" {
+		return gopts.CacheDir
+	}
+	dir, err := cache.DefaultDir()
+	if err != nil {
+		Warningf("unable to locate the cache directory, an interrupted check cannot be resumed: %v\n", err)
+		return ""
+	}
+	return dir
+}
+
+// openCheckJournal opens the journal which records the packs already read,
+// with opts.NoResume a previous journal is discarded.
+func openCheckJournal(opts CheckOptions, repo *repository.Repository, baseDir string) (*repository.OperationJournal, error) {
+	var dir string
+	if baseDir != "" {
+		dir = filepath.Join(baseDir, repo.Config().ID)
+	}
+	params := checkJournalParams{ReadData: opts.ReadData, ReadDataSubset: opts.ReadDataSubset}
+
+	journal, err := repository.OpenOperationJournalDir(dir, "check-read-data", params)
+	if err != nil {
+		return nil, err
+	}
+	if opts.NoResume && journal.Resumed() {
+		if err := journal.Finish(); err != nil {
+			return nil, err
+		}
+		return repository.OpenOperationJournalDir(dir, "check-read-data", params)
+	}
+	return journal, nil
+}
+
+// selectJournalPacks returns the packs selected randomly by an interrupted
+// check, so that it is resumed with the same packs. Otherwise the packs are
+// selected via selectPacks and stored in the journal. Packs which were
+// removed from the repository in the meantime are skipped.
+func selectJournalPacks(journal *repository.OperationJournal, allPacks map[restic.ID]int64, selectPacks func(map[restic.ID]int64) map[restic.ID]int64) (map[restic.ID]int64, error) {
+	var ids restic.IDs
+	ok, err := journal.Get("packs", &ids)
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		packs := make(map[restic.ID]int64, len(ids))
+		for _, id := range ids {
+			if size, ok := allPacks[id]; ok {
+				packs[id] = size
+			}
+		}
+		return packs, nil
+	}
+
+	packs := selectPacks(allPacks)
+	ids = make(restic.IDs, 0, len(packs))
+	for id := range packs {
+		ids = append(ids, id)
+	}
+	if err := journal.Set("packs", ids); err != nil {
+		return nil, err
+	}
+	return packs, nil
+}
+
 // selectPacksByBucket selects subsets of packs by ranges of buckets.
 func selectPacksByBucket(allPacks map[restic.ID]int64, bucket, totalBuckets uint) map[restic.ID]int64 {
 	packs := make(map[restic.ID]int64)
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+
+	"github.com/spf13/cobra"
+
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/restic"
+)
+
+var cmdConfig = &cobra.Command{
+	Use:   "config [get|set] key [value]",
+	Short: "Show or modify repository settings",
+	Long: `
+The "config" command shows or modifies settings stored in the repository
+config. The following settings are available:
+
+  min_snapshot_age  forget refuses to remove snapshots younger than this
+                    duration, e.g. "7d" or "1m2d" (default: empty, disabled)
+
+Setting a value to the empty string resets it to the default.
+
+Some backends, e.g. the REST server, cannot replace the config file
+atomically. For these, a copy of the previous config file is stored in a
+temporary directory while the config is replaced. The copy is removed once the
+new config was saved, an error message reports its location otherwise.
+
+The subcommand "config pack" writes the repository location, password and
+options to an encrypted bundle for unattended hosts, see "restic config pack
+--help".
+
+EXIT STATUS
+===========
+
+Exit status is 0 if the command was successful, and non-zero if there was any error.
+`,
+	DisableAutoGenTag: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runConfig(cmd.Context(), globalOptions, args)
+	},
+}
+
+func init() {
+	cmdRoot.AddCommand(cmdConfig)
+}
+
+// configSetting describes a setting which can be shown or modified using the
+// config command.
+type configSetting struct {
+	get func(cfg restic.Config) string
+	set func(cfg *restic.Config, value string) error
+}
+
+var configSettings = map[string]configSetting{
+	"min_snapshot_age": {
+		get: func(cfg restic.Config) string {
+			return cfg.MinSnapshotAge
+		},
+		set: func(cfg *restic.Config, value string) error {
+			if value != "" {
+				d, err := restic.ParseDuration(value)
+				if err != nil {
+					return err
+				}
+				// normalize the value
+				value = d.String()
+			}
+			cfg.MinSnapshotAge = value
+			return nil
+		},
+	},
+}
+
+func runConfig(ctx context.Context, gopts GlobalOptions, args []string) error {
+	if len(args) < 2 || (args[0] == "get" && len(args) != 2) || (args[0] == "set" && len(args) != 3) {
+		return errors.Fatal("wrong number of arguments")
+	}
+
+	setting, ok := configSettings[args[1]]
+	if !ok {
+		return errors.Fatalf("unknown setting %q", args[1])
+	}
+
+	repo, err := OpenRepository(ctx, gopts)
+	if err != nil {
+		return err
+	}
+
+	switch args[0] {
+	case "get":
+		Printf("%s\n", setting.get(repo.Config()))
+		return nil
+	case "set":
+		lock, ctx, err := lockRepoExclusive(ctx, repo)
+		defer unlockRepo(lock)
+		if err != nil {
+			return err
+		}
+
+		cfg := repo.Config()
+		if err := setting.set(&cfg, args[2]); err != nil {
+			return errors.Fatalf("invalid value for %v: %v", args[1], err)
+		}
+
+		err = repo.UpdateConfig(ctx, cfg)
+		if err != nil {
+			return err
+		}
+		Verbosef("set %v to %q\n", args[1], setting.get(cfg))
+		return nil
+	default:
+		return errors.Fatalf("invalid subcommand %q", args[0])
+	}
+}
@@ -0,0 +1,355 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/restic/restic/internal/crypto"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/keystore"
+)
+
+var cmdConfigPack = &cobra.Command{
+	Use:   "pack [flags] file",
+	Short: "Write the repository configuration to an encrypted bundle",
+	Long: `
+The "config pack" command writes the repository location, the source of the
+password and the extended options to a single encrypted file. The file can be
+copied to hosts which run restic unattended, which then only need
+"--config-bundle file" instead of separate files or environment variables for
+each setting.
+
+The bundle is encrypted with a random key, which is sealed using a keystore of
+the local machine. The bundle can therefore only be used on the machine it was
+created on. The following keystores are available:
+
+  machine  a key of the machine which does not require a user session, so
+           that services and scheduled jobs can use the bundle: the host
+           credential secret of systemd-creds, combined with the TPM if
+           available (Linux, requires root), or the data protection API with
+           the machine scope (Windows). This is the default where available.
+  keyring  the keyring of the user: the secret service (via secret-tool) on
+           Linux and BSD, which requires a desktop session, the keychain on
+           macOS and the data protection API on Windows. This is the default
+           on macOS and BSD.
+  tpm2     the TPM of the machine, via systemd-creds (Linux only)
+
+"config pack --remove file" removes the bundle and the key stored in the
+keyring, if any.
+
+By default only a reference to the password (--password-file or
+--password-command) is stored. With "--include-password", the password itself
+is stored in the bundle. Environment variables, e.g. the credentials for the
+backend, can be added with "--env".
+
+Settings passed on the command line or via environment variables take
+precedence over the values from the bundle.
+
+EXIT STATUS
+===========
+
+Exit status is 0 if the command was successful, and non-zero if there was any error.
+`,
+	DisableAutoGenTag: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runConfigPack(cmd.Context(), configPackOptions, globalOptions, args)
+	},
+}
+
+// ConfigPackOptions collects all options for the config pack command.
+type ConfigPackOptions struct {
+	Keystore        string
+	IncludePassword bool
+	Env             []string
+	Remove          bool
+}
+
+var configPackOptions ConfigPackOptions
+
+func init() {
+	cmdConfig.AddCommand(cmdConfigPack)
+
+	f := cmdConfigPack.Flags()
+	f.StringVar(&configPackOptions.Keystore, "keystore", keystore.Default(), "`name` of the keystore used to seal the bundle: machine, keyring or tpm2")
+	f.BoolVar(&configPackOptions.IncludePassword, "include-password", false, "store the repository password in the bundle")
+	f.StringArrayVar(&configPackOptions.Env, "env", nil, "add the environment variable `name` to the bundle (can be specified multiple times)")
+	f.BoolVar(&configPackOptions.Remove, "remove", false, "remove the bundle and its key stored in the keyring instead")
+}
+
+// configBundleVersion is the version of the bundle file format.
+const configBundleVersion = 1
+
+// configBundleFile is the content of a file written by "config pack".
+type configBundleFile struct {
+	Version  int    `json:"version"`
+	Keystore string `json:"keystore"`
+	// SealedKey is the JSON encoded crypto.Key used to encrypt Data, sealed
+	// with the keystore.
+	SealedKey []byte `json:"sealed_key"`
+	// Data is the encrypted configBundle, prefixed with the nonce.
+	Data []byte `json:"data"`
+}
+
+// configBundle holds the settings stored in a bundle.
+type configBundle struct {
+	Repo            string            `json:"repository"`
+	PasswordFile    string            `json:"password_file,omitempty"`
+	PasswordCommand string            `json:"password_command,omitempty"`
+	Password        string            `json:"password,omitempty"`
+	KeyHint         string            `json:"key_hint,omitempty"`
+	Options         []string          `json:"options,omitempty"`
+	Env             map[string]string `json:"env,omitempty"`
+}
+
+func runConfigPack(ctx context.Context, opts ConfigPackOptions, gopts GlobalOptions, args []string) error {
+	if len(args) != 1 {
+		return errors.Fatal("please specify the file to write the bundle to")
+	}
+	if opts.Remove {
+		return removeConfigBundle(ctx, args[0])
+	}
+
+	sealer, err := keystore.Lookup(opts.Keystore)
+	if err != nil {
+		return err
+	}
+
+	repo, err := ReadRepo(gopts)
+	if err != nil {
+		return err
+	}
+
+	bundle := configBundle{
+		Repo:            repo,
+		PasswordFile:    gopts.PasswordFile,
+		PasswordCommand: gopts.PasswordCommand,
+		KeyHint:         gopts.KeyHint,
+		Options:         gopts.Options,
+	}
+
+	if opts.IncludePassword {
+		bundle.Password, err = ReadPassword(gopts, "enter password for repository: ")
+		if err != nil {
+			return err
+		}
+		// make sure only the password from the bundle is used
+		bundle.PasswordFile = ""
+		bundle.PasswordCommand = ""
+		gopts.password = bundle.Password
+	} else if bundle.PasswordFile == "" && bundle.PasswordCommand == "" {
+		return errors.Fatal("the bundle would not contain a password, specify --password-file, --password-command or --include-password")
+	}
+
+	for _, name := range opts.Env {
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			return errors.Fatalf("environment variable %v is not set", name)
+		}
+		if bundle.Env == nil {
+			bundle.Env = make(map[string]string)
+		}
+		bundle.Env[name] = value
+	}
+
+	// make sure the bundle can be used to open the repository
+	if _, err := OpenRepository(ctx, gopts); err != nil {
+		return err
+	}
+
+	file, err := sealConfigBundle(ctx, sealer, opts.Keystore, &bundle)
+	if err != nil {
+		return err
+	}
+
+	buf, err := json.Marshal(file)
+	if err == nil {
+		err = writeNewFile(args[0], buf)
+	}
+	if err != nil {
+		// do not leave the unused key behind in the keyring
+		removeSealed(ctx, sealer, file.SealedKey)
+		return err
+	}
+
+	Printf("wrote configuration bundle for %v to %v, sealed with %v\n", repo, args[0], opts.Keystore)
+	return nil
+}
+
+// sealConfigBundle encrypts bundle with a new random key and seals the key
+// with sealer.
+func sealConfigBundle(ctx context.Context, sealer keystore.Sealer, name string, bundle *configBundle) (*configBundleFile, error) {
+	plaintext, err := json.Marshal(bundle)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	key := crypto.NewRandomKey()
+	rawKey, err := json.Marshal(key)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	sealedKey, err := sealer.Seal(ctx, rawKey)
+	if err != nil {
+		return nil, errors.Fatalf("unable to seal the bundle key: %v", err)
+	}
+
+	nonce := crypto.NewRandomNonce()
+	data := make([]byte, 0, crypto.CiphertextLength(len(plaintext)))
+	data = append(data, nonce...)
+	data = key.Seal(data, nonce, plaintext, nil)
+
+	return &configBundleFile{
+		Version:   configBundleVersion,
+		Keystore:  name,
+		SealedKey: sealedKey,
+		Data:      data,
+	}, nil
+}
+
+// removeSealed removes the sealed secret from the keystore if it is stored
+// there, errors are only logged.
+func removeSealed(ctx context.Context, sealer keystore.Sealer, sealed []byte) {
+	remover, ok := sealer.(keystore.Remover)
+	if !ok {
+		return
+	}
+	if err := remover.Remove(ctx, sealed); err != nil {
+		Warnf("unable to remove the bundle key from the keystore: %v\n", err)
+	}
+}
+
+// removeConfigBundle removes the bundle stored in filename and the key it
+// references in the keystore.
+func removeConfigBundle(ctx context.Context, filename string) error {
+	file, err := readConfigBundleFile(filename)
+	if err != nil {
+		return err
+	}
+
+	sealer, err := keystore.Lookup(file.Keystore)
+	if err != nil {
+		return err
+	}
+	if remover, ok := sealer.(keystore.Remover); ok {
+		if err := remover.Remove(ctx, file.SealedKey); err != nil {
+			return errors.Fatalf("unable to remove the bundle key from the keystore: %v", err)
+		}
+	}
+
+	if err := os.Remove(filename); err != nil {
+		return errors.Fatalf("unable to remove configuration bundle: %v", err)
+	}
+	Verbosef("removed configuration bundle %v\n", filename)
+	return nil
+}
+
+// readConfigBundleFile reads the bundle stored in filename without
+// decrypting it.
+func readConfigBundleFile(filename string) (*configBundleFile, error) {
+	buf, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, errors.Fatalf("unable to read configuration bundle: %v", err)
+	}
+
+	var file configBundleFile
+	if err := json.Unmarshal(buf, &file); err != nil {
+		return nil, errors.Fatalf("invalid configuration bundle %v: %v", filename, err)
+	}
+	if file.Version != configBundleVersion {
+		return nil, errors.Fatalf("configuration bundle %v has unsupported version %d", filename, file.Version)
+	}
+	return &file, nil
+}
+
+// loadConfigBundle reads and decrypts the bundle stored in filename.
+func loadConfigBundle(ctx context.Context, filename string) (*configBundle, error) {
+	file, err := readConfigBundleFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	sealer, err := keystore.Lookup(file.Keystore)
+	if err != nil {
+		return nil, err
+	}
+
+	rawKey, err := sealer.Unseal(ctx, file.SealedKey)
+	if err != nil {
+		return nil, errors.Fatalf("unable to unseal configuration bundle %v: %v", filename, err)
+	}
+
+	key := &crypto.Key{}
+	if err := json.Unmarshal(rawKey, key); err != nil || !key.Valid() {
+		return nil, errors.Fatalf("configuration bundle %v contains an invalid key", filename)
+	}
+
+	if len(file.Data) < key.NonceSize() {
+		return nil, errors.Fatalf("configuration bundle %v is truncated", filename)
+	}
+	nonce, ciphertext := file.Data[:key.NonceSize()], file.Data[key.NonceSize():]
+	plaintext, err := key.Open(ciphertext[:0], nonce, ciphertext, nil)
+	if err != nil {
+		return nil, errors.Fatalf("unable to decrypt configuration bundle %v: %v", filename, err)
+	}
+
+	bundle := &configBundle{}
+	if err := json.Unmarshal(plaintext, bundle); err != nil {
+		return nil, errors.Fatalf("invalid configuration bundle %v: %v", filename, err)
+	}
+	return bundle, nil
+}
+
+// applyConfigBundle loads the bundle configured in gopts and fills in all
+// settings which are not already set. The password stored in the bundle is
+// returned, it must only be used if no other password has been specified.
+func applyConfigBundle(ctx context.Context, gopts *GlobalOptions) (string, error) {
+	bundle, err := loadConfigBundle(ctx, gopts.ConfigBundle)
+	if err != nil {
+		return "", err
+	}
+
+	for name, value := range bundle.Env {
+		if _, ok := os.LookupEnv(name); ok {
+			continue
+		}
+		if err := os.Setenv(name, value); err != nil {
+			return "", errors.Wrap(err, "Setenv")
+		}
+		applyEnvOption(gopts, name, value, true)
+	}
+
+	if gopts.Repo == "" && gopts.RepositoryFile == "" {
+		gopts.Repo = bundle.Repo
+	}
+	if gopts.KeyHint == "" {
+		gopts.KeyHint = bundle.KeyHint
+	}
+
+	password := bundle.Password
+	if gopts.PasswordFile != "" || gopts.PasswordCommand != "" || os.Getenv("RESTIC_PASSWORD") != "" {
+		password = ""
+	} else {
+		gopts.PasswordFile = bundle.PasswordFile
+		gopts.PasswordCommand = bundle.PasswordCommand
+	}
+
+	// options given on the command line replace those from the bundle
+	set := make(map[string]struct{}, len(gopts.Options))
+	for _, opt := range gopts.Options {
+		key, _, _ := strings.Cut(opt, "=")
+		set[key] = struct{}{}
+	}
+	for _, opt := range bundle.Options {
+		key, _, _ := strings.Cut(opt, "=")
+		if _, ok := set[key]; !ok {
+			gopts.Options = append(gopts.Options, opt)
+		}
+	}
+
+	return password, nil
+}
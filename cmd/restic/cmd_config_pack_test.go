@@ -0,0 +1,176 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/keystore"
+	"github.com/restic/restic/internal/repository"
+	"github.com/restic/restic/internal/restic"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+// testSealer "seals" secrets by inverting all bits.
+type testSealer struct{}
+
+func (testSealer) Seal(_ context.Context, secret []byte) ([]byte, error) {
+	sealed := make([]byte, len(secret))
+	for i, b := range secret {
+		sealed[i] = ^b
+	}
+	return sealed, nil
+}
+
+func (s testSealer) Unseal(ctx context.Context, sealed []byte) ([]byte, error) {
+	return s.Seal(ctx, sealed)
+}
+
+// testKeyring stores the secrets in memory, the sealed secret is the name of
+// the entry.
+type testKeyring struct {
+	secrets map[string][]byte
+}
+
+func (k *testKeyring) Seal(_ context.Context, secret []byte) ([]byte, error) {
+	name := restic.NewRandomID().String()
+	k.secrets[name] = secret
+	return []byte(name), nil
+}
+
+func (k *testKeyring) Unseal(_ context.Context, sealed []byte) ([]byte, error) {
+	secret, ok := k.secrets[string(sealed)]
+	if !ok {
+		return nil, errors.New("not found")
+	}
+	return secret, nil
+}
+
+func (k *testKeyring) Remove(_ context.Context, sealed []byte) error {
+	delete(k.secrets, string(sealed))
+	return nil
+}
+
+var testKeyringSealer = &testKeyring{secrets: make(map[string][]byte)}
+
+func init() {
+	keystore.Register("test", testSealer{})
+	keystore.Register("test-keyring", testKeyringSealer)
+}
+
+func TestConfigPack(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testRunInit(t, env.gopts)
+
+	t.Setenv("RESTIC_TEST_BUNDLE_VAR", "foo")
+	t.Setenv("RESTIC_PACK_SIZE", "8")
+	bundle := filepath.Join(env.base, "bundle")
+	opts := ConfigPackOptions{
+		Keystore:        "test",
+		IncludePassword: true,
+		Env:             []string{"RESTIC_TEST_BUNDLE_VAR", "RESTIC_PACK_SIZE"},
+	}
+	gopts := env.gopts
+	gopts.Options = []string{"local.connections=3", "local.layout=default"}
+	rtest.OK(t, runConfigPack(context.TODO(), opts, gopts, []string{bundle}))
+
+	// an existing bundle is not overwritten
+	rtest.Assert(t, runConfigPack(context.TODO(), opts, gopts, []string{bundle}) != nil,
+		"expected error for existing bundle")
+
+	fi, err := os.Stat(bundle)
+	rtest.OK(t, err)
+	if os.PathSeparator == '/' {
+		rtest.Equals(t, os.FileMode(0600), fi.Mode().Perm())
+	}
+
+	rtest.OK(t, os.Unsetenv("RESTIC_TEST_BUNDLE_VAR"))
+	rtest.OK(t, os.Unsetenv("RESTIC_PACK_SIZE"))
+
+	gopts = env.gopts
+	gopts.Repo = ""
+	gopts.password = ""
+	gopts.ConfigBundle = bundle
+	gopts.Options = []string{"local.connections=5"}
+	password, err := applyConfigBundle(context.TODO(), &gopts)
+	rtest.OK(t, err)
+
+	rtest.Equals(t, env.repo, gopts.Repo)
+	rtest.Equals(t, env.gopts.password, password)
+	rtest.Equals(t, "foo", os.Getenv("RESTIC_TEST_BUNDLE_VAR"))
+	rtest.Equals(t, []string{"local.connections=5", "local.layout=default"}, gopts.Options)
+	// environment variables from the bundle also apply to the global options
+	rtest.Equals(t, uint(8), gopts.PackSize)
+
+	gopts.password = password
+	testRunCheck(t, gopts)
+
+	// but do not replace options set on the command line
+	rtest.OK(t, os.Unsetenv("RESTIC_PACK_SIZE"))
+	gopts = env.gopts
+	gopts.ConfigBundle = bundle
+	gopts.PackSize = 16
+	_, err = applyConfigBundle(context.TODO(), &gopts)
+	rtest.OK(t, err)
+	rtest.Equals(t, uint(16), gopts.PackSize)
+	rtest.OK(t, os.Unsetenv("RESTIC_PACK_SIZE"))
+}
+
+func TestConfigPackRemove(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testRunInit(t, env.gopts)
+
+	bundle := filepath.Join(env.base, "bundle")
+	opts := ConfigPackOptions{Keystore: "test-keyring", IncludePassword: true}
+	rtest.OK(t, runConfigPack(context.TODO(), opts, env.gopts, []string{bundle}))
+	rtest.Equals(t, 1, len(testKeyringSealer.secrets))
+
+	// the key is removed if the bundle cannot be written
+	rtest.Assert(t, runConfigPack(context.TODO(), opts, env.gopts, []string{bundle}) != nil,
+		"expected error for existing bundle")
+	rtest.Equals(t, 1, len(testKeyringSealer.secrets))
+
+	opts.Remove = true
+	rtest.OK(t, runConfigPack(context.TODO(), opts, env.gopts, []string{bundle}))
+	rtest.Equals(t, 0, len(testKeyringSealer.secrets))
+	_, err := os.Stat(bundle)
+	rtest.Assert(t, errors.Is(err, os.ErrNotExist), "bundle was not removed: %v", err)
+}
+
+func TestConfigBundleEnvOptions(t *testing.T) {
+	// options of single commands are also set from the bundle
+	defer func(old uint) { backupOptions.ReadConcurrency = old }(backupOptions.ReadConcurrency)
+	backupOptions.ReadConcurrency = 0
+
+	var gopts GlobalOptions
+	applyEnvOption(&gopts, "RESTIC_READ_CONCURRENCY", "7", true)
+	applyEnvOption(&gopts, "RESTIC_COMPRESSION", "max", true)
+	applyEnvOption(&gopts, "RESTIC_TELEMETRY", "true", true)
+	rtest.Equals(t, uint(7), backupOptions.ReadConcurrency)
+	rtest.Equals(t, repository.CompressionMax, gopts.Compression)
+	rtest.Equals(t, true, gopts.Telemetry)
+
+	gopts.KeyHint = "cli"
+	applyEnvOption(&gopts, "RESTIC_KEY_HINT", "bundle", true)
+	rtest.Equals(t, "cli", gopts.KeyHint)
+}
+
+func TestConfigPackNoPassword(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testRunInit(t, env.gopts)
+
+	bundle := filepath.Join(env.base, "bundle")
+	err := runConfigPack(context.TODO(), ConfigPackOptions{Keystore: "test"}, env.gopts, []string{bundle})
+	rtest.Assert(t, err != nil, "expected error for bundle without password")
+
+	err = runConfigPack(context.TODO(), ConfigPackOptions{Keystore: "invalid"}, env.gopts, []string{bundle})
+	rtest.Assert(t, err != nil, "expected error for unknown keystore")
+}
@@ -6,6 +6,7 @@ import (
 
 	"github.com/restic/restic/internal/backend"
 	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/index"
 	"github.com/restic/restic/internal/repository"
 	"github.com/restic/restic/internal/restic"
 	"golang.org/x/sync/errgroup"
@@ -30,6 +31,11 @@ This means that copied files, which existed in both the source and destination
 repository, /may occupy up to twice their space/ in the destination repository.
 This can be mitigated by the "--copy-chunker-params" option when initializing a
 new destination repository using the "init" command.
+
+If the copy is interrupted, running it again with the same options skips the
+snapshots which were already copied. The trees of these snapshots are also
+not traversed again, unless the destination repository was pruned in the
+meantime.
 `,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		return runCopy(cmd.Context(), copyOptions, globalOptions, args)
@@ -53,6 +59,10 @@ func init() {
 }
 
 func runCopy(ctx context.Context, opts CopyOptions, gopts GlobalOptions, args []string) error {
+	if err := opts.validate(args); err != nil {
+		return err
+	}
+
 	secondaryGopts, isFromRepo, err := fillSecondaryGlobalOpts(opts.secondaryRepoOptions, gopts, "destination")
 	if err != nil {
 		return err
@@ -108,7 +118,7 @@ func runCopy(ctx context.Context, opts CopyOptions, gopts GlobalOptions, args []
 	}
 
 	dstSnapshotByOriginal := make(map[restic.ID][]*restic.Snapshot)
-	for sn := range FindFilteredSnapshots(ctx, dstSnapshotLister, dstRepo, opts.Hosts, opts.Tags, opts.Paths, nil) {
+	for sn := range FindFilteredSnapshots(ctx, dstSnapshotLister, dstRepo, &opts.snapshotFilterOptions, nil) {
 		if sn.Original != nil && !sn.Original.IsNull() {
 			dstSnapshotByOriginal[*sn.Original] = append(dstSnapshotByOriginal[*sn.Original], sn)
 		}
@@ -116,10 +126,18 @@ func runCopy(ctx context.Context, opts CopyOptions, gopts GlobalOptions, args []
 		dstSnapshotByOriginal[*sn.ID()] = append(dstSnapshotByOriginal[*sn.ID()], sn)
 	}
 
+	journal, err := openCopyJournal(opts, srcRepo, dstRepo, args)
+	if err != nil {
+		return err
+	}
+
 	// remember already processed trees across all snapshots
-	visitedTrees := restic.NewIDSet()
+	visitedTrees := restic.NewIDSet(journal.DoneIDs("trees")...)
+	if len(visitedTrees) > 0 {
+		Verbosef("resuming the copy started at %v, %d trees were already copied\n", journal.Started().Format(TimeFormat), len(visitedTrees))
+	}
 
-	for sn := range FindFilteredSnapshots(ctx, srcSnapshotLister, srcRepo, opts.Hosts, opts.Tags, opts.Paths, args) {
+	for sn := range FindFilteredSnapshots(ctx, srcSnapshotLister, srcRepo, &opts.snapshotFilterOptions, args) {
 
 		// check whether the destination has a snapshot with the same persistent ID which has similar snapshot fields
 		srcOriginal := *sn.ID()
@@ -158,8 +176,70 @@ func runCopy(ctx context.Context, opts CopyOptions, gopts GlobalOptions, args []
 			return err
 		}
 		Verbosef("snapshot %s saved\n", newID.Str())
+
+		if err := recordCopyProgress(journal, dstRepo, visitedTrees); err != nil {
+			Warningf("unable to save the copy progress: %v\n", err)
+		}
+	}
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return journal.Finish()
+}
+
+// copyJournalParams are the options which determine the snapshots which are
+// copied.
+type copyJournalParams struct {
+	Source      string                `json:"source"`
+	Destination string                `json:"destination"`
+	Filter      snapshotFilterOptions `json:"filter"`
+	Snapshots   []string              `json:"snapshots"`
+}
+
+// openCopyJournal opens the journal which records the trees that were copied
+// completely by an interrupted copy. The trees are only valid if none of the
+// index files of the destination repository recorded along with them was
+// removed, otherwise the destination may have been pruned and the journal is
+// discarded.
+func openCopyJournal(opts CopyOptions, srcRepo, dstRepo *repository.Repository, args []string) (*repository.OperationJournal, error) {
+	params := copyJournalParams{
+		Source:      srcRepo.Config().ID,
+		Destination: dstRepo.Config().ID,
+		Filter:      opts.snapshotFilterOptions,
+		Snapshots:   args,
+	}
+	journal, err := repository.OpenOperationJournal(srcRepo, "copy", params)
+	if err != nil || !journal.Resumed() {
+		return journal, err
+	}
+
+	var recorded restic.IDs
+	_, err = journal.Get("dst-index", &recorded)
+	if err != nil {
+		return nil, err
+	}
+	current := dstRepo.Index().(*index.MasterIndex).IDs()
+	for _, id := range recorded {
+		if !current.Has(id) {
+			debug.Log("index %v of destination was removed, discarding copy journal", id)
+			if err := journal.Finish(); err != nil {
+				return nil, err
+			}
+			return repository.OpenOperationJournal(srcRepo, "copy", params)
+		}
+	}
+	return journal, nil
+}
+
+// recordCopyProgress records the visited trees, which were copied completely,
+// together with the current index files of the destination repository.
+func recordCopyProgress(journal *repository.OperationJournal, dstRepo restic.Repository, visitedTrees restic.IDSet) error {
+	for id := range visitedTrees {
+		if err := journal.MarkDone("trees", id); err != nil {
+			return err
+		}
 	}
-	return nil
+	return journal.Set("dst-index", dstRepo.Index().(*index.MasterIndex).IDs().List())
 }
 
 func similarSnapshots(sna *restic.Snapshot, snb *restic.Snapshot) bool {
@@ -29,6 +29,10 @@ directory:
 * M  The file's content was modified
 * T  The type was changed, e.g. a file was made a symlink
 
+The special snapshot IDs "latest" and "latest~n" and time ranges like
+"2024-01-01..2024-02-01" select the latest or n-th latest snapshot matching
+the --host, --tag, --path, --before and --after options.
+
 EXIT STATUS
 ===========
 
@@ -42,6 +46,7 @@ Exit status is 0 if the command was successful, and non-zero if there was any er
 
 // DiffOptions collects all options for the diff command.
 type DiffOptions struct {
+	snapshotFilterOptions
 	ShowMetadata bool
 }
 
@@ -52,10 +57,11 @@ func init() {
 
 	f := cmdDiff.Flags()
 	f.BoolVar(&diffOptions.ShowMetadata, "metadata", false, "print changes in metadata")
+	initSingleSnapshotFilterOptions(f, &diffOptions.snapshotFilterOptions)
 }
 
-func loadSnapshot(ctx context.Context, be restic.Lister, repo restic.Repository, desc string) (*restic.Snapshot, error) {
-	sn, err := restic.FindSnapshot(ctx, be, repo, desc)
+func loadSnapshot(ctx context.Context, be restic.Lister, repo restic.Repository, opts *snapshotFilterOptions, desc string) (*restic.Snapshot, error) {
+	sn, err := findFilteredSnapshot(ctx, be, repo, opts, desc)
 	if err != nil {
 		return nil, errors.Fatal(err.Error())
 	}
@@ -151,7 +157,7 @@ func updateBlobs(repo restic.Repository, blobs restic.BlobSet, stats *DiffStat)
 
 		size, found := repo.LookupBlobSize(h.ID, h.Type)
 		if !found {
-			Warnf("unable to find blob size for %v\n", h)
+			Warningf("unable to find blob size for %v\n", h)
 			continue
 		}
 
@@ -346,12 +352,12 @@ func runDiff(ctx context.Context, opts DiffOptions, gopts GlobalOptions, args []
 	if err != nil {
 		return err
 	}
-	sn1, err := loadSnapshot(ctx, be, repo, args[0])
+	sn1, err := loadSnapshot(ctx, be, repo, &opts.snapshotFilterOptions, args[0])
 	if err != nil {
 		return err
 	}
 
-	sn2, err := loadSnapshot(ctx, be, repo, args[1])
+	sn2, err := loadSnapshot(ctx, be, repo, &opts.snapshotFilterOptions, args[1])
 	if err != nil {
 		return err
 	}
@@ -25,7 +25,8 @@ as a tar (default) or zip file containing the contents of the specified folder.
 Pass "/" as file name to dump the whole snapshot as an archive file.
 
 The special snapshot "latest" can be used to use the latest snapshot in the
-repository.
+repository, "latest~n" uses the n-th snapshot before the latest one. A time
+range like "2024-01-01..2024-02-01" uses the latest snapshot in that range.
 
 EXIT STATUS
 ===========
@@ -139,7 +140,7 @@ func runDump(ctx context.Context, opts DumpOptions, gopts GlobalOptions, args []
 		}
 	}
 
-	sn, err := restic.FindFilteredSnapshot(ctx, repo.Backend(), repo, opts.Paths, opts.Tags, opts.Hosts, nil, snapshotIDString)
+	sn, err := findFilteredSnapshot(ctx, repo.Backend(), repo, &opts.snapshotFilterOptions, snapshotIDString)
 	if err != nil {
 		return errors.Fatalf("failed to find snapshot: %v", err)
 	}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/repository"
+	"github.com/restic/restic/internal/restic"
+	"github.com/restic/restic/internal/ui/table"
+)
+
+var cmdExcludePolicy = &cobra.Command{
+	Use:   "exclude-policy [flags] [list|set|remove] [name]",
+	Short: "Manage exclude policies stored in the repository",
+	Long: `
+The "exclude-policy" command manages named sets of exclude patterns which are
+stored in the repository. All hosts backing up to the repository can apply
+such a policy by passing "--use-repo-excludes name" to the backup command.
+
+The "set" subcommand stores the patterns given via --exclude, --iexclude,
+--exclude-file and --iexclude-file under the given name, replacing an
+existing policy with the same name. The policies are stored in the repository
+config, "set" and "remove" therefore need an exclusive lock.
+
+EXIT STATUS
+===========
+
+Exit status is 0 if the command was successful, and non-zero if there was any error.
+`,
+	DisableAutoGenTag: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runExcludePolicy(cmd.Context(), excludePolicyOptions, globalOptions, args)
+	},
+}
+
+// ExcludePolicyOptions bundles all options for the 'exclude-policy' command.
+type ExcludePolicyOptions struct {
+	excludePatternOptions
+}
+
+var excludePolicyOptions ExcludePolicyOptions
+
+func init() {
+	cmdRoot.AddCommand(cmdExcludePolicy)
+
+	f := cmdExcludePolicy.Flags()
+	initExcludePatternOptions(f, &excludePolicyOptions.excludePatternOptions)
+}
+
+func listExcludePolicies(repo *repository.Repository, gopts GlobalOptions) error {
+	type policyInfo struct {
+		Name                string   `json:"name"`
+		Time                string   `json:"time"`
+		Excludes            []string `json:"excludes"`
+		InsensitiveExcludes []string `json:"iexcludes"`
+	}
+
+	policies := []policyInfo{}
+	for _, p := range repo.Config().ExcludePolicies {
+		policies = append(policies, policyInfo{
+			Name:                p.Name,
+			Time:                p.Time.Local().Format(TimeFormat),
+			Excludes:            p.Excludes,
+			InsensitiveExcludes: p.InsensitiveExcludes,
+		})
+	}
+
+	if gopts.JSON {
+		return json.NewEncoder(globalOptions.stdout).Encode(policies)
+	}
+
+	tab := table.New()
+	tab.AddColumn("Name", "{{ .Name }}")
+	tab.AddColumn("Time", "{{ .Time }}")
+	tab.AddColumn("Excludes", "{{ join .Excludes \", \" }}")
+	tab.AddColumn("Insensitive Excludes", "{{ join .InsensitiveExcludes \", \" }}")
+
+	for _, p := range policies {
+		tab.AddRow(p)
+	}
+
+	return tab.Write(globalOptions.stdout)
+}
+
+func setExcludePolicy(ctx context.Context, repo *repository.Repository, opts ExcludePolicyOptions, name string) error {
+	excludes, insensitiveExcludes, err := opts.Patterns()
+	if err != nil {
+		return err
+	}
+	if len(excludes) == 0 && len(insensitiveExcludes) == 0 {
+		return errors.Fatal("no exclude patterns specified")
+	}
+
+	cfg := repo.Config()
+	cfg.SetExcludePolicy(restic.NewExcludePolicy(name, excludes, insensitiveExcludes, time.Now()))
+	if err := repo.UpdateConfig(ctx, cfg); err != nil {
+		return err
+	}
+
+	Verbosef("saved exclude policy %q\n", name)
+	return nil
+}
+
+func removeExcludePolicy(ctx context.Context, repo *repository.Repository, name string) error {
+	cfg := repo.Config()
+	if !cfg.RemoveExcludePolicy(name) {
+		return errors.Fatalf("no exclude policy named %q found", name)
+	}
+	if err := repo.UpdateConfig(ctx, cfg); err != nil {
+		return err
+	}
+
+	Verbosef("removed exclude policy %q\n", name)
+	return nil
+}
+
+func runExcludePolicy(ctx context.Context, opts ExcludePolicyOptions, gopts GlobalOptions, args []string) error {
+	if len(args) < 1 || (args[0] == "list" && len(args) != 1) || (args[0] != "list" && len(args) != 2) {
+		return errors.Fatal("wrong number of arguments")
+	}
+
+	if args[0] != "set" && !opts.Empty() {
+		return errors.Fatal("exclude patterns can only be specified for \"set\"")
+	}
+
+	if len(args) == 2 && strings.TrimSpace(args[1]) == "" {
+		return errors.Fatal("empty exclude policy name")
+	}
+
+	repo, err := OpenRepository(ctx, gopts)
+	if err != nil {
+		return err
+	}
+
+	switch args[0] {
+	case "list":
+		return listExcludePolicies(repo, gopts)
+	case "set", "remove":
+		// the policies are stored in the config, which is replaced
+		lock, ctx, err := lockRepoExclusive(ctx, repo)
+		defer unlockRepo(lock)
+		if err != nil {
+			return err
+		}
+
+		if args[0] == "set" {
+			return setExcludePolicy(ctx, repo, opts, args[1])
+		}
+		return removeExcludePolicy(ctx, repo, args[1])
+	default:
+		return errors.Fatalf("invalid subcommand %q", args[0])
+	}
+}
+
+// loadRepoExcludes adds the patterns of the exclude policies called names to
+// opts.
+func loadRepoExcludes(repo *repository.Repository, opts *excludePatternOptions, names []string) error {
+	for _, name := range names {
+		p, err := repo.Config().ExcludePolicy(name)
+		if err != nil {
+			return errors.Fatalf("unable to load exclude policy: %v", err)
+		}
+		debug.Log("using exclude policy %v", p)
+
+		opts.Excludes = append(opts.Excludes, p.Excludes...)
+		opts.InsensitiveExcludes = append(opts.InsensitiveExcludes, p.InsensitiveExcludes...)
+	}
+	return nil
+}
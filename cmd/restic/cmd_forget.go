@@ -3,7 +3,9 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"io"
+	"time"
 
 	"github.com/restic/restic/internal/errors"
 	"github.com/restic/restic/internal/restic"
@@ -22,6 +24,14 @@ Please note that this command really only deletes the snapshot object in the
 repository, which is a reference to data stored there. In order to remove the
 unreferenced data after "forget" was run successfully, see the "prune" command.
 
+Snapshots can also be passed as time ranges like "2024-01-01..2024-02-01",
+which selects all snapshots created in that range.
+
+Snapshots younger than the "min_snapshot_age" repository setting are not
+removed unless "--force" is specified, see "restic config". This also allows
+removing snapshots with a timestamp in the future, which never reach the
+minimum age.
+
 Please also read the documentation for "forget" to learn about some important
 security considerations.
 
@@ -59,6 +69,7 @@ type ForgetOptions struct {
 	GroupBy string
 	DryRun  bool
 	Prune   bool
+	Force   bool
 }
 
 var forgetOptions ForgetOptions
@@ -94,6 +105,7 @@ func init() {
 	f.StringVarP(&forgetOptions.GroupBy, "group-by", "g", "host,paths", "`group` snapshots by host, paths and/or tags, separated by comma (disable grouping with '')")
 	f.BoolVarP(&forgetOptions.DryRun, "dry-run", "n", false, "do not delete anything, just print what would be done")
 	f.BoolVar(&forgetOptions.Prune, "prune", false, "automatically run the 'prune' command if snapshots have been removed")
+	f.BoolVar(&forgetOptions.Force, "force", false, "also remove snapshots younger than the min_snapshot_age of the repository")
 
 	f.SortFlags = false
 	addPruneOptions(cmdForget)
@@ -105,6 +117,10 @@ func runForget(ctx context.Context, opts ForgetOptions, gopts GlobalOptions, arg
 		return err
 	}
 
+	if err := opts.validate(args); err != nil {
+		return err
+	}
+
 	repo, err := OpenRepository(ctx, gopts)
 	if err != nil {
 		return err
@@ -123,10 +139,20 @@ func runForget(ctx context.Context, opts ForgetOptions, gopts GlobalOptions, arg
 		}
 	}
 
+	minAge, err := repo.Config().SnapshotMinAge()
+	if err != nil {
+		return err
+	}
+	if opts.Force {
+		minAge = restic.Duration{}
+	}
+	now := time.Now()
+
 	var snapshots restic.Snapshots
 	removeSnIDs := restic.NewIDSet()
+	protected := 0
 
-	for sn := range FindFilteredSnapshots(ctx, repo.Backend(), repo, opts.Hosts, opts.Tags, opts.Paths, args) {
+	for sn := range FindFilteredSnapshots(ctx, repo.Backend(), repo, &opts.snapshotFilterOptions, args) {
 		snapshots = append(snapshots, sn)
 	}
 
@@ -135,6 +161,11 @@ func runForget(ctx context.Context, opts ForgetOptions, gopts GlobalOptions, arg
 	if len(args) > 0 {
 		// When explicit snapshots args are given, remove them immediately.
 		for _, sn := range snapshots {
+			if sn.Protected(minAge, now) {
+				Warningf("refusing to remove snapshot %v, it is younger than the min_snapshot_age %v of the repository\n", sn.ID().Str(), minAge)
+				protected++
+				continue
+			}
 			removeSnIDs.Insert(*sn.ID())
 		}
 	} else {
@@ -189,6 +220,7 @@ func runForget(ctx context.Context, opts ForgetOptions, gopts GlobalOptions, arg
 				fg.Paths = key.Paths
 
 				keep, remove, reasons := restic.ApplyPolicy(snapshotGroup, policy)
+				keep, remove, reasons = keepProtected(keep, remove, reasons, minAge, now)
 
 				if len(keep) != 0 && !gopts.Quiet && !gopts.JSON {
 					Printf("keep %d snapshots:\n", len(keep))
@@ -240,12 +272,38 @@ func runForget(ctx context.Context, opts ForgetOptions, gopts GlobalOptions, arg
 			Verbosef("%d snapshots have been removed, running prune\n", len(removeSnIDs))
 		}
 		pruneOptions.DryRun = opts.DryRun
-		return runPruneWithRepo(ctx, pruneOptions, gopts, repo, removeSnIDs)
+		err = runPruneWithRepo(ctx, pruneOptions, gopts, repo, removeSnIDs)
+		if err != nil {
+			return err
+		}
+	}
+
+	if protected > 0 {
+		return errors.Fatalf("%d snapshots were not removed as they are younger than the min_snapshot_age %v, use --force to remove them anyway", protected, minAge)
 	}
 
 	return nil
 }
 
+// keepProtected moves all snapshots from remove to keep which are younger than
+// minAge at the time now.
+func keepProtected(keep, remove restic.Snapshots, reasons []restic.KeepReason, minAge restic.Duration, now time.Time) (restic.Snapshots, restic.Snapshots, []restic.KeepReason) {
+	var stillRemove restic.Snapshots
+	for _, sn := range remove {
+		if !sn.Protected(minAge, now) {
+			stillRemove = append(stillRemove, sn)
+			continue
+		}
+
+		keep = append(keep, sn)
+		reasons = append(reasons, restic.KeepReason{
+			Snapshot: sn,
+			Matches:  []string{fmt.Sprintf("younger than min_snapshot_age %v", minAge)},
+		})
+	}
+	return keep, stillRemove, reasons
+}
+
 // ForgetGroup helps to print what is forgotten in JSON.
 type ForgetGroup struct {
 	Tags    []string            `json:"tags"`
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/ui"
+	"github.com/restic/restic/internal/ui/table"
+
+	"github.com/spf13/cobra"
+)
+
+var cmdHistory = &cobra.Command{
+	Use:   "history [flags]",
+	Short: "Show the runs recorded in the local telemetry store",
+	Long: `
+The "history" command shows the previous runs of restic recorded in the local
+telemetry store: when each command was started, how long it ran, how much data
+it uploaded to and downloaded from the repository and whether it failed.
+
+Runs are only recorded if telemetry has been enabled using "--telemetry" or by
+setting the environment variable RESTIC_TELEMETRY to "true". The store is
+located in the cache directory and keeps the last 100 runs. It is never sent
+anywhere. With "--clear", all recorded runs are removed.
+
+EXIT STATUS
+===========
+
+Exit status is 0 if the command was successful, and non-zero if there was any error.
+`,
+	DisableAutoGenTag: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runHistory(historyOptions, globalOptions, args)
+	},
+}
+
+// HistoryOptions collects all options for the history command.
+type HistoryOptions struct {
+	Last    int
+	Command string
+	Clear   bool
+}
+
+var historyOptions HistoryOptions
+
+func init() {
+	cmdRoot.AddCommand(cmdHistory)
+
+	f := cmdHistory.Flags()
+	f.IntVar(&historyOptions.Last, "last", 0, "only show the last `n` runs")
+	f.StringVar(&historyOptions.Command, "command", "", "only show runs of the `command`, e.g. \"backup\"")
+	f.BoolVar(&historyOptions.Clear, "clear", false, "remove all recorded runs")
+}
+
+func runHistory(opts HistoryOptions, gopts GlobalOptions, args []string) error {
+	if len(args) > 0 {
+		return errors.Fatal("the history command expects no arguments, only options - please see `restic help history` for usage and flags")
+	}
+	if opts.Last < 0 {
+		return errors.Fatal("--last must not be negative")
+	}
+
+	filename, err := telemetryFile(gopts)
+	if err != nil {
+		return err
+	}
+
+	if opts.Clear {
+		err := os.Remove(filename)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return errors.Fatalf("unable to remove the telemetry store: %v", err)
+		}
+		Verbosef("removed all recorded runs\n")
+		return nil
+	}
+
+	store, err := loadTelemetryStore(filename)
+	if err != nil {
+		return err
+	}
+
+	runs := []TelemetryRun{}
+	for _, run := range store.Runs {
+		if opts.Command == "" || run.Command == opts.Command {
+			runs = append(runs, run)
+		}
+	}
+	if opts.Last > 0 && len(runs) > opts.Last {
+		runs = runs[len(runs)-opts.Last:]
+	}
+
+	if gopts.JSON {
+		err := json.NewEncoder(gopts.stdout).Encode(runs)
+		if err != nil {
+			return fmt.Errorf("encoding output: %v", err)
+		}
+		return nil
+	}
+
+	if len(store.Runs) == 0 && !gopts.Telemetry {
+		Verbosef("no runs recorded, enable recording with --telemetry or RESTIC_TELEMETRY=true\n")
+		return nil
+	}
+
+	return printHistory(gopts, runs)
+}
+
+func printHistory(gopts GlobalOptions, runs []TelemetryRun) error {
+	tab := table.New()
+	tab.AddColumn("Time", "{{ .Time }}")
+	tab.AddColumn("Command", "{{ .Command }}")
+	tab.AddColumn("Duration", "{{ .Duration }}")
+	tab.AddColumn("Uploaded", "{{ .Uploaded }}")
+	tab.AddColumn("Downloaded", "{{ .Downloaded }}")
+	tab.AddColumn("Exit", "{{ .ExitCode }}")
+	tab.AddColumn("Result", "{{ .Result }}")
+
+	for _, run := range runs {
+		result := run.Error
+		if result == "" && run.Warnings > 0 {
+			result = fmt.Sprintf("%d warnings", run.Warnings)
+		}
+		if result == "" {
+			result = "ok"
+		}
+
+		data := struct {
+			Time, Command, Duration, Uploaded, Downloaded, Result string
+			ExitCode                                              int
+		}{
+			Time:       run.Time.Local().Format(TimeFormat),
+			Command:    run.Command,
+			Duration:   ui.FormatDuration(run.Duration),
+			Uploaded:   ui.FormatBytes(run.BytesUploaded),
+			Downloaded: ui.FormatBytes(run.BytesDownloaded),
+			ExitCode:   run.ExitCode,
+			Result:     result,
+		}
+		tab.AddRow(data)
+	}
+	tab.AddFooter(fmt.Sprintf("%d runs", len(runs)))
+
+	return tab.Write(gopts.stdout)
+}
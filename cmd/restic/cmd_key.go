@@ -8,6 +8,7 @@ import (
 	"sync"
 
 	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/keystore"
 	"github.com/restic/restic/internal/repository"
 	"github.com/restic/restic/internal/restic"
 	"github.com/restic/restic/internal/ui/table"
@@ -16,11 +17,18 @@ import (
 )
 
 var cmdKey = &cobra.Command{
-	Use:   "key [flags] [list|add|remove|passwd] [ID]",
+	Use:   "key [flags] [list|add|remove|passwd|seal-tpm] [ID|file]",
 	Short: "Manage keys (passwords)",
 	Long: `
 The "key" command manages keys (passwords) for accessing the repository.
 
+"key seal-tpm file" adds a new key with a random password and seals the
+password to the TPM of the local machine. The sealed password is written to
+file, which can then be passed to "--tpm-key" to open the repository without a
+password on this machine. With "--tpm-pcrs", unsealing additionally requires
+the given platform configuration registers to be unchanged, e.g. PCR 7 for the
+secure boot state. The TPM is accessed via systemd-creds (Linux only).
+
 EXIT STATUS
 ===========
 
@@ -36,6 +44,7 @@ var (
 	newPasswordFile string
 	keyUsername     string
 	keyHostname     string
+	keyTPMPCRs      []uint
 )
 
 func init() {
@@ -45,6 +54,7 @@ func init() {
 	flags.StringVarP(&newPasswordFile, "new-password-file", "", "", "`file` from which to read the new password")
 	flags.StringVarP(&keyUsername, "user", "", "", "the username for new keys")
 	flags.StringVarP(&keyHostname, "host", "", "", "the hostname for new keys")
+	flags.UintSliceVar(&keyTPMPCRs, "tpm-pcrs", nil, "bind the key sealed by seal-tpm to the TPM PCR `index` (can be specified multiple times)")
 }
 
 func listKeys(ctx context.Context, s *repository.Repository, gopts GlobalOptions) error {
@@ -62,7 +72,7 @@ func listKeys(ctx context.Context, s *repository.Repository, gopts GlobalOptions
 	err := restic.ParallelList(ctx, s.Backend(), restic.KeyFile, s.Connections(), func(ctx context.Context, id restic.ID, size int64) error {
 		k, err := repository.LoadKey(ctx, s, id)
 		if err != nil {
-			Warnf("LoadKey() failed: %v\n", err)
+			Warningf("LoadKey() failed: %v\n", err)
 			return nil
 		}
 
@@ -201,7 +211,8 @@ func switchToNewKeyAndRemoveIfBroken(ctx context.Context, repo *repository.Repos
 }
 
 func runKey(ctx context.Context, gopts GlobalOptions, args []string) error {
-	if len(args) < 1 || (args[0] == "remove" && len(args) != 2) || (args[0] != "remove" && len(args) != 1) {
+	needsArg := len(args) > 0 && (args[0] == "remove" || args[0] == "seal-tpm")
+	if len(args) < 1 || (needsArg && len(args) != 2) || (!needsArg && len(args) != 1) {
 		return errors.Fatal("wrong number of arguments")
 	}
 
@@ -248,6 +259,26 @@ func runKey(ctx context.Context, gopts GlobalOptions, args []string) error {
 		}
 
 		return changePassword(ctx, repo, gopts)
+	case "seal-tpm":
+		lock, ctx, err := lockRepo(ctx, repo)
+		defer unlockRepo(lock)
+		if err != nil {
+			return err
+		}
+
+		sealer, err := keystore.Lookup("tpm2")
+		if err != nil {
+			return err
+		}
+		if len(keyTPMPCRs) > 0 {
+			binder, ok := sealer.(keystore.PCRBinder)
+			if !ok {
+				return errors.Fatal("the tpm2 keystore does not support --tpm-pcrs")
+			}
+			sealer = binder.WithPCRs(keyTPMPCRs)
+		}
+
+		return sealKey(ctx, repo, sealer, "tpm2", args[1])
 	}
 
 	return nil
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/keystore"
+	"github.com/restic/restic/internal/repository"
+	"github.com/restic/restic/internal/restic"
+)
+
+// sealedKeyVersion is the version of the file format written by "key seal-tpm".
+const sealedKeyVersion = 1
+
+// sealedKeyFile is the content of a file written by "key seal-tpm".
+type sealedKeyFile struct {
+	Version  int    `json:"version"`
+	Keystore string `json:"keystore"`
+	// KeyID is the ID of the key, it is used as the key hint.
+	KeyID string `json:"key_id"`
+	// SealedPassword is the password of the key, sealed with the keystore.
+	SealedPassword []byte `json:"sealed_password"`
+}
+
+// sealKey adds a new key with a random password to repo, seals the password
+// with sealer and writes it to filename. The sealer is tested by unsealing
+// the password again, the key is removed if any step fails.
+func sealKey(ctx context.Context, repo *repository.Repository, sealer keystore.Sealer, name, filename string) error {
+	pw := restic.NewRandomID().String()
+	key, err := repository.AddKey(ctx, repo, pw, keyUsername, keyHostname, repo.Key())
+	if err != nil {
+		return errors.Fatalf("creating new key failed: %v\n", err)
+	}
+
+	file := sealedKeyFile{
+		Version:  sealedKeyVersion,
+		Keystore: name,
+		KeyID:    key.ID().String(),
+	}
+
+	err = func() error {
+		file.SealedPassword, err = sealer.Seal(ctx, []byte(pw))
+		if err != nil {
+			return errors.Fatalf("unable to seal the password: %v", err)
+		}
+		unsealed, err := sealer.Unseal(ctx, file.SealedPassword)
+		if err != nil {
+			return errors.Fatalf("unable to unseal the password again: %v", err)
+		}
+		if string(unsealed) != pw {
+			return errors.Fatal("unsealed password does not match")
+		}
+
+		buf, err := json.Marshal(file)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		return writeNewFile(filename, buf)
+	}()
+	if err != nil {
+		_ = deleteKey(ctx, repo, key.ID())
+		return err
+	}
+
+	Verbosef("saved new key as %s, the password is sealed with %v in %v\n", key.ID(), name, filename)
+	return nil
+}
+
+// writeNewFile writes buf to filename, which must not exist yet and is only
+// accessible by the current user.
+func writeNewFile(filename string, buf []byte) error {
+	f, err := os.OpenFile(filename, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return errors.Fatalf("unable to create %v: %v", filename, err)
+	}
+	_, err = f.Write(buf)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		_ = os.Remove(filename)
+		return errors.Fatalf("unable to write %v: %v", filename, err)
+	}
+	return nil
+}
+
+// applyTPMKey unseals the password stored in the file configured with
+// --tpm-key and sets the key hint to the corresponding key, unless another
+// hint has been specified.
+func applyTPMKey(ctx context.Context, gopts *GlobalOptions) (string, error) {
+	buf, err := os.ReadFile(gopts.TPMKey)
+	if err != nil {
+		return "", errors.Fatalf("unable to read sealed key: %v", err)
+	}
+
+	var file sealedKeyFile
+	if err := json.Unmarshal(buf, &file); err != nil {
+		return "", errors.Fatalf("invalid sealed key %v: %v", gopts.TPMKey, err)
+	}
+	if file.Version != sealedKeyVersion {
+		return "", errors.Fatalf("sealed key %v has unsupported version %d", gopts.TPMKey, file.Version)
+	}
+
+	sealer, err := keystore.Lookup(file.Keystore)
+	if err != nil {
+		return "", err
+	}
+	pw, err := sealer.Unseal(ctx, file.SealedPassword)
+	if err != nil {
+		return "", errors.Fatalf("unable to unseal the password in %v: %v", gopts.TPMKey, err)
+	}
+
+	if gopts.KeyHint == "" {
+		gopts.KeyHint = file.KeyID
+	}
+	return string(pw), nil
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/restic/restic/internal/errors"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+// failingSealer is a sealer which cannot seal any secret.
+type failingSealer struct{}
+
+func (failingSealer) Seal(_ context.Context, _ []byte) ([]byte, error) {
+	return nil, errors.New("no TPM available")
+}
+
+func (failingSealer) Unseal(_ context.Context, _ []byte) ([]byte, error) {
+	return nil, errors.New("no TPM available")
+}
+
+func TestKeySealTPM(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	// must list keys more than once
+	env.gopts.backendTestHook = nil
+	defer cleanup()
+
+	testRunInit(t, env.gopts)
+
+	repo, err := OpenRepository(context.TODO(), env.gopts)
+	rtest.OK(t, err)
+
+	filename := filepath.Join(env.base, "sealed-key")
+	rtest.OK(t, sealKey(context.TODO(), repo, testSealer{}, "test", filename))
+	rtest.Equals(t, 1, len(testRunKeyListOtherIDs(t, env.gopts)))
+
+	// an existing file is not overwritten, the new key is removed again
+	err = sealKey(context.TODO(), repo, testSealer{}, "test", filename)
+	rtest.Assert(t, err != nil, "expected error for existing file")
+	rtest.Equals(t, 1, len(testRunKeyListOtherIDs(t, env.gopts)))
+
+	fi, err := os.Stat(filename)
+	rtest.OK(t, err)
+	if os.PathSeparator == '/' {
+		rtest.Equals(t, os.FileMode(0600), fi.Mode().Perm())
+	}
+
+	gopts := env.gopts
+	gopts.password = ""
+	gopts.TPMKey = filename
+	password, err := applyTPMKey(context.TODO(), &gopts)
+	rtest.OK(t, err)
+	rtest.Equals(t, testRunKeyListOtherIDs(t, env.gopts)[0], gopts.KeyHint[:8])
+
+	gopts.password = password
+	testRunCheck(t, gopts)
+}
+
+func TestKeySealTPMFailure(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	// must list keys more than once
+	env.gopts.backendTestHook = nil
+	defer cleanup()
+
+	testRunInit(t, env.gopts)
+
+	repo, err := OpenRepository(context.TODO(), env.gopts)
+	rtest.OK(t, err)
+
+	filename := filepath.Join(env.base, "sealed-key")
+	err = sealKey(context.TODO(), repo, failingSealer{}, "failing", filename)
+	rtest.Assert(t, err != nil, "expected error for failing sealer")
+	rtest.Equals(t, 0, len(testRunKeyListOtherIDs(t, env.gopts)))
+
+	_, err = os.Stat(filename)
+	rtest.Assert(t, errors.Is(err, os.ErrNotExist), "sealed key file was created: %v", err)
+}
@@ -4,12 +4,15 @@ import (
 	"context"
 	"encoding/json"
 	"os"
+	"path"
+	"reflect"
 	"strings"
 	"time"
 
 	"github.com/spf13/cobra"
 
 	"github.com/restic/restic/internal/backend"
+	"github.com/restic/restic/internal/debug"
 	"github.com/restic/restic/internal/errors"
 	"github.com/restic/restic/internal/fs"
 	"github.com/restic/restic/internal/restic"
@@ -17,7 +20,7 @@ import (
 )
 
 var cmdLs = &cobra.Command{
-	Use:   "ls [flags] snapshotID [dir...]",
+	Use:   "ls [flags] [--snapshot-diff snapshotID] snapshotID [dir...]",
 	Short: "List files in a snapshot",
 	Long: `
 The "ls" command lists files and directories in a snapshot.
@@ -25,7 +28,9 @@ The "ls" command lists files and directories in a snapshot.
 The special snapshot ID "latest" can be used to list files and
 directories of the latest snapshot in the repository. The
 --host flag can be used in conjunction to select the latest
-snapshot originating from a certain host only.
+snapshot originating from a certain host only. "latest~n" selects
+the n-th snapshot before the latest one, and a time range like
+"2024-01-01..2024-02-01" the latest snapshot in that range.
 
 File listings can optionally be filtered by directories. Any
 positional arguments after the snapshot ID are interpreted as
@@ -35,6 +40,13 @@ will allow traversing into matching directories' subfolders.
 Any directory paths specified must be absolute (starting with
 a path separator); paths use the forward slash '/' as separator.
 
+With "--snapshot-diff", only the entries which differ between the given
+snapshot and the snapshot passed as argument are listed, prefixed by their
+status: "+" (added), "-" (removed), "T" (type changed), "M" (content modified)
+or "U" (metadata changed). Directories with identical content in both
+snapshots are skipped without loading them, which is much faster than "diff"
+for large snapshots with few changes.
+
 EXIT STATUS
 ===========
 
@@ -50,7 +62,8 @@ Exit status is 0 if the command was successful, and non-zero if there was any er
 type LsOptions struct {
 	ListLong bool
 	snapshotFilterOptions
-	Recursive bool
+	Recursive    bool
+	SnapshotDiff string
 }
 
 var lsOptions LsOptions
@@ -62,6 +75,7 @@ func init() {
 	initSingleSnapshotFilterOptions(flags, &lsOptions.snapshotFilterOptions)
 	flags.BoolVarP(&lsOptions.ListLong, "long", "l", false, "use a long listing format showing size and mode")
 	flags.BoolVar(&lsOptions.Recursive, "recursive", false, "include files in subfolders of the listed directories")
+	flags.StringVar(&lsOptions.SnapshotDiff, "snapshot-diff", "", "only list entries which differ from the snapshot `snapshotID`")
 }
 
 type lsSnapshot struct {
@@ -71,8 +85,9 @@ type lsSnapshot struct {
 	StructType string     `json:"struct_type"` // "snapshot"
 }
 
-// Print node in our custom JSON format, followed by a newline.
-func lsNodeJSON(enc *json.Encoder, path string, node *restic.Node) error {
+// Print node in our custom JSON format, followed by a newline. The status is
+// only set for the output of "--snapshot-diff".
+func lsNodeJSON(enc *json.Encoder, path, status string, node *restic.Node) error {
 	n := &struct {
 		Name        string      `json:"name"`
 		Type        string      `json:"type"`
@@ -85,6 +100,7 @@ func lsNodeJSON(enc *json.Encoder, path string, node *restic.Node) error {
 		ModTime     time.Time   `json:"mtime,omitempty"`
 		AccessTime  time.Time   `json:"atime,omitempty"`
 		ChangeTime  time.Time   `json:"ctime,omitempty"`
+		Status      string      `json:"status,omitempty"`
 		StructType  string      `json:"struct_type"` // "node"
 
 		size uint64 // Target for Size pointer.
@@ -100,6 +116,7 @@ func lsNodeJSON(enc *json.Encoder, path string, node *restic.Node) error {
 		ModTime:     node.ModTime,
 		AccessTime:  node.AccessTime,
 		ChangeTime:  node.ChangeTime,
+		Status:      status,
 		StructType:  "node",
 	}
 	// Always print size for regular files, even when empty,
@@ -177,7 +194,7 @@ func runLs(ctx context.Context, opts LsOptions, gopts GlobalOptions, args []stri
 
 	var (
 		printSnapshot func(sn *restic.Snapshot)
-		printNode     func(path string, node *restic.Node)
+		printNode     func(path, status string, node *restic.Node)
 	)
 
 	if gopts.JSON {
@@ -195,8 +212,8 @@ func runLs(ctx context.Context, opts LsOptions, gopts GlobalOptions, args []stri
 			}
 		}
 
-		printNode = func(path string, node *restic.Node) {
-			err := lsNodeJSON(enc, path, node)
+		printNode = func(path, status string, node *restic.Node) {
+			err := lsNodeJSON(enc, path, status, node)
 			if err != nil {
 				Warnf("JSON encode failed: %v\n", err)
 			}
@@ -205,16 +222,49 @@ func runLs(ctx context.Context, opts LsOptions, gopts GlobalOptions, args []stri
 		printSnapshot = func(sn *restic.Snapshot) {
 			Verbosef("snapshot %s of %v filtered by %v at %s):\n", sn.ID().Str(), sn.Paths, dirs, sn.Time)
 		}
-		printNode = func(path string, node *restic.Node) {
-			Printf("%s\n", formatNode(path, node, lsOptions.ListLong))
+		printNode = func(path, status string, node *restic.Node) {
+			if opts.SnapshotDiff != "" {
+				Printf("%-5s%s\n", status, formatNode(path, node, opts.ListLong))
+				return
+			}
+			Printf("%s\n", formatNode(path, node, opts.ListLong))
 		}
 	}
 
-	sn, err := restic.FindFilteredSnapshot(ctx, snapshotLister, repo, opts.Hosts, opts.Tags, opts.Paths, nil, args[0])
+	sn, err := findFilteredSnapshot(ctx, snapshotLister, repo, &opts.snapshotFilterOptions, args[0])
 	if err != nil {
 		return err
 	}
 
+	if opts.SnapshotDiff != "" {
+		sn1, err := findFilteredSnapshot(ctx, snapshotLister, repo, &opts.snapshotFilterOptions, opts.SnapshotDiff)
+		if err != nil {
+			return err
+		}
+		if sn1.Tree == nil {
+			return errors.Errorf("snapshot %v has nil tree", sn1.ID().Str())
+		}
+		if sn.Tree == nil {
+			return errors.Errorf("snapshot %v has nil tree", sn.ID().Str())
+		}
+
+		printSnapshot(sn1)
+		printSnapshot(sn)
+
+		d := &lsDiffer{
+			repo: repo,
+			printNode: func(nodepath, status string, node *restic.Node) {
+				if withinDir(nodepath) {
+					printNode(nodepath, status, node)
+				}
+			},
+			enterDir: func(nodepath string) bool {
+				return (opts.Recursive && withinDir(nodepath)) || approachingMatchingTree(nodepath)
+			},
+		}
+		return d.diffTree(ctx, "/", *sn1.Tree, *sn.Tree)
+	}
+
 	printSnapshot(sn)
 
 	err = walker.Walk(ctx, repo, *sn.Tree, nil, func(_ restic.ID, nodepath string, node *restic.Node, err error) (bool, error) {
@@ -227,7 +277,7 @@ func runLs(ctx context.Context, opts LsOptions, gopts GlobalOptions, args []stri
 
 		if withinDir(nodepath) {
 			// if we're within a dir, print the node
-			printNode(nodepath, node)
+			printNode(nodepath, "", node)
 
 			// if recursive listing is requested, signal the walker that it
 			// should continue walking recursively
@@ -256,3 +306,121 @@ func runLs(ctx context.Context, opts LsOptions, gopts GlobalOptions, args []stri
 
 	return nil
 }
+
+// lsDiffer lists the entries which differ between two trees.
+type lsDiffer struct {
+	repo restic.BlobLoader
+	// printNode is called for each entry which differs. For removed entries,
+	// node is the entry from the first tree.
+	printNode func(nodepath, status string, node *restic.Node)
+	// enterDir reports whether the entries below the directory nodepath
+	// should be listed.
+	enterDir func(nodepath string) bool
+}
+
+// sameMetadata returns whether node1 and node2 only differ in their subtree.
+func sameMetadata(node1, node2 *restic.Node) bool {
+	n1, n2 := *node1, *node2
+	n1.Subtree, n2.Subtree = nil, nil
+	return n1.Equals(n2)
+}
+
+// diffTree compares the trees id1 and id2. Subtrees with the same ID are not
+// loaded.
+func (d *lsDiffer) diffTree(ctx context.Context, prefix string, id1, id2 restic.ID) error {
+	if id1.Equal(id2) {
+		return nil
+	}
+
+	debug.Log("diffing %v to %v", id1, id2)
+	tree1, err := restic.LoadTree(ctx, d.repo, id1)
+	if err != nil {
+		return err
+	}
+
+	tree2, err := restic.LoadTree(ctx, d.repo, id2)
+	if err != nil {
+		return err
+	}
+
+	tree1Nodes, tree2Nodes, names := uniqueNodeNames(tree1, tree2)
+
+	for _, name := range names {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		node1, t1 := tree1Nodes[name]
+		node2, t2 := tree2Nodes[name]
+		nodepath := path.Join(prefix, name)
+
+		switch {
+		case t1 && t2:
+			status := ""
+			if node1.Type != node2.Type {
+				status += "T"
+			}
+			if node1.Type == "file" && node2.Type == "file" &&
+				!reflect.DeepEqual(node1.Content, node2.Content) {
+				status += "M"
+			} else if !sameMetadata(node1, node2) {
+				status += "U"
+			}
+
+			if status != "" {
+				d.printNode(nodepath, status, node2)
+			}
+
+			if node1.Type == "dir" && node2.Type == "dir" {
+				if d.enterDir(nodepath) {
+					err = d.diffTree(ctx, nodepath, *node1.Subtree, *node2.Subtree)
+				}
+			} else {
+				// the type changed, list the content of the directory
+				err = d.listDir(ctx, nodepath, "-", node1)
+				if err == nil {
+					err = d.listDir(ctx, nodepath, "+", node2)
+				}
+			}
+		case t1 && !t2:
+			d.printNode(nodepath, "-", node1)
+			err = d.listDir(ctx, nodepath, "-", node1)
+		case !t1 && t2:
+			d.printNode(nodepath, "+", node2)
+			err = d.listDir(ctx, nodepath, "+", node2)
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// listDir lists all entries below node with the given status, if node is a
+// directory.
+func (d *lsDiffer) listDir(ctx context.Context, prefix, status string, node *restic.Node) error {
+	if node.Type != "dir" || !d.enterDir(prefix) {
+		return nil
+	}
+
+	tree, err := restic.LoadTree(ctx, d.repo, *node.Subtree)
+	if err != nil {
+		return err
+	}
+
+	for _, node := range tree.Nodes {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		nodepath := path.Join(prefix, node.Name)
+		d.printNode(nodepath, status, node)
+		if err := d.listDir(ctx, nodepath, status, node); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
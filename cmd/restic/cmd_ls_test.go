@@ -80,7 +80,7 @@ func TestLsNodeJSON(t *testing.T) {
 	} {
 		buf := new(bytes.Buffer)
 		enc := json.NewEncoder(buf)
-		err := lsNodeJSON(enc, c.path, &c.Node)
+		err := lsNodeJSON(enc, c.path, "", &c.Node)
 		rtest.OK(t, err)
 		rtest.Equals(t, c.expect+"\n", buf.String())
 
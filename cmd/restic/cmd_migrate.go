@@ -79,11 +79,11 @@ func applyMigrations(ctx context.Context, opts MigrateOptions, gopts GlobalOptio
 						if reason == "" {
 							reason = "check failed"
 						}
-						Warnf("migration %v cannot be applied: %v\nIf you want to apply this migration anyway, re-run with option --force\n", m.Name(), reason)
+						Warningf("migration %v cannot be applied: %v\nIf you want to apply this migration anyway, re-run with option --force\n", m.Name(), reason)
 						continue
 					}
 
-					Warnf("check for migration %v failed, continuing anyway\n", m.Name())
+					Warningf("check for migration %v failed, continuing anyway\n", m.Name())
 				}
 
 				if m.RepoCheck() {
@@ -160,7 +160,7 @@ func runMount(ctx context.Context, opts MountOptions, gopts GlobalOptions, args
 		debug.Log("running umount cleanup handler for mount at %v", mountpoint)
 		err := umount(mountpoint)
 		if err != nil {
-			Warnf("unable to umount (maybe already umounted or still in use?): %v\n", err)
+			Warningf("unable to umount (maybe already umounted or still in use?): %v\n", err)
 		}
 		// replace error code of sigint
 		if code == 130 {
@@ -169,6 +169,11 @@ func runMount(ctx context.Context, opts MountOptions, gopts GlobalOptions, args
 		return code, nil
 	})
 
+	timeRange, err := opts.timeRange()
+	if err != nil {
+		return err
+	}
+
 	c, err := systemFuse.Mount(mountpoint, mountOptions...)
 	if err != nil {
 		return err
@@ -183,6 +188,7 @@ func runMount(ctx context.Context, opts MountOptions, gopts GlobalOptions, args
 		Hosts:         opts.Hosts,
 		Tags:          opts.Tags,
 		Paths:         opts.Paths,
+		TimeRange:     timeRange,
 		TimeTemplate:  opts.TimeTemplate,
 		PathTemplates: opts.PathTemplates,
 	}
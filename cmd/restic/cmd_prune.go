@@ -2,11 +2,15 @@ package main
 
 import (
 	"context"
+	"fmt"
 	"math"
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
 
+	"github.com/restic/restic/internal/backend"
+	"github.com/restic/restic/internal/backend/inventory"
 	"github.com/restic/restic/internal/debug"
 	"github.com/restic/restic/internal/errors"
 	"github.com/restic/restic/internal/index"
@@ -29,6 +33,9 @@ var cmdPrune = &cobra.Command{
 The "prune" command checks the repository and removes data that is not
 referenced and therefore not needed any more.
 
+If prune is interrupted after repacking has completed, the next run with the
+same snapshots only removes the remaining obsolete files.
+
 EXIT STATUS
 ===========
 
@@ -56,6 +63,17 @@ type PruneOptions struct {
 	RepackCachableOnly bool
 	RepackSmall        bool
 	RepackUncompressed bool
+
+	// RepackSmallSize is the size below which --repack-small repacks pack
+	// files, by default 80% of the target pack size.
+	RepackSmallSize  string
+	repackSmallBytes uint64
+
+	// RepackOnly restricts repacking to the packs selected by RepackSmall
+	// and RepackUncompressed.
+	RepackOnly bool
+
+	RecordStats bool
 }
 
 var pruneOptions PruneOptions
@@ -75,6 +93,9 @@ func addPruneOptions(c *cobra.Command) {
 	f.BoolVar(&pruneOptions.RepackCachableOnly, "repack-cacheable-only", false, "only repack packs which are cacheable")
 	f.BoolVar(&pruneOptions.RepackSmall, "repack-small", false, "repack pack files below 80% of target pack size")
 	f.BoolVar(&pruneOptions.RepackUncompressed, "repack-uncompressed", false, "repack all uncompressed data")
+	f.StringVar(&pruneOptions.RepackSmallSize, "repack-small-size", "", "with --repack-small, repack pack files below `size` instead of 80% of the target pack size (allowed suffixes: k/K, m/M, g/G, t/T)")
+	f.BoolVar(&pruneOptions.RepackOnly, "repack-only", false, "only repack the pack files selected by --repack-small and --repack-uncompressed, but not partly used ones")
+	f.BoolVar(&pruneOptions.RecordStats, "record-stats", false, "save a statistics record about the repository in the local cache, listed by 'stats --history'")
 }
 
 func verifyPruneOptions(opts *PruneOptions) error {
@@ -86,6 +107,19 @@ func verifyPruneOptions(opts *PruneOptions) error {
 		}
 		opts.MaxRepackBytes = uint64(size)
 	}
+	if len(opts.RepackSmallSize) > 0 {
+		if !opts.RepackSmall {
+			return errors.Fatal("--repack-small-size requires --repack-small")
+		}
+		size, err := parseSizeStr(opts.RepackSmallSize)
+		if err != nil {
+			return errors.Fatalf("invalid size %q for --repack-small-size: %v", opts.RepackSmallSize, err)
+		}
+		opts.repackSmallBytes = uint64(size)
+	}
+	if opts.RepackOnly && !opts.RepackSmall && !opts.RepackUncompressed {
+		return errors.Fatal("--repack-only requires --repack-small and/or --repack-uncompressed")
+	}
 	if opts.UnsafeNoSpaceRecovery != "" {
 		// prevent repacking data to make sure users cannot get stuck.
 		opts.MaxRepackBytes = 0
@@ -191,7 +225,32 @@ func runPruneWithRepo(ctx context.Context, opts PruneOptions, gopts GlobalOption
 		return err
 	}
 
-	plan, stats, err := planPrune(ctx, opts, repo, ignoreSnapshots, gopts.Quiet)
+	// the snapshots are listed only once, for the journal and for finding the
+	// used blobs
+	snapshotLister, err := backend.MemorizeList(ctx, repo.Backend(), restic.SnapshotFile)
+	if err != nil {
+		return err
+	}
+
+	journal, err := openPruneJournal(ctx, repo, snapshotLister, ignoreSnapshots)
+	if err != nil {
+		return err
+	}
+
+	var pending prunePending
+	ok, err := journal.Get("pending", &pending)
+	if err != nil {
+		return err
+	}
+	if ok && !opts.unsafeRecovery {
+		if opts.DryRun {
+			Verbosef("would complete the prune started at %v, which was interrupted\n", journal.Started().Format(TimeFormat))
+			return nil
+		}
+		return resumePrune(ctx, gopts, repo, snapshotLister, ignoreSnapshots, journal, pending)
+	}
+
+	plan, stats, err := planPrune(ctx, opts, repo, snapshotLister, ignoreSnapshots, gopts.Quiet)
 	if err != nil {
 		return err
 	}
@@ -201,7 +260,145 @@ func runPruneWithRepo(ctx context.Context, opts PruneOptions, gopts GlobalOption
 		return err
 	}
 
-	return doPrune(ctx, opts, gopts, repo, plan)
+	return doPrune(ctx, opts, gopts, repo, plan, journal)
+}
+
+// pruneJournalParams identifies the state of the repository for which an
+// interrupted prune can be resumed. Running backups or forget in between
+// changes the snapshots, the journal is then discarded.
+type pruneJournalParams struct {
+	Snapshots restic.IDs `json:"snapshots"`
+}
+
+// prunePending records the packs which are removed after repacking has
+// completed, all data which is still used was already copied to new packs.
+// Indexes lists the index files at that time, the plan is only valid as long
+// as the index is not changed by other commands.
+type prunePending struct {
+	IgnorePacks restic.IDs `json:"ignore_packs"`
+	RemovePacks restic.IDs `json:"remove_packs"`
+	Indexes     restic.IDs `json:"indexes"`
+}
+
+func openPruneJournal(ctx context.Context, repo *repository.Repository, snapshotLister restic.Lister, ignoreSnapshots restic.IDSet) (*repository.OperationJournal, error) {
+	snapshots := restic.NewIDSet()
+	err := snapshotLister.List(ctx, restic.SnapshotFile, func(fi restic.FileInfo) error {
+		id, err := restic.ParseID(fi.Name)
+		if err != nil {
+			debug.Log("unable to parse %v as an ID", fi.Name)
+			return nil
+		}
+		if !ignoreSnapshots.Has(id) {
+			snapshots.Insert(id)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	params := pruneJournalParams{Snapshots: snapshots.List()}
+	journal, err := repository.OpenOperationJournal(repo, "prune", params)
+	if err != nil {
+		return nil, err
+	}
+
+	var pending prunePending
+	ok, err := journal.Get("pending", &pending)
+	if err != nil || !ok {
+		return journal, err
+	}
+	current := repo.Index().(*index.MasterIndex).IDs()
+	if !current.Equals(restic.NewIDSet(pending.Indexes...)) {
+		debug.Log("index was changed, discarding prune journal")
+		if err := journal.Finish(); err != nil {
+			return nil, err
+		}
+		return repository.OpenOperationJournal(repo, "prune", params)
+	}
+	return journal, nil
+}
+
+// setPrunePending records pending together with the index files of the
+// repository at this point.
+func setPrunePending(journal *repository.OperationJournal, pending prunePending, indexes restic.IDSet) error {
+	pending.Indexes = indexes.List()
+	return journal.Set("pending", pending)
+}
+
+// resumePrune completes an interrupted prune: the index is rebuilt without
+// the packs recorded in pending and these packs are removed.
+func resumePrune(ctx context.Context, gopts GlobalOptions, repo restic.Repository, snapshotLister restic.Lister, ignoreSnapshots restic.IDSet, journal *repository.OperationJournal, pending prunePending) error {
+	Verbosef("resuming the prune started at %v, repacking already completed\n", journal.Started().Format(TimeFormat))
+
+	// the packs are only removed if all data still in use is stored in
+	// other packs
+	ignorePacks := restic.NewIDSet(pending.IgnorePacks...)
+	err := verifyKeptBlobs(ctx, repo, snapshotLister, ignoreSnapshots, ignorePacks, gopts.Quiet)
+	if err != nil {
+		if ferr := journal.Finish(); ferr != nil {
+			Warningf("unable to remove the prune journal: %v\n", ferr)
+		}
+		return err
+	}
+
+	indexes, err := rebuildIndexFiles(ctx, gopts, repo, ignorePacks, nil)
+	if err != nil {
+		return errors.Fatalf("%s", err)
+	}
+
+	err = setPrunePending(journal, pending, indexes)
+	if err != nil {
+		Warningf("unable to save the prune journal: %v\n", err)
+	}
+
+	// some packs may have been removed before the interruption
+	removePacks := restic.NewIDSet()
+	remove := restic.NewIDSet(pending.RemovePacks...)
+	err = repo.List(ctx, restic.PackFile, func(id restic.ID, size int64) error {
+		if remove.Has(id) {
+			removePacks.Insert(id)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if len(removePacks) != 0 {
+		Verbosef("removing %d old packs\n", len(removePacks))
+		DeleteFiles(ctx, gopts, repo, removePacks, restic.PackFile)
+	}
+
+	if err := journal.Finish(); err != nil {
+		Warningf("unable to remove the prune journal: %v\n", err)
+	}
+
+	Verbosef("done, run prune again to check whether more data can be removed\n")
+	return nil
+}
+
+// verifyKeptBlobs checks that every blob used by the snapshots is stored in a
+// pack which is not in ignorePacks.
+func verifyKeptBlobs(ctx context.Context, repo restic.Repository, snapshotLister restic.Lister, ignoreSnapshots restic.IDSet, ignorePacks restic.IDSet, quiet bool) error {
+	usedBlobs, _, err := getUsedBlobs(ctx, repo, snapshotLister, ignoreSnapshots, quiet)
+	if err != nil {
+		return err
+	}
+
+	for bh := range usedBlobs {
+		kept := false
+		for _, pb := range repo.Index().Lookup(bh) {
+			if !ignorePacks.Has(pb.PackID) {
+				kept = true
+				break
+			}
+		}
+		if !kept {
+			return errors.Fatalf("%v is not stored in any remaining pack, the interrupted prune was discarded, run prune again", bh)
+		}
+	}
+	return nil
 }
 
 type pruneStats struct {
@@ -240,6 +437,7 @@ type prunePlan struct {
 	keepBlobs        restic.CountedBlobSet // blobs to keep during repacking
 	removePacks      restic.IDSet          // packs to remove
 	ignorePacks      restic.IDSet          // packs to ignore when rebuilding the index
+	snapshots        uint                  // number of snapshots which are kept
 }
 
 type packInfo struct {
@@ -258,10 +456,10 @@ type packInfoWithID struct {
 
 // planPrune selects which files to rewrite and which to delete and which blobs to keep.
 // Also some summary statistics are returned.
-func planPrune(ctx context.Context, opts PruneOptions, repo restic.Repository, ignoreSnapshots restic.IDSet, quiet bool) (prunePlan, pruneStats, error) {
+func planPrune(ctx context.Context, opts PruneOptions, repo restic.Repository, snapshotLister restic.Lister, ignoreSnapshots restic.IDSet, quiet bool) (prunePlan, pruneStats, error) {
 	var stats pruneStats
 
-	usedBlobs, err := getUsedBlobs(ctx, repo, ignoreSnapshots, quiet)
+	usedBlobs, snapshots, err := getUsedBlobs(ctx, repo, snapshotLister, ignoreSnapshots, quiet)
 	if err != nil {
 		return prunePlan{}, stats, err
 	}
@@ -298,6 +496,7 @@ func planPrune(ctx context.Context, opts PruneOptions, repo restic.Repository, i
 		keepBlobs = nil
 	}
 	plan.keepBlobs = keepBlobs
+	plan.snapshots = snapshots
 
 	return plan, stats, nil
 }
@@ -465,11 +664,14 @@ func decidePackAction(ctx context.Context, opts PruneOptions, repo restic.Reposi
 	if opts.RepackSmall {
 		// consider files with at least 80% of the target size as large enough
 		targetPackSize = repo.PackSize() / 5 * 4
+		if opts.repackSmallBytes > 0 {
+			targetPackSize = uint(opts.repackSmallBytes)
+		}
 	}
 
 	// loop over all packs and decide what to do
 	bar := newProgressMax(quiet, uint64(len(indexPack)), "packs processed")
-	err := repo.List(ctx, restic.PackFile, func(id restic.ID, packSize int64) error {
+	processPack := func(id restic.ID, packSize int64) error {
 		p, ok := indexPack[id]
 		if !ok {
 			// Pack was not referenced in index and is not used  => immediately remove!
@@ -538,12 +740,31 @@ func decidePackAction(ctx context.Context, opts PruneOptions, repo restic.Reposi
 		delete(indexPack, id)
 		bar.Add(1)
 		return nil
-	})
-	bar.Done()
+	}
+
+	err := repo.List(inventory.Allow(ctx), restic.PackFile, processPack)
 	if err != nil {
+		bar.Done()
 		return prunePlan{}, err
 	}
 
+	// the list of packs may come from an outdated inventory report, check
+	// the packs missing from it against the backend
+	for id := range indexPack {
+		fi, err := repo.Backend().Stat(ctx, restic.Handle{Type: restic.PackFile, Name: id.String()})
+		if repo.Backend().IsNotExist(err) {
+			continue
+		}
+		if err == nil {
+			err = processPack(id, fi.Size)
+		}
+		if err != nil {
+			bar.Done()
+			return prunePlan{}, err
+		}
+	}
+	bar.Done()
+
 	// At this point indexPacks contains only missing packs!
 
 	// missing packs that are not needed can be ignored
@@ -565,10 +786,11 @@ func decidePackAction(ctx context.Context, opts PruneOptions, repo restic.Reposi
 		return prunePlan{}, errorPacksMissing
 	}
 	if len(ignorePacks) != 0 {
-		Warnf("Missing but unneeded pack files are referenced in the index, will be repaired\n")
+		msg := "Missing but unneeded pack files are referenced in the index, will be repaired\n"
 		for id := range ignorePacks {
-			Warnf("will forget missing pack file %v\n", id)
+			msg += fmt.Sprintf("will forget missing pack file %v\n", id)
 		}
+		Warningf("%s", msg)
 	}
 
 	if len(repackSmallCandidates) < 10 {
@@ -616,11 +838,16 @@ func decidePackAction(ctx context.Context, opts PruneOptions, repo restic.Reposi
 		reachedUnusedSizeAfter := (stats.size.unused-stats.size.remove-stats.size.repackrm < maxUnusedSizeAfter)
 		reachedRepackSize := stats.size.repack+p.unusedSize+p.usedSize >= opts.MaxRepackBytes
 		packIsLargeEnough := p.unusedSize+p.usedSize >= uint64(targetPackSize)
+		// with --repack-only, only the requested kinds of packs are repacked
+		selected := (opts.RepackSmall && !packIsLargeEnough) || (opts.RepackUncompressed && p.uncompressed)
 
 		switch {
 		case reachedRepackSize:
 			stats.packs.keep++
 
+		case opts.RepackOnly && !selected:
+			stats.packs.keep++
+
 		case p.tpe != restic.DataBlob, p.uncompressed:
 			// repacking non-data packs / uncompressed-trees is only limited by repackSize
 			repack(p.ID, p.packInfo)
@@ -698,7 +925,7 @@ func printPruneStats(stats pruneStats) error {
 // - rebuild the index while ignoring all files that will be deleted
 // - delete the files
 // plan.removePacks and plan.ignorePacks are modified in this function.
-func doPrune(ctx context.Context, opts PruneOptions, gopts GlobalOptions, repo restic.Repository, plan prunePlan) (err error) {
+func doPrune(ctx context.Context, opts PruneOptions, gopts GlobalOptions, repo *repository.Repository, plan prunePlan, journal *repository.OperationJournal) (err error) {
 	if opts.DryRun {
 		if !gopts.JSON && gopts.verbosity >= 2 {
 			Printf("Repeated prune dry-runs can report slightly different amounts of data to keep or repack. This is expected behavior.\n\n")
@@ -748,6 +975,20 @@ func doPrune(ctx context.Context, opts PruneOptions, gopts GlobalOptions, repo r
 		plan.ignorePacks.Merge(plan.removePacks)
 	}
 
+	// from now on an interrupted prune can be completed without repacking
+	// the packs again
+	var pending *prunePending
+	if !opts.unsafeRecovery && len(plan.repackPacks) != 0 {
+		pending = &prunePending{
+			IgnorePacks: plan.ignorePacks.List(),
+			RemovePacks: plan.removePacks.List(),
+		}
+		err = setPrunePending(journal, *pending, repo.Index().(*index.MasterIndex).IDs())
+		if err != nil {
+			Warningf("unable to save the prune journal: %v\n", err)
+		}
+	}
+
 	if opts.unsafeRecovery {
 		Verbosef("deleting index files\n")
 		indexFiles := repo.Index().(*index.MasterIndex).IDs()
@@ -756,10 +997,18 @@ func doPrune(ctx context.Context, opts PruneOptions, gopts GlobalOptions, repo r
 			return errors.Fatalf("%s", err)
 		}
 	} else if len(plan.ignorePacks) != 0 {
-		err = rebuildIndexFiles(ctx, gopts, repo, plan.ignorePacks, nil)
+		indexes, err := rebuildIndexFiles(ctx, gopts, repo, plan.ignorePacks, nil)
 		if err != nil {
 			return errors.Fatalf("%s", err)
 		}
+
+		// the journal must refer to the rebuilt index
+		if pending != nil {
+			err = setPrunePending(journal, *pending, indexes)
+			if err != nil {
+				Warningf("unable to save the prune journal: %v\n", err)
+			}
+		}
 	}
 
 	if len(plan.removePacks) != 0 {
@@ -768,39 +1017,73 @@ func doPrune(ctx context.Context, opts PruneOptions, gopts GlobalOptions, repo r
 	}
 
 	if opts.unsafeRecovery {
-		_, err = writeIndexFiles(ctx, gopts, repo, plan.ignorePacks, nil)
+		_, _, err = writeIndexFiles(ctx, gopts, repo, plan.ignorePacks, nil)
 		if err != nil {
 			return errors.Fatalf("%s", err)
 		}
 	}
 
+	if err := journal.Finish(); err != nil {
+		Warningf("unable to remove the prune journal: %v\n", err)
+	}
+
+	if opts.RecordStats {
+		if err := saveStatsRecord(repo, plan.snapshots, "prune", "", plan.ignorePacks); err != nil {
+			Warningf("unable to save statistics record: %v\n", err)
+		}
+	}
+
 	Verbosef("done\n")
 	return nil
 }
 
-func writeIndexFiles(ctx context.Context, gopts GlobalOptions, repo restic.Repository, removePacks restic.IDSet, extraObsolete restic.IDs) (restic.IDSet, error) {
+// indexSaver records the IDs of the index files saved by the wrapped
+// repository.
+type indexSaver struct {
+	restic.Repository
+
+	m   sync.Mutex
+	ids restic.IDSet
+}
+
+func (s *indexSaver) SaveUnpacked(ctx context.Context, t restic.FileType, buf []byte) (restic.ID, error) {
+	id, err := s.Repository.SaveUnpacked(ctx, t, buf)
+	if err == nil && t == restic.IndexFile {
+		s.m.Lock()
+		s.ids.Insert(id)
+		s.m.Unlock()
+	}
+	return id, err
+}
+
+// writeIndexFiles saves a new index without removePacks and returns the
+// obsolete as well as the new index files.
+func writeIndexFiles(ctx context.Context, gopts GlobalOptions, repo restic.Repository, removePacks restic.IDSet, extraObsolete restic.IDs) (obsolete restic.IDSet, created restic.IDSet, err error) {
 	Verbosef("rebuilding index\n")
 
+	saver := &indexSaver{Repository: repo, ids: restic.NewIDSet()}
 	bar := newProgressMax(!gopts.Quiet, 0, "packs processed")
-	obsoleteIndexes, err := repo.Index().Save(ctx, repo, removePacks, extraObsolete, bar)
+	obsoleteIndexes, err := repo.Index().Save(ctx, saver, removePacks, extraObsolete, bar)
 	bar.Done()
-	return obsoleteIndexes, err
+	return obsoleteIndexes, saver.ids, err
 }
 
-func rebuildIndexFiles(ctx context.Context, gopts GlobalOptions, repo restic.Repository, removePacks restic.IDSet, extraObsolete restic.IDs) error {
-	obsoleteIndexes, err := writeIndexFiles(ctx, gopts, repo, removePacks, extraObsolete)
+// rebuildIndexFiles replaces the index by one without removePacks and
+// returns the IDs of the new index files.
+func rebuildIndexFiles(ctx context.Context, gopts GlobalOptions, repo restic.Repository, removePacks restic.IDSet, extraObsolete restic.IDs) (restic.IDSet, error) {
+	obsoleteIndexes, created, err := writeIndexFiles(ctx, gopts, repo, removePacks, extraObsolete)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	Verbosef("deleting obsolete index files\n")
-	return DeleteFilesChecked(ctx, gopts, repo, obsoleteIndexes, restic.IndexFile)
+	return created, DeleteFilesChecked(ctx, gopts, repo, obsoleteIndexes, restic.IndexFile)
 }
 
-func getUsedBlobs(ctx context.Context, repo restic.Repository, ignoreSnapshots restic.IDSet, quiet bool) (usedBlobs restic.CountedBlobSet, err error) {
+func getUsedBlobs(ctx context.Context, repo restic.Repository, snapshotLister restic.Lister, ignoreSnapshots restic.IDSet, quiet bool) (usedBlobs restic.CountedBlobSet, snapshots uint, err error) {
 	var snapshotTrees restic.IDs
 	Verbosef("loading all snapshots...\n")
-	err = restic.ForAllSnapshots(ctx, repo.Backend(), repo, ignoreSnapshots,
+	err = restic.ForAllSnapshots(ctx, snapshotLister, repo, ignoreSnapshots,
 		func(id restic.ID, sn *restic.Snapshot, err error) error {
 			if err != nil {
 				debug.Log("failed to load snapshot %v (error %v)", id, err)
@@ -811,7 +1094,7 @@ func getUsedBlobs(ctx context.Context, repo restic.Repository, ignoreSnapshots r
 			return nil
 		})
 	if err != nil {
-		return nil, errors.Fatalf("failed loading snapshot: %v", err)
+		return nil, 0, errors.Fatalf("failed loading snapshot: %v", err)
 	}
 
 	Verbosef("finding data that is still in use for %d snapshots\n", len(snapshotTrees))
@@ -824,10 +1107,10 @@ func getUsedBlobs(ctx context.Context, repo restic.Repository, ignoreSnapshots r
 	err = restic.FindUsedBlobs(ctx, repo, snapshotTrees, usedBlobs, bar)
 	if err != nil {
 		if repo.Backend().IsNotExist(err) {
-			return nil, errors.Fatal("unable to load a tree from the repository: " + err.Error())
+			return nil, 0, errors.Fatal("unable to load a tree from the repository: " + err.Error())
 		}
 
-		return nil, err
+		return nil, 0, err
 	}
-	return usedBlobs, nil
+	return usedBlobs, uint(len(snapshotTrees)), nil
 }
@@ -78,7 +78,7 @@ func rebuildIndex(ctx context.Context, opts RebuildIndexOptions, gopts GlobalOpt
 		mi := index.NewMasterIndex()
 		err := index.ForAllIndexes(ctx, repo, func(id restic.ID, idx *index.Index, oldFormat bool, err error) error {
 			if err != nil {
-				Warnf("removing invalid index %v: %v\n", id, err)
+				Warningf("removing invalid index %v: %v\n", id, err)
 				obsoleteIndexes = append(obsoleteIndexes, id)
 				return nil
 			}
@@ -111,9 +111,9 @@ func rebuildIndex(ctx context.Context, opts RebuildIndexOptions, gopts GlobalOpt
 			removePacks.Insert(id)
 		}
 		if !ok {
-			Warnf("adding pack file to index %v\n", id)
+			Warningf("adding pack file to index %v\n", id)
 		} else if size != packSize {
-			Warnf("reindexing pack file %v with unexpected size %v instead of %v\n", id, packSize, size)
+			Warningf("reindexing pack file %v with unexpected size %v instead of %v\n", id, packSize, size)
 		}
 		delete(packSizeFromIndex, id)
 		return nil
@@ -125,7 +125,7 @@ func rebuildIndex(ctx context.Context, opts RebuildIndexOptions, gopts GlobalOpt
 		// forget pack files that are referenced in the index but do not exist
 		// when rebuilding the index
 		removePacks.Insert(id)
-		Warnf("removing not found pack file %v\n", id)
+		Warningf("removing not found pack file %v\n", id)
 	}
 
 	if len(packSizeFromList) > 0 {
@@ -142,7 +142,7 @@ func rebuildIndex(ctx context.Context, opts RebuildIndexOptions, gopts GlobalOpt
 		}
 	}
 
-	err = rebuildIndexFiles(ctx, gopts, repo, removePacks, obsoleteIndexes)
+	_, err = rebuildIndexFiles(ctx, gopts, repo, removePacks, obsoleteIndexes)
 	if err != nil {
 		return err
 	}
@@ -77,7 +77,7 @@ func runRecover(ctx context.Context, gopts GlobalOptions) error {
 	for id := range trees {
 		tree, err := restic.LoadTree(ctx, repo, id)
 		if err != nil {
-			Warnf("unable to load tree %v: %v\n", id.Str(), err)
+			Warningf("unable to load tree %v: %v\n", id.Str(), err)
 			continue
 		}
 
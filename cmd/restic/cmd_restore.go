@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"runtime"
 	"strings"
 	"time"
 
@@ -22,7 +23,34 @@ The "restore" command extracts the data from a snapshot from the repository to
 a directory.
 
 The special snapshot "latest" can be used to restore the latest snapshot in the
-repository.
+repository, "latest~n" restores the n-th snapshot before the latest one. A time
+range like "2024-01-01..2024-02-01" restores the latest snapshot in that range.
+
+By default, files already present in the target directory are overwritten. Use
+"--overwrite" to only replace files whose content differs from the snapshot
+("if-changed"), files which are older than the one in the snapshot
+("if-newer"), or to keep all existing files ("never"). With "--keep-both",
+files which would replace an existing file are restored next to it instead.
+
+Device nodes and unix sockets are only restored with "--allow-special". Sockets
+are restored as placeholders which no process listens on. Like files, special
+files only replace existing files as permitted by "--overwrite".
+
+To reduce the impact of a restore on other workloads, "--limit-restore-write"
+paces the writes to the restored files and the global option
+"--limit-download" limits the downloads from the repository.
+
+Files are preallocated to their final size before their content is written.
+With "--direct-io", the content is written bypassing the page cache of the
+operating system (Linux only), so that restoring large files does not evict the
+cached data of other processes. Files on filesystems which do not support
+direct I/O are written as usual.
+
+On Windows, "--skip-zero-fill" marks preallocated files as valid data, so that
+Windows does not fill them with zeros first. This requires the
+SeManageVolumePrivilege. If the restore fails or is interrupted, the parts of
+a file which were not restored yet contain stale data from the disk, which may
+belong to other, deleted files.
 
 EXIT STATUS
 ===========
@@ -43,8 +71,14 @@ type RestoreOptions struct {
 	InsensitiveInclude []string
 	Target             string
 	snapshotFilterOptions
-	Sparse bool
-	Verify bool
+	Sparse       bool
+	Verify       bool
+	Overwrite    restorer.OverwriteBehavior
+	KeepBoth     bool
+	AllowSpecial bool
+	LimitWriteKb int
+	DirectIO     bool
+	ValidData    bool
 }
 
 var restoreOptions RestoreOptions
@@ -62,6 +96,12 @@ func init() {
 	initSingleSnapshotFilterOptions(flags, &restoreOptions.snapshotFilterOptions)
 	flags.BoolVar(&restoreOptions.Sparse, "sparse", false, "restore files as sparse")
 	flags.BoolVar(&restoreOptions.Verify, "verify", false, "verify restored files content")
+	flags.Var(&restoreOptions.Overwrite, "overwrite", "overwrite behavior for existing files, one of (always|if-changed|if-newer|never)")
+	flags.BoolVar(&restoreOptions.KeepBoth, "keep-both", false, "restore files which would replace an existing file next to it with a \".restored\" suffix")
+	flags.BoolVar(&restoreOptions.AllowSpecial, "allow-special", false, "restore device nodes and unix sockets")
+	flags.BoolVar(&restoreOptions.DirectIO, "direct-io", false, "write restored files bypassing the page cache (Linux only)")
+	flags.BoolVar(&restoreOptions.ValidData, "skip-zero-fill", false, "do not let the filesystem zero-fill preallocated files, unrestored parts expose stale disk contents (Windows only)")
+	flags.IntVar(&restoreOptions.LimitWriteKb, "limit-restore-write", 0, "limits writes to restored files to a maximum `rate` in KiB/s. (default: unlimited)")
 }
 
 func runRestore(ctx context.Context, opts RestoreOptions, gopts GlobalOptions, args []string) error {
@@ -113,6 +153,17 @@ func runRestore(ctx context.Context, opts RestoreOptions, gopts GlobalOptions, a
 		return errors.Fatal("exclude and include patterns are mutually exclusive")
 	}
 
+	if opts.KeepBoth && opts.Overwrite == restorer.OverwriteNever {
+		return errors.Fatal("--keep-both cannot be combined with --overwrite=never")
+	}
+
+	if opts.DirectIO && runtime.GOOS != "linux" {
+		return errors.Fatal("--direct-io is only supported on Linux")
+	}
+	if opts.ValidData && runtime.GOOS != "windows" {
+		return errors.Fatal("--skip-zero-fill is only supported on Windows")
+	}
+
 	snapshotIDString := args[0]
 
 	debug.Log("restore %v to %v", snapshotIDString, opts.Target)
@@ -131,7 +182,7 @@ func runRestore(ctx context.Context, opts RestoreOptions, gopts GlobalOptions, a
 		}
 	}
 
-	sn, err := restic.FindFilteredSnapshot(ctx, repo.Backend(), repo, opts.Hosts, opts.Tags, opts.Paths, nil, snapshotIDString)
+	sn, err := findFilteredSnapshot(ctx, repo.Backend(), repo, &opts.snapshotFilterOptions, snapshotIDString)
 	if err != nil {
 		return errors.Fatalf("failed to find snapshot: %v", err)
 	}
@@ -141,7 +192,22 @@ func runRestore(ctx context.Context, opts RestoreOptions, gopts GlobalOptions, a
 		return err
 	}
 
-	res := restorer.NewRestorer(ctx, repo, sn, opts.Sparse)
+	// read the pack files one disk after another
+	packLocation, err := mediaPackLocation(gopts)
+	if err != nil {
+		return err
+	}
+
+	res := restorer.NewRestorer(ctx, repo, sn, restorer.Options{
+		Sparse:       opts.Sparse,
+		Overwrite:    opts.Overwrite,
+		KeepBoth:     opts.KeepBoth,
+		AllowSpecial: opts.AllowSpecial,
+		WriteLimitKb: opts.LimitWriteKb,
+		DirectIO:     opts.DirectIO,
+		ValidData:    opts.ValidData,
+		PackLocation: packLocation,
+	})
 
 	totalErrors := 0
 	res.Error = func(location string, err error) error {
@@ -205,6 +271,10 @@ func runRestore(ctx context.Context, opts RestoreOptions, gopts GlobalOptions, a
 		return err
 	}
 
+	if n := res.SkippedSpecial(); n > 0 {
+		Warningf("skipped %d device nodes and sockets, use --allow-special to restore them\n", n)
+	}
+
 	if totalErrors > 0 {
 		return errors.Fatalf("There were %d errors\n", totalErrors)
 	}
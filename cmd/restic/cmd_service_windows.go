@@ -0,0 +1,453 @@
+//go:build windows
+// +build windows
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+	"unsafe"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/sys/windows"
+	"golang.org/x/sys/windows/svc"
+	svcdebug "golang.org/x/sys/windows/svc/debug"
+	"golang.org/x/sys/windows/svc/eventlog"
+	"golang.org/x/sys/windows/svc/mgr"
+
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
+)
+
+var cmdService = &cobra.Command{
+	Use:   "service [flags] [install|uninstall|run] [-- restic arguments]",
+	Short: "Run scheduled backups as a Windows service",
+	Long: `
+The "service" command registers restic as a Windows service which runs the
+given restic command at a fixed interval, for example:
+
+    restic service install --interval 24h -- --repository-file C:\restic\repo.txt --password-file C:\restic\password.txt backup --use-fs-snapshot C:\Users
+
+The service runs with SYSTEM privileges and without the environment of the
+installing user, thus the repository and the password must be passed as
+arguments. The start and the result of each run are reported to the Windows
+Event Log using the service name as the event source.
+
+The "uninstall" subcommand removes the service and the event source. The "run"
+subcommand is invoked by the service control manager; when started from an
+interactive session it runs in the foreground and logs to the console.
+
+Stopping the service interrupts a running command like Ctrl-C does, the
+command removes its locks before the service reports that it has stopped.
+
+EXIT STATUS
+===========
+
+Exit status is 0 if the command was successful, and non-zero if there was any error.
+`,
+	DisableAutoGenTag: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runService(cmd.Context(), serviceOptions, args)
+	},
+}
+
+// ServiceOptions bundles all options for the service command.
+type ServiceOptions struct {
+	Name     string
+	Interval time.Duration
+}
+
+var serviceOptions ServiceOptions
+
+func init() {
+	cmdRoot.AddCommand(cmdService)
+
+	f := cmdService.Flags()
+	f.StringVar(&serviceOptions.Name, "name", "restic", "`name` of the service and of the event log source")
+	f.DurationVar(&serviceOptions.Interval, "interval", 24*time.Hour, "run the command every `duration`")
+
+	watchServiceStop()
+}
+
+// serviceStopEnv is the environment variable which passes the handle of the
+// stop event to the commands run by the service. The commands stop as if
+// interrupted by Ctrl-C once the event is signalled.
+const serviceStopEnv = "RESTIC_SERVICE_STOP_EVENT"
+
+// serviceStopTimeout is the time a command has to finish after the service
+// was asked to stop, afterwards it is killed.
+const serviceStopTimeout = 30 * time.Second
+
+// watchServiceStop interrupts the current command when the stop event passed
+// by the service is signalled.
+func watchServiceStop() {
+	v := os.Getenv(serviceStopEnv)
+	if v == "" {
+		return
+	}
+	h, err := strconv.ParseUint(v, 10, 64)
+	if err != nil {
+		debug.Log("invalid %v %q: %v", serviceStopEnv, v, err)
+		return
+	}
+	go waitServiceStop(windows.Handle(h), cleanupHandlers.ch)
+}
+
+// waitServiceStop sends SIGINT to ch once the event stop is signalled.
+func waitServiceStop(stop windows.Handle, ch chan<- os.Signal) {
+	ev, err := windows.WaitForSingleObject(stop, windows.INFINITE)
+	if err != nil || ev != windows.WAIT_OBJECT_0 {
+		debug.Log("waiting for the service stop event failed: %v", err)
+		return
+	}
+	ch <- syscall.SIGINT
+}
+
+// Event IDs reported to the Windows Event Log.
+const (
+	eventServiceStarted  uint32 = 1
+	eventServiceStopped  uint32 = 2
+	eventRunStarted      uint32 = 10
+	eventRunSucceeded    uint32 = 11
+	eventRunIncomplete   uint32 = 12
+	eventRunFailed       uint32 = 13
+	eventServiceInternal uint32 = 20
+)
+
+// maxEventOutput limits the amount of command output included in an event,
+// the event log rejects messages larger than about 32 KiB.
+const maxEventOutput = 16 * 1024
+
+func runService(ctx context.Context, opts ServiceOptions, args []string) error {
+	subcommand, cmdArgs, err := parseServiceArgs(opts, args)
+	if err != nil {
+		return err
+	}
+
+	switch subcommand {
+	case "install":
+		return installService(opts, cmdArgs)
+	case "uninstall":
+		return uninstallService(opts)
+	default:
+		return runServiceHandler(ctx, opts, cmdArgs)
+	}
+}
+
+// parseServiceArgs validates the options and splits args into the
+// subcommand and the arguments of the restic command run by the service.
+func parseServiceArgs(opts ServiceOptions, args []string) (subcommand string, cmdArgs []string, err error) {
+	if len(args) == 0 {
+		return "", nil, errors.Fatal("no subcommand specified, use install, uninstall or run")
+	}
+	if opts.Name == "" {
+		return "", nil, errors.Fatal("--name must not be empty")
+	}
+	if opts.Interval <= 0 {
+		return "", nil, errors.Fatal("--interval must be positive")
+	}
+
+	switch args[0] {
+	case "install", "run":
+		if len(args) < 2 {
+			return "", nil, errors.Fatal("no restic command to run specified")
+		}
+		return args[0], args[1:], nil
+	case "uninstall":
+		if len(args) != 1 {
+			return "", nil, errors.Fatal("wrong number of arguments")
+		}
+		return args[0], nil, nil
+	default:
+		return "", nil, errors.Fatalf("invalid subcommand %q", args[0])
+	}
+}
+
+// serviceConfig returns the configuration of the service and the arguments
+// passed to restic by the service control manager, which start the "run"
+// subcommand with the same options.
+func serviceConfig(opts ServiceOptions, cmdArgs []string) (mgr.Config, []string) {
+	svcArgs := append([]string{"service", "run", "--name", opts.Name, "--interval", opts.Interval.String(), "--"}, cmdArgs...)
+	cfg := mgr.Config{
+		StartType:   mgr.StartAutomatic,
+		DisplayName: fmt.Sprintf("restic (%s)", opts.Name),
+		Description: fmt.Sprintf("Runs \"restic %s\" every %v", strings.Join(cmdArgs, " "), opts.Interval),
+	}
+	return cfg, svcArgs
+}
+
+func installService(opts ServiceOptions, cmdArgs []string) error {
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+
+	m, err := mgr.Connect()
+	if err != nil {
+		return errors.Fatalf("unable to connect to the service manager: %v", err)
+	}
+	defer func() {
+		_ = m.Disconnect()
+	}()
+
+	s, err := m.OpenService(opts.Name)
+	if err == nil {
+		_ = s.Close()
+		return errors.Fatalf("service %q already exists", opts.Name)
+	}
+
+	cfg, svcArgs := serviceConfig(opts, cmdArgs)
+	s, err = m.CreateService(opts.Name, exe, cfg, svcArgs...)
+	if err != nil {
+		return errors.Fatalf("unable to create service: %v", err)
+	}
+	defer func() {
+		_ = s.Close()
+	}()
+
+	err = eventlog.InstallAsEventCreate(opts.Name, eventlog.Error|eventlog.Warning|eventlog.Info)
+	if err != nil {
+		_ = s.Delete()
+		return errors.Fatalf("unable to register event log source: %v", err)
+	}
+
+	Verbosef("installed service %q\n", opts.Name)
+	return nil
+}
+
+func uninstallService(opts ServiceOptions) error {
+	m, err := mgr.Connect()
+	if err != nil {
+		return errors.Fatalf("unable to connect to the service manager: %v", err)
+	}
+	defer func() {
+		_ = m.Disconnect()
+	}()
+
+	s, err := m.OpenService(opts.Name)
+	if err != nil {
+		return errors.Fatalf("service %q is not installed", opts.Name)
+	}
+	defer func() {
+		_ = s.Close()
+	}()
+
+	err = s.Delete()
+	if err != nil {
+		return errors.Fatalf("unable to delete service: %v", err)
+	}
+
+	err = eventlog.Remove(opts.Name)
+	if err != nil {
+		Warningf("unable to remove event log source: %v\n", err)
+	}
+
+	Verbosef("removed service %q\n", opts.Name)
+	return nil
+}
+
+func runServiceHandler(ctx context.Context, opts ServiceOptions, cmdArgs []string) error {
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+
+	isService, err := svc.IsWindowsService()
+	if err != nil {
+		return err
+	}
+
+	// the event is inherited by the commands, it is signalled to stop them
+	sa := &windows.SecurityAttributes{InheritHandle: 1}
+	sa.Length = uint32(unsafe.Sizeof(*sa))
+	stop, err := windows.CreateEvent(sa, 1, 0, nil)
+	if err != nil {
+		return errors.Wrap(err, "CreateEvent")
+	}
+	defer func() {
+		_ = windows.CloseHandle(stop)
+	}()
+
+	h := &serviceHandler{
+		ctx:      ctx,
+		stop:     stop,
+		exe:      exe,
+		args:     cmdArgs,
+		interval: opts.Interval,
+	}
+
+	if !isService {
+		h.log = svcdebug.New(opts.Name)
+		return svcdebug.Run(opts.Name, h)
+	}
+
+	elog, err := eventlog.Open(opts.Name)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = elog.Close()
+	}()
+	h.log = elog
+
+	return svc.Run(opts.Name, h)
+}
+
+// serviceHandler runs a restic command periodically and reports the results
+// to log.
+type serviceHandler struct {
+	ctx      context.Context
+	stop     windows.Handle
+	log      svcdebug.Log
+	exe      string
+	args     []string
+	interval time.Duration
+}
+
+// Execute implements svc.Handler.
+func (h *serviceHandler) Execute(_ []string, r <-chan svc.ChangeRequest, changes chan<- svc.Status) (bool, uint32) {
+	const accepted = svc.AcceptStop | svc.AcceptShutdown
+	changes <- svc.Status{State: svc.StartPending}
+
+	ctx, cancel := context.WithCancel(h.ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		h.schedule(ctx)
+	}()
+
+	changes <- svc.Status{State: svc.Running, Accepts: accepted}
+	_ = h.log.Info(eventServiceStarted, fmt.Sprintf("service started, running \"restic %s\" every %v",
+		strings.Join(h.args, " "), h.interval))
+
+loop:
+	for c := range r {
+		switch c.Cmd {
+		case svc.Interrogate:
+			changes <- c.CurrentStatus
+		case svc.Stop, svc.Shutdown:
+			break loop
+		default:
+			_ = h.log.Warning(eventServiceInternal, fmt.Sprintf("unexpected control request #%d", c.Cmd))
+		}
+	}
+
+	changes <- svc.Status{State: svc.StopPending, WaitHint: uint32(serviceStopTimeout / time.Millisecond)}
+	cancel()
+	// wait until the command has removed its locks
+	<-done
+
+	_ = h.log.Info(eventServiceStopped, "service stopped")
+	return false, 0
+}
+
+// schedule runs the command once and then every interval until ctx is
+// cancelled.
+func (h *serviceHandler) schedule(ctx context.Context) {
+	ticker := time.NewTicker(h.interval)
+	defer ticker.Stop()
+
+	for {
+		h.runOnce(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (h *serviceHandler) runOnce(ctx context.Context) {
+	_ = h.log.Info(eventRunStarted, fmt.Sprintf("running \"restic %s\"", strings.Join(h.args, " ")))
+
+	start := time.Now()
+	out := &tailBuffer{max: maxEventOutput}
+	cmd := exec.Command(h.exe, h.args...)
+	cmd.Stdout = out
+	cmd.Stderr = out
+	cmd.Env = append(os.Environ(), fmt.Sprintf("%s=%d", serviceStopEnv, h.stop))
+	cmd.SysProcAttr = &syscall.SysProcAttr{AdditionalInheritedHandles: []syscall.Handle{syscall.Handle(h.stop)}}
+
+	err := cmd.Start()
+	if err == nil {
+		err = h.wait(ctx, cmd)
+	}
+	if ctx.Err() != nil {
+		// the service is shutting down, the result is meaningless
+		return
+	}
+
+	msg := fmt.Sprintf("\"restic %s\" finished after %v", strings.Join(h.args, " "), time.Since(start).Round(time.Second))
+	if output := out.String(); output != "" {
+		msg += "\n\n" + output
+	}
+
+	h.report(err, msg)
+}
+
+// wait waits for cmd to finish. If ctx is cancelled, cmd is stopped via the
+// stop event, which lets it remove its locks. It is killed if it does not
+// finish within serviceStopTimeout.
+func (h *serviceHandler) wait(ctx context.Context, cmd *exec.Cmd) error {
+	done := make(chan error, 1)
+	go func() {
+		done <- cmd.Wait()
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+	}
+
+	if err := windows.SetEvent(h.stop); err != nil {
+		_ = h.log.Warning(eventServiceInternal, fmt.Sprintf("unable to stop the command: %v", err))
+	}
+	select {
+	case err := <-done:
+		return err
+	case <-time.After(serviceStopTimeout):
+		_ = h.log.Warning(eventServiceInternal, fmt.Sprintf("command did not stop within %v, killing it", serviceStopTimeout))
+		_ = cmd.Process.Kill()
+		return <-done
+	}
+}
+
+// report logs the result err of a run with the message msg.
+func (h *serviceHandler) report(err error, msg string) {
+	var exitErr *exec.ExitError
+	switch {
+	case err == nil:
+		_ = h.log.Info(eventRunSucceeded, msg)
+	case errors.As(err, &exitErr) && exitErr.ExitCode() == 3:
+		_ = h.log.Warning(eventRunIncomplete, msg)
+	default:
+		_ = h.log.Error(eventRunFailed, fmt.Sprintf("%s\n\nerror: %v", msg, err))
+	}
+}
+
+// tailBuffer keeps the last max bytes written to it.
+type tailBuffer struct {
+	buf bytes.Buffer
+	max int
+}
+
+func (b *tailBuffer) Write(p []byte) (int, error) {
+	n, _ := b.buf.Write(p)
+	if b.buf.Len() > b.max {
+		b.buf.Next(b.buf.Len() - b.max)
+	}
+	return n, nil
+}
+
+func (b *tailBuffer) String() string {
+	return b.buf.String()
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"golang.org/x/sys/windows"
+	"golang.org/x/sys/windows/svc/mgr"
+
+	"github.com/restic/restic/internal/errors"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func TestParseServiceArgs(t *testing.T) {
+	opts := ServiceOptions{Name: "restic", Interval: time.Hour}
+
+	for _, test := range []struct {
+		opts       ServiceOptions
+		args       []string
+		subcommand string
+		cmdArgs    []string
+		err        string
+	}{
+		{opts, []string{"install", "backup", `C:\Users`}, "install", []string{"backup", `C:\Users`}, ""},
+		{opts, []string{"run", "--repo", `D:\repo`, "check"}, "run", []string{"--repo", `D:\repo`, "check"}, ""},
+		{opts, []string{"uninstall"}, "uninstall", nil, ""},
+		{opts, nil, "", nil, "no subcommand specified"},
+		{opts, []string{"install"}, "", nil, "no restic command"},
+		{opts, []string{"run"}, "", nil, "no restic command"},
+		{opts, []string{"uninstall", "backup"}, "", nil, "wrong number of arguments"},
+		{opts, []string{"start"}, "", nil, "invalid subcommand"},
+		{ServiceOptions{Name: "restic"}, []string{"install", "backup"}, "", nil, "--interval must be positive"},
+		{ServiceOptions{Interval: time.Hour}, []string{"uninstall"}, "", nil, "--name must not be empty"},
+	} {
+		t.Run(strings.Join(test.args, " "), func(t *testing.T) {
+			subcommand, cmdArgs, err := parseServiceArgs(test.opts, test.args)
+			if test.err != "" {
+				rtest.Assert(t, err != nil && strings.Contains(err.Error(), test.err),
+					"expected error containing %q, got %v", test.err, err)
+				rtest.Assert(t, errors.IsFatal(err), "error %v is not fatal", err)
+				return
+			}
+			rtest.OK(t, err)
+			rtest.Equals(t, test.subcommand, subcommand)
+			rtest.Equals(t, test.cmdArgs, cmdArgs)
+		})
+	}
+}
+
+func TestServiceConfig(t *testing.T) {
+	opts := ServiceOptions{Name: "nightly", Interval: 6 * time.Hour}
+	cmdArgs := []string{"--password-file", `C:\restic\password.txt`, "backup", `C:\Users`}
+
+	cfg, svcArgs := serviceConfig(opts, cmdArgs)
+	rtest.Equals(t, uint32(mgr.StartAutomatic), cfg.StartType)
+	rtest.Equals(t, "restic (nightly)", cfg.DisplayName)
+	rtest.Equals(t, `Runs "restic --password-file C:\restic\password.txt backup C:\Users" every 6h0m0s`, cfg.Description)
+
+	// the service control manager starts the run subcommand with the same
+	// options
+	rtest.Equals(t, []string{"service", "run", "--name", "nightly", "--interval", "6h0m0s", "--",
+		"--password-file", `C:\restic\password.txt`, "backup", `C:\Users`}, svcArgs)
+
+	defer func(saved ServiceOptions) {
+		serviceOptions = saved
+	}(serviceOptions)
+	f := cmdService.Flags()
+	rtest.OK(t, f.Parse(svcArgs[1:]))
+	rtest.Equals(t, opts, serviceOptions)
+
+	subcommand, args, err := parseServiceArgs(serviceOptions, f.Args())
+	rtest.OK(t, err)
+	rtest.Equals(t, "run", subcommand)
+	rtest.Equals(t, cmdArgs, args)
+}
+
+type testEventLog struct {
+	ids  []uint32
+	msgs []string
+}
+
+func (l *testEventLog) log(eid uint32, msg string) error {
+	l.ids = append(l.ids, eid)
+	l.msgs = append(l.msgs, msg)
+	return nil
+}
+
+func (l *testEventLog) Close() error                         { return nil }
+func (l *testEventLog) Info(eid uint32, msg string) error    { return l.log(eid, msg) }
+func (l *testEventLog) Warning(eid uint32, msg string) error { return l.log(eid, msg) }
+func (l *testEventLog) Error(eid uint32, msg string) error   { return l.log(eid, msg) }
+
+func TestServiceReport(t *testing.T) {
+	log := &testEventLog{}
+	h := &serviceHandler{log: log}
+
+	h.report(nil, "ok")
+	h.report(exec.Command("cmd", "/c", "exit 3").Run(), "incomplete")
+	h.report(exec.Command("cmd", "/c", "exit 1").Run(), "failed")
+
+	rtest.Equals(t, []uint32{eventRunSucceeded, eventRunIncomplete, eventRunFailed}, log.ids)
+	rtest.Assert(t, strings.HasPrefix(log.msgs[2], "failed\n\nerror: "), "unexpected message %q", log.msgs[2])
+}
+
+func TestTailBuffer(t *testing.T) {
+	b := &tailBuffer{max: 8}
+	n, err := b.Write([]byte("0123456789"))
+	rtest.OK(t, err)
+	rtest.Equals(t, 10, n)
+	_, _ = b.Write([]byte("ab"))
+	rtest.Equals(t, "456789ab", b.String())
+}
+
+func TestWaitServiceStop(t *testing.T) {
+	stop, err := windows.CreateEvent(nil, 1, 0, nil)
+	rtest.OK(t, err)
+	defer func() {
+		_ = windows.CloseHandle(stop)
+	}()
+
+	ch := make(chan os.Signal, 1)
+	go waitServiceStop(stop, ch)
+
+	select {
+	case s := <-ch:
+		t.Fatalf("unexpected signal %v before the stop event was signalled", s)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	rtest.OK(t, windows.SetEvent(stop))
+	select {
+	case s := <-ch:
+		rtest.Equals(t, os.Signal(syscall.SIGINT), s)
+	case <-time.After(5 * time.Second):
+		t.Fatal("no signal after the stop event was signalled")
+	}
+}
@@ -9,6 +9,7 @@ import (
 	"strings"
 
 	"github.com/restic/restic/internal/restic"
+	"github.com/restic/restic/internal/ui"
 	"github.com/restic/restic/internal/ui/table"
 	"github.com/spf13/cobra"
 )
@@ -19,6 +20,16 @@ var cmdSnapshots = &cobra.Command{
 	Long: `
 The "snapshots" command lists all snapshots stored in the repository.
 
+With --details, the statistics recorded by the backup which created each
+snapshot are shown, such as the number of new and changed files, the amount of
+data added to the repository, the duration and the number of errors. Snapshots
+created by older versions of restic do not contain these statistics.
+
+Snapshots whose content may be inconsistent, for example because a filesystem
+snapshot was deleted while the backup read from it, are marked as suspect.
+The reason is shown with --details and in the "suspect" field of the JSON
+output.
+
 EXIT STATUS
 ===========
 
@@ -34,6 +45,7 @@ Exit status is 0 if the command was successful, and non-zero if there was any er
 type SnapshotOptions struct {
 	snapshotFilterOptions
 	Compact bool
+	Details bool
 	Last    bool // This option should be removed in favour of Latest.
 	Latest  int
 	GroupBy string
@@ -47,6 +59,7 @@ func init() {
 	f := cmdSnapshots.Flags()
 	initMultiSnapshotFilterOptions(f, &snapshotOptions.snapshotFilterOptions, true)
 	f.BoolVarP(&snapshotOptions.Compact, "compact", "c", false, "use compact output format")
+	f.BoolVar(&snapshotOptions.Details, "details", false, "show the statistics of the backup which created each snapshot")
 	f.BoolVar(&snapshotOptions.Last, "last", false, "only show the last snapshot for each host and path")
 	err := f.MarkDeprecated("last", "use --latest 1")
 	if err != nil {
@@ -58,6 +71,10 @@ func init() {
 }
 
 func runSnapshots(ctx context.Context, opts SnapshotOptions, gopts GlobalOptions, args []string) error {
+	if err := opts.validate(args); err != nil {
+		return err
+	}
+
 	repo, err := OpenRepository(ctx, gopts)
 	if err != nil {
 		return err
@@ -73,7 +90,7 @@ func runSnapshots(ctx context.Context, opts SnapshotOptions, gopts GlobalOptions
 	}
 
 	var snapshots restic.Snapshots
-	for sn := range FindFilteredSnapshots(ctx, repo.Backend(), repo, opts.Hosts, opts.Tags, opts.Paths, args) {
+	for sn := range FindFilteredSnapshots(ctx, repo.Backend(), repo, &opts.snapshotFilterOptions, args) {
 		snapshots = append(snapshots, sn)
 	}
 	snapshotGroups, grouped, err := restic.GroupSnapshots(snapshots, opts.GroupBy)
@@ -109,7 +126,11 @@ func runSnapshots(ctx context.Context, opts SnapshotOptions, gopts GlobalOptions
 				return nil
 			}
 		}
-		PrintSnapshots(gopts.stdout, list, nil, opts.Compact)
+		if opts.Details {
+			PrintSnapshotDetails(gopts.stdout, list)
+		} else {
+			PrintSnapshots(gopts.stdout, list, nil, opts.Compact)
+		}
 	}
 
 	return nil
@@ -171,7 +192,11 @@ func PrintSnapshots(stdout io.Writer, list restic.Snapshots, reasons []restic.Ke
 
 	// Determine the max widths for host and tag.
 	maxHost, maxTag := 10, 6
+	suspect := 0
 	for _, sn := range list {
+		if sn.Suspect != "" {
+			suspect++
+		}
 		if len(sn.Hostname) > maxHost {
 			maxHost = len(sn.Hostname)
 		}
@@ -189,6 +214,9 @@ func PrintSnapshots(stdout io.Writer, list restic.Snapshots, reasons []restic.Ke
 		tab.AddColumn("Time", "{{ .Timestamp }}")
 		tab.AddColumn("Host", "{{ .Hostname }}")
 		tab.AddColumn("Tags  ", `{{ join .Tags "\n" }}`)
+		if suspect > 0 {
+			tab.AddColumn("Suspect", "{{ .Suspect }}")
+		}
 	} else {
 		tab.AddColumn("ID", "{{ .ID }}")
 		tab.AddColumn("Time", "{{ .Timestamp }}")
@@ -197,6 +225,9 @@ func PrintSnapshots(stdout io.Writer, list restic.Snapshots, reasons []restic.Ke
 		if len(reasons) > 0 {
 			tab.AddColumn("Reasons", `{{ join .Reasons "\n" }}`)
 		}
+		if suspect > 0 {
+			tab.AddColumn("Suspect", "{{ .Suspect }}")
+		}
 		tab.AddColumn("Paths", `{{ join .Paths "\n" }}`)
 	}
 
@@ -206,6 +237,7 @@ func PrintSnapshots(stdout io.Writer, list restic.Snapshots, reasons []restic.Ke
 		Hostname  string
 		Tags      []string
 		Reasons   []string
+		Suspect   string
 		Paths     []string
 	}
 
@@ -224,6 +256,11 @@ func PrintSnapshots(stdout io.Writer, list restic.Snapshots, reasons []restic.Ke
 			data.Reasons = keepReasons[*id].Matches
 		}
 
+		// the reason is shown by --details
+		if sn.Suspect != "" {
+			data.Suspect = "yes"
+		}
+
 		if len(sn.Paths) > 1 && !compact {
 			multiline = true
 		}
@@ -231,7 +268,11 @@ func PrintSnapshots(stdout io.Writer, list restic.Snapshots, reasons []restic.Ke
 		tab.AddRow(data)
 	}
 
-	tab.AddFooter(fmt.Sprintf("%d snapshots", len(list)))
+	if suspect > 0 {
+		tab.AddFooter(fmt.Sprintf("%d snapshots, %d suspect", len(list), suspect))
+	} else {
+		tab.AddFooter(fmt.Sprintf("%d snapshots", len(list)))
+	}
 
 	if multiline {
 		// print an additional blank line between snapshots
@@ -255,6 +296,69 @@ func PrintSnapshots(stdout io.Writer, list restic.Snapshots, reasons []restic.Ke
 	}
 }
 
+// PrintSnapshotDetails prints a text table of the snapshots in list together
+// with the backup summary stored in each snapshot to stdout.
+func PrintSnapshotDetails(stdout io.Writer, list restic.Snapshots) {
+	// always sort the snapshots so that the newer ones are listed last
+	sort.SliceStable(list, func(i, j int) bool {
+		return list[i].Time.Before(list[j].Time)
+	})
+
+	tab := table.New()
+	tab.AddColumn("ID", "{{ .ID }}")
+	tab.AddColumn("Time", "{{ .Timestamp }}")
+	tab.AddColumn("Host", "{{ .Hostname }}")
+	tab.AddColumn("Duration", "{{ .Duration }}")
+	tab.AddColumn("Files new/changed/unmodified", "{{ .Files }}")
+	tab.AddColumn("Added", "{{ .Added }}")
+	tab.AddColumn("Stored", "{{ .Stored }}")
+	tab.AddColumn("Errors", "{{ .Errors }}")
+	for _, sn := range list {
+		if sn.Suspect != "" {
+			tab.AddColumn("Suspect", "{{ .Suspect }}")
+			break
+		}
+	}
+
+	type snapshot struct {
+		ID        string
+		Timestamp string
+		Hostname  string
+		Duration  string
+		Files     string
+		Added     string
+		Stored    string
+		Errors    string
+		Suspect   string
+	}
+
+	for _, sn := range list {
+		data := snapshot{
+			ID:        sn.ID().Str(),
+			Timestamp: sn.Time.Local().Format(TimeFormat),
+			Hostname:  sn.Hostname,
+			Suspect:   sn.Suspect,
+		}
+
+		if s := sn.Summary; s != nil {
+			data.Duration = ui.FormatDuration(s.Duration())
+			data.Files = fmt.Sprintf("%d / %d / %d", s.FilesNew, s.FilesChanged, s.FilesUnmodified)
+			data.Added = ui.FormatBytes(s.DataAdded)
+			data.Stored = ui.FormatBytes(s.DataAddedPacked)
+			data.Errors = fmt.Sprintf("%d", s.Errors)
+		}
+
+		tab.AddRow(data)
+	}
+
+	tab.AddFooter(fmt.Sprintf("%d snapshots", len(list)))
+
+	err := tab.Write(stdout)
+	if err != nil {
+		Warnf("error printing: %v\n", err)
+	}
+}
+
 // PrintSnapshotGroupHeader prints which group of the group-by option the
 // following snapshots belong to.
 // Prints nothing, if we did not group at all.
@@ -3,7 +3,9 @@ package main
 import (
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/restic/restic/internal/restic"
 	rtest "github.com/restic/restic/internal/test"
 )
 
@@ -17,3 +19,32 @@ func TestEmptySnapshotGroupJSON(t *testing.T) {
 		rtest.Equals(t, "[]", strings.TrimSpace(w.String()))
 	}
 }
+
+func TestPrintSnapshotsSuspect(t *testing.T) {
+	sn, err := restic.NewSnapshot([]string{"/home"}, nil, "host", time.Now())
+	rtest.OK(t, err)
+	id := restic.NewRandomID()
+	sn.Tree = &id
+	suspect := *sn
+	suspect.Time = sn.Time.Add(time.Minute)
+	suspect.Suspect = "zfs snapshot of /home was replaced"
+
+	var w strings.Builder
+	PrintSnapshots(&w, restic.Snapshots{sn}, nil, false)
+	rtest.Assert(t, !strings.Contains(w.String(), "Suspect"), "unexpected suspect column in\n%v", w.String())
+
+	for _, compact := range []bool{false, true} {
+		w.Reset()
+		PrintSnapshots(&w, restic.Snapshots{sn, &suspect}, nil, compact)
+		rtest.Assert(t, strings.Contains(w.String(), "Suspect"), "missing suspect column in\n%v", w.String())
+		rtest.Assert(t, strings.Contains(w.String(), "2 snapshots, 1 suspect"), "missing suspect count in\n%v", w.String())
+	}
+
+	w.Reset()
+	PrintSnapshotDetails(&w, restic.Snapshots{sn, &suspect})
+	rtest.Assert(t, strings.Contains(w.String(), suspect.Suspect), "missing reason in\n%v", w.String())
+
+	w.Reset()
+	rtest.OK(t, printSnapshotGroupJSON(&w, map[string]restic.Snapshots{"": {&suspect}}, false))
+	rtest.Assert(t, strings.Contains(w.String(), `"suspect":"zfs snapshot of /home was replaced"`), "missing reason in\n%v", w.String())
+}
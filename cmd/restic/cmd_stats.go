@@ -4,12 +4,19 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"os"
 	"path/filepath"
+	"time"
 
 	"github.com/restic/restic/internal/backend"
 	"github.com/restic/restic/internal/crypto"
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/index"
+	"github.com/restic/restic/internal/repository"
 	"github.com/restic/restic/internal/restic"
 	"github.com/restic/restic/internal/ui"
+	"github.com/restic/restic/internal/ui/table"
 	"github.com/restic/restic/internal/walker"
 
 	"github.com/minio/sha256-simd"
@@ -42,6 +49,11 @@ The modes are:
 
 Refer to the online manual for more details about each mode.
 
+With "--record-stats", "backup" and "prune" save a small statistics record
+about the repository in the local cache. With "--history", the records saved
+on this host are listed instead, which shows how the repository has grown
+over time.
+
 EXIT STATUS
 ===========
 
@@ -57,6 +69,8 @@ Exit status is 0 if the command was successful, and non-zero if there was any er
 type StatsOptions struct {
 	// the mode of counting to perform (see consts for available modes)
 	countMode string
+	// list the saved statistics records instead
+	history bool
 
 	snapshotFilterOptions
 }
@@ -67,6 +81,7 @@ func init() {
 	cmdRoot.AddCommand(cmdStats)
 	f := cmdStats.Flags()
 	f.StringVar(&statsOptions.countMode, "mode", countModeRestoreSize, "counting mode: restore-size (default), files-by-contents, blobs-per-file or raw-data")
+	f.BoolVar(&statsOptions.history, "history", false, "list the statistics records saved by backup and prune with --record-stats")
 	initMultiSnapshotFilterOptions(f, &statsOptions.snapshotFilterOptions, true)
 }
 
@@ -76,6 +91,10 @@ func runStats(ctx context.Context, gopts GlobalOptions, args []string) error {
 		return err
 	}
 
+	if err := statsOptions.validate(args); err != nil {
+		return err
+	}
+
 	repo, err := OpenRepository(ctx, gopts)
 	if err != nil {
 		return err
@@ -90,6 +109,10 @@ func runStats(ctx context.Context, gopts GlobalOptions, args []string) error {
 		}
 	}
 
+	if statsOptions.history {
+		return statsHistory(repo, gopts)
+	}
+
 	snapshotLister, err := backend.MemorizeList(ctx, repo.Backend(), restic.SnapshotFile)
 	if err != nil {
 		return err
@@ -111,7 +134,7 @@ func runStats(ctx context.Context, gopts GlobalOptions, args []string) error {
 		SnapshotsCount: 0,
 	}
 
-	for sn := range FindFilteredSnapshots(ctx, snapshotLister, repo, statsOptions.Hosts, statsOptions.Tags, statsOptions.Paths, args) {
+	for sn := range FindFilteredSnapshots(ctx, snapshotLister, repo, &statsOptions.snapshotFilterOptions, args) {
 		err = statsWalkSnapshot(ctx, sn, repo, stats)
 		if err != nil {
 			return fmt.Errorf("error walking snapshot: %v", err)
@@ -181,6 +204,183 @@ func runStats(ctx context.Context, gopts GlobalOptions, args []string) error {
 	return nil
 }
 
+// StatsRecord describes the size of the repository at a point in time. With
+// --record-stats, backup and prune save a record in the local cache, so that
+// the growth of the repository can be followed over time.
+type StatsRecord struct {
+	Time     time.Time `json:"time"`
+	Hostname string    `json:"hostname,omitempty"`
+	// Command is the command which saved the record, e.g. "backup".
+	Command string `json:"command"`
+
+	Snapshots uint `json:"snapshots"`
+	Packs     uint `json:"packs"`
+	DataBlobs uint `json:"data_blobs"`
+	TreeBlobs uint `json:"tree_blobs"`
+	// StoredSize is the size of all blobs as stored in the repository, after
+	// compression and encryption.
+	StoredSize uint64 `json:"stored_size"`
+	// UncompressedSize is the size of all blobs before compression.
+	UncompressedSize uint64 `json:"uncompressed_size"`
+}
+
+// statsHistory prints all statistics records, oldest first.
+func statsHistory(repo *repository.Repository, gopts GlobalOptions) error {
+	filename, err := statsHistoryFile(repo)
+	if err != nil {
+		return err
+	}
+	records, err := loadStatsRecords(filename)
+	if err != nil {
+		return err
+	}
+
+	if gopts.JSON {
+		if records == nil {
+			records = []*StatsRecord{}
+		}
+		err = json.NewEncoder(globalOptions.stdout).Encode(records)
+		if err != nil {
+			return fmt.Errorf("encoding output: %v", err)
+		}
+		return nil
+	}
+
+	tab := table.New()
+	tab.AddColumn("Time", "{{ .Time }}")
+	tab.AddColumn("Host", "{{ .Host }}")
+	tab.AddColumn("Command", "{{ .Command }}")
+	tab.AddColumn("Snapshots", "{{ .Snapshots }}")
+	tab.AddColumn("Blobs", "{{ .Blobs }}")
+	tab.AddColumn("Stored Size", "{{ .StoredSize }}")
+	tab.AddColumn("Uncompressed Size", "{{ .UncompressedSize }}")
+
+	for _, r := range records {
+		data := struct {
+			Time, Host, Command          string
+			Snapshots, Blobs             uint
+			StoredSize, UncompressedSize string
+		}{
+			Time:             r.Time.Local().Format(TimeFormat),
+			Host:             r.Hostname,
+			Command:          r.Command,
+			Snapshots:        r.Snapshots,
+			Blobs:            r.DataBlobs + r.TreeBlobs,
+			StoredSize:       ui.FormatBytes(r.StoredSize),
+			UncompressedSize: ui.FormatBytes(r.UncompressedSize),
+		}
+		tab.AddRow(data)
+	}
+
+	return tab.Write(globalOptions.stdout)
+}
+
+const (
+	// statsHistoryFilename is the name of the file in the cache directory of
+	// the repository which contains the statistics records.
+	statsHistoryFilename = "stats-history.json"
+	// statsMaxRecords is the number of statistics records which are kept,
+	// older records are removed when saving a new one.
+	statsMaxRecords = 5000
+)
+
+// statsHistoryFile returns the location of the statistics records for repo.
+func statsHistoryFile(repo *repository.Repository) (string, error) {
+	if repo.Cache == nil {
+		return "", errors.Fatal("statistics records are stored in the cache directory, which is disabled by --no-cache")
+	}
+	return filepath.Join(repo.Cache.Path(), statsHistoryFilename), nil
+}
+
+// loadStatsRecords loads the statistics records from filename, oldest first.
+// A missing file contains no records.
+func loadStatsRecords(filename string) ([]*StatsRecord, error) {
+	buf, err := os.ReadFile(filename)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	var records []*StatsRecord
+	if err := json.Unmarshal(buf, &records); err != nil {
+		return nil, errors.Wrapf(err, "unable to decode %v", filename)
+	}
+	return records, nil
+}
+
+// addStatsRecord appends r to the statistics records in filename, keeping at
+// most statsMaxRecords records. The file is replaced atomically, so that an
+// interrupted run does not lose the existing records.
+func addStatsRecord(filename string, r *StatsRecord) error {
+	records, err := loadStatsRecords(filename)
+	if err != nil {
+		return err
+	}
+	records = append(records, r)
+	if len(records) > statsMaxRecords {
+		records = records[len(records)-statsMaxRecords:]
+	}
+
+	buf, err := json.Marshal(records)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	f, err := os.CreateTemp(filepath.Dir(filename), filepath.Base(filename)+"-tmp-")
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	_, err = f.Write(buf)
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), filename)
+	}
+	if err != nil {
+		_ = os.Remove(f.Name())
+		return errors.WithStack(err)
+	}
+	return nil
+}
+
+// saveStatsRecord saves a statistics record for the current index of repo,
+// which contains the given number of snapshots. Blobs in ignorePacks are not
+// counted.
+func saveStatsRecord(repo *repository.Repository, snapshots uint, command, hostname string, ignorePacks restic.IDSet) error {
+	filename, err := statsHistoryFile(repo)
+	if err != nil {
+		return err
+	}
+	if hostname == "" {
+		hostname, _ = os.Hostname()
+	}
+
+	// with a lazily loaded index, this loads all index files again
+	idx := repo.Index().(*index.MasterIndex)
+	data := idx.Totals(restic.DataBlob, ignorePacks)
+	tree := idx.Totals(restic.TreeBlob, ignorePacks)
+	debug.Log("saving statistics record to %v", filename)
+
+	return addStatsRecord(filename, &StatsRecord{
+		Time:             time.Now(),
+		Hostname:         hostname,
+		Command:          command,
+		Snapshots:        snapshots,
+		Packs:            uint(len(idx.Packs(ignorePacks))),
+		DataBlobs:        data.Count,
+		TreeBlobs:        tree.Count,
+		StoredSize:       data.Size + tree.Size,
+		UncompressedSize: data.UncompressedSize + tree.UncompressedSize,
+	})
+}
+
 func statsWalkSnapshot(ctx context.Context, snapshot *restic.Snapshot, repo restic.Repository, stats *statsContainer) error {
 	if snapshot.Tree == nil {
 		return fmt.Errorf("snapshot %s has nil tree", snapshot.ID().Str())
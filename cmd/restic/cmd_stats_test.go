@@ -0,0 +1,37 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func TestAddStatsRecord(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), statsHistoryFilename)
+
+	records, err := loadStatsRecords(filename)
+	rtest.OK(t, err)
+	rtest.Equals(t, 0, len(records))
+
+	newRecord := func(i int) *StatsRecord {
+		return &StatsRecord{Time: time.Unix(int64(i), 0).UTC(), Command: "backup", Snapshots: uint(i)}
+	}
+
+	// the oldest records are dropped once there are too many
+	for i := 0; i < statsMaxRecords+2; i++ {
+		rtest.OK(t, addStatsRecord(filename, newRecord(i)))
+	}
+
+	records, err = loadStatsRecords(filename)
+	rtest.OK(t, err)
+	rtest.Equals(t, statsMaxRecords, len(records))
+	rtest.Equals(t, newRecord(2), records[0])
+	rtest.Equals(t, newRecord(statsMaxRecords+1), records[len(records)-1])
+
+	// a damaged file is not replaced
+	rtest.OK(t, os.WriteFile(filename, []byte("{"), 0600))
+	rtest.Assert(t, addStatsRecord(filename, newRecord(0)) != nil, "adding a record to a damaged file did not fail")
+}
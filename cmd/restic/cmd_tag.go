@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 
 	"github.com/spf13/cobra"
 
@@ -9,6 +10,7 @@ import (
 	"github.com/restic/restic/internal/errors"
 	"github.com/restic/restic/internal/repository"
 	"github.com/restic/restic/internal/restic"
+	"github.com/restic/restic/internal/ui/table"
 )
 
 var cmdTag = &cobra.Command{
@@ -21,6 +23,11 @@ You can either set/replace the entire set of tags on a snapshot, or
 add tags to/remove tags from the existing set.
 
 When no snapshot-ID is given, all snapshots matching the host, tag and path filter criteria are modified.
+The options "--before" and "--after" additionally restrict the modified snapshots to a time range.
+
+Use "--dry-run" to list the planned changes without modifying the repository. All
+modified snapshots are first saved with the new tags, the original snapshots are only
+removed once all new snapshots were saved successfully.
 
 EXIT STATUS
 ===========
@@ -39,6 +46,7 @@ type TagOptions struct {
 	SetTags    restic.TagLists
 	AddTags    restic.TagLists
 	RemoveTags restic.TagLists
+	DryRun     bool
 }
 
 var tagOptions TagOptions
@@ -50,49 +58,140 @@ func init() {
 	tagFlags.Var(&tagOptions.SetTags, "set", "`tags` which will replace the existing tags in the format `tag[,tag,...]` (can be given multiple times)")
 	tagFlags.Var(&tagOptions.AddTags, "add", "`tags` which will be added to the existing tags in the format `tag[,tag,...]` (can be given multiple times)")
 	tagFlags.Var(&tagOptions.RemoveTags, "remove", "`tags` which will be removed from the existing tags in the format `tag[,tag,...]` (can be given multiple times)")
+	tagFlags.BoolVarP(&tagOptions.DryRun, "dry-run", "n", false, "do not modify the repository, just print what would be done")
 	initMultiSnapshotFilterOptions(tagFlags, &tagOptions.snapshotFilterOptions, true)
 }
 
-func changeTags(ctx context.Context, repo *repository.Repository, sn *restic.Snapshot, setTags, addTags, removeTags []string) (bool, error) {
-	var changed bool
+// tagChange describes the modification of the tags of a single snapshot.
+type tagChange struct {
+	sn      *restic.Snapshot
+	oldTags []string
+	newID   restic.ID
+}
 
+// applyTags modifies the tags of sn and returns whether they changed.
+func applyTags(sn *restic.Snapshot, setTags, addTags, removeTags []string) bool {
 	if len(setTags) != 0 {
 		// Setting the tag to an empty string really means no tags.
 		if len(setTags) == 1 && setTags[0] == "" {
 			setTags = nil
 		}
 		sn.Tags = setTags
+		return true
+	}
+
+	changed := sn.AddTags(addTags)
+	if sn.RemoveTags(removeTags) {
 		changed = true
-	} else {
-		changed = sn.AddTags(addTags)
-		if sn.RemoveTags(removeTags) {
-			changed = true
+	}
+	return changed
+}
+
+// planTagChanges applies the tag modifications to the snapshots selected by
+// opts and args and returns the snapshots whose tags changed. The repository
+// is not modified.
+func planTagChanges(ctx context.Context, repo *repository.Repository, opts TagOptions, args []string) ([]tagChange, error) {
+	// report invalid times instead of silently selecting no snapshots
+	if err := opts.validate(args); err != nil {
+		return nil, err
+	}
+
+	var changes []tagChange
+	for sn := range FindFilteredSnapshots(ctx, repo.Backend(), repo, &opts.snapshotFilterOptions, args) {
+		oldTags := append([]string{}, sn.Tags...)
+		if applyTags(sn, opts.SetTags.Flatten(), opts.AddTags.Flatten(), opts.RemoveTags.Flatten()) {
+			changes = append(changes, tagChange{sn: sn, oldTags: oldTags})
 		}
 	}
+	return changes, ctx.Err()
+}
 
-	if changed {
+// saveTagChanges first saves all modified snapshots and then removes the
+// original snapshots. If saving a snapshot fails, the already saved snapshots
+// are removed again, leaving the repository unchanged.
+func saveTagChanges(ctx context.Context, repo *repository.Repository, gopts GlobalOptions, changes []tagChange) error {
+	bar := newProgressMax(!gopts.JSON && !gopts.Quiet, uint64(len(changes)), "snapshots saved")
+	for i := range changes {
+		sn := changes[i].sn
 		// Retain the original snapshot id over all tag changes.
 		if sn.Original == nil {
 			sn.Original = sn.ID()
 		}
 
-		// Save the new snapshot.
 		id, err := restic.SaveSnapshot(ctx, repo, sn)
 		if err != nil {
-			return false, err
+			bar.Done()
+			saved := restic.NewIDSet()
+			for _, c := range changes[:i] {
+				saved.Insert(c.newID)
+			}
+			if rerr := DeleteFilesChecked(context.Background(), gopts, repo, saved, restic.SnapshotFile); rerr != nil {
+				Warningf("unable to remove the already saved snapshots: %v\n", rerr)
+			}
+			return errors.Fatalf("unable to save snapshot with new tags for %v, no snapshots were modified: %v", sn.ID().Str(), err)
 		}
+		debug.Log("new snapshot for %v saved as %v", sn.ID(), id)
+		changes[i].newID = id
+		bar.Add(1)
+	}
+	bar.Done()
 
-		debug.Log("new snapshot saved as %v", id)
+	old := restic.NewIDSet()
+	for _, c := range changes {
+		old.Insert(*c.sn.ID())
+	}
+	err := DeleteFilesChecked(ctx, gopts, repo, old, restic.SnapshotFile)
+	if err != nil {
+		return errors.Fatalf("unable to remove the original snapshots, the repository now contains snapshots with both the old and the new tags: %v", err)
+	}
+	return nil
+}
+
+func printTagChanges(gopts GlobalOptions, changes []tagChange) error {
+	type changeInfo struct {
+		ID      string   `json:"id"`
+		NewID   string   `json:"new_id,omitempty"`
+		Time    string   `json:"time"`
+		Host    string   `json:"hostname"`
+		OldTags []string `json:"old_tags"`
+		NewTags []string `json:"new_tags"`
+	}
 
-		// Remove the old snapshot.
-		h := restic.Handle{Type: restic.SnapshotFile, Name: sn.ID().String()}
-		if err = repo.Backend().Remove(ctx, h); err != nil {
-			return false, err
+	infos := make([]changeInfo, 0, len(changes))
+	for _, c := range changes {
+		info := changeInfo{
+			ID:      c.sn.ID().Str(),
+			Time:    c.sn.Time.Local().Format(TimeFormat),
+			Host:    c.sn.Hostname,
+			OldTags: c.oldTags,
+			NewTags: c.sn.Tags,
 		}
+		if !c.newID.IsNull() {
+			info.NewID = c.newID.Str()
+		}
+		if gopts.JSON {
+			info.ID = c.sn.ID().String()
+			if !c.newID.IsNull() {
+				info.NewID = c.newID.String()
+			}
+		}
+		infos = append(infos, info)
+	}
+
+	if gopts.JSON {
+		return json.NewEncoder(gopts.stdout).Encode(infos)
+	}
 
-		debug.Log("old snapshot %v removed", sn.ID())
+	tab := table.New()
+	tab.AddColumn("ID", "{{ .ID }}")
+	tab.AddColumn("Time", "{{ .Time }}")
+	tab.AddColumn("Host", "{{ .Host }}")
+	tab.AddColumn("Old Tags", "{{ join .OldTags \",\" }}")
+	tab.AddColumn("New Tags", "{{ join .NewTags \",\" }}")
+	for _, info := range infos {
+		tab.AddRow(info)
 	}
-	return changed, nil
+	return tab.Write(gopts.stdout)
 }
 
 func runTag(ctx context.Context, opts TagOptions, gopts GlobalOptions, args []string) error {
@@ -108,7 +207,7 @@ func runTag(ctx context.Context, opts TagOptions, gopts GlobalOptions, args []st
 		return err
 	}
 
-	if !gopts.NoLock {
+	if !gopts.NoLock && !opts.DryRun {
 		Verbosef("create exclusive lock for repository\n")
 		var lock *restic.Lock
 		lock, ctx, err = lockRepoExclusive(ctx, repo)
@@ -118,21 +217,37 @@ func runTag(ctx context.Context, opts TagOptions, gopts GlobalOptions, args []st
 		}
 	}
 
-	changeCnt := 0
-	for sn := range FindFilteredSnapshots(ctx, repo.Backend(), repo, opts.Hosts, opts.Tags, opts.Paths, args) {
-		changed, err := changeTags(ctx, repo, sn, opts.SetTags.Flatten(), opts.AddTags.Flatten(), opts.RemoveTags.Flatten())
-		if err != nil {
-			Warnf("unable to modify the tags for snapshot ID %q, ignoring: %v\n", sn.ID(), err)
-			continue
+	changes, err := planTagChanges(ctx, repo, opts, args)
+	if err != nil {
+		return err
+	}
+
+	if opts.DryRun {
+		if !gopts.JSON {
+			Verbosef("would modify tags on %v snapshots\n", len(changes))
 		}
-		if changed {
-			changeCnt++
+		if len(changes) == 0 && !gopts.JSON {
+			return nil
 		}
+		return printTagChanges(gopts, changes)
 	}
-	if changeCnt == 0 {
+
+	if len(changes) == 0 {
+		if gopts.JSON {
+			return printTagChanges(gopts, changes)
+		}
 		Verbosef("no snapshots were modified\n")
-	} else {
-		Verbosef("modified tags on %v snapshots\n", changeCnt)
+		return nil
+	}
+
+	err = saveTagChanges(ctx, repo, gopts, changes)
+	if err != nil {
+		return err
+	}
+
+	if gopts.JSON {
+		return printTagChanges(gopts, changes)
 	}
+	Verbosef("modified tags on %v snapshots\n", len(changes))
 	return nil
 }
@@ -0,0 +1,320 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/restic/restic/internal/backend"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/restic"
+	"github.com/restic/restic/internal/ui"
+	"github.com/restic/restic/internal/ui/table"
+
+	"github.com/spf13/cobra"
+)
+
+var cmdUnused = &cobra.Command{
+	Use:   "unused [flags] [snapshot ID] [...]",
+	Short: "Show how much data prune would remove",
+	Long: `
+The "unused" command reports how much unused data is stored in the repository
+and how much of it "prune" would remove for different values of "--max-unused".
+The repository is not modified.
+
+For each "--max-unused" value, the size of the pack files which prune would
+have to download and upload again to repack them is shown along with the space
+it would free. This helps deciding whether running prune is worth the traffic,
+for example for backends which charge for downloads.
+
+If snapshots are specified, the command also shows how much data would become
+unused if these snapshots were removed via "forget". With "--individually",
+removing each of the snapshots is additionally evaluated on its own.
+
+EXIT STATUS
+===========
+
+Exit status is 0 if the command was successful, and non-zero if there was any error.
+`,
+	DisableAutoGenTag: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runUnused(cmd.Context(), unusedOptions, globalOptions, args)
+	},
+}
+
+// UnusedOptions collects all options for the unused command.
+type UnusedOptions struct {
+	MaxUnused    []string
+	Individually bool
+}
+
+var unusedOptions UnusedOptions
+
+func init() {
+	cmdRoot.AddCommand(cmdUnused)
+
+	f := cmdUnused.Flags()
+	f.StringSliceVar(&unusedOptions.MaxUnused, "max-unused", []string{"0%", "5%", "10%", "25%", "unlimited"}, "evaluate prune with the given `limit`s of unused data (see \"prune --max-unused\", comma separated or specified multiple times)")
+	f.BoolVar(&unusedOptions.Individually, "individually", false, "also evaluate removing each given snapshot on its own")
+}
+
+// unusedScenario is a set of snapshots which are assumed to be removed.
+type unusedScenario struct {
+	name    string
+	removed restic.IDSet
+}
+
+// UnusedResult is the outcome of a prune run for one scenario and one value
+// of --max-unused.
+type UnusedResult struct {
+	Scenario         string     `json:"scenario"`
+	RemovedSnapshots restic.IDs `json:"removed_snapshots"`
+	MaxUnused        string     `json:"max_unused"`
+	TotalSize        uint64     `json:"total_size"`
+	UnusedSize       uint64     `json:"unused_size"`
+	DeletePacks      uint       `json:"delete_packs"`
+	DeleteSize       uint64     `json:"delete_size"`
+	RepackPacks      uint       `json:"repack_packs"`
+	RepackSize       uint64     `json:"repack_size"`
+	FreedSize        uint64     `json:"freed_size"`
+	UnusedSizeAfter  uint64     `json:"unused_size_after"`
+}
+
+// packListRepository lists the pack files of the repository only once, as
+// the same listing is used to evaluate all prune plans.
+type packListRepository struct {
+	restic.Repository
+	packs map[restic.ID]int64
+}
+
+func newPackListRepository(ctx context.Context, repo restic.Repository) (*packListRepository, error) {
+	r := &packListRepository{Repository: repo, packs: make(map[restic.ID]int64)}
+	err := repo.List(ctx, restic.PackFile, func(id restic.ID, size int64) error {
+		r.packs[id] = size
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *packListRepository) List(ctx context.Context, t restic.FileType, fn func(restic.ID, int64) error) error {
+	if t != restic.PackFile {
+		return r.Repository.List(ctx, t, fn)
+	}
+	for id, size := range r.packs {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err := fn(id, size); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func runUnused(ctx context.Context, opts UnusedOptions, gopts GlobalOptions, args []string) error {
+	if len(opts.MaxUnused) == 0 {
+		return errors.Fatal("no value for --max-unused specified")
+	}
+	if opts.Individually && len(args) == 0 {
+		return errors.Fatal("--individually requires at least one snapshot")
+	}
+	if err := (&snapshotFilterOptions{}).validate(args); err != nil {
+		return err
+	}
+
+	pruneOpts := make([]PruneOptions, 0, len(opts.MaxUnused))
+	for _, maxUnused := range opts.MaxUnused {
+		o := PruneOptions{MaxUnused: maxUnused}
+		if err := verifyPruneOptions(&o); err != nil {
+			return err
+		}
+		pruneOpts = append(pruneOpts, o)
+	}
+
+	repo, err := OpenRepository(ctx, gopts)
+	if err != nil {
+		return err
+	}
+
+	if !gopts.NoLock {
+		var lock *restic.Lock
+		lock, ctx, err = lockRepo(ctx, repo)
+		defer unlockRepo(lock)
+		if err != nil {
+			return err
+		}
+	}
+
+	snapshotLister, err := backend.MemorizeList(ctx, repo.Backend(), restic.SnapshotFile)
+	if err != nil {
+		return err
+	}
+
+	scenarios := []unusedScenario{{name: "none", removed: restic.NewIDSet()}}
+	if len(args) > 0 {
+		all := restic.NewIDSet()
+		var individual []unusedScenario
+		for sn := range FindFilteredSnapshots(ctx, snapshotLister, repo, &snapshotFilterOptions{}, args) {
+			all.Insert(*sn.ID())
+			individual = append(individual, unusedScenario{name: sn.ID().Str(), removed: restic.NewIDSet(*sn.ID())})
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if len(all) == 0 {
+			return errors.Fatal("no matching snapshots found")
+		}
+
+		if len(all) == 1 {
+			scenarios = append(scenarios, individual[0])
+		} else {
+			scenarios = append(scenarios, unusedScenario{name: fmt.Sprintf("%d snapshots", len(all)), removed: all})
+			if opts.Individually {
+				scenarios = append(scenarios, individual...)
+			}
+		}
+	}
+
+	Verbosef("loading indexes...\n")
+	if err = repo.LoadIndex(ctx); err != nil {
+		return err
+	}
+
+	Verbosef("loading all snapshots...\n")
+	snapshotTrees := make(map[restic.ID]restic.ID)
+	err = restic.ForAllSnapshots(ctx, snapshotLister, repo, nil, func(id restic.ID, sn *restic.Snapshot, err error) error {
+		if err != nil {
+			return err
+		}
+		snapshotTrees[id] = *sn.Tree
+		return nil
+	})
+	if err != nil {
+		return errors.Fatalf("failed loading snapshot: %v", err)
+	}
+
+	listRepo, err := newPackListRepository(ctx, repo)
+	if err != nil {
+		return err
+	}
+
+	var results []UnusedResult
+	for _, scenario := range scenarios {
+		usedBlobs, err := scenarioUsedBlobs(ctx, repo, snapshotTrees, scenario.removed, gopts.Quiet)
+		if err != nil {
+			return err
+		}
+
+		for _, o := range pruneOpts {
+			res, err := evaluatePrune(ctx, listRepo, usedBlobs.Copy(), o)
+			if err != nil {
+				return err
+			}
+			res.Scenario = scenario.name
+			res.RemovedSnapshots = scenario.removed.List()
+			results = append(results, res)
+		}
+	}
+
+	if gopts.JSON {
+		err = json.NewEncoder(globalOptions.stdout).Encode(results)
+		if err != nil {
+			return fmt.Errorf("encoding output: %v", err)
+		}
+		return nil
+	}
+
+	return printUnusedResults(results)
+}
+
+// scenarioUsedBlobs returns the blobs referenced by the snapshots in
+// snapshotTrees, except for those in removed.
+func scenarioUsedBlobs(ctx context.Context, repo restic.Repository, snapshotTrees map[restic.ID]restic.ID, removed restic.IDSet, quiet bool) (restic.CountedBlobSet, error) {
+	var trees restic.IDs
+	for id, tree := range snapshotTrees {
+		if !removed.Has(id) {
+			trees = append(trees, tree)
+		}
+	}
+
+	Verbosef("finding data that is still in use for %d snapshots\n", len(trees))
+
+	usedBlobs := restic.NewCountedBlobSet()
+	bar := newProgressMax(!quiet, uint64(len(trees)), "snapshots")
+	defer bar.Done()
+
+	err := restic.FindUsedBlobs(ctx, repo, trees, usedBlobs, bar)
+	if err != nil {
+		if repo.Backend().IsNotExist(err) {
+			return nil, errors.Fatal("unable to load a tree from the repository: " + err.Error())
+		}
+		return nil, err
+	}
+	return usedBlobs, nil
+}
+
+// evaluatePrune determines which packs prune would delete and repack with
+// opts, if only the blobs in usedBlobs are still needed.
+func evaluatePrune(ctx context.Context, repo restic.Repository, usedBlobs restic.CountedBlobSet, opts PruneOptions) (UnusedResult, error) {
+	var stats pruneStats
+	_, indexPack, err := packInfoFromIndex(ctx, repo.Index(), usedBlobs, &stats)
+	if err != nil {
+		return UnusedResult{}, err
+	}
+	// the pack files are listed from memory, the last argument disables the
+	// progress bar for each evaluation
+	_, err = decidePackAction(ctx, opts, repo, indexPack, &stats, false)
+	if err != nil {
+		return UnusedResult{}, err
+	}
+
+	// same calculation as in printPruneStats
+	totalSize := stats.size.used + stats.size.duplicate + stats.size.unused + stats.size.unref
+	unusedSize := stats.size.duplicate + stats.size.unused
+	freed := stats.size.remove + stats.size.repackrm + stats.size.unref
+
+	return UnusedResult{
+		MaxUnused:       opts.MaxUnused,
+		TotalSize:       totalSize,
+		UnusedSize:      unusedSize + stats.size.unref,
+		DeletePacks:     stats.packs.remove + stats.packs.unref,
+		DeleteSize:      stats.size.remove + stats.size.unref,
+		RepackPacks:     stats.packs.repack,
+		RepackSize:      stats.size.repack,
+		FreedSize:       freed,
+		UnusedSizeAfter: unusedSize - stats.size.remove - stats.size.repackrm,
+	}, nil
+}
+
+func printUnusedResults(results []UnusedResult) error {
+	tab := table.New()
+	tab.AddColumn("Removed Snapshots", "{{ .Scenario }}")
+	tab.AddColumn("Max Unused", "{{ .MaxUnused }}")
+	tab.AddColumn("Unused", "{{ .Unused }}")
+	tab.AddColumn("Delete", "{{ .Delete }}")
+	tab.AddColumn("Repack", "{{ .Repack }}")
+	tab.AddColumn("Freed", "{{ .Freed }}")
+	tab.AddColumn("Unused After", "{{ .UnusedAfter }}")
+
+	for _, res := range results {
+		data := struct {
+			Scenario, MaxUnused, Unused, Delete, Repack, Freed, UnusedAfter string
+		}{
+			Scenario:    res.Scenario,
+			MaxUnused:   strings.TrimSpace(res.MaxUnused),
+			Unused:      fmt.Sprintf("%s (%s)", ui.FormatBytes(res.UnusedSize), ui.FormatPercent(res.UnusedSize, res.TotalSize)),
+			Delete:      fmt.Sprintf("%d packs / %s", res.DeletePacks, ui.FormatBytes(res.DeleteSize)),
+			Repack:      fmt.Sprintf("%d packs / %s", res.RepackPacks, ui.FormatBytes(res.RepackSize)),
+			Freed:       ui.FormatBytes(res.FreedSize),
+			UnusedAfter: ui.FormatBytes(res.UnusedSizeAfter),
+		}
+		tab.AddRow(data)
+	}
+	tab.AddFooter("Repacking downloads the listed size and uploads the data which is still used.")
+
+	return tab.Write(globalOptions.stdout)
+}
@@ -49,7 +49,7 @@ func deleteFiles(ctx context.Context, gopts GlobalOptions, ignoreError bool, rep
 				err := repo.Backend().Remove(ctx, h)
 				if err != nil {
 					if !gopts.JSON {
-						Warnf("unable to remove %v from the repository\n", h)
+						Warningf("unable to remove %v from the repository\n", h)
 					}
 					if !ignoreError {
 						return err
@@ -16,6 +16,7 @@ import (
 	"github.com/restic/restic/internal/filter"
 	"github.com/restic/restic/internal/fs"
 	"github.com/restic/restic/internal/repository"
+	"github.com/restic/restic/internal/restic"
 	"github.com/restic/restic/internal/textfile"
 	"github.com/spf13/pflag"
 )
@@ -167,7 +168,7 @@ func isDirExcludedByFile(dir, tagFilename, header string) bool {
 		return false
 	}
 	if err != nil {
-		Warnf("could not access exclusion tagfile: %v", err)
+		Warningf("could not access exclusion tagfile: %v\n", err)
 		return false
 	}
 	// when no signature is given, the mere presence of tf is enough reason
@@ -180,7 +181,7 @@ func isDirExcludedByFile(dir, tagFilename, header string) bool {
 	// indented ignore-action is not performed.
 	f, err := os.Open(tf)
 	if err != nil {
-		Warnf("could not open exclusion tagfile: %v", err)
+		Warningf("could not open exclusion tagfile: %v\n", err)
 		return false
 	}
 	defer func() {
@@ -190,15 +191,15 @@ func isDirExcludedByFile(dir, tagFilename, header string) bool {
 	_, err = io.ReadFull(f, buf)
 	// EOF is handled with a dedicated message, otherwise the warning were too cryptic
 	if err == io.EOF {
-		Warnf("invalid (too short) signature in exclusion tagfile %q\n", tf)
+		Warningf("invalid (too short) signature in exclusion tagfile %q\n", tf)
 		return false
 	}
 	if err != nil {
-		Warnf("could not read signature from exclusion tagfile %q: %v\n", tf, err)
+		Warningf("could not read signature from exclusion tagfile %q: %v\n", tf, err)
 		return false
 	}
 	if !bytes.Equal(buf, []byte(header)) {
-		Warnf("invalid signature in exclusion tagfile %q\n", tf)
+		Warningf("invalid signature in exclusion tagfile %q\n", tf)
 		return false
 	}
 	return true
@@ -209,8 +210,9 @@ func isDirExcludedByFile(dir, tagFilename, header string) bool {
 // maps the name of a source path to its device ID.
 type DeviceMap map[string]uint64
 
-// NewDeviceMap creates a new device map from the list of source paths.
-func NewDeviceMap(allowedSourcePaths []string) (DeviceMap, error) {
+// NewDeviceMap creates a new device map from the list of source paths, the
+// device IDs are read via filesystem.
+func NewDeviceMap(filesystem fs.FS, allowedSourcePaths []string) (DeviceMap, error) {
 	deviceMap := make(map[string]uint64)
 
 	for _, item := range allowedSourcePaths {
@@ -219,7 +221,7 @@ func NewDeviceMap(allowedSourcePaths []string) (DeviceMap, error) {
 			return nil, err
 		}
 
-		fi, err := fs.Lstat(item)
+		fi, err := filesystem.Lstat(item)
 		if err != nil {
 			return nil, err
 		}
@@ -271,14 +273,26 @@ func (m DeviceMap) IsAllowed(item string, deviceID uint64) (bool, error) {
 }
 
 // rejectByDevice returns a RejectFunc that rejects files which are on a
-// different file systems than the files/dirs in samples.
-func rejectByDevice(samples []string) (RejectFunc, error) {
-	deviceMap, err := NewDeviceMap(samples)
+// different file systems than the files/dirs in samples. All device IDs are
+// read via filesystem, so that they match the file info passed to the
+// RejectFunc. If crossVolume is set, it is called for mount points. If it
+// returns true, everything on the same file system below the mount point is
+// accepted as well, e.g. a child ZFS dataset which has been snapshotted.
+func rejectByDevice(filesystem fs.FS, samples []string, crossVolume func(item string) bool) (RejectFunc, error) {
+	deviceMap, err := NewDeviceMap(filesystem, samples)
 	if err != nil {
 		return nil, err
 	}
 	debug.Log("allowed devices: %v\n", deviceMap)
 
+	// the device map is extended for each volume crossed via crossVolume
+	var m sync.RWMutex
+	isAllowed := func(item string, id uint64) (bool, error) {
+		m.RLock()
+		defer m.RUnlock()
+		return deviceMap.IsAllowed(item, id)
+	}
+
 	return func(item string, fi os.FileInfo) bool {
 		id, err := fs.DeviceID(fi)
 		if err != nil {
@@ -287,7 +301,7 @@ func rejectByDevice(samples []string) (RejectFunc, error) {
 			panic(err)
 		}
 
-		allowed, err := deviceMap.IsAllowed(filepath.Clean(item), id)
+		allowed, err := isAllowed(filepath.Clean(item), id)
 		if err != nil {
 			// this should not happen
 			panic(fmt.Sprintf("error checking device ID of %v: %v", item, err))
@@ -308,7 +322,7 @@ func rejectByDevice(samples []string) (RejectFunc, error) {
 		// directory would be included.
 		parentDir := filepath.Dir(filepath.Clean(item))
 
-		parentFI, err := fs.Lstat(parentDir)
+		parentFI, err := filesystem.Lstat(parentDir)
 		if err != nil {
 			debug.Log("item %v: error running lstat() on parent directory: %v", item, err)
 			// if in doubt, reject
@@ -322,7 +336,7 @@ func rejectByDevice(samples []string) (RejectFunc, error) {
 			return true
 		}
 
-		parentAllowed, err := deviceMap.IsAllowed(parentDir, parentDeviceID)
+		parentAllowed, err := isAllowed(parentDir, parentDeviceID)
 		if err != nil {
 			debug.Log("item %v: error checking parent directory: %v", item, err)
 			// if in doubt, reject
@@ -330,7 +344,14 @@ func rejectByDevice(samples []string) (RejectFunc, error) {
 		}
 
 		if parentAllowed {
-			// we found a mount point, so accept the directory
+			// we found a mount point, so accept the directory. Its content is
+			// only included if the file system may be crossed.
+			if crossVolume != nil && crossVolume(item) {
+				debug.Log("item %v: crossing into file system with device %d", item, id)
+				m.Lock()
+				deviceMap[filepath.Clean(item)] = id
+				m.Unlock()
+			}
 			return false
 		}
 
@@ -385,6 +406,31 @@ func rejectBySize(maxSizeStr string) (RejectFunc, error) {
 	}, nil
 }
 
+// timeMachineExcludeXattr is the extended attribute set by "tmutil addexclusion"
+// on macOS for items which are excluded from Time Machine backups.
+const timeMachineExcludeXattr = "com.apple.metadata:com_apple_backup_excludeItem"
+
+// rejectTimeMachineExcluded rejects items which carry the Time Machine exclude
+// attribute. Exclusions of fixed paths, which are stored in the Time Machine
+// settings instead, are not considered.
+func rejectTimeMachineExcluded(item string, fi os.FileInfo) bool {
+	if fi.Mode()&os.ModeSymlink != 0 {
+		return false
+	}
+
+	value, err := restic.Getxattr(item, timeMachineExcludeXattr)
+	if err != nil {
+		debug.Log("unable to read Time Machine exclude attribute of %v: %v", item, err)
+		return false
+	}
+	if value != nil {
+		debug.Log("%v is excluded from Time Machine backups", item)
+		return true
+	}
+
+	return false
+}
+
 func parseSizeStr(sizeStr string) (int64, error) {
 	if sizeStr == "" {
 		return 0, errors.New("expected size, got empty string")
@@ -480,16 +526,34 @@ func (opts *excludePatternOptions) Empty() bool {
 }
 
 func (opts excludePatternOptions) CollectPatterns() ([]RejectByNameFunc, error) {
+	excludes, insensitiveExcludes, err := opts.Patterns()
+	if err != nil {
+		return nil, err
+	}
+
 	var fs []RejectByNameFunc
+	if len(insensitiveExcludes) > 0 {
+		fs = append(fs, rejectByInsensitivePattern(insensitiveExcludes))
+	}
+
+	if len(excludes) > 0 {
+		fs = append(fs, rejectByPattern(excludes))
+	}
+	return fs, nil
+}
+
+// Patterns returns the validated exclude and insensitive exclude patterns,
+// including those read from exclude files.
+func (opts excludePatternOptions) Patterns() (excludes, insensitiveExcludes []string, err error) {
 	// add patterns from file
 	if len(opts.ExcludeFiles) > 0 {
 		excludePatterns, err := readExcludePatternsFromFiles(opts.ExcludeFiles)
 		if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
 
 		if err := filter.ValidatePatterns(excludePatterns); err != nil {
-			return nil, errors.Fatalf("--exclude-file: %s", err)
+			return nil, nil, errors.Fatalf("--exclude-file: %s", err)
 		}
 
 		opts.Excludes = append(opts.Excludes, excludePatterns...)
@@ -498,11 +562,11 @@ func (opts excludePatternOptions) CollectPatterns() ([]RejectByNameFunc, error)
 	if len(opts.InsensitiveExcludeFiles) > 0 {
 		excludes, err := readExcludePatternsFromFiles(opts.InsensitiveExcludeFiles)
 		if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
 
 		if err := filter.ValidatePatterns(excludes); err != nil {
-			return nil, errors.Fatalf("--iexclude-file: %s", err)
+			return nil, nil, errors.Fatalf("--iexclude-file: %s", err)
 		}
 
 		opts.InsensitiveExcludes = append(opts.InsensitiveExcludes, excludes...)
@@ -510,18 +574,14 @@ func (opts excludePatternOptions) CollectPatterns() ([]RejectByNameFunc, error)
 
 	if len(opts.InsensitiveExcludes) > 0 {
 		if err := filter.ValidatePatterns(opts.InsensitiveExcludes); err != nil {
-			return nil, errors.Fatalf("--iexclude: %s", err)
+			return nil, nil, errors.Fatalf("--iexclude: %s", err)
 		}
-
-		fs = append(fs, rejectByInsensitivePattern(opts.InsensitiveExcludes))
 	}
 
 	if len(opts.Excludes) > 0 {
 		if err := filter.ValidatePatterns(opts.Excludes); err != nil {
-			return nil, errors.Fatalf("--exclude: %s", err)
+			return nil, nil, errors.Fatalf("--exclude: %s", err)
 		}
-
-		fs = append(fs, rejectByPattern(opts.Excludes))
 	}
-	return fs, nil
+	return opts.Excludes, opts.InsensitiveExcludes, nil
 }
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/restic/restic/internal/fs"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+// deviceFileInfo is a directory located on the device dev.
+type deviceFileInfo struct {
+	name string
+	dev  uint64
+}
+
+func (fi deviceFileInfo) Name() string       { return filepath.Base(fi.name) }
+func (fi deviceFileInfo) Size() int64        { return 0 }
+func (fi deviceFileInfo) Mode() os.FileMode  { return os.ModeDir | 0755 }
+func (fi deviceFileInfo) ModTime() time.Time { return time.Time{} }
+func (fi deviceFileInfo) IsDir() bool        { return true }
+func (fi deviceFileInfo) Sys() interface{} {
+	st := &syscall.Stat_t{}
+	st.Dev = fi.dev
+	return st
+}
+
+// deviceFS returns the device of each directory from a fixed list.
+type deviceFS struct {
+	fs.Local
+	devices map[string]uint64
+}
+
+func (f deviceFS) Lstat(name string) (os.FileInfo, error) {
+	dev, ok := f.devices[name]
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+	return deviceFileInfo{name: name, dev: dev}, nil
+}
+
+func TestRejectByDeviceCrossVolume(t *testing.T) {
+	filesystem := deviceFS{devices: map[string]uint64{
+		"/tank":                  1,
+		"/tank/dir":              1,
+		"/tank/child":            2,
+		"/tank/child/dir":        2,
+		"/tank/child/tmp":        3,
+		"/tank/child/tmp/dir":    3,
+		"/tank/failed":           4,
+		"/tank/failed/dir":       4,
+		"/tank/child/tmp/nested": 5,
+	}}
+
+	var tests = []struct {
+		item            string
+		rejected        bool
+		rejectedCrossed bool
+	}{
+		{"/tank/dir", false, false},
+		// mount points are always kept
+		{"/tank/child", false, false},
+		{"/tank/child/dir", true, false},
+		{"/tank/child/tmp", true, false},
+		{"/tank/child/tmp/dir", true, true},
+		{"/tank/child/tmp/nested", true, true},
+		{"/tank/failed", false, false},
+		{"/tank/failed/dir", true, true},
+	}
+
+	crossVolume := func(item string) bool {
+		return item == "/tank/child"
+	}
+
+	reject, err := rejectByDevice(filesystem, []string{"/tank"}, nil)
+	rtest.OK(t, err)
+	rejectCrossed, err := rejectByDevice(filesystem, []string{"/tank"}, crossVolume)
+	rtest.OK(t, err)
+
+	for _, test := range tests {
+		fi, err := filesystem.Lstat(test.item)
+		rtest.OK(t, err)
+		rtest.Equals(t, test.rejected, reject(test.item, fi))
+		rtest.Equals(t, test.rejectedCrossed, rejectCrossed(test.item, fi))
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"path/filepath"
 	"testing"
 
+	"github.com/restic/restic/internal/restic"
 	"github.com/restic/restic/internal/test"
 )
 
@@ -315,6 +316,34 @@ func TestIsExcludedByFileSize(t *testing.T) {
 	}
 }
 
+func TestRejectTimeMachineExcluded(t *testing.T) {
+	tempDir := test.TempDir(t)
+
+	included := filepath.Join(tempDir, "included")
+	excluded := filepath.Join(tempDir, "excluded")
+	for _, p := range []string{included, excluded} {
+		test.OK(t, os.WriteFile(p, []byte("foo"), 0600))
+	}
+
+	fi, err := os.Lstat(included)
+	test.OK(t, err)
+	test.Assert(t, !rejectTimeMachineExcluded(included, fi), "file without attribute was rejected")
+
+	// the attribute can only be set on macOS, most other systems require a
+	// namespace prefix in the name
+	err = restic.Setxattr(excluded, timeMachineExcludeXattr, []byte("com.apple.backupd"))
+	if err != nil {
+		t.Skipf("unable to set the Time Machine exclude attribute: %v", err)
+	}
+	if value, _ := restic.Getxattr(excluded, timeMachineExcludeXattr); value == nil {
+		t.Skip("extended attributes are not supported")
+	}
+
+	fi, err = os.Lstat(excluded)
+	test.OK(t, err)
+	test.Assert(t, rejectTimeMachineExcluded(excluded, fi), "file with attribute was not rejected")
+}
+
 func TestDeviceMap(t *testing.T) {
 	deviceMap := DeviceMap{
 		filepath.FromSlash("/"):          1,
@@ -2,16 +2,77 @@ package main
 
 import (
 	"context"
+	"strings"
 
 	"github.com/restic/restic/internal/backend"
+	"github.com/restic/restic/internal/errors"
 	"github.com/restic/restic/internal/restic"
 	"github.com/spf13/pflag"
 )
 
 type snapshotFilterOptions struct {
-	Hosts []string
-	Tags  restic.TagLists
-	Paths []string
+	Hosts  []string
+	Tags   restic.TagLists
+	Paths  []string
+	Before string
+	After  string
+}
+
+// timeRange returns the time range selected by the --before and --after
+// options.
+func (opts *snapshotFilterOptions) timeRange() (restic.TimeRange, error) {
+	var r restic.TimeRange
+	var err error
+	if opts.Before != "" {
+		if r.Before, err = parseTime(opts.Before); err != nil {
+			return r, err
+		}
+	}
+	if opts.After != "" {
+		if r.After, err = parseTime(opts.After); err != nil {
+			return r, err
+		}
+	}
+	return r, nil
+}
+
+// validate checks the filter options and the snapshot ranges in snapshotIDs,
+// such that invalid values are reported before any snapshot is selected.
+func (opts *snapshotFilterOptions) validate(snapshotIDs []string) error {
+	if _, err := opts.timeRange(); err != nil {
+		return err
+	}
+	for _, s := range snapshotIDs {
+		if _, _, err := parseSnapshotRange(s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// parseSnapshotRange parses a snapshot argument of the form `start..end`,
+// which selects all snapshots created at or after start and before end.
+// Either side may be omitted. ok is false if s is not a range.
+func parseSnapshotRange(s string) (r restic.TimeRange, ok bool, err error) {
+	start, end, ok := strings.Cut(s, "..")
+	if !ok {
+		return r, false, nil
+	}
+	if start == "" && end == "" {
+		return r, true, errors.Fatalf("invalid snapshot range %q, at least one of start and end must be given", s)
+	}
+
+	if start != "" {
+		if r.After, err = parseTime(start); err != nil {
+			return r, true, err
+		}
+	}
+	if end != "" {
+		if r.Before, err = parseTime(end); err != nil {
+			return r, true, err
+		}
+	}
+	return r, true, nil
 }
 
 // initMultiSnapshotFilterOptions is used for commands that work on multiple snapshots
@@ -24,6 +85,8 @@ func initMultiSnapshotFilterOptions(flags *pflag.FlagSet, options *snapshotFilte
 	flags.StringArrayVarP(&options.Hosts, "host", hostShorthand, nil, "only consider snapshots for this `host` (can be specified multiple times)")
 	flags.Var(&options.Tags, "tag", "only consider snapshots including `tag[,tag,...]` (can be specified multiple times)")
 	flags.StringArrayVar(&options.Paths, "path", nil, "only consider snapshots including this (absolute) `path` (can be specified multiple times)")
+	flags.StringVar(&options.Before, "before", "", "only consider snapshots created before `time`")
+	flags.StringVar(&options.After, "after", "", "only consider snapshots created at or after `time`")
 }
 
 // initSingleSnapshotFilterOptions is used for commands that work on a single snapshot
@@ -32,33 +95,106 @@ func initSingleSnapshotFilterOptions(flags *pflag.FlagSet, options *snapshotFilt
 	flags.StringArrayVarP(&options.Hosts, "host", "H", nil, "only consider snapshots for this `host`, when snapshot ID \"latest\" is given (can be specified multiple times)")
 	flags.Var(&options.Tags, "tag", "only consider snapshots including `tag[,tag,...]`, when snapshot ID \"latest\" is given (can be specified multiple times)")
 	flags.StringArrayVar(&options.Paths, "path", nil, "only consider snapshots including this (absolute) `path`, when snapshot ID \"latest\" is given (can be specified multiple times)")
+	flags.StringVar(&options.Before, "before", "", "only consider snapshots created before `time`, when snapshot ID \"latest\" is given")
+	flags.StringVar(&options.After, "after", "", "only consider snapshots created at or after `time`, when snapshot ID \"latest\" is given")
+}
+
+// findFilteredSnapshot returns the snapshot specified by snapshotID. The
+// special snapshot IDs "latest" and "latest~n" and ranges of the form
+// `start..end` select the latest or n-th latest snapshot matching the filter
+// options.
+func findFilteredSnapshot(ctx context.Context, be restic.Lister, loader restic.LoaderUnpacked, opts *snapshotFilterOptions, snapshotID string) (*restic.Snapshot, error) {
+	timeRange, err := opts.timeRange()
+	if err != nil {
+		return nil, err
+	}
+
+	argRange, isRange, err := parseSnapshotRange(snapshotID)
+	if err != nil {
+		return nil, err
+	}
+	if isRange {
+		timeRange = timeRange.Intersect(argRange)
+		snapshotID = "latest"
+	}
+
+	return restic.FindFilteredSnapshot(ctx, be, loader, opts.Hosts, opts.Tags, opts.Paths, timeRange, snapshotID)
 }
 
 // FindFilteredSnapshots yields Snapshots, either given explicitly by `snapshotIDs` or filtered from the list of all snapshots.
-func FindFilteredSnapshots(ctx context.Context, be restic.Lister, loader restic.LoaderUnpacked, hosts []string, tags []restic.TagList, paths []string, snapshotIDs []string) <-chan *restic.Snapshot {
+// A range of the form `start..end` in snapshotIDs selects all snapshots created in that range which match the filter options.
+// Callers should check the options with opts.validate first, invalid values are only reported as warnings.
+func FindFilteredSnapshots(ctx context.Context, be restic.Lister, loader restic.LoaderUnpacked, opts *snapshotFilterOptions, snapshotIDs []string) <-chan *restic.Snapshot {
 	out := make(chan *restic.Snapshot)
 	go func() {
 		defer close(out)
+		timeRange, err := opts.timeRange()
+		if err != nil {
+			Warningf("could not load snapshots: %v\n", err)
+			return
+		}
+
 		be, err := backend.MemorizeList(ctx, be, restic.SnapshotFile)
 		if err != nil {
-			Warnf("could not load snapshots: %v\n", err)
+			Warningf("could not load snapshots: %v\n", err)
 			return
 		}
 
-		err = restic.FindFilteredSnapshots(ctx, be, loader, hosts, tags, paths, snapshotIDs, func(id string, sn *restic.Snapshot, err error) error {
-			if err != nil {
-				Warnf("Ignoring %q: %v\n", id, err)
-			} else {
-				select {
-				case <-ctx.Done():
-					return ctx.Err()
-				case out <- sn:
+		var ids []string
+		var ranges []restic.TimeRange
+		seen := restic.NewIDSet()
+		yield := func(id string, sn *restic.Snapshot, err error) error {
+			if errors.Is(err, restic.ErrFiltersNotUsed) {
+				// the filters are used for the ranges
+				if len(ranges) == 0 {
+					Warningf("Ignoring filters: %v\n", err)
 				}
+				return nil
+			}
+			if err != nil {
+				Warningf("Ignoring %q: %v\n", id, err)
+				return nil
+			}
+			if seen.Has(*sn.ID()) {
+				return nil
+			}
+			seen.Insert(*sn.ID())
+
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case out <- sn:
 			}
 			return nil
-		})
-		if err != nil {
-			Warnf("could not load snapshots: %v\n", err)
+		}
+
+		for _, s := range snapshotIDs {
+			r, isRange, err := parseSnapshotRange(s)
+			if err != nil {
+				Warningf("Ignoring %q: %v\n", s, err)
+				continue
+			}
+			if isRange {
+				ranges = append(ranges, timeRange.Intersect(r))
+			} else {
+				ids = append(ids, s)
+			}
+		}
+
+		if len(ids) != 0 || len(ranges) == 0 {
+			err = restic.FindFilteredSnapshots(ctx, be, loader, opts.Hosts, opts.Tags, opts.Paths, timeRange, ids, yield)
+			if err != nil {
+				Warningf("could not load snapshots: %v\n", err)
+				return
+			}
+		}
+
+		for _, r := range ranges {
+			err = restic.FindFilteredSnapshots(ctx, be, loader, opts.Hosts, opts.Tags, opts.Paths, r, nil, yield)
+			if err != nil {
+				Warningf("could not load snapshots: %v\n", err)
+				return
+			}
 		}
 	}()
 	return out
@@ -3,6 +3,7 @@ package main
 import (
 	"fmt"
 	"os"
+	"strconv"
 
 	"github.com/restic/restic/internal/restic"
 )
@@ -33,8 +34,13 @@ func formatNode(path string, n *restic.Node, long bool) string {
 		mode = os.ModeSocket
 	}
 
-	return fmt.Sprintf("%s %5d %5d %6d %s %s%s",
-		mode|n.Mode, n.UID, n.GID, n.Size,
+	size := strconv.FormatUint(n.Size, 10)
+	if major, minor, ok := n.DeviceNumbers(); ok {
+		size = fmt.Sprintf("%d, %d", major, minor)
+	}
+
+	return fmt.Sprintf("%s %5d %5d %6s %s %s%s",
+		mode|n.Mode, n.UID, n.GID, size,
 		n.ModTime.Local().Format(TimeFormat), path,
 		target)
 }
@@ -20,6 +20,7 @@ import (
 	"github.com/restic/restic/internal/backend/limiter"
 	"github.com/restic/restic/internal/backend/local"
 	"github.com/restic/restic/internal/backend/location"
+	"github.com/restic/restic/internal/backend/media"
 	"github.com/restic/restic/internal/backend/rclone"
 	"github.com/restic/restic/internal/backend/rest"
 	"github.com/restic/restic/internal/backend/retry"
@@ -56,16 +57,31 @@ type GlobalOptions struct {
 	PasswordFile    string
 	PasswordCommand string
 	KeyHint         string
+	ConfigBundle    string
+	TPMKey          string
 	Quiet           bool
 	Verbose         int
 	NoLock          bool
 	JSON            bool
+	// WarningExitCode selects a separate exit status for commands which
+	// completed with warnings.
+	WarningExitCode bool
 	CacheDir        string
 	NoCache         bool
 	CleanupCache    bool
 	Compression     repository.CompressionMode
 	PackSize        uint
 
+	// MaxCores limits the number of CPU cores used concurrently.
+	MaxCores int
+
+	// AdaptiveConnections tunes the number of concurrent uploads
+	// automatically instead of always using all backend connections.
+	AdaptiveConnections bool
+
+	// Telemetry records each run in the local telemetry store.
+	Telemetry bool
+
 	backend.TransportOptions
 	limiter.Limits
 
@@ -73,6 +89,10 @@ type GlobalOptions struct {
 	stdout   io.Writer
 	stderr   io.Writer
 
+	// openFileLimit is the maximum number of open files, zero means unknown
+	// or unlimited.
+	openFileLimit uint64
+
 	backendTestHook, backendInnerTestHook backendWrapper
 
 	// verbosity is set as follows:
@@ -111,10 +131,13 @@ func init() {
 	f.StringVarP(&globalOptions.PasswordFile, "password-file", "p", "", "`file` to read the repository password from (default: $RESTIC_PASSWORD_FILE)")
 	f.StringVarP(&globalOptions.KeyHint, "key-hint", "", "", "`key` ID of key to try decrypting first (default: $RESTIC_KEY_HINT)")
 	f.StringVarP(&globalOptions.PasswordCommand, "password-command", "", "", "shell `command` to obtain the repository password from (default: $RESTIC_PASSWORD_COMMAND)")
+	f.StringVar(&globalOptions.ConfigBundle, "config-bundle", "", "read the repository location, password and options from the configuration bundle `file` created by \"config pack\" (default: $RESTIC_CONFIG_BUNDLE)")
+	f.StringVar(&globalOptions.TPMKey, "tpm-key", "", "read the repository password from the sealed key `file` created by \"key seal-tpm\" (default: $RESTIC_TPM_KEY)")
 	f.BoolVarP(&globalOptions.Quiet, "quiet", "q", false, "do not output comprehensive progress report")
 	f.CountVarP(&globalOptions.Verbose, "verbose", "v", "be verbose (specify multiple times or a level using --verbose=`n`, max level/times is 3)")
 	f.BoolVar(&globalOptions.NoLock, "no-lock", false, "do not lock the repository, this allows some operations on read-only repositories")
 	f.BoolVarP(&globalOptions.JSON, "json", "", false, "set output mode to JSON for commands that support it")
+	f.BoolVar(&globalOptions.WarningExitCode, "warning-exit-code", false, "exit with status 4 if the command completed, but reported warnings")
 	f.StringVar(&globalOptions.CacheDir, "cache-dir", "", "set the cache `directory`. (default: use system default cache directory)")
 	f.BoolVar(&globalOptions.NoCache, "no-cache", false, "do not use a local cache")
 	f.StringSliceVar(&globalOptions.RootCertFilenames, "cacert", nil, "`file` to load root certificates from (default: use system certificates)")
@@ -124,28 +147,95 @@ func init() {
 	f.Var(&globalOptions.Compression, "compression", "compression mode (only available for repository format version 2), one of (auto|off|max)")
 	f.IntVar(&globalOptions.Limits.UploadKb, "limit-upload", 0, "limits uploads to a maximum `rate` in KiB/s. (default: unlimited)")
 	f.IntVar(&globalOptions.Limits.DownloadKb, "limit-download", 0, "limits downloads to a maximum `rate` in KiB/s. (default: unlimited)")
+	f.IntVar(&globalOptions.MaxCores, "max-cores", 0, "use at most `n` CPU cores (default: $RESTIC_MAX_CORES or all cores)")
+	f.BoolVar(&globalOptions.Telemetry, "telemetry", false, "record duration, transferred bytes and errors of this run in the local history shown by \"history\" (default: $RESTIC_TELEMETRY)")
+	f.BoolVar(&globalOptions.AdaptiveConnections, "adaptive-connections", false, "automatically tune the number of concurrent uploads based on latency and errors, up to the number of backend connections")
 	f.UintVar(&globalOptions.PackSize, "pack-size", 0, "set target pack `size` in MiB, created pack files may be larger (default: $RESTIC_PACK_SIZE)")
 	f.StringSliceVarP(&globalOptions.Options, "option", "o", []string{}, "set extended option (`key=value`, can be specified multiple times)")
 	// Use our "generate" command instead of the cobra provided "completion" command
 	cmdRoot.CompletionOptions.DisableDefaultCmd = true
 
-	globalOptions.Repo = os.Getenv("RESTIC_REPOSITORY")
-	globalOptions.RepositoryFile = os.Getenv("RESTIC_REPOSITORY_FILE")
-	globalOptions.PasswordFile = os.Getenv("RESTIC_PASSWORD_FILE")
-	globalOptions.KeyHint = os.Getenv("RESTIC_KEY_HINT")
-	globalOptions.PasswordCommand = os.Getenv("RESTIC_PASSWORD_COMMAND")
-	comp := os.Getenv("RESTIC_COMPRESSION")
-	if comp != "" {
-		// ignore error as there's no good way to handle it
-		_ = globalOptions.Compression.Set(comp)
-	}
-	// parse target pack size from env, on error the default value will be used
-	targetPackSize, _ := strconv.ParseUint(os.Getenv("RESTIC_PACK_SIZE"), 10, 32)
-	globalOptions.PackSize = uint(targetPackSize)
+	setFromEnv("RESTIC_REPOSITORY", func(gopts *GlobalOptions) interface{} { return &gopts.Repo })
+	setFromEnv("RESTIC_REPOSITORY_FILE", func(gopts *GlobalOptions) interface{} { return &gopts.RepositoryFile })
+	setFromEnv("RESTIC_PASSWORD_FILE", func(gopts *GlobalOptions) interface{} { return &gopts.PasswordFile })
+	setFromEnv("RESTIC_KEY_HINT", func(gopts *GlobalOptions) interface{} { return &gopts.KeyHint })
+	setFromEnv("RESTIC_PASSWORD_COMMAND", func(gopts *GlobalOptions) interface{} { return &gopts.PasswordCommand })
+	setFromEnv("RESTIC_CONFIG_BUNDLE", func(gopts *GlobalOptions) interface{} { return &gopts.ConfigBundle })
+	setFromEnv("RESTIC_TPM_KEY", func(gopts *GlobalOptions) interface{} { return &gopts.TPMKey })
+	setFromEnv("RESTIC_COMPRESSION", func(gopts *GlobalOptions) interface{} { return &gopts.Compression })
+	setFromEnv("RESTIC_PACK_SIZE", func(gopts *GlobalOptions) interface{} { return &gopts.PackSize })
+	setFromEnv("RESTIC_MAX_CORES", func(gopts *GlobalOptions) interface{} { return &gopts.MaxCores })
+	setFromEnv("RESTIC_TELEMETRY", func(gopts *GlobalOptions) interface{} { return &gopts.Telemetry })
 
 	restoreTerminal()
 }
 
+// envOption is an option which defaults to the value of an environment
+// variable. field returns a pointer to the option, options of a single
+// command ignore gopts.
+type envOption struct {
+	name  string
+	field func(gopts *GlobalOptions) interface{}
+}
+
+// envOptions lists all options which are set from environment variables, so
+// that the variables stored in a configuration bundle can be applied to them
+// after startup. Variables which are only read when they are used, e.g.
+// RESTIC_PASSWORD or RESTIC_CACHE_DIR, are not listed.
+var envOptions []envOption
+
+// setFromEnv records that the option returned by field defaults to the value
+// of the environment variable name and sets it to the current value.
+func setFromEnv(name string, field func(gopts *GlobalOptions) interface{}) {
+	envOptions = append(envOptions, envOption{name: name, field: field})
+	if value := os.Getenv(name); value != "" {
+		setEnvOption(field(&globalOptions), value, false)
+	}
+}
+
+// applyEnvOption sets all options which default to the value of the
+// environment variable name. If keep is true, options which are already set,
+// e.g. on the command line, are not changed.
+func applyEnvOption(gopts *GlobalOptions, name, value string, keep bool) {
+	for _, opt := range envOptions {
+		if opt.name == name {
+			setEnvOption(opt.field(gopts), value, keep)
+		}
+	}
+}
+
+// setEnvOption parses value and stores it in opt, an invalid value is ignored
+// and the default value is used instead. If keep is true, opt is only set if
+// it still has its default value.
+func setEnvOption(opt interface{}, value string, keep bool) {
+	switch opt := opt.(type) {
+	case *string:
+		if !keep || *opt == "" {
+			*opt = value
+		}
+	case *bool:
+		if !keep || !*opt {
+			*opt, _ = strconv.ParseBool(value)
+		}
+	case *int:
+		if !keep || *opt == 0 {
+			v, _ := strconv.ParseInt(value, 10, 32)
+			*opt = int(v)
+		}
+	case *uint:
+		if !keep || *opt == 0 {
+			v, _ := strconv.ParseUint(value, 10, 32)
+			*opt = uint(v)
+		}
+	case *repository.CompressionMode:
+		if !keep || *opt == repository.CompressionAuto {
+			_ = opt.Set(value)
+		}
+	default:
+		panic(fmt.Sprintf("unsupported option type %T for %v", opt, value))
+	}
+}
+
 // checkErrno returns nil when err is set to syscall.Errno(0), since this is no
 // error condition.
 func checkErrno(err error) error {
@@ -390,6 +480,55 @@ func ReadPasswordTwice(gopts GlobalOptions, prompt1, prompt2 string) (string, er
 	return pw1, nil
 }
 
+// promptMediaChange asks the user to mount a different disk for the media
+// backend and waits until the user presses enter.
+func promptMediaChange(label, mount string) error {
+	if !stdinIsTerminal() {
+		if label == "" {
+			return errors.Fatalf("no disk with free space is mounted at %v", mount)
+		}
+		return errors.Fatalf("disk %q is not mounted at %v", label, mount)
+	}
+
+	if label == "" {
+		fmt.Fprintf(os.Stderr, "mount another disk with free space at %v and press enter ", mount)
+	} else {
+		fmt.Fprintf(os.Stderr, "mount disk %q at %v and press enter ", label, mount)
+	}
+
+	_, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil {
+		return errors.Wrap(err, "unable to read answer")
+	}
+	return nil
+}
+
+// mediaPackLocation returns a function which reports the label of the disk on
+// which a pack file is stored, if the repository uses the media backend.
+// Otherwise it returns nil.
+func mediaPackLocation(opts GlobalOptions) (func(restic.ID) string, error) {
+	repo, err := ReadRepo(opts)
+	if err != nil {
+		return nil, err
+	}
+	loc, err := location.Parse(repo)
+	if err != nil || loc.Scheme != "media" {
+		return nil, nil
+	}
+
+	cfg, err := parseConfig(loc, opts.extended)
+	if err != nil {
+		return nil, err
+	}
+	labels, err := media.PackLabels(cfg.(media.Config).Path)
+	if err != nil {
+		return nil, err
+	}
+	return func(id restic.ID) string {
+		return labels[id.String()]
+	}, nil
+}
+
 func ReadRepo(opts GlobalOptions) (string, error) {
 	if opts.Repo == "" && opts.RepositoryFile == "" {
 		return "", errors.Fatal("Please specify repository location (-r or --repository-file)")
@@ -437,6 +576,10 @@ func OpenRepository(ctx context.Context, opts GlobalOptions) (*repository.Reposi
 	}
 	be = retry.New(be, 10, report, success)
 
+	if opts.Telemetry {
+		be = telemetryBackend{Backend: be}
+	}
+
 	// wrap backend if a test specified a hook
 	if opts.backendTestHook != nil {
 		be, err = opts.backendTestHook(be)
@@ -501,7 +644,7 @@ func OpenRepository(ctx context.Context, opts GlobalOptions) (*repository.Reposi
 
 	c, err := cache.New(s.Config().ID, opts.CacheDir)
 	if err != nil {
-		Warnf("unable to open cache: %v\n", err)
+		Warningf("unable to open cache: %v\n", err)
 		return s, nil
 	}
 
@@ -514,7 +657,7 @@ func OpenRepository(ctx context.Context, opts GlobalOptions) (*repository.Reposi
 
 	oldCacheDirs, err := cache.Old(c.Base)
 	if err != nil {
-		Warnf("unable to find old cache directories: %v", err)
+		Warningf("unable to find old cache directories: %v\n", err)
 	}
 
 	// nothing more to do if no old cache dirs could be found
@@ -531,7 +674,7 @@ func OpenRepository(ctx context.Context, opts GlobalOptions) (*repository.Reposi
 			dir := filepath.Join(c.Base, item.Name())
 			err = fs.RemoveAll(dir)
 			if err != nil {
-				Warnf("unable to remove %v: %v\n", dir, err)
+				Warningf("unable to remove %v: %v\n", dir, err)
 			}
 		}
 	} else {
@@ -567,6 +710,15 @@ func parseConfig(loc location.Location, opts options.Options) (interface{}, erro
 		debug.Log("opening sftp repository at %#v", cfg)
 		return cfg, nil
 
+	case "media":
+		cfg := loc.Config.(media.Config)
+		if err := opts.Apply(loc.Scheme, &cfg); err != nil {
+			return nil, err
+		}
+
+		debug.Log("opening media repository at %#v", cfg)
+		return cfg, nil
+
 	case "s3":
 		cfg := loc.Config.(s3.Config)
 		if cfg.KeyID == "" {
@@ -717,6 +869,8 @@ func open(ctx context.Context, s string, gopts GlobalOptions, opts options.Optio
 		be, err = local.Open(ctx, cfg.(local.Config))
 	case "sftp":
 		be, err = sftp.Open(ctx, cfg.(sftp.Config))
+	case "media":
+		be, err = media.Open(ctx, cfg.(media.Config), promptMediaChange)
 	case "s3":
 		be, err = s3.Open(ctx, cfg.(s3.Config), rt)
 	case "gs":
@@ -748,11 +902,16 @@ func open(ctx context.Context, s string, gopts GlobalOptions, opts options.Optio
 		}
 	}
 
-	if loc.Scheme == "local" || loc.Scheme == "sftp" {
+	if loc.Scheme == "local" || loc.Scheme == "sftp" || loc.Scheme == "media" {
 		// wrap the backend in a LimitBackend so that the throughput is limited
 		be = limiter.LimitBackend(be, lim)
 	}
 
+	if gopts.AdaptiveConnections {
+		// placed below the retry backend to observe each individual attempt
+		be = limiter.AdaptiveConcurrencyBackend(be)
+	}
+
 	// check if config is there
 	fi, err := be.Stat(ctx, restic.Handle{Type: restic.ConfigFile})
 	if err != nil {
@@ -789,6 +948,8 @@ func create(ctx context.Context, s string, opts options.Options) (restic.Backend
 		return local.Create(ctx, cfg.(local.Config))
 	case "sftp":
 		return sftp.Create(ctx, cfg.(sftp.Config))
+	case "media":
+		return media.Create(ctx, cfg.(media.Config), promptMediaChange)
 	case "s3":
 		return s3.Create(ctx, cfg.(s3.Config), rt)
 	case "gs":
@@ -15,16 +15,19 @@ import (
 	"runtime"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"syscall"
 	"testing"
 	"time"
 
+	"github.com/restic/restic/internal/backend"
 	"github.com/restic/restic/internal/errors"
 	"github.com/restic/restic/internal/filter"
 	"github.com/restic/restic/internal/fs"
 	"github.com/restic/restic/internal/index"
 	"github.com/restic/restic/internal/repository"
 	"github.com/restic/restic/internal/restic"
+	"github.com/restic/restic/internal/restorer"
 	rtest "github.com/restic/restic/internal/test"
 	"github.com/restic/restic/internal/ui/termstatus"
 	"golang.org/x/sync/errgroup"
@@ -362,6 +365,66 @@ func testBackup(t *testing.T, useFsSnapshot bool) {
 	testRunCheck(t, env.gopts)
 }
 
+func TestBackupSummary(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testSetupBackupData(t, env)
+	opts := BackupOptions{}
+
+	testRunBackup(t, filepath.Dir(env.testdata), []string{"testdata"}, opts, env.gopts)
+	newest, _ := testRunSnapshots(t, env.gopts)
+	rtest.Assert(t, newest != nil && newest.Summary != nil, "snapshot has no summary")
+	first := *newest.Summary
+	rtest.Assert(t, first.FilesNew > 0, "expected new files, got %+v", first)
+	rtest.Equals(t, first.FilesNew, first.TotalFilesProcessed)
+	rtest.Assert(t, first.DataAdded > 0, "expected data to be added, got %+v", first)
+
+	testRunBackup(t, filepath.Dir(env.testdata), []string{"testdata"}, opts, env.gopts)
+	newest, _ = testRunSnapshots(t, env.gopts)
+	second := *newest.Summary
+	rtest.Equals(t, uint(0), second.FilesNew)
+	rtest.Equals(t, first.FilesNew, second.FilesUnmodified)
+	rtest.Equals(t, 0, second.DataBlobs)
+
+	buf := bytes.NewBuffer(nil)
+	env.gopts.stdout = buf
+	rtest.OK(t, runSnapshots(context.TODO(), SnapshotOptions{Details: true}, env.gopts, nil))
+	env.gopts.stdout = os.Stdout
+	rtest.Assert(t, strings.Contains(buf.String(), fmt.Sprintf("%d / 0 / 0", first.FilesNew)),
+		"details output does not contain the number of new files:\n%v", buf.String())
+}
+
+func TestBackupPartial(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testSetupBackupData(t, env)
+	testRunBackup(t, filepath.Dir(env.testdata), []string{"testdata"}, BackupOptions{}, env.gopts)
+	parent, _ := testRunSnapshots(t, env.gopts)
+
+	rtest.OK(t, os.RemoveAll(filepath.Join(env.testdata, "0", "0", "9")))
+	rtest.OK(t, os.WriteFile(filepath.Join(env.testdata, "0", "new"), []byte("new file"), 0644))
+
+	// --partial requires an explicit parent snapshot
+	err := testRunBackupAssumeFailure(t, filepath.Dir(env.testdata), []string{"testdata/0/0/9", "testdata/0/new"}, BackupOptions{Partial: true}, env.gopts)
+	rtest.Assert(t, err != nil, "expected error for missing parent snapshot")
+
+	opts := BackupOptions{Partial: true, Parent: parent.ID.String()}
+	testRunBackup(t, filepath.Dir(env.testdata), []string{"testdata/0/0/9", "testdata/0/new"}, opts, env.gopts)
+	newest, snapshots := testRunSnapshots(t, env.gopts)
+	rtest.Equals(t, 2, len(snapshots))
+	rtest.Equals(t, parent.Paths, newest.Paths)
+	rtest.Equals(t, uint(1), newest.Summary.TotalFilesProcessed)
+
+	restoredir := filepath.Join(env.base, "restore")
+	testRunRestore(t, env.gopts, restoredir, *newest.ID)
+	diff := directoriesContentsDiff(env.testdata, filepath.Join(restoredir, "testdata"))
+	rtest.Assert(t, diff == "", "directories are not equal: %v", diff)
+
+	testRunCheck(t, env.gopts)
+}
+
 func TestDryRunBackup(t *testing.T) {
 	env, cleanup := withTestEnvironment(t)
 	defer cleanup()
@@ -436,6 +499,39 @@ func TestBackupNonExistingFile(t *testing.T) {
 	testRunBackup(t, "", dirs, opts, env.gopts)
 }
 
+func TestBackupNonExistingFileWarning(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testSetupBackupData(t, env)
+	buf := bytes.NewBuffer(nil)
+	globalOptions.stderr = buf
+	globalOptions.JSON = true
+	atomic.StoreUint32(&warningCount, 0)
+	defer func() {
+		globalOptions.stderr = os.Stderr
+		globalOptions.JSON = false
+		atomic.StoreUint32(&warningCount, 0)
+		warningSummaryShown = false
+	}()
+
+	p := filepath.Join(env.testdata, "0", "0", "9")
+	dirs := []string{
+		filepath.Join(p, "0"),
+		filepath.Join(p, "nonexisting"),
+	}
+
+	testRunBackup(t, "", dirs, BackupOptions{}, env.gopts)
+	rtest.Equals(t, uint(1), warnings())
+	// backup prints the number of warnings in its own summary
+	rtest.Assert(t, warningSummaryShown, "backup did not print the warning summary")
+
+	var warning jsonWarning
+	rtest.OK(t, json.Unmarshal(buf.Bytes(), &warning))
+	rtest.Equals(t, "warning", warning.MessageType)
+	rtest.Equals(t, filepath.Join(p, "nonexisting")+" does not exist, skipping", warning.Message)
+}
+
 func removePacksExcept(gopts GlobalOptions, t *testing.T, keep restic.IDSet, removeTreePacks bool) {
 	r, err := OpenRepository(context.TODO(), gopts)
 	rtest.OK(t, err)
@@ -623,6 +719,55 @@ func TestBackupExclude(t *testing.T) {
 		"expected file %q not in first snapshot, but it's included", "passwords.txt")
 }
 
+func testRunExcludePolicy(t testing.TB, opts ExcludePolicyOptions, gopts GlobalOptions, args ...string) {
+	rtest.OK(t, runExcludePolicy(context.TODO(), opts, gopts, args))
+}
+
+func testExcludePolicies(t testing.TB, gopts GlobalOptions) []restic.ExcludePolicy {
+	repo, err := OpenRepository(context.TODO(), gopts)
+	rtest.OK(t, err)
+	return repo.Config().ExcludePolicies
+}
+
+func TestBackupRepoExcludes(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testRunInit(t, env.gopts)
+
+	datadir := filepath.Join(env.base, "testdata")
+
+	for _, filename := range backupExcludeFilenames {
+		fp := filepath.Join(datadir, filename)
+		rtest.OK(t, os.MkdirAll(filepath.Dir(fp), 0755))
+		rtest.OK(t, os.WriteFile(fp, []byte(filename), 0644))
+	}
+
+	policyOpts := ExcludePolicyOptions{}
+	policyOpts.Excludes = []string{"*.tar.gz"}
+	testRunExcludePolicy(t, policyOpts, env.gopts, "set", "fleet")
+	policyOpts.Excludes = []string{"*.tar.gz", "private/secret"}
+	testRunExcludePolicy(t, policyOpts, env.gopts, "set", "fleet")
+	rtest.Equals(t, 1, len(testExcludePolicies(t, env.gopts)))
+
+	opts := BackupOptions{UseRepoExcludes: []string{"fleet"}}
+	testRunBackup(t, filepath.Dir(env.testdata), []string{"testdata"}, opts, env.gopts)
+	_, snapshotID := lastSnapshot(make(map[string]struct{}), loadSnapshotMap(t, env.gopts))
+	files := testRunLs(t, env.gopts, snapshotID)
+	rtest.Assert(t, !includes(files, "/testdata/foo.tar.gz"),
+		"expected file %q not in snapshot, but it's included", "foo.tar.gz")
+	rtest.Assert(t, !includes(files, "/testdata/private/secret/passwords.txt"),
+		"expected file %q not in snapshot, but it's included", "passwords.txt")
+	rtest.Assert(t, includes(files, "/testdata/work/source/test.c"),
+		"expected file %q in snapshot, but it's not included", "test.c")
+
+	testRunExcludePolicy(t, ExcludePolicyOptions{}, env.gopts, "remove", "fleet")
+	rtest.Equals(t, 0, len(testExcludePolicies(t, env.gopts)))
+
+	err := testRunBackupAssumeFailure(t, filepath.Dir(env.testdata), []string{"testdata"}, opts, env.gopts)
+	rtest.Assert(t, err != nil, "backup with missing exclude policy should fail")
+}
+
 func TestBackupErrors(t *testing.T) {
 	if runtime.GOOS == "windows" {
 		return
@@ -1004,6 +1149,63 @@ func TestTag(t *testing.T) {
 		"expected original ID to be set to the first snapshot id")
 }
 
+func TestTagBulk(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testSetupBackupData(t, env)
+	for _, ts := range []string{"2021-01-01 10:00:00", "2022-01-01 10:00:00", "2023-01-01 10:00:00"} {
+		testRunBackup(t, "", []string{env.testdata}, BackupOptions{TimeStamp: ts}, env.gopts)
+	}
+
+	opts := TagOptions{
+		snapshotFilterOptions: snapshotFilterOptions{
+			After:  "2021-06-01",
+			Before: "2023-01-01",
+		},
+		AddTags: restic.TagLists{[]string{"archived"}},
+		DryRun:  true,
+	}
+
+	buf := bytes.NewBuffer(nil)
+	gopts := env.gopts
+	gopts.stdout = buf
+	gopts.JSON = true
+	rtest.OK(t, runTag(context.TODO(), opts, gopts, nil))
+
+	var plan []struct {
+		ID      string   `json:"id"`
+		NewID   string   `json:"new_id"`
+		NewTags []string `json:"new_tags"`
+	}
+	rtest.OK(t, json.Unmarshal(buf.Bytes(), &plan))
+	rtest.Equals(t, 1, len(plan))
+	rtest.Equals(t, []string{"archived"}, plan[0].NewTags)
+	rtest.Equals(t, "", plan[0].NewID)
+
+	_, snapmap := testRunSnapshots(t, env.gopts)
+	rtest.Equals(t, 3, len(snapmap))
+	for _, sn := range snapmap {
+		rtest.Assert(t, len(sn.Tags) == 0, "dry run modified snapshot %v", sn.ShortID)
+	}
+
+	opts.DryRun = false
+	opts.After = ""
+	testRunTag(t, opts, env.gopts)
+	testRunCheck(t, env.gopts)
+
+	tagged := 0
+	_, snapmap = testRunSnapshots(t, env.gopts)
+	for _, sn := range snapmap {
+		if sn.HasTags([]string{"archived"}) {
+			tagged++
+			rtest.Assert(t, sn.Time.Before(time.Date(2023, 1, 1, 0, 0, 0, 0, time.Local)),
+				"snapshot %v is too new to be tagged", sn.ShortID)
+		}
+	}
+	rtest.Equals(t, 2, tagged)
+}
+
 func testRunKeyListOtherIDs(t testing.TB, gopts GlobalOptions) []string {
 	buf := bytes.NewBuffer(nil)
 
@@ -1229,6 +1431,43 @@ func TestRestore(t *testing.T) {
 	rtest.Assert(t, diff == "", "directories are not equal %v", diff)
 }
 
+func TestRestoreVerifyConflicts(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testRunInit(t, env.gopts)
+
+	p := filepath.Join(env.testdata, "testfile")
+	rtest.OK(t, os.MkdirAll(filepath.Dir(p), 0755))
+	rtest.OK(t, appendRandomData(p, 1024))
+	testRunBackup(t, filepath.Dir(env.testdata), []string{filepath.Base(env.testdata)}, BackupOptions{}, env.gopts)
+	snapshotIDs := testRunList(t, "snapshots", env.gopts)
+	rtest.Assert(t, len(snapshotIDs) == 1, "expected one snapshot, got %v", snapshotIDs)
+
+	// an existing file with different content is kept or restored next to it
+	restoredir := filepath.Join(env.base, "restore")
+	existing := filepath.Join(restoredir, filepath.Base(env.testdata), "testfile")
+	rtest.OK(t, os.MkdirAll(filepath.Dir(existing), 0755))
+	rtest.OK(t, os.WriteFile(existing, []byte("existing content"), 0644))
+
+	opts := RestoreOptions{Target: restoredir, Verify: true, Overwrite: restorer.OverwriteNever}
+	rtest.OK(t, runRestore(context.TODO(), opts, env.gopts, []string{snapshotIDs[0].String()}))
+	buf, err := os.ReadFile(existing)
+	rtest.OK(t, err)
+	rtest.Equals(t, "existing content", string(buf))
+
+	opts = RestoreOptions{Target: restoredir, Verify: true, Overwrite: restorer.OverwriteAlways, KeepBoth: true}
+	rtest.OK(t, runRestore(context.TODO(), opts, env.gopts, []string{snapshotIDs[0].String()}))
+	buf, err = os.ReadFile(existing)
+	rtest.OK(t, err)
+	rtest.Equals(t, "existing content", string(buf))
+	want, err := os.ReadFile(p)
+	rtest.OK(t, err)
+	buf, err = os.ReadFile(existing + ".restored")
+	rtest.OK(t, err)
+	rtest.Assert(t, bytes.Equal(want, buf), "file restored next to the existing one has wrong content")
+}
+
 func TestRestoreLatest(t *testing.T) {
 	env, cleanup := withTestEnvironment(t)
 	defer cleanup()
@@ -1583,6 +1822,133 @@ func TestCheckRestoreNoLock(t *testing.T) {
 	testRunRestore(t, env.gopts, filepath.Join(env.base, "restore"), snapshotIDs[0])
 }
 
+func TestBackupLazyIndex(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testSetupBackupData(t, env)
+	opts := BackupOptions{LazyIndex: true}
+
+	testRunBackup(t, "", []string{env.testdata}, opts, env.gopts)
+	stat1 := dirStats(env.repo)
+
+	// data blobs which are already stored must be found in the lazy index
+	opts.Force = true
+	testRunBackup(t, "", []string{env.testdata}, opts, env.gopts)
+	stat2 := dirStats(env.repo)
+	rtest.Assert(t, stat2.size-stat1.size < stat1.size/10,
+		"second backup with lazy index added too much data: %v -> %v", stat1.size, stat2.size)
+
+	testRunCheck(t, env.gopts)
+}
+
+func TestCheckConcurrentBackup(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testSetupBackupData(t, env)
+	testRunBackup(t, "", []string{env.testdata}, BackupOptions{}, env.gopts)
+
+	// simulate a backup which is still running
+	repo, err := OpenRepository(context.TODO(), env.gopts)
+	rtest.OK(t, err)
+	lock, err := restic.NewLock(context.TODO(), repo)
+	rtest.OK(t, err)
+	defer func() {
+		rtest.OK(t, lock.Unlock())
+	}()
+
+	testRunCheck(t, env.gopts)
+}
+
+func TestCheckResumeReadData(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testSetupBackupData(t, env)
+	testRunBackup(t, "", []string{env.testdata}, BackupOptions{}, env.gopts)
+
+	repo, err := OpenRepository(context.TODO(), env.gopts)
+	rtest.OK(t, err)
+	rtest.OK(t, repo.LoadIndex(context.TODO()))
+
+	dataPacks := restic.NewIDSet()
+	treePacks := restic.NewIDSet()
+	repo.Index().Each(context.TODO(), func(pb restic.PackedBlob) {
+		if pb.Type == restic.TreeBlob {
+			treePacks.Insert(pb.PackID)
+		} else {
+			dataPacks.Insert(pb.PackID)
+		}
+	})
+	dataPacks = dataPacks.Sub(treePacks)
+	rtest.Assert(t, len(dataPacks) > 0, "no data packs found")
+
+	// corrupt a data pack, which a resumed check has already read
+	var corrupted restic.ID
+	for id := range dataPacks {
+		corrupted = id
+		break
+	}
+	filename := filepath.Join(env.repo, "data", corrupted.String()[:2], corrupted.String())
+	buf, err := os.ReadFile(filename)
+	rtest.OK(t, err)
+	buf[len(buf)/2] ^= 0xff
+	rtest.OK(t, os.WriteFile(filename, buf, 0600))
+
+	opts := CheckOptions{ReadData: true}
+	journal, err := openCheckJournal(opts, repo, env.gopts.CacheDir)
+	rtest.OK(t, err)
+	for id := range dataPacks {
+		rtest.OK(t, journal.MarkDone("read", id))
+	}
+	rtest.OK(t, journal.Save())
+
+	// the interrupted check is resumed with the remaining packs
+	rtest.OK(t, runCheck(context.TODO(), opts, env.gopts, nil))
+
+	// the completed check has removed the journal and reads all packs again
+	rtest.Assert(t, runCheck(context.TODO(), opts, env.gopts, nil) != nil,
+		"check did not detect the corrupted pack")
+
+	journal, err = openCheckJournal(opts, repo, env.gopts.CacheDir)
+	rtest.OK(t, err)
+	rtest.OK(t, journal.MarkDone("read", corrupted))
+	rtest.OK(t, journal.Save())
+
+	opts.NoResume = true
+	rtest.Assert(t, runCheck(context.TODO(), opts, env.gopts, nil) != nil,
+		"check with --no-resume did not detect the corrupted pack")
+}
+
+func TestForgetMinSnapshotAge(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testSetupBackupData(t, env)
+	testRunBackup(t, "", []string{env.testdata}, BackupOptions{}, env.gopts)
+	testRunBackup(t, "", []string{env.testdata}, BackupOptions{}, env.gopts)
+	snapshotIDs := testRunList(t, "snapshots", env.gopts)
+	rtest.Assert(t, len(snapshotIDs) == 2, "expected two snapshots, got %v", snapshotIDs)
+
+	rtest.OK(t, runConfig(context.TODO(), env.gopts, []string{"set", "min_snapshot_age", "1d"}))
+
+	err := runForget(context.TODO(), ForgetOptions{}, env.gopts, []string{snapshotIDs[0].String()})
+	rtest.Assert(t, err != nil, "forget of a protected snapshot should fail")
+	rtest.Equals(t, 2, len(testRunList(t, "snapshots", env.gopts)))
+
+	rtest.OK(t, runForget(context.TODO(), ForgetOptions{Last: 1}, env.gopts, nil))
+	rtest.Equals(t, 2, len(testRunList(t, "snapshots", env.gopts)))
+
+	// --force overrides the protection
+	rtest.OK(t, runForget(context.TODO(), ForgetOptions{Force: true}, env.gopts, []string{snapshotIDs[0].String()}))
+	rtest.Equals(t, 1, len(testRunList(t, "snapshots", env.gopts)))
+
+	rtest.OK(t, runConfig(context.TODO(), env.gopts, []string{"set", "min_snapshot_age", ""}))
+	testRunForget(t, env.gopts, snapshotIDs[1].String())
+	rtest.Equals(t, 0, len(testRunList(t, "snapshots", env.gopts)))
+}
+
 func TestPrune(t *testing.T) {
 	testPruneVariants(t, false)
 	testPruneVariants(t, true)
@@ -1621,6 +1987,197 @@ func testPruneVariants(t *testing.T, unsafeNoSpaceRecovery bool) {
 		checkOpts := CheckOptions{ReadData: true, CheckUnused: true}
 		testPrune(t, opts, checkOpts)
 	})
+	t.Run("SmallOnly", func(t *testing.T) {
+		opts := PruneOptions{MaxUnused: "0%", RepackSmall: true, RepackSmallSize: "1M", RepackOnly: true}
+		checkOpts := CheckOptions{ReadData: true}
+		testPrune(t, opts, checkOpts)
+	})
+}
+
+func TestPruneRepackOnly(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testSetupBackupData(t, env)
+	opts := BackupOptions{}
+
+	testRunBackup(t, "", []string{filepath.Join(env.testdata, "0", "0", "9")}, opts, env.gopts)
+	firstSnapshot := testRunList(t, "snapshots", env.gopts)
+	testRunBackup(t, "", []string{filepath.Join(env.testdata, "0", "0", "9", "2")}, opts, env.gopts)
+	testRunForget(t, env.gopts, firstSnapshot[0].String())
+
+	// no pack is below the threshold, thus partly used packs must be kept
+	// although no unused data is tolerated
+	packsBefore := listPacks(env.gopts, t)
+	pruneOpts := PruneOptions{MaxUnused: "0%", RepackSmall: true, RepackSmallSize: "1", RepackOnly: true}
+	testRunPrune(t, env.gopts, pruneOpts)
+	packsAfter := listPacks(env.gopts, t)
+	rtest.Assert(t, len(packsAfter) > 0, "all packs were removed")
+	for id := range packsAfter {
+		rtest.Assert(t, packsBefore.Has(id), "pack %v was created by repacking", id.Str())
+	}
+	rtest.OK(t, runCheck(context.TODO(), CheckOptions{ReadData: true}, env.gopts, nil))
+	rtest.Assert(t, runCheck(context.TODO(), CheckOptions{CheckUnused: true}, env.gopts, nil) != nil,
+		"expected unused blobs to remain in the repository")
+
+	// without --repack-only, the same options repack all partly used packs
+	testRunPrune(t, env.gopts, PruneOptions{MaxUnused: "0%"})
+	rtest.OK(t, runCheck(context.TODO(), CheckOptions{ReadData: true, CheckUnused: true}, env.gopts, nil))
+}
+
+func testOpenPruneJournal(t testing.TB, gopts GlobalOptions) (*repository.Repository, *repository.OperationJournal) {
+	repo, err := OpenRepository(context.TODO(), gopts)
+	rtest.OK(t, err)
+	snapshotLister, err := backend.MemorizeList(context.TODO(), repo.Backend(), restic.SnapshotFile)
+	rtest.OK(t, err)
+	rtest.OK(t, repo.LoadIndex(context.TODO()))
+	journal, err := openPruneJournal(context.TODO(), repo, snapshotLister, restic.NewIDSet())
+	rtest.OK(t, err)
+	return repo, journal
+}
+
+func TestPruneResume(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testSetupBackupData(t, env)
+	opts := BackupOptions{}
+
+	testRunBackup(t, "", []string{filepath.Join(env.testdata, "0", "0", "9")}, opts, env.gopts)
+	firstSnapshot := testRunList(t, "snapshots", env.gopts)
+	testRunBackup(t, "", []string{filepath.Join(env.testdata, "0", "0", "9", "2")}, opts, env.gopts)
+	testRunForget(t, env.gopts, firstSnapshot[0].String())
+	packsBefore := listPacks(env.gopts, t)
+
+	// simulate a prune which was interrupted after repacking, the packs to
+	// remove may have been deleted already
+	repo, journal := testOpenPruneJournal(t, env.gopts)
+	rtest.OK(t, setPrunePending(journal, prunePending{RemovePacks: restic.IDs{restic.NewRandomID()}}, repo.Index().(*index.MasterIndex).IDs()))
+
+	// the resumed prune only completes the interrupted one
+	testRunPrune(t, env.gopts, PruneOptions{MaxUnused: "0%"})
+	rtest.Equals(t, packsBefore, listPacks(env.gopts, t))
+	rtest.OK(t, runCheck(context.TODO(), CheckOptions{ReadData: true}, env.gopts, nil))
+
+	repo, journal = testOpenPruneJournal(t, env.gopts)
+	rtest.Assert(t, !journal.Resumed(), "journal was not removed")
+
+	testRunPrune(t, env.gopts, PruneOptions{MaxUnused: "0%"})
+	rtest.Assert(t, len(listPacks(env.gopts, t)) < len(packsBefore), "prune did not remove packs")
+	rtest.OK(t, runCheck(context.TODO(), CheckOptions{ReadData: true, CheckUnused: true}, env.gopts, nil))
+}
+
+func TestPruneResumeDiscard(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testSetupBackupData(t, env)
+	testRunBackup(t, "", []string{filepath.Join(env.testdata, "0", "0", "9")}, BackupOptions{}, env.gopts)
+	packs := listPacks(env.gopts, t)
+
+	// the journal is discarded if the index was changed in between
+	repo, journal := testOpenPruneJournal(t, env.gopts)
+	rtest.OK(t, journal.Set("pending", prunePending{
+		IgnorePacks: packs.List(),
+		RemovePacks: packs.List(),
+		Indexes:     restic.IDs{restic.NewRandomID()},
+	}))
+	repo, journal = testOpenPruneJournal(t, env.gopts)
+	rtest.Assert(t, !journal.Resumed(), "journal for a changed index was not discarded")
+
+	// packs which contain the only copy of used data are not removed
+	rtest.OK(t, setPrunePending(journal, prunePending{
+		IgnorePacks: packs.List(),
+		RemovePacks: packs.List(),
+	}, repo.Index().(*index.MasterIndex).IDs()))
+	gopts := env.gopts
+	gopts.backendTestHook = func(r restic.Backend) (restic.Backend, error) { return newListOnceBackend(r), nil }
+	err := runPrune(context.TODO(), PruneOptions{MaxUnused: "0%"}, gopts)
+	rtest.Assert(t, err != nil && strings.Contains(err.Error(), "not stored in any remaining pack"),
+		"expected resuming the prune to fail, got %v", err)
+	rtest.Equals(t, packs, listPacks(env.gopts, t))
+	rtest.OK(t, runCheck(context.TODO(), CheckOptions{ReadData: true}, env.gopts, nil))
+
+	testRunPrune(t, env.gopts, PruneOptions{MaxUnused: "0%"})
+	rtest.OK(t, runCheck(context.TODO(), CheckOptions{ReadData: true, CheckUnused: true}, env.gopts, nil))
+}
+
+func TestPruneRepackOptions(t *testing.T) {
+	for _, opts := range []PruneOptions{
+		{MaxUnused: "5%", RepackSmallSize: "1M"},
+		{MaxUnused: "5%", RepackSmall: true, RepackSmallSize: "foo"},
+		{MaxUnused: "5%", RepackOnly: true},
+	} {
+		err := verifyPruneOptions(&opts)
+		rtest.Assert(t, err != nil, "expected error for options %+v", opts)
+	}
+
+	opts := PruneOptions{MaxUnused: "5%", RepackSmall: true, RepackSmallSize: "2M", RepackOnly: true}
+	rtest.OK(t, verifyPruneOptions(&opts))
+	rtest.Equals(t, uint64(2*1024*1024), opts.repackSmallBytes)
+}
+
+func testRunUnused(t testing.TB, gopts GlobalOptions, opts UnusedOptions, args ...string) []UnusedResult {
+	buf := bytes.NewBuffer(nil)
+	globalOptions.stdout = buf
+	defer func() {
+		globalOptions.stdout = os.Stdout
+	}()
+	gopts.JSON = true
+
+	rtest.OK(t, runUnused(context.TODO(), opts, gopts, args))
+
+	var results []UnusedResult
+	rtest.OK(t, json.Unmarshal(buf.Bytes(), &results))
+	return results
+}
+
+func TestUnused(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testSetupBackupData(t, env)
+	opts := BackupOptions{}
+
+	testRunBackup(t, "", []string{filepath.Join(env.testdata, "0", "0", "9")}, opts, env.gopts)
+	firstSnapshot := testRunList(t, "snapshots", env.gopts)
+	testRunBackup(t, "", []string{filepath.Join(env.testdata, "0", "0", "9", "2")}, opts, env.gopts)
+	packsBefore := listPacks(env.gopts, t)
+
+	unusedOpts := UnusedOptions{MaxUnused: []string{"0%", "unlimited"}}
+	results := testRunUnused(t, env.gopts, unusedOpts, firstSnapshot[0].String())
+	rtest.Equals(t, 4, len(results))
+
+	// nothing can be removed as long as all snapshots are kept
+	for _, res := range results[:2] {
+		rtest.Equals(t, "none", res.Scenario)
+		rtest.Equals(t, 0, len(res.RemovedSnapshots))
+		rtest.Equals(t, uint64(0), res.UnusedSize)
+		rtest.Equals(t, uint64(0), res.FreedSize)
+	}
+
+	strict, unlimited := results[2], results[3]
+	rtest.Equals(t, firstSnapshot[0].Str(), strict.Scenario)
+	rtest.Equals(t, firstSnapshot, strict.RemovedSnapshots)
+	rtest.Equals(t, "0%", strict.MaxUnused)
+	rtest.Equals(t, "unlimited", unlimited.MaxUnused)
+	rtest.Assert(t, strict.UnusedSize > 0, "expected unused data without the first snapshot")
+	rtest.Equals(t, strict.UnusedSize, strict.FreedSize)
+	rtest.Equals(t, uint64(0), strict.UnusedSizeAfter)
+	rtest.Assert(t, unlimited.FreedSize <= strict.FreedSize && unlimited.RepackSize <= strict.RepackSize,
+		"unlimited unused data frees more than 0%%: %+v, %+v", unlimited, strict)
+
+	// the repository must not be modified
+	rtest.Equals(t, packsBefore, listPacks(env.gopts, t))
+
+	err := runUnused(context.TODO(), UnusedOptions{MaxUnused: []string{"foo"}}, env.gopts, nil)
+	rtest.Assert(t, err != nil, "expected error for invalid --max-unused value")
+
+	testRunForget(t, env.gopts, firstSnapshot[0].String())
+	testRunPrune(t, env.gopts, PruneOptions{MaxUnused: "0%"})
+	results = testRunUnused(t, env.gopts, unusedOpts)
+	rtest.Equals(t, 2, len(results))
+	rtest.Equals(t, uint64(0), results[0].UnusedSize)
 }
 
 func testPrune(t *testing.T, pruneOpts PruneOptions, checkOpts CheckOptions) {
@@ -1648,6 +2205,63 @@ func testPrune(t *testing.T, pruneOpts PruneOptions, checkOpts CheckOptions) {
 	rtest.OK(t, runCheck(context.TODO(), checkOpts, env.gopts, nil))
 }
 
+func testRunStatsHistory(t testing.TB, gopts GlobalOptions) []StatsRecord {
+	buf := bytes.NewBuffer(nil)
+	globalOptions.stdout = buf
+	globalOptions.JSON = true
+	statsOptions.history = true
+	defer func() {
+		globalOptions.stdout = os.Stdout
+		globalOptions.JSON = gopts.JSON
+		statsOptions.history = false
+	}()
+
+	rtest.OK(t, runStats(context.TODO(), globalOptions, nil))
+
+	var records []StatsRecord
+	rtest.OK(t, json.Unmarshal(buf.Bytes(), &records))
+	return records
+}
+
+func TestStatsHistory(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testSetupBackupData(t, env)
+	rtest.Equals(t, 0, len(testRunStatsHistory(t, env.gopts)))
+
+	// records are only saved with --record-stats
+	testRunBackup(t, "", []string{filepath.Join(env.testdata, "0", "0", "9", "1")}, BackupOptions{}, env.gopts)
+	rtest.Equals(t, 0, len(testRunStatsHistory(t, env.gopts)))
+	snapshotIDs := testRunList(t, "snapshots", env.gopts)
+	testRunForget(t, env.gopts, snapshotIDs[0].String())
+
+	opts := BackupOptions{Host: "example", RecordStats: true}
+	testRunBackup(t, "", []string{filepath.Join(env.testdata, "0", "0", "9")}, opts, env.gopts)
+	testRunBackup(t, "", []string{filepath.Join(env.testdata, "0", "0", "9", "2")}, opts, env.gopts)
+
+	snapshotIDs = testRunList(t, "snapshots", env.gopts)
+	testRunForget(t, env.gopts, snapshotIDs[0].String())
+	pruneOpts := pruneDefaultOptions
+	pruneOpts.RecordStats = true
+	testRunPrune(t, env.gopts, pruneOpts)
+
+	records := testRunStatsHistory(t, env.gopts)
+	rtest.Equals(t, 3, len(records))
+
+	for i, command := range []string{"backup", "backup", "prune"} {
+		rtest.Equals(t, command, records[i].Command)
+		rtest.Assert(t, records[i].DataBlobs > 0 && records[i].TreeBlobs > 0,
+			"record %d does not contain blobs: %+v", i, records[i])
+	}
+	rtest.Equals(t, "example", records[0].Hostname)
+	rtest.Equals(t, uint(1), records[0].Snapshots)
+	rtest.Equals(t, uint(2), records[1].Snapshots)
+	rtest.Equals(t, uint(1), records[2].Snapshots)
+	rtest.Assert(t, records[2].StoredSize < records[1].StoredSize,
+		"prune did not reduce the stored size: %+v", records)
+}
+
 var pruneDefaultOptions = PruneOptions{MaxUnused: "5%"}
 
 func listPacks(gopts GlobalOptions, t *testing.T) restic.IDSet {
@@ -2091,6 +2705,42 @@ func TestDiff(t *testing.T) {
 	rtest.Assert(t, len(outQuiet) < len(out), "expected shorter output on quiet mode %v vs. %v", len(outQuiet), len(out))
 }
 
+func TestLsSnapshotDiff(t *testing.T) {
+	env, cleanup, firstSnapshotID, secondSnapshotID := setupDiffRepo(t)
+	defer cleanup()
+
+	buf := bytes.NewBuffer(nil)
+	globalOptions.stdout = buf
+	defer func() {
+		globalOptions.stdout = os.Stdout
+	}()
+
+	opts := LsOptions{SnapshotDiff: firstSnapshotID}
+	rtest.OK(t, runLs(context.TODO(), opts, env.gopts, []string{secondSnapshotID}))
+
+	moddir := filepath.ToSlash(filepath.Join(env.base, "testdata", "moddir"))
+	lines := make(map[string]struct{})
+	for _, line := range strings.Split(buf.String(), "\n") {
+		lines[line] = struct{}{}
+	}
+
+	for _, line := range []string{
+		"-    " + moddir + "/modfile",
+		"M    " + moddir + "/modfile1",
+		"+    " + moddir + "/modfile2",
+		"+    " + moddir + "/modfile3",
+		"+    " + moddir + "/modfile4",
+		"-    " + moddir + "/submoddir",
+		"-    " + moddir + "/submoddir/subsubmoddir",
+		"+    " + moddir + "/submoddir2",
+		"+    " + moddir + "/submoddir2/subsubmoddir",
+	} {
+		_, ok := lines[line]
+		rtest.Assert(t, ok, "line %q missing from output\n%v", line, buf.String())
+	}
+	rtest.Assert(t, !strings.Contains(buf.String(), "testdir"), "unchanged directory listed in output\n%v", buf.String())
+}
+
 type typeSniffer struct {
 	MessageType string `json:"message_type"`
 }
@@ -2209,7 +2859,7 @@ func TestFindListOnce(t *testing.T) {
 
 	snapshotIDs := restic.NewIDSet()
 	// specify the two oldest snapshots explicitly and use "latest" to reference the newest one
-	for sn := range FindFilteredSnapshots(context.TODO(), repo.Backend(), repo, nil, nil, nil, []string{
+	for sn := range FindFilteredSnapshots(context.TODO(), repo.Backend(), repo, &snapshotFilterOptions{}, []string{
 		secondSnapshot[0].String(),
 		secondSnapshot[1].String()[:8],
 		"latest",
@@ -2220,3 +2870,54 @@ func TestFindListOnce(t *testing.T) {
 	// the snapshots can only be listed once, if both lists match then the there has been only a single List() call
 	rtest.Equals(t, thirdSnapshot, snapshotIDs)
 }
+
+func TestFindSnapshotSelectors(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testSetupBackupData(t, env)
+	var ids []restic.ID
+	snapshots := make(map[string]struct{})
+	for _, ts := range []string{"2021-01-01 10:00:00", "2022-01-01 10:00:00", "2023-01-01 10:00:00"} {
+		testRunBackup(t, "", []string{env.testdata}, BackupOptions{TimeStamp: ts}, env.gopts)
+		var id string
+		snapshots, id = lastSnapshot(snapshots, loadSnapshotMap(t, env.gopts))
+		ids = append(ids, restic.TestParseID(id))
+	}
+
+	repo, err := OpenRepository(context.TODO(), env.gopts)
+	rtest.OK(t, err)
+	// the test backend only allows listing the snapshots once
+	snapshotLister, err := backend.MemorizeList(context.TODO(), repo.Backend(), restic.SnapshotFile)
+	rtest.OK(t, err)
+
+	find := func(opts snapshotFilterOptions, args ...string) restic.IDSet {
+		found := restic.NewIDSet()
+		for sn := range FindFilteredSnapshots(context.TODO(), snapshotLister, repo, &opts, args) {
+			found.Insert(*sn.ID())
+		}
+		return found
+	}
+
+	rtest.Equals(t, restic.NewIDSet(ids[1]), find(snapshotFilterOptions{}, "latest~1"))
+	rtest.Equals(t, restic.NewIDSet(ids[0], ids[1]), find(snapshotFilterOptions{}, "..2022-06-01"))
+	rtest.Equals(t, restic.NewIDSet(ids[1], ids[2]), find(snapshotFilterOptions{After: "2021-06-01"}))
+	rtest.Equals(t, restic.NewIDSet(ids[0], ids[2]), find(snapshotFilterOptions{}, "2022-06-01..", ids[0].String()))
+
+	sn, err := findFilteredSnapshot(context.TODO(), snapshotLister, repo, &snapshotFilterOptions{Before: "2022-06-01"}, "latest")
+	rtest.OK(t, err)
+	rtest.Equals(t, ids[1], *sn.ID())
+
+	sn, err = findFilteredSnapshot(context.TODO(), snapshotLister, repo, &snapshotFilterOptions{}, "2021-01-01..2022-06-01")
+	rtest.OK(t, err)
+	rtest.Equals(t, ids[1], *sn.ID())
+
+	// invalid selectors are reported instead of selecting no snapshots
+	for _, args := range [][]string{{"..2022-13-01"}, {".."}, {ids[0].String(), "foo.."}} {
+		err = runForget(context.TODO(), ForgetOptions{}, env.gopts, args)
+		rtest.Assert(t, errors.IsFatal(err), "expected fatal error for %v, got %v", args, err)
+	}
+	err = runSnapshots(context.TODO(), SnapshotOptions{snapshotFilterOptions: snapshotFilterOptions{Before: "foo"}}, env.gopts, nil)
+	rtest.Assert(t, errors.IsFatal(err), "expected fatal error for invalid --before, got %v", err)
+	rtest.Equals(t, 3, len(testRunList(t, "snapshots", env.gopts)))
+}
@@ -85,7 +85,7 @@ func refreshLocks(ctx context.Context, lock *restic.Lock, lockInfo *lockContext,
 		debug.Log("unlocking repository with lock %v", lock)
 		if err := lock.Unlock(); err != nil {
 			debug.Log("error while unlocking: %v", err)
-			Warnf("error while unlocking: %v", err)
+			Warningf("error while unlocking: %v\n", err)
 		}
 
 		lockInfo.refreshWG.Done()
@@ -105,7 +105,7 @@ func refreshLocks(ctx context.Context, lock *restic.Lock, lockInfo *lockContext,
 			debug.Log("refreshing locks")
 			err := lock.Refresh(context.TODO())
 			if err != nil {
-				Warnf("unable to refresh lock: %v\n", err)
+				Warningf("unable to refresh lock: %v\n", err)
 			} else {
 				lastRefresh = lock.Time
 				// inform monitor gorountine about successful refresh
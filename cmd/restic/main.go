@@ -7,6 +7,7 @@ import (
 	"log"
 	"os"
 	"runtime"
+	"time"
 
 	"github.com/restic/restic/internal/debug"
 	"github.com/restic/restic/internal/options"
@@ -30,6 +31,8 @@ directories in an encrypted repository stored on different backends.
 	DisableAutoGenTag: true,
 
 	PersistentPreRunE: func(c *cobra.Command, args []string) error {
+		setTelemetryCommand(c, nil)
+
 		// set verbosity, default is one
 		globalOptions.verbosity = 1
 		if globalOptions.Quiet && globalOptions.Verbose > 0 {
@@ -45,6 +48,30 @@ directories in an encrypted repository stored on different backends.
 			globalOptions.verbosity = 0
 		}
 
+		// the bundle may set environment variables for other global options
+		var bundlePassword string
+		if globalOptions.ConfigBundle != "" {
+			var err error
+			bundlePassword, err = applyConfigBundle(c.Context(), &globalOptions)
+			if err != nil {
+				return err
+			}
+		}
+
+		if globalOptions.MaxCores < 0 {
+			return errors.Fatal("--max-cores must not be negative")
+		}
+		if globalOptions.MaxCores > 0 {
+			runtime.GOMAXPROCS(globalOptions.MaxCores)
+		}
+
+		limit, err := raiseOpenFileLimit()
+		if err != nil {
+			debug.Log("unable to raise the open file limit: %v", err)
+		}
+		debug.Log("open file limit is %v", limit)
+		globalOptions.openFileLimit = limit
+
 		// parse extended options
 		opts, err := options.Parse(globalOptions.Options)
 		if err != nil {
@@ -59,6 +86,15 @@ directories in an encrypted repository stored on different backends.
 			fmt.Fprintf(os.Stderr, "Resolving password failed: %v\n", err)
 			Exit(1)
 		}
+		if pwd == "" {
+			pwd = bundlePassword
+		}
+		if pwd == "" && globalOptions.TPMKey != "" {
+			pwd, err = applyTPMKey(c.Context(), &globalOptions)
+			if err != nil {
+				return err
+			}
+		}
 		globalOptions.password = pwd
 
 		// run the debug functions for all subcommands (if build tag "debug" is
@@ -76,7 +112,7 @@ directories in an encrypted repository stored on different backends.
 // user for authentication).
 func needsPassword(cmd string) bool {
 	switch cmd {
-	case "cache", "generate", "help", "options", "self-update", "version":
+	case "cache", "generate", "help", "history", "options", "self-update", "version":
 		return false
 	default:
 		return true
@@ -93,7 +129,9 @@ func main() {
 	debug.Log("main %#v", os.Args)
 	debug.Log("restic %s compiled with %v on %v/%v",
 		version, runtime.Version(), runtime.GOOS, runtime.GOARCH)
-	err := cmdRoot.ExecuteContext(internalGlobalCtx)
+	AddCleanupHandler(telemetryHandler(&globalOptions, time.Now()))
+	cmd, err := cmdRoot.ExecuteContextC(internalGlobalCtx)
+	setTelemetryCommand(cmd, err)
 
 	switch {
 	case restic.IsAlreadyLocked(err):
@@ -114,14 +152,22 @@ func main() {
 		}
 	}
 
+	if err == nil || err == ErrInvalidSourceData {
+		printWarningSummary()
+	}
+
 	var exitCode int
 	switch err {
 	case nil:
 		exitCode = 0
+		if globalOptions.WarningExitCode && warnings() > 0 {
+			exitCode = exitCodeWarnings
+		}
 	case ErrInvalidSourceData:
 		exitCode = 3
 	default:
 		exitCode = 1
 	}
+
 	Exit(exitCode)
 }
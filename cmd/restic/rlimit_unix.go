@@ -0,0 +1,27 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import "golang.org/x/sys/unix"
+
+// raiseOpenFileLimit raises the soft limit for the number of open files to
+// the hard limit and returns the resulting soft limit. If the limit cannot be
+// raised, the current limit is returned together with the error.
+func raiseOpenFileLimit() (uint64, error) {
+	var lim unix.Rlimit
+	if err := unix.Getrlimit(unix.RLIMIT_NOFILE, &lim); err != nil {
+		return 0, err
+	}
+
+	if lim.Cur < lim.Max {
+		cur := lim.Cur
+		lim.Cur = lim.Max
+		if err := unix.Setrlimit(unix.RLIMIT_NOFILE, &lim); err != nil {
+			// for example macOS refuses limits above kern.maxfilesperproc
+			return uint64(cur), err
+		}
+	}
+
+	return uint64(lim.Cur), nil
+}
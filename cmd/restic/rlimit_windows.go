@@ -0,0 +1,7 @@
+package main
+
+// raiseOpenFileLimit does nothing on Windows, which has no relevant limit for
+// the number of open files. It always returns zero.
+func raiseOpenFileLimit() (uint64, error) {
+	return 0, nil
+}
@@ -1,8 +1,6 @@
 package main
 
 import (
-	"os"
-
 	"github.com/restic/restic/internal/errors"
 	"github.com/spf13/pflag"
 )
@@ -37,11 +35,11 @@ func initSecondaryRepoOptions(f *pflag.FlagSet, opts *secondaryRepoOptions, repo
 	_ = f.MarkHidden("key-hint2")
 	_ = f.MarkHidden("password-command2")
 
-	opts.LegacyRepo = os.Getenv("RESTIC_REPOSITORY2")
-	opts.LegacyRepositoryFile = os.Getenv("RESTIC_REPOSITORY_FILE2")
-	opts.LegacyPasswordFile = os.Getenv("RESTIC_PASSWORD_FILE2")
-	opts.LegacyKeyHint = os.Getenv("RESTIC_KEY_HINT2")
-	opts.LegacyPasswordCommand = os.Getenv("RESTIC_PASSWORD_COMMAND2")
+	setFromEnv("RESTIC_REPOSITORY2", func(*GlobalOptions) interface{} { return &opts.LegacyRepo })
+	setFromEnv("RESTIC_REPOSITORY_FILE2", func(*GlobalOptions) interface{} { return &opts.LegacyRepositoryFile })
+	setFromEnv("RESTIC_PASSWORD_FILE2", func(*GlobalOptions) interface{} { return &opts.LegacyPasswordFile })
+	setFromEnv("RESTIC_KEY_HINT2", func(*GlobalOptions) interface{} { return &opts.LegacyKeyHint })
+	setFromEnv("RESTIC_PASSWORD_COMMAND2", func(*GlobalOptions) interface{} { return &opts.LegacyPasswordCommand })
 
 	f.StringVarP(&opts.Repo, "from-repo", "", "", "source `repository` "+repoUsage+" (default: $RESTIC_FROM_REPOSITORY)")
 	f.StringVarP(&opts.RepositoryFile, "from-repository-file", "", "", "`file` from which to read the source repository location "+repoUsage+" (default: $RESTIC_FROM_REPOSITORY_FILE)")
@@ -49,11 +47,11 @@ func initSecondaryRepoOptions(f *pflag.FlagSet, opts *secondaryRepoOptions, repo
 	f.StringVarP(&opts.KeyHint, "from-key-hint", "", "", "key ID of key to try decrypting the source repository first (default: $RESTIC_FROM_KEY_HINT)")
 	f.StringVarP(&opts.PasswordCommand, "from-password-command", "", "", "shell `command` to obtain the source repository password from (default: $RESTIC_FROM_PASSWORD_COMMAND)")
 
-	opts.Repo = os.Getenv("RESTIC_FROM_REPOSITORY")
-	opts.RepositoryFile = os.Getenv("RESTIC_FROM_REPOSITORY_FILE")
-	opts.PasswordFile = os.Getenv("RESTIC_FROM_PASSWORD_FILE")
-	opts.KeyHint = os.Getenv("RESTIC_FROM_KEY_HINT")
-	opts.PasswordCommand = os.Getenv("RESTIC_FROM_PASSWORD_COMMAND")
+	setFromEnv("RESTIC_FROM_REPOSITORY", func(*GlobalOptions) interface{} { return &opts.Repo })
+	setFromEnv("RESTIC_FROM_REPOSITORY_FILE", func(*GlobalOptions) interface{} { return &opts.RepositoryFile })
+	setFromEnv("RESTIC_FROM_PASSWORD_FILE", func(*GlobalOptions) interface{} { return &opts.PasswordFile })
+	setFromEnv("RESTIC_FROM_KEY_HINT", func(*GlobalOptions) interface{} { return &opts.KeyHint })
+	setFromEnv("RESTIC_FROM_PASSWORD_COMMAND", func(*GlobalOptions) interface{} { return &opts.PasswordCommand })
 }
 
 func fillSecondaryGlobalOpts(opts secondaryRepoOptions, gopts GlobalOptions, repoPrefix string) (GlobalOptions, bool, error) {
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/restic/restic/internal/backend/location"
+	"github.com/restic/restic/internal/cache"
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/fs"
+	"github.com/restic/restic/internal/restic"
+
+	"github.com/spf13/cobra"
+)
+
+// telemetryMaxRuns is the number of runs kept in the telemetry store, older
+// runs are removed.
+const telemetryMaxRuns = 100
+
+// telemetryFilename is the name of the telemetry store within the cache
+// directory. It is shared by all repositories.
+const telemetryFilename = "telemetry.json"
+
+// TelemetryRun describes a single run of restic. It is only stored locally and
+// never sent anywhere.
+type TelemetryRun struct {
+	Time            time.Time     `json:"time"`
+	Command         string        `json:"command"`
+	Repository      string        `json:"repository,omitempty"`
+	Duration        time.Duration `json:"duration"`
+	ExitCode        int           `json:"exit_code"`
+	Error           string        `json:"error,omitempty"`
+	Warnings        uint          `json:"warnings,omitempty"`
+	BytesUploaded   uint64        `json:"bytes_uploaded"`
+	BytesDownloaded uint64        `json:"bytes_downloaded"`
+}
+
+// telemetryStore holds the most recent runs, oldest first.
+type telemetryStore struct {
+	filename string
+	Runs     []TelemetryRun `json:"runs"`
+}
+
+// telemetryFile returns the location of the telemetry store for gopts.
+func telemetryFile(gopts GlobalOptions) (string, error) {
+	if gopts.NoCache {
+		return "", errors.Fatal("the telemetry store is located in the cache directory, which is disabled by --no-cache")
+	}
+
+	dir := gopts.CacheDir
+	if dir == "" {
+		var err error
+		dir, err = cache.DefaultDir()
+		if err != nil {
+			return "", err
+		}
+	}
+	return filepath.Join(dir, telemetryFilename), nil
+}
+
+// loadTelemetryStore loads the store from filename. A missing or damaged file
+// results in an empty store.
+func loadTelemetryStore(filename string) (*telemetryStore, error) {
+	store := &telemetryStore{filename: filename}
+	ok, err := fs.ReadJSONFile(filename, store)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		debug.Log("no usable telemetry store in %v", filename)
+		return &telemetryStore{filename: filename}, nil
+	}
+	return store, nil
+}
+
+// add appends run to the store, only the newest telemetryMaxRuns runs are
+// kept.
+func (s *telemetryStore) add(run TelemetryRun) {
+	s.Runs = append(s.Runs, run)
+	if len(s.Runs) > telemetryMaxRuns {
+		s.Runs = append([]TelemetryRun(nil), s.Runs[len(s.Runs)-telemetryMaxRuns:]...)
+	}
+}
+
+// save writes the store to disk. Runs which finish at the same time may
+// overwrite each others record, which is acceptable for local statistics.
+func (s *telemetryStore) save() error {
+	buf, err := json.Marshal(s)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	return fs.WriteFileAtomic(s.filename, buf)
+}
+
+// telemetryBytesUploaded and telemetryBytesDownloaded count the data
+// transferred to and from all repositories opened by the current command.
+var telemetryBytesUploaded, telemetryBytesDownloaded uint64
+
+// telemetryBackend counts the bytes saved to and loaded from a backend.
+type telemetryBackend struct {
+	restic.Backend
+}
+
+func (be telemetryBackend) Save(ctx context.Context, h restic.Handle, rd restic.RewindReader) error {
+	err := be.Backend.Save(ctx, h, rd)
+	if err == nil {
+		atomic.AddUint64(&telemetryBytesUploaded, uint64(rd.Length()))
+	}
+	return err
+}
+
+func (be telemetryBackend) Load(ctx context.Context, h restic.Handle, length int, offset int64, consumer func(rd io.Reader) error) error {
+	return be.Backend.Load(ctx, h, length, offset, func(rd io.Reader) error {
+		return consumer(telemetryReader{rd})
+	})
+}
+
+type telemetryReader struct {
+	io.Reader
+}
+
+func (rd telemetryReader) Read(p []byte) (int, error) {
+	n, err := rd.Reader.Read(p)
+	atomic.AddUint64(&telemetryBytesDownloaded, uint64(n))
+	return n, err
+}
+
+// telemetryCommand is the command which is currently run and the error it
+// returned, they are recorded by the handler returned by telemetryHandler.
+var telemetryCommand struct {
+	sync.Mutex
+	cmd *cobra.Command
+	err error
+}
+
+// setTelemetryCommand sets the command and the error recorded in the telemetry
+// store when restic exits.
+func setTelemetryCommand(cmd *cobra.Command, err error) {
+	telemetryCommand.Lock()
+	defer telemetryCommand.Unlock()
+	telemetryCommand.cmd = cmd
+	telemetryCommand.err = err
+}
+
+// telemetryHandler returns a cleanup handler which records the command set by
+// setTelemetryCommand if telemetry is enabled in gopts. As a cleanup handler,
+// it also records runs which end by calling Exit or which are interrupted by
+// a signal.
+func telemetryHandler(gopts *GlobalOptions, start time.Time) func(code int) (int, error) {
+	return func(code int) (int, error) {
+		if !gopts.Telemetry {
+			return code, nil
+		}
+
+		telemetryCommand.Lock()
+		cmd, err := telemetryCommand.cmd, telemetryCommand.err
+		telemetryCommand.Unlock()
+
+		recordTelemetry(*gopts, cmd, start, code, err)
+		return code, nil
+	}
+}
+
+// recordTelemetry adds a record of the command which just finished to the
+// telemetry store. Errors are only logged, as they must not change the result
+// of the command.
+func recordTelemetry(gopts GlobalOptions, cmd *cobra.Command, start time.Time, exitCode int, cmdErr error) {
+	if cmd == nil || cmd == cmdRoot {
+		return
+	}
+	switch cmd.Name() {
+	case "history", "help", "version":
+		return
+	}
+
+	filename, err := telemetryFile(gopts)
+	if err != nil {
+		debug.Log("not recording telemetry: %v", err)
+		return
+	}
+
+	run := TelemetryRun{
+		Time:            start,
+		Command:         strings.TrimPrefix(cmd.CommandPath(), cmdRoot.Name()+" "),
+		Duration:        time.Since(start),
+		ExitCode:        exitCode,
+		Warnings:        warnings(),
+		BytesUploaded:   atomic.LoadUint64(&telemetryBytesUploaded),
+		BytesDownloaded: atomic.LoadUint64(&telemetryBytesDownloaded),
+	}
+	if repo, err := ReadRepo(gopts); err == nil {
+		run.Repository = location.StripPassword(repo)
+	}
+	if cmdErr != nil {
+		// only keep the first line, fatal errors may contain a stack trace
+		run.Error, _, _ = strings.Cut(cmdErr.Error(), "\n")
+	}
+
+	store, err := loadTelemetryStore(filename)
+	if err == nil {
+		store.add(run)
+		err = store.save()
+	}
+	if err != nil {
+		debug.Log("unable to record telemetry in %v: %v", filename, err)
+	}
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/restic/restic/internal/errors"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func TestTelemetryStore(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "cache", telemetryFilename)
+
+	store, err := loadTelemetryStore(filename)
+	rtest.OK(t, err)
+	rtest.Equals(t, 0, len(store.Runs))
+
+	start := time.Unix(1600000000, 0).UTC()
+	for i := 0; i < telemetryMaxRuns+5; i++ {
+		store.add(TelemetryRun{Time: start.Add(time.Duration(i) * time.Minute), Command: "backup", ExitCode: i})
+	}
+	rtest.OK(t, store.save())
+
+	store, err = loadTelemetryStore(filename)
+	rtest.OK(t, err)
+	rtest.Equals(t, telemetryMaxRuns, len(store.Runs))
+	// the oldest runs are removed
+	rtest.Equals(t, 5, store.Runs[0].ExitCode)
+	rtest.Equals(t, telemetryMaxRuns+4, store.Runs[len(store.Runs)-1].ExitCode)
+
+	// a damaged store is replaced
+	rtest.OK(t, os.WriteFile(filename, []byte("{invalid"), 0600))
+	store, err = loadTelemetryStore(filename)
+	rtest.OK(t, err)
+	rtest.Equals(t, 0, len(store.Runs))
+}
+
+func testRunHistory(t testing.TB, gopts GlobalOptions, opts HistoryOptions) []TelemetryRun {
+	buf := bytes.NewBuffer(nil)
+	gopts.stdout = buf
+	gopts.JSON = true
+
+	rtest.OK(t, runHistory(opts, gopts, nil))
+
+	var runs []TelemetryRun
+	rtest.OK(t, json.Unmarshal(buf.Bytes(), &runs))
+	return runs
+}
+
+func TestHistory(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	env.gopts.Telemetry = true
+	atomic.StoreUint64(&telemetryBytesUploaded, 0)
+	atomic.StoreUint64(&telemetryBytesDownloaded, 0)
+
+	testSetupBackupData(t, env)
+	start := time.Now()
+	testRunBackup(t, "", []string{env.testdata}, BackupOptions{}, env.gopts)
+	recordTelemetry(env.gopts, cmdBackup, start, 0, nil)
+
+	testRunCheck(t, env.gopts)
+	recordTelemetry(env.gopts, cmdCheck, start, 1, errors.New("check failed\nsecond line"))
+
+	// the history command itself is not recorded
+	recordTelemetry(env.gopts, cmdHistory, start, 0, nil)
+
+	runs := testRunHistory(t, env.gopts, HistoryOptions{})
+	rtest.Equals(t, 2, len(runs))
+	rtest.Equals(t, "backup", runs[0].Command)
+	rtest.Equals(t, env.gopts.Repo, runs[0].Repository)
+	rtest.Assert(t, runs[0].BytesUploaded > 0, "no uploaded bytes recorded for backup")
+	rtest.Equals(t, "check", runs[1].Command)
+	rtest.Equals(t, 1, runs[1].ExitCode)
+	rtest.Equals(t, "check failed", runs[1].Error)
+	rtest.Assert(t, runs[1].BytesDownloaded > runs[0].BytesDownloaded, "no downloaded bytes recorded for check")
+
+	runs = testRunHistory(t, env.gopts, HistoryOptions{Command: "backup"})
+	rtest.Equals(t, 1, len(runs))
+	runs = testRunHistory(t, env.gopts, HistoryOptions{Last: 1})
+	rtest.Equals(t, 1, len(runs))
+	rtest.Equals(t, "check", runs[0].Command)
+
+	// runs which end by calling Exit are recorded by the cleanup handler
+	setTelemetryCommand(cmdPrune, nil)
+	defer setTelemetryCommand(nil, nil)
+	code, err := telemetryHandler(&env.gopts, start)(130)
+	rtest.OK(t, err)
+	rtest.Equals(t, 130, code)
+	runs = testRunHistory(t, env.gopts, HistoryOptions{Last: 1})
+	rtest.Equals(t, 1, len(runs))
+	rtest.Equals(t, "prune", runs[0].Command)
+	rtest.Equals(t, 130, runs[0].ExitCode)
+
+	rtest.OK(t, runHistory(HistoryOptions{Clear: true}, env.gopts, nil))
+	runs = testRunHistory(t, env.gopts, HistoryOptions{})
+	rtest.Equals(t, 0, len(runs))
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync/atomic"
+)
+
+// exitCodeWarnings is the exit status used with --warning-exit-code if a
+// command completed, but reported warnings.
+const exitCodeWarnings = 4
+
+// warningCount is the number of warnings reported by the current command.
+var warningCount uint32
+
+// jsonWarning is written to stderr for each warning in JSON mode.
+type jsonWarning struct {
+	MessageType string `json:"message_type"` // "warning"
+	Message     string `json:"message"`
+}
+
+// Warningf reports a warning, i.e. a problem which did not prevent the
+// command from completing, for example a skipped file. In contrast to Warnf,
+// the message is marked as a warning, printed as a JSON message to stderr in
+// JSON mode and counted for the exit status.
+func Warningf(format string, args ...interface{}) {
+	countWarnings(1)
+
+	msg := fmt.Sprintf(format, args...)
+	if !globalOptions.JSON {
+		Warnf("warning: %s", msg)
+		return
+	}
+
+	buf, err := json.Marshal(jsonWarning{
+		MessageType: "warning",
+		Message:     strings.TrimSpace(msg),
+	})
+	if err != nil {
+		panic(err)
+	}
+	Warnf("%s\n", buf)
+}
+
+// warningSummaryShown is set by commands which print the number of warnings
+// in their own summary, e.g. backup.
+var warningSummaryShown bool
+
+// printWarningSummary prints the number of warnings reported by the command,
+// unless the command already printed it. In JSON mode, each warning is a
+// separate message and no summary is printed.
+func printWarningSummary() {
+	n := warnings()
+	if n == 0 || warningSummaryShown || globalOptions.JSON {
+		return
+	}
+	if n == 1 {
+		Warnf("completed with 1 warning\n")
+		return
+	}
+	Warnf("completed with %d warnings\n", n)
+}
+
+// countWarnings adds n warnings which were reported by other means than
+// Warningf, e.g. by the backup progress printer.
+func countWarnings(n uint) {
+	atomic.AddUint32(&warningCount, uint32(n))
+}
+
+// warnings returns the number of warnings reported so far.
+func warnings() uint {
+	return uint(atomic.LoadUint32(&warningCount))
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"sync/atomic"
+	"testing"
+
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func TestPrintWarningSummary(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	globalOptions.stderr = buf
+	defer func() {
+		globalOptions.stderr = os.Stderr
+		atomic.StoreUint32(&warningCount, 0)
+		warningSummaryShown = false
+	}()
+
+	atomic.StoreUint32(&warningCount, 0)
+	warningSummaryShown = false
+	printWarningSummary()
+	rtest.Equals(t, "", buf.String())
+
+	Warningf("first\n")
+	Warningf("second\n")
+	buf.Reset()
+	printWarningSummary()
+	rtest.Equals(t, "completed with 2 warnings\n", buf.String())
+
+	// not printed again by commands with their own summary
+	warningSummaryShown = true
+	buf.Reset()
+	printWarningSummary()
+	rtest.Equals(t, "", buf.String())
+}
@@ -6,6 +6,7 @@ import (
 	"path"
 	"runtime"
 	"sort"
+	"sync"
 	"time"
 
 	"github.com/restic/restic/internal/debug"
@@ -48,6 +49,23 @@ func (s *ItemStats) Add(other ItemStats) {
 	s.TreeSizeInRepo += other.TreeSizeInRepo
 }
 
+// ChangeStats counts how many items were new, changed or unchanged compared
+// to the parent snapshot.
+type ChangeStats struct {
+	New       uint
+	Changed   uint
+	Unchanged uint
+}
+
+// Summary collects statistics about all items processed during a backup.
+type Summary struct {
+	Files, Dirs    ChangeStats
+	ProcessedBytes uint64
+	// Errors is the number of errors which were ignored by the error callback.
+	Errors uint
+	ItemStats
+}
+
 // Archiver saves a directory structure to the repo.
 type Archiver struct {
 	Repo         restic.Repository
@@ -60,6 +78,9 @@ type Archiver struct {
 	fileSaver *FileSaver
 	treeSaver *TreeSaver
 
+	mu      sync.Mutex
+	summary *Summary
+
 	// Error is called for all errors that occur during backup.
 	Error ErrorFunc
 
@@ -86,8 +107,17 @@ type Archiver struct {
 	// default.
 	WithAtime bool
 
+	// AllowSpecial configures if unix sockets are saved as placeholder
+	// nodes. Other special files like FIFOs and device nodes are always
+	// saved.
+	AllowSpecial bool
+
 	// Flags controlling change detection. See doc/040_backup.rst for details.
 	ChangeIgnoreFlags uint
+
+	// ChunkCache is used to find the content of large files which were moved
+	// or renamed since the parent snapshot. It may be nil.
+	ChunkCache *ChunkCache
 }
 
 // Flags for the ChangeIgnoreFlags bitfield.
@@ -172,9 +202,54 @@ func (arch *Archiver) error(item string, err error) error {
 	if err != errf {
 		debug.Log("item %v: error was filtered by handler, before: %q, after: %v", item, err, errf)
 	}
+	if errf == nil {
+		arch.mu.Lock()
+		if arch.summary != nil {
+			arch.summary.Errors++
+		}
+		arch.mu.Unlock()
+	}
 	return errf
 }
 
+// trackItem updates the summary and calls CompleteItem.
+func (arch *Archiver) trackItem(item string, previous, current *restic.Node, s ItemStats, d time.Duration) {
+	arch.CompleteItem(item, previous, current, s, d)
+
+	arch.mu.Lock()
+	defer arch.mu.Unlock()
+	if arch.summary == nil {
+		return
+	}
+
+	arch.summary.ItemStats.Add(s)
+
+	// for the last item "/", current is nil
+	if current == nil {
+		return
+	}
+	arch.summary.ProcessedBytes += current.Size
+
+	var stats *ChangeStats
+	switch current.Type {
+	case "dir":
+		stats = &arch.summary.Dirs
+	case "file":
+		stats = &arch.summary.Files
+	default:
+		return
+	}
+
+	switch {
+	case previous == nil:
+		stats.New++
+	case previous.Equals(*current):
+		stats.Unchanged++
+	default:
+		stats.Changed++
+	}
+}
+
 // nodeFromFileInfo returns the restic node from an os.FileInfo.
 func (arch *Archiver) nodeFromFileInfo(snPath, filename string, fi os.FileInfo) (*restic.Node, error) {
 	node, err := restic.NodeFromFileInfo(filename, fi)
@@ -367,10 +442,11 @@ func (arch *Archiver) Save(ctx context.Context, snPath, target string, previous
 
 		// check if the file has not changed before performing a fopen operation (more expensive, specially
 		// in network filesystems)
-		if previous != nil && !fileChanged(fi, previous, arch.ChangeIgnoreFlags) {
+		changed := previous != nil && fileChanged(fi, previous, arch.ChangeIgnoreFlags)
+		if previous != nil && !changed {
 			if arch.allBlobsPresent(previous) {
 				debug.Log("%v hasn't changed, using old list of blobs", target)
-				arch.CompleteItem(snPath, previous, previous, ItemStats{}, time.Since(start))
+				arch.trackItem(snPath, previous, previous, ItemStats{}, time.Since(start))
 				arch.CompleteBlob(previous.Size)
 				node, err := arch.nodeFromFileInfo(snPath, target, fi)
 				if err != nil {
@@ -379,6 +455,7 @@ func (arch *Archiver) Save(ctx context.Context, snPath, target string, previous
 
 				// copy list of blobs
 				node.Content = previous.Content
+				arch.ChunkCache.add(node)
 
 				fn = newFutureNodeWithResult(futureNodeResult{
 					snPath: snPath,
@@ -397,6 +474,37 @@ func (arch *Archiver) Save(ctx context.Context, snPath, target string, previous
 			}
 		}
 
+		// the file may have been moved or renamed since the last backup, but
+		// the cache must not be used for a file known to be modified
+		var content restic.IDs
+		cached := false
+		if !changed {
+			content, cached = arch.ChunkCache.lookup(fi)
+		}
+		if cached {
+			if arch.allBlobsPresent(&restic.Node{Content: content}) && arch.verifyCachedContent(target, fi, content) {
+				debug.Log("%v found in chunk cache, using cached list of blobs", target)
+				node, err := arch.nodeFromFileInfo(snPath, target, fi)
+				if err != nil {
+					return FutureNode{}, false, err
+				}
+				node.Content = content
+
+				arch.trackItem(snPath, previous, node, ItemStats{}, time.Since(start))
+				arch.CompleteBlob(node.Size)
+
+				fn = newFutureNodeWithResult(futureNodeResult{
+					snPath: snPath,
+					target: target,
+					node:   node,
+				})
+				return fn, false, nil
+			}
+
+			debug.Log("%v found in chunk cache, but contents are missing or differ", target)
+			arch.ChunkCache.remove(fi)
+		}
+
 		// reopen file and do an fstat() on the open file to check it is still
 		// a file (and has not been exchanged for e.g. a symlink)
 		file, err := arch.FS.OpenFile(target, fs.O_RDONLY|fs.O_NOFOLLOW, 0)
@@ -435,9 +543,10 @@ func (arch *Archiver) Save(ctx context.Context, snPath, target string, previous
 		fn = arch.fileSaver.Save(ctx, snPath, target, file, fi, func() {
 			arch.StartFile(snPath)
 		}, func() {
-			arch.CompleteItem(snPath, nil, nil, ItemStats{}, 0)
+			arch.trackItem(snPath, nil, nil, ItemStats{}, 0)
 		}, func(node *restic.Node, stats ItemStats) {
-			arch.CompleteItem(snPath, previous, node, stats, time.Since(start))
+			arch.ChunkCache.add(node)
+			arch.trackItem(snPath, previous, node, stats, time.Since(start))
 		})
 
 	case fi.IsDir():
@@ -454,14 +563,14 @@ func (arch *Archiver) Save(ctx context.Context, snPath, target string, previous
 
 		fn, err = arch.SaveDir(ctx, snPath, target, fi, oldSubtree,
 			func(node *restic.Node, stats ItemStats) {
-				arch.CompleteItem(snItem, previous, node, stats, time.Since(start))
+				arch.trackItem(snItem, previous, node, stats, time.Since(start))
 			})
 		if err != nil {
 			debug.Log("SaveDir for %v returned error: %v", snPath, err)
 			return FutureNode{}, false, err
 		}
 
-	case fi.Mode()&os.ModeSocket > 0:
+	case fi.Mode()&os.ModeSocket > 0 && !arch.AllowSpecial:
 		debug.Log("  %v is a socket, ignoring", target)
 		return FutureNode{}, true, nil
 
@@ -610,7 +719,7 @@ func (arch *Archiver) SaveTree(ctx context.Context, snPath string, atree *Tree,
 
 		// not a leaf node, archive subtree
 		fn, _, err := arch.SaveTree(ctx, join(snPath, name), &subatree, oldSubtree, func(n *restic.Node, is ItemStats) {
-			arch.CompleteItem(snItem, oldNode, n, is, time.Since(start))
+			arch.trackItem(snItem, oldNode, n, is, time.Since(start))
 		})
 		if err != nil {
 			return FutureNode{}, 0, err
@@ -714,7 +823,7 @@ func (arch *Archiver) runWorkers(ctx context.Context, wg *errgroup.Group) {
 	arch.fileSaver.CompleteBlob = arch.CompleteBlob
 	arch.fileSaver.NodeFromFileInfo = arch.nodeFromFileInfo
 
-	arch.treeSaver = NewTreeSaver(ctx, wg, arch.Options.SaveTreeConcurrency, arch.blobSaver.Save, arch.Error)
+	arch.treeSaver = NewTreeSaver(ctx, wg, arch.Options.SaveTreeConcurrency, arch.blobSaver.Save, arch.error)
 }
 
 func (arch *Archiver) stopWorkers() {
@@ -740,6 +849,11 @@ func (arch *Archiver) Snapshot(ctx context.Context, targets []string, opts Snaps
 
 	var rootTreeID restic.ID
 
+	backupStart := time.Now()
+	arch.mu.Lock()
+	arch.summary = &Summary{}
+	arch.mu.Unlock()
+
 	wgUp, wgUpCtx := errgroup.WithContext(ctx)
 	arch.Repo.StartPackUploader(wgUpCtx, wgUp)
 
@@ -752,7 +866,7 @@ func (arch *Archiver) Snapshot(ctx context.Context, targets []string, opts Snaps
 
 			debug.Log("starting snapshot")
 			fn, nodeCount, err := arch.SaveTree(wgCtx, "/", atree, arch.loadParentTree(wgCtx, opts.ParentSnapshot), func(n *restic.Node, is ItemStats) {
-				arch.CompleteItem("/", nil, nil, is, time.Since(start))
+				arch.trackItem("/", nil, nil, is, time.Since(start))
 			})
 			if err != nil {
 				return err
@@ -790,17 +904,23 @@ func (arch *Archiver) Snapshot(ctx context.Context, targets []string, opts Snaps
 	if err != nil {
 		return nil, restic.ID{}, err
 	}
+	suspect, err := arch.verifySourceSnapshots()
+	if err != nil {
+		return nil, restic.ID{}, err
+	}
 
 	sn, err := restic.NewSnapshot(targets, opts.Tags, opts.Hostname, opts.Time)
 	if err != nil {
 		return nil, restic.ID{}, err
 	}
+	sn.Suspect = suspect
 
 	sn.Excludes = opts.Excludes
 	if opts.ParentSnapshot != nil {
 		sn.Parent = opts.ParentSnapshot.ID()
 	}
 	sn.Tree = &rootTreeID
+	sn.Summary = arch.snapshotSummary(backupStart, time.Now())
 
 	id, err := restic.SaveSnapshot(ctx, arch.Repo, sn)
 	if err != nil {
@@ -809,3 +929,52 @@ func (arch *Archiver) Snapshot(ctx context.Context, targets []string, opts Snaps
 
 	return sn, id, nil
 }
+
+// verifySourceSnapshots checks that the filesystem snapshots the data was read
+// from, if any, still exist unchanged. Otherwise the error is reported and its
+// message is returned, so that the snapshot can be marked as suspect.
+func (arch *Archiver) verifySourceSnapshots() (string, error) {
+	v, ok := arch.FS.(fs.SnapshotVerifier)
+	if !ok {
+		return "", nil
+	}
+
+	verr := v.VerifySnapshots()
+	if verr == nil {
+		return "", nil
+	}
+	debug.Log("source snapshots are inconsistent: %v", verr)
+	err := arch.error("/", errors.Wrap(verr, "filesystem snapshot changed during backup"))
+	if err != nil {
+		return "", err
+	}
+	return verr.Error(), nil
+}
+
+// snapshotSummary converts the summary collected since the start of the
+// backup to the representation stored in the snapshot.
+func (arch *Archiver) snapshotSummary(start, end time.Time) *restic.SnapshotSummary {
+	arch.mu.Lock()
+	defer arch.mu.Unlock()
+
+	s := arch.summary
+	return &restic.SnapshotSummary{
+		BackupStart: start,
+		BackupEnd:   end,
+
+		FilesNew:        s.Files.New,
+		FilesChanged:    s.Files.Changed,
+		FilesUnmodified: s.Files.Unchanged,
+		DirsNew:         s.Dirs.New,
+		DirsChanged:     s.Dirs.Changed,
+		DirsUnmodified:  s.Dirs.Unchanged,
+		DataBlobs:       s.DataBlobs,
+		TreeBlobs:       s.TreeBlobs,
+		DataAdded:       s.DataSize + s.TreeSize,
+		DataAddedPacked: s.DataSizeInRepo + s.TreeSizeInRepo,
+
+		TotalFilesProcessed: s.Files.New + s.Files.Changed + s.Files.Unchanged,
+		TotalBytesProcessed: s.ProcessedBytes,
+		Errors:              s.Errors,
+	}
+}
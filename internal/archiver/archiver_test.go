@@ -1708,6 +1708,104 @@ func TestArchiverParent(t *testing.T) {
 	}
 }
 
+func TestArchiverSnapshotSummary(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	src := TestDir{
+		"subdir": TestDir{
+			"a": TestFile{Content: "foo"},
+			"b": TestFile{Content: "bar"},
+		},
+		"c": TestFile{Content: "baz"},
+	}
+	tempdir, repo := prepareTempdirRepoSrc(t, src)
+
+	back := restictest.Chdir(t, tempdir)
+	defer back()
+
+	arch := New(repo, fs.Track{FS: fs.Local{}}, Options{})
+	sn, _, err := arch.Snapshot(ctx, []string{"."}, SnapshotOptions{Time: time.Now()})
+	restictest.OK(t, err)
+
+	summary := sn.Summary
+	restictest.Assert(t, summary != nil, "snapshot has no summary")
+	restictest.Assert(t, !summary.BackupEnd.Before(summary.BackupStart), "invalid backup duration %v", summary.Duration())
+	restictest.Equals(t, uint(3), summary.FilesNew)
+	restictest.Equals(t, uint(0), summary.FilesChanged+summary.FilesUnmodified)
+	restictest.Equals(t, uint(1), summary.DirsNew)
+	restictest.Equals(t, uint(3), summary.TotalFilesProcessed)
+	restictest.Equals(t, uint64(9), summary.TotalBytesProcessed)
+	restictest.Equals(t, 3, summary.DataBlobs)
+	restictest.Equals(t, uint(0), summary.Errors)
+
+	// change one file and create a second snapshot
+	restictest.OK(t, os.WriteFile(filepath.Join(tempdir, "subdir", "a"), []byte("changed"), 0644))
+	sn, _, err = arch.Snapshot(ctx, []string{"."}, SnapshotOptions{Time: time.Now(), ParentSnapshot: sn})
+	restictest.OK(t, err)
+
+	summary = sn.Summary
+	restictest.Equals(t, uint(0), summary.FilesNew)
+	restictest.Equals(t, uint(1), summary.FilesChanged)
+	restictest.Equals(t, uint(2), summary.FilesUnmodified)
+	restictest.Equals(t, uint(1), summary.DirsChanged)
+	restictest.Equals(t, uint(0), summary.DirsUnmodified)
+	restictest.Equals(t, 1, summary.DataBlobs)
+}
+
+// snapshotVerifierFS simulates a file system which reads from filesystem
+// snapshots, VerifySnapshots returns err.
+type snapshotVerifierFS struct {
+	fs.FS
+	err error
+}
+
+func (f snapshotVerifierFS) VerifySnapshots() error {
+	return f.err
+}
+
+func TestArchiverSnapshotSuspect(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	src := TestDir{
+		"a": TestFile{Content: "foo"},
+	}
+	tempdir, repo := prepareTempdirRepoSrc(t, src)
+
+	back := restictest.Chdir(t, tempdir)
+	defer back()
+
+	arch := New(repo, snapshotVerifierFS{FS: fs.Local{}}, Options{})
+	sn, _, err := arch.Snapshot(ctx, []string{"."}, SnapshotOptions{Time: time.Now()})
+	restictest.OK(t, err)
+	restictest.Equals(t, "", sn.Suspect)
+	restictest.Equals(t, uint(0), sn.Summary.Errors)
+
+	var reported []error
+	arch = New(repo, snapshotVerifierFS{FS: fs.Local{}, err: errors.New("snapshot was deleted")}, Options{})
+	arch.Error = func(item string, err error) error {
+		reported = append(reported, err)
+		return nil
+	}
+	sn, id, err := arch.Snapshot(ctx, []string{"."}, SnapshotOptions{Time: time.Now()})
+	restictest.OK(t, err)
+	restictest.Equals(t, "snapshot was deleted", sn.Suspect)
+	restictest.Equals(t, uint(1), sn.Summary.Errors)
+	restictest.Equals(t, 1, len(reported))
+
+	loaded, err := restic.LoadSnapshot(ctx, repo, id)
+	restictest.OK(t, err)
+	restictest.Equals(t, "snapshot was deleted", loaded.Suspect)
+
+	// the backup is aborted if the error handler returns the error
+	arch.Error = func(item string, err error) error {
+		return err
+	}
+	_, _, err = arch.Snapshot(ctx, []string{"."}, SnapshotOptions{Time: time.Now()})
+	restictest.Assert(t, err != nil, "expected error from snapshot verification")
+}
+
 func TestArchiverErrorReporting(t *testing.T) {
 	ignoreErrorForBasename := func(basename string) ErrorFunc {
 		return func(item string, err error) error {
@@ -4,9 +4,17 @@
 package archiver
 
 import (
+	"context"
+	"net"
 	"os"
+	"path/filepath"
 	"syscall"
 	"testing"
+	"time"
+
+	"github.com/restic/restic/internal/fs"
+	"github.com/restic/restic/internal/restic"
+	restictest "github.com/restic/restic/internal/test"
 )
 
 type wrappedFileInfo struct {
@@ -40,3 +48,35 @@ func wrapFileInfo(t testing.TB, fi os.FileInfo) os.FileInfo {
 
 	return res
 }
+
+func TestArchiverAllowSpecial(t *testing.T) {
+	for _, allowSpecial := range []bool{false, true} {
+		tempdir, repo := prepareTempdirRepoSrc(t, TestDir{
+			"file": TestFile{Content: "foo"},
+		})
+
+		l, err := net.ListenUnix("unix", &net.UnixAddr{Name: filepath.Join(tempdir, "socket"), Net: "unix"})
+		restictest.OK(t, err)
+		defer func() {
+			_ = l.Close()
+		}()
+
+		arch := New(repo, fs.Track{FS: fs.Local{}}, Options{})
+		arch.AllowSpecial = allowSpecial
+
+		back := restictest.Chdir(t, tempdir)
+		sn, _, err := arch.Snapshot(context.TODO(), []string{"."}, SnapshotOptions{Time: time.Now()})
+		back()
+		restictest.OK(t, err)
+
+		tree, err := restic.LoadTree(context.TODO(), repo, *sn.Tree)
+		restictest.OK(t, err)
+
+		node := tree.Find("socket")
+		if allowSpecial {
+			restictest.Assert(t, node != nil && node.Type == "socket", "socket not saved as placeholder: %v", node)
+		} else {
+			restictest.Assert(t, node == nil, "socket should have been skipped, got %v", node)
+		}
+	}
+}
@@ -0,0 +1,301 @@
+package archiver
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/restic/restic/internal/crypto"
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/fs"
+	"github.com/restic/restic/internal/restic"
+)
+
+// ChunkCacheMinSize is the minimum size of a file for its content to be
+// recorded in the chunk cache. Smaller files are cheap enough to read again.
+const ChunkCacheMinSize = 64 * 1024 * 1024
+
+// chunkCacheMaxAge is the duration after which an entry is removed from the
+// chunk cache if it was not used by any backup.
+const chunkCacheMaxAge = 90 * 24 * time.Hour
+
+// chunkCacheKey identifies a file on the local machine independent of its
+// path.
+type chunkCacheKey struct {
+	DeviceID uint64 `json:"device_id"`
+	Inode    uint64 `json:"inode"`
+	Size     uint64 `json:"size"`
+	ModTime  int64  `json:"mtime"`
+}
+
+type chunkCacheEntry struct {
+	chunkCacheKey
+	Used    time.Time  `json:"used"`
+	Content restic.IDs `json:"content"`
+}
+
+// ChunkCache records the list of blobs of large files, identified by the
+// device, inode, size and modification time of the file. This allows reusing
+// the content of files which were moved or renamed since the last backup
+// without reading them again. As inode numbers are reused, the first and last
+// blob of a file found in the cache are compared with the file before using
+// the recorded content, see verifyCachedContent. The cache file is encrypted
+// with the repository key, as the blob IDs allow confirming the content of
+// files.
+//
+// All methods can be called on a nil *ChunkCache, which disables the cache.
+type ChunkCache struct {
+	filename string
+	key      *crypto.Key
+	minSize  uint64
+
+	m       sync.Mutex
+	entries map[chunkCacheKey]*chunkCacheEntry
+	changed bool
+}
+
+// LoadChunkCache loads the chunk cache stored in filename. If the file does
+// not exist or cannot be decrypted with key, an empty cache is returned.
+func LoadChunkCache(filename string, key *crypto.Key) (*ChunkCache, error) {
+	c := &ChunkCache{
+		filename: filename,
+		key:      key,
+		minSize:  ChunkCacheMinSize,
+		entries:  make(map[chunkCacheKey]*chunkCacheEntry),
+	}
+
+	buf, err := os.ReadFile(filename)
+	if errors.Is(err, os.ErrNotExist) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	if len(buf) < key.NonceSize() {
+		debug.Log("chunk cache %v is truncated, ignoring it", filename)
+		return c, nil
+	}
+
+	nonce, ciphertext := buf[:key.NonceSize()], buf[key.NonceSize():]
+	plaintext, err := key.Open(ciphertext[:0], nonce, ciphertext, nil)
+	if err != nil {
+		debug.Log("unable to decrypt chunk cache %v, ignoring it: %v", filename, err)
+		return c, nil
+	}
+
+	var entries []*chunkCacheEntry
+	if err := json.Unmarshal(plaintext, &entries); err != nil {
+		debug.Log("unable to parse chunk cache %v, ignoring it: %v", filename, err)
+		return c, nil
+	}
+
+	for _, e := range entries {
+		c.entries[e.chunkCacheKey] = e
+	}
+	debug.Log("loaded %d entries from chunk cache %v", len(c.entries), filename)
+
+	return c, nil
+}
+
+func (c *ChunkCache) newKey(deviceID, inode, size uint64, modTime time.Time) (chunkCacheKey, bool) {
+	// without an inode number files cannot be identified reliably
+	if inode == 0 || size < c.minSize {
+		return chunkCacheKey{}, false
+	}
+	return chunkCacheKey{
+		DeviceID: deviceID,
+		Inode:    inode,
+		Size:     size,
+		ModTime:  modTime.UnixNano(),
+	}, true
+}
+
+// lookup returns the list of blobs recorded for the file described by fi.
+func (c *ChunkCache) lookup(fi os.FileInfo) (restic.IDs, bool) {
+	if c == nil {
+		return nil, false
+	}
+
+	extFI := fs.ExtendedStat(fi)
+	key, ok := c.newKey(extFI.DeviceID, extFI.Inode, uint64(extFI.Size), extFI.ModTime)
+	if !ok {
+		return nil, false
+	}
+
+	c.m.Lock()
+	defer c.m.Unlock()
+	e, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	e.Used = time.Now()
+	c.changed = true
+	return e.Content, true
+}
+
+// add records the content of the file described by node.
+func (c *ChunkCache) add(node *restic.Node) {
+	if c == nil || node == nil || node.Type != "file" {
+		return
+	}
+
+	key, ok := c.newKey(node.DeviceID, node.Inode, node.Size, node.ModTime)
+	if !ok {
+		return
+	}
+
+	c.m.Lock()
+	defer c.m.Unlock()
+	c.entries[key] = &chunkCacheEntry{
+		chunkCacheKey: key,
+		Used:          time.Now(),
+		Content:       node.Content,
+	}
+	c.changed = true
+}
+
+// remove removes the entry for the file described by fi, for example because
+// its blobs are no longer contained in the repository.
+func (c *ChunkCache) remove(fi os.FileInfo) {
+	if c == nil {
+		return
+	}
+
+	extFI := fs.ExtendedStat(fi)
+	key, ok := c.newKey(extFI.DeviceID, extFI.Inode, uint64(extFI.Size), extFI.ModTime)
+	if !ok {
+		return
+	}
+
+	c.m.Lock()
+	defer c.m.Unlock()
+	if _, ok := c.entries[key]; ok {
+		delete(c.entries, key)
+		c.changed = true
+	}
+}
+
+// Len returns the number of files in the cache.
+func (c *ChunkCache) Len() int {
+	if c == nil {
+		return 0
+	}
+
+	c.m.Lock()
+	defer c.m.Unlock()
+	return len(c.entries)
+}
+
+// Save writes the cache to disk, entries which have not been used for a long
+// time are removed.
+func (c *ChunkCache) Save() error {
+	if c == nil {
+		return nil
+	}
+
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	entries := make([]*chunkCacheEntry, 0, len(c.entries))
+	for key, e := range c.entries {
+		if time.Since(e.Used) > chunkCacheMaxAge {
+			delete(c.entries, key)
+			c.changed = true
+			continue
+		}
+		entries = append(entries, e)
+	}
+
+	if !c.changed {
+		return nil
+	}
+
+	plaintext, err := json.Marshal(entries)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	nonce := crypto.NewRandomNonce()
+	ciphertext := make([]byte, 0, crypto.CiphertextLength(len(plaintext)))
+	ciphertext = append(ciphertext, nonce...)
+	ciphertext = c.key.Seal(ciphertext, nonce, plaintext, nil)
+
+	f, err := os.CreateTemp(filepath.Dir(c.filename), filepath.Base(c.filename)+"-tmp-")
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	_, err = f.Write(ciphertext)
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), c.filename)
+	}
+	if err != nil {
+		_ = os.Remove(f.Name())
+		return errors.WithStack(err)
+	}
+
+	c.changed = false
+	return nil
+}
+
+// verifyCachedContent reports whether the file at target, described by fi,
+// starts with the first and ends with the last blob of content. This detects
+// a different file which reuses the inode of a recorded file, while reading
+// only a small part of it.
+func (arch *Archiver) verifyCachedContent(target string, fi os.FileInfo, content restic.IDs) bool {
+	if len(content) == 0 {
+		return false
+	}
+
+	sizes := make([]uint, len(content))
+	var total int64
+	for i, id := range content {
+		size, ok := arch.Repo.LookupBlobSize(id, restic.DataBlob)
+		if !ok {
+			return false
+		}
+		sizes[i] = size
+		total += int64(size)
+	}
+	if total != fi.Size() {
+		return false
+	}
+
+	f, err := arch.FS.OpenFile(target, fs.O_RDONLY|fs.O_NOFOLLOW, 0)
+	if err != nil {
+		debug.Log("unable to open %v: %v", target, err)
+		return false
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+
+	if !blobMatches(f, 0, sizes[0], content[0]) {
+		return false
+	}
+	last := len(content) - 1
+	return last == 0 || blobMatches(f, total-int64(sizes[last]), sizes[last], content[last])
+}
+
+// blobMatches reports whether the size bytes at offset in f are the blob id.
+func blobMatches(f fs.File, offset int64, size uint, id restic.ID) bool {
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		return false
+	}
+	buf := make([]byte, size)
+	if _, err := io.ReadFull(f, buf); err != nil {
+		return false
+	}
+	return restic.Hash(buf) == id
+}
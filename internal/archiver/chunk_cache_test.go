@@ -0,0 +1,134 @@
+package archiver
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/restic/restic/internal/fs"
+	restictest "github.com/restic/restic/internal/test"
+)
+
+func TestArchiverChunkCacheRename(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	tempdir, repo := prepareTempdirRepoSrc(t, TestDir{
+		"dir": TestDir{
+			"large": TestFile{Content: "large file which is expensive to read"},
+		},
+		"small": TestFile{Content: "x"},
+	})
+
+	back := restictest.Chdir(t, tempdir)
+	defer back()
+
+	filename := filepath.Join(restictest.TempDir(t), "chunks")
+	cache, err := LoadChunkCache(filename, repo.Key())
+	restictest.OK(t, err)
+	cache.minSize = 10
+
+	arch := New(repo, fs.Track{FS: fs.Local{}}, Options{})
+	arch.ChunkCache = cache
+	parent, _, err := arch.Snapshot(ctx, []string{"."}, SnapshotOptions{Time: time.Now()})
+	restictest.OK(t, err)
+	restictest.Equals(t, 1, cache.Len())
+	restictest.OK(t, cache.Save())
+
+	restictest.OK(t, os.Rename(filepath.Join("dir", "large"), filepath.Join("dir", "renamed")))
+
+	// load the cache again to check that it was saved correctly
+	cache, err = LoadChunkCache(filename, repo.Key())
+	restictest.OK(t, err)
+	cache.minSize = 10
+	restictest.Equals(t, 1, cache.Len())
+
+	var started int32
+	arch = New(repo, fs.Track{FS: fs.Local{}}, Options{})
+	arch.ChunkCache = cache
+	arch.StartFile = func(string) {
+		atomic.AddInt32(&started, 1)
+	}
+	sn, id, err := arch.Snapshot(ctx, []string{"."}, SnapshotOptions{Time: time.Now(), ParentSnapshot: parent})
+	restictest.OK(t, err)
+
+	restictest.Equals(t, int32(0), atomic.LoadInt32(&started))
+	restictest.Equals(t, uint(1), sn.Summary.FilesNew)
+	restictest.Equals(t, uint(1), sn.Summary.FilesUnmodified)
+
+	TestEnsureSnapshot(t, repo, id, TestDir{
+		"dir": TestDir{
+			"renamed": TestFile{Content: "large file which is expensive to read"},
+		},
+		"small": TestFile{Content: "x"},
+	})
+}
+
+func TestArchiverChunkCacheModified(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	tempdir, repo := prepareTempdirRepoSrc(t, TestDir{
+		"dir": TestDir{
+			"large": TestFile{Content: "large file which is expensive to read"},
+		},
+	})
+
+	back := restictest.Chdir(t, tempdir)
+	defer back()
+
+	cache, err := LoadChunkCache(filepath.Join(restictest.TempDir(t), "chunks"), repo.Key())
+	restictest.OK(t, err)
+	cache.minSize = 10
+
+	arch := New(repo, fs.Track{FS: fs.Local{}}, Options{})
+	arch.ChunkCache = cache
+	parent, _, err := arch.Snapshot(ctx, []string{"."}, SnapshotOptions{Time: time.Now()})
+	restictest.OK(t, err)
+	restictest.Equals(t, 1, cache.Len())
+
+	// rewrite the file with the same size and modification time
+	filename := filepath.Join("dir", "large")
+	fi, err := os.Stat(filename)
+	restictest.OK(t, err)
+	sleep()
+	restictest.OK(t, os.WriteFile(filename, []byte("LARGE FILE WHICH IS EXPENSIVE TO READ"), 0644))
+	restictest.OK(t, os.Chtimes(filename, fi.ModTime(), fi.ModTime()))
+
+	restictest.OK(t, os.Rename("dir", "renamed"))
+
+	var started int32
+	arch = New(repo, fs.Track{FS: fs.Local{}}, Options{})
+	arch.ChunkCache = cache
+	arch.StartFile = func(string) {
+		atomic.AddInt32(&started, 1)
+	}
+	_, id, err := arch.Snapshot(ctx, []string{"."}, SnapshotOptions{Time: time.Now(), ParentSnapshot: parent})
+	restictest.OK(t, err)
+	restictest.Equals(t, int32(1), atomic.LoadInt32(&started))
+
+	TestEnsureSnapshot(t, repo, id, TestDir{
+		"renamed": TestDir{
+			"large": TestFile{Content: "LARGE FILE WHICH IS EXPENSIVE TO READ"},
+		},
+	})
+}
+
+func TestChunkCacheInvalidFile(t *testing.T) {
+	_, repo := prepareTempdirRepoSrc(t, TestDir{})
+
+	filename := filepath.Join(restictest.TempDir(t), "chunks")
+	restictest.OK(t, os.WriteFile(filename, []byte("invalid data which cannot be decrypted"), 0600))
+
+	cache, err := LoadChunkCache(filename, repo.Key())
+	restictest.OK(t, err)
+	restictest.Equals(t, 0, cache.Len())
+
+	// a nil cache must be usable
+	var nilCache *ChunkCache
+	restictest.Equals(t, 0, nilCache.Len())
+	restictest.OK(t, nilCache.Save())
+}
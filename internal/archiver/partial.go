@@ -0,0 +1,269 @@
+package archiver
+
+import (
+	"context"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/fs"
+	"github.com/restic/restic/internal/restic"
+	"golang.org/x/sync/errgroup"
+)
+
+// partialTree describes which parts of a snapshot are replaced by
+// SnapshotPartial. Nodes with replace set are read from disk again, for all
+// other nodes only the metadata of the directory is updated.
+type partialTree struct {
+	// path is the location of the item on disk, it is empty for virtual
+	// directories like the volume name on Windows.
+	path     string
+	replace  bool
+	children map[string]*partialTree
+}
+
+func newPartialTree(fs fs.FS, targets []string) (*partialTree, error) {
+	root := &partialTree{}
+	for _, target := range targets {
+		pc, virtualPrefix := pathComponents(fs, target, false)
+		if len(pc) == 0 {
+			return nil, errors.Errorf("cannot replace the root directory %q, create a new snapshot instead", target)
+		}
+
+		// paths[i] is the location on disk of the item for pc[i]
+		paths := make([]string, len(pc))
+		p := target
+		for i := len(pc) - 1; i >= 0; i-- {
+			paths[i] = p
+			p = fs.Dir(p)
+		}
+		if virtualPrefix {
+			paths[0] = ""
+		}
+
+		t := root
+		for i, name := range pc {
+			if t.replace {
+				// already replaced completely
+				break
+			}
+			if t.children == nil {
+				t.children = make(map[string]*partialTree)
+			}
+			child, ok := t.children[name]
+			if !ok {
+				child = &partialTree{path: paths[i]}
+				t.children[name] = child
+			}
+			t = child
+		}
+
+		if !t.replace {
+			t.replace = true
+			t.children = nil
+		}
+	}
+
+	return root, nil
+}
+
+// SnapshotPartial creates a new snapshot based on opts.ParentSnapshot. Only
+// the targets are read from disk again, everything else is reused from the
+// parent snapshot, only the metadata of the directories containing the
+// targets is updated. Targets which no longer exist are removed from the new
+// snapshot. The targets are mapped to the
+// snapshot in the same way as for Snapshot, so they must be specified in the
+// same way as for the backup which created the parent snapshot. The directory
+// containing a target must already exist in the parent snapshot.
+func (arch *Archiver) SnapshotPartial(ctx context.Context, targets []string, opts SnapshotOptions) (*restic.Snapshot, restic.ID, error) {
+	parent := opts.ParentSnapshot
+	if parent == nil || parent.Tree == nil {
+		return nil, restic.ID{}, errors.New("partial snapshot requires a parent snapshot")
+	}
+
+	cleanTargets, err := resolveRelativeTargets(arch.FS, targets)
+	if err != nil {
+		return nil, restic.ID{}, err
+	}
+
+	ptree, err := newPartialTree(arch.FS, cleanTargets)
+	if err != nil {
+		return nil, restic.ID{}, err
+	}
+
+	var rootTreeID restic.ID
+
+	backupStart := time.Now()
+	arch.mu.Lock()
+	arch.summary = &Summary{}
+	arch.mu.Unlock()
+
+	wgUp, wgUpCtx := errgroup.WithContext(ctx)
+	arch.Repo.StartPackUploader(wgUpCtx, wgUp)
+
+	wgUp.Go(func() error {
+		wg, wgCtx := errgroup.WithContext(wgUpCtx)
+
+		wg.Go(func() error {
+			arch.runWorkers(wgCtx, wg)
+
+			debug.Log("starting partial snapshot of %v", parent.ID())
+			id, err := arch.replaceSubtrees(wgCtx, "/", *parent.Tree, ptree)
+			if err != nil {
+				return err
+			}
+
+			rootTreeID = id
+			arch.stopWorkers()
+			return nil
+		})
+
+		err = wg.Wait()
+		if err != nil {
+			debug.Log("error while saving tree: %v", err)
+			return err
+		}
+
+		return arch.Repo.Flush(ctx)
+	})
+	err = wgUp.Wait()
+	if err != nil {
+		return nil, restic.ID{}, err
+	}
+	suspect, err := arch.verifySourceSnapshots()
+	if err != nil {
+		return nil, restic.ID{}, err
+	}
+
+	sn, err := restic.NewSnapshot(parent.Paths, opts.Tags, opts.Hostname, opts.Time)
+	if err != nil {
+		return nil, restic.ID{}, err
+	}
+	sn.Suspect = suspect
+
+	sn.Excludes = opts.Excludes
+	sn.Parent = parent.ID()
+	sn.Tree = &rootTreeID
+	sn.Summary = arch.snapshotSummary(backupStart, time.Now())
+
+	id, err := restic.SaveSnapshot(ctx, arch.Repo, sn)
+	if err != nil {
+		return nil, restic.ID{}, err
+	}
+
+	return sn, id, nil
+}
+
+// replaceSubtrees loads the tree with the given id and saves a copy of it, in
+// which the nodes contained in ptree are replaced.
+func (arch *Archiver) replaceSubtrees(ctx context.Context, snPath string, id restic.ID, ptree *partialTree) (restic.ID, error) {
+	tree, err := restic.LoadTree(ctx, arch.Repo, id)
+	if err != nil {
+		return restic.ID{}, err
+	}
+
+	names := make([]string, 0, len(ptree.children))
+	for name := range ptree.children {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	newTree := restic.NewTree(len(tree.Nodes))
+	for _, node := range tree.Nodes {
+		if _, ok := ptree.children[node.Name]; ok {
+			continue
+		}
+		err = newTree.Insert(node)
+		if err != nil {
+			return restic.ID{}, err
+		}
+	}
+
+	for _, name := range names {
+		child := ptree.children[name]
+		previous := tree.Find(name)
+		childPath := join(snPath, name)
+
+		if !child.replace {
+			if previous == nil || previous.Type != "dir" || previous.Subtree == nil {
+				return restic.ID{}, errors.Errorf("directory %v not found in parent snapshot", childPath)
+			}
+
+			subtreeID, err := arch.replaceSubtrees(ctx, childPath, *previous.Subtree, child)
+			if err != nil {
+				return restic.ID{}, err
+			}
+
+			node, err := arch.refreshDirNode(childPath, child.path, previous)
+			if err != nil {
+				return restic.ID{}, err
+			}
+			node.Subtree = &subtreeID
+			err = newTree.Insert(node)
+			if err != nil {
+				return restic.ID{}, err
+			}
+			continue
+		}
+
+		// targets which were removed are expected, don't report them as error
+		if _, err := arch.FS.Lstat(child.path); errors.Is(err, os.ErrNotExist) {
+			debug.Log("%v was removed", childPath)
+			continue
+		}
+
+		fn, excluded, err := arch.Save(ctx, childPath, child.path, previous)
+		if err != nil {
+			return restic.ID{}, err
+		}
+		if excluded {
+			debug.Log("%v is excluded", childPath)
+			continue
+		}
+
+		fnr := fn.take(ctx)
+		if fnr.err != nil {
+			return restic.ID{}, fnr.err
+		}
+		if fnr.node == nil {
+			continue
+		}
+
+		err = newTree.Insert(fnr.node)
+		if err != nil {
+			return restic.ID{}, err
+		}
+	}
+
+	return restic.SaveTree(ctx, arch.Repo, newTree)
+}
+
+// refreshDirNode returns a copy of the node for the directory at path with
+// the current metadata from disk. If the directory cannot be accessed or
+// reading the metadata fails with an error ignored by arch.error, the metadata
+// is kept from previous.
+func (arch *Archiver) refreshDirNode(snPath, path string, previous *restic.Node) (*restic.Node, error) {
+	node := *previous
+	if path == "" {
+		return &node, nil
+	}
+
+	fi, err := arch.FS.Lstat(path)
+	if err != nil || !fi.IsDir() {
+		debug.Log("keeping metadata of %v: %v", snPath, err)
+		return &node, nil
+	}
+
+	current, err := arch.nodeFromFileInfo(snPath, path, fi)
+	if err != nil {
+		err = arch.error(path, err)
+		if err != nil {
+			return nil, err
+		}
+		debug.Log("keeping metadata of %v", snPath)
+		return &node, nil
+	}
+	return current, nil
+}
@@ -0,0 +1,151 @@
+package archiver
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/restic/restic/internal/checker"
+	"github.com/restic/restic/internal/fs"
+	restictest "github.com/restic/restic/internal/test"
+)
+
+func TestArchiverSnapshotPartial(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	src := TestDir{
+		"db": TestDir{
+			"table1": TestFile{Content: "foo"},
+			"table2": TestFile{Content: "bar"},
+		},
+		"logs": TestDir{
+			"old": TestFile{Content: "log"},
+		},
+		"other": TestDir{
+			"file": TestFile{Content: "other"},
+		},
+	}
+	tempdir, repo := prepareTempdirRepoSrc(t, src)
+
+	back := restictest.Chdir(t, tempdir)
+	defer back()
+
+	arch := New(repo, fs.Track{FS: fs.Local{}}, Options{})
+	parent, _, err := arch.Snapshot(ctx, []string{"."}, SnapshotOptions{Time: time.Now()})
+	restictest.OK(t, err)
+
+	// modify the files on disk, "other" must not be read again
+	restictest.OK(t, os.WriteFile(filepath.Join(tempdir, "db", "table1"), []byte("changed"), 0644))
+	restictest.OK(t, os.WriteFile(filepath.Join(tempdir, "db", "table3"), []byte("new"), 0644))
+	restictest.OK(t, os.RemoveAll(filepath.Join(tempdir, "logs", "old")))
+	restictest.OK(t, os.WriteFile(filepath.Join(tempdir, "other", "file"), []byte("ignored"), 0644))
+
+	sn, id, err := arch.SnapshotPartial(ctx, []string{"db", "logs/old"}, SnapshotOptions{
+		Time:           time.Now(),
+		ParentSnapshot: parent,
+	})
+	restictest.OK(t, err)
+	restictest.Equals(t, parent.Paths, sn.Paths)
+	restictest.Equals(t, parent.ID(), sn.Parent)
+	restictest.Equals(t, uint(1), sn.Summary.FilesNew)
+	restictest.Equals(t, uint(1), sn.Summary.FilesChanged)
+	restictest.Equals(t, uint(1), sn.Summary.FilesUnmodified)
+
+	TestEnsureSnapshot(t, repo, id, TestDir{
+		"db": TestDir{
+			"table1": TestFile{Content: "changed"},
+			"table2": TestFile{Content: "bar"},
+			"table3": TestFile{Content: "new"},
+		},
+		"logs": TestDir{},
+		"other": TestDir{
+			"file": TestFile{Content: "other"},
+		},
+	})
+
+	checker.TestCheckRepo(t, repo)
+}
+
+func TestArchiverSnapshotPartialErrors(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	tempdir, repo := prepareTempdirRepoSrc(t, TestDir{
+		"dir": TestDir{
+			"file": TestFile{Content: "foo"},
+		},
+	})
+
+	back := restictest.Chdir(t, tempdir)
+	defer back()
+
+	arch := New(repo, fs.Track{FS: fs.Local{}}, Options{})
+	_, _, err := arch.SnapshotPartial(ctx, []string{"dir"}, SnapshotOptions{Time: time.Now()})
+	restictest.Assert(t, err != nil, "expected error for missing parent snapshot")
+
+	parent, _, err := arch.Snapshot(ctx, []string{"."}, SnapshotOptions{Time: time.Now()})
+	restictest.OK(t, err)
+
+	restictest.OK(t, os.MkdirAll(filepath.Join(tempdir, "missing", "sub"), 0755))
+	_, _, err = arch.SnapshotPartial(ctx, []string{"missing/sub"}, SnapshotOptions{Time: time.Now(), ParentSnapshot: parent})
+	restictest.Assert(t, err != nil, "expected error for directory missing in the parent snapshot")
+}
+
+func TestArchiverSnapshotPartialIgnoredError(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	tempdir, repo := prepareTempdirRepoSrc(t, TestDir{
+		"dir": TestDir{
+			"file": TestFile{Content: "foo"},
+		},
+	})
+
+	back := restictest.Chdir(t, tempdir)
+	defer back()
+
+	arch := New(repo, fs.Track{FS: fs.Local{}}, Options{})
+	parent, _, err := arch.Snapshot(ctx, []string{"."}, SnapshotOptions{Time: time.Now()})
+	restictest.OK(t, err)
+
+	// "dir" still looks like a directory, but reading its metadata fails
+	restictest.OK(t, os.Rename("dir", "moved"))
+	fi, err := os.Lstat("moved")
+	restictest.OK(t, err)
+
+	var ignored []string
+	arch = New(repo, fs.Track{FS: &StatFS{FS: fs.Local{}, OverrideLstat: map[string]os.FileInfo{"dir": fi}}}, Options{})
+	arch.Error = func(item string, err error) error {
+		ignored = append(ignored, item)
+		return nil
+	}
+
+	_, id, err := arch.SnapshotPartial(ctx, []string{"dir/file"}, SnapshotOptions{Time: time.Now(), ParentSnapshot: parent})
+	restictest.OK(t, err)
+	restictest.Equals(t, []string{"dir"}, ignored)
+
+	TestEnsureSnapshot(t, repo, id, TestDir{
+		"dir": TestDir{},
+	})
+}
+
+func TestNewPartialTree(t *testing.T) {
+	ptree, err := newPartialTree(fs.Local{}, []string{"/a/b/c", "/a/b", "/a/d/e", "/f"})
+	restictest.OK(t, err)
+
+	a := ptree.children["a"]
+	restictest.Assert(t, a != nil && !a.replace, "unexpected node for a: %v", a)
+	restictest.Equals(t, "/a", a.path)
+	restictest.Equals(t, "/a/b", a.children["b"].path)
+	restictest.Assert(t, a.children["b"].replace, "/a/b is not replaced")
+	restictest.Assert(t, a.children["b"].children == nil, "nested target was not merged")
+	restictest.Equals(t, "/a/d", a.children["d"].path)
+	restictest.Equals(t, "/a/d/e", a.children["d"].children["e"].path)
+	restictest.Assert(t, ptree.children["f"].replace, "/f is not replaced")
+
+	_, err = newPartialTree(fs.Local{}, []string{"/"})
+	restictest.Assert(t, err != nil, "expected error for replacing the root directory")
+}
@@ -3,6 +3,7 @@ package gs
 import (
 	"path"
 	"strings"
+	"time"
 
 	"github.com/restic/restic/internal/errors"
 	"github.com/restic/restic/internal/options"
@@ -17,6 +18,9 @@ type Config struct {
 	Prefix    string
 
 	Connections uint `option:"connections" help:"set a limit for the number of concurrent connections (default: 5)"`
+
+	Inventory       string        `option:"inventory" help:"list pack files using the Storage Insights inventory report with the manifest at bucket/path/manifest.json"`
+	InventoryMaxAge time.Duration `option:"inventory-max-age" help:"refuse to use inventory reports older than this (default: 48h)"`
 }
 
 // NewConfig returns a new Config with the default values filled in.
@@ -10,10 +10,12 @@ import (
 	"os"
 	"path"
 	"strings"
+	"time"
 
 	"cloud.google.com/go/storage"
 	"github.com/pkg/errors"
 	"github.com/restic/restic/internal/backend"
+	"github.com/restic/restic/internal/backend/inventory"
 	"github.com/restic/restic/internal/backend/layout"
 	"github.com/restic/restic/internal/backend/sema"
 	"github.com/restic/restic/internal/debug"
@@ -43,6 +45,9 @@ type Backend struct {
 	prefix       string
 	listMaxItems int
 	layout.Layout
+
+	inventory       string
+	inventoryMaxAge time.Duration
 }
 
 // Ensure that *Backend implements restic.Backend.
@@ -116,7 +121,9 @@ func open(cfg Config, rt http.RoundTripper) (*Backend, error) {
 			Path: cfg.Prefix,
 			Join: path.Join,
 		},
-		listMaxItems: defaultListMaxItems,
+		listMaxItems:    defaultListMaxItems,
+		inventory:       cfg.Inventory,
+		inventoryMaxAge: cfg.InventoryMaxAge,
 	}
 
 	return be, nil
@@ -351,6 +358,10 @@ func (be *Backend) List(ctx context.Context, t restic.FileType, fn func(restic.F
 		prefix += "/"
 	}
 
+	if t == restic.PackFile && be.inventory != "" && inventory.Allowed(ctx) {
+		return be.listInventory(ctx, prefix, fn)
+	}
+
 	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
 
@@ -389,6 +400,47 @@ func (be *Backend) List(ctx context.Context, t restic.FileType, fn func(restic.F
 	return ctx.Err()
 }
 
+// listInventory lists the pack files below prefix using the configured
+// inventory report instead of listing the bucket.
+func (be *Backend) listInventory(ctx context.Context, prefix string, fn func(restic.FileInfo) error) error {
+	bucket, key, err := inventory.ParseLocation(be.inventory)
+	if err != nil {
+		return err
+	}
+
+	maxAge := be.inventoryMaxAge
+	if maxAge == 0 {
+		maxAge = inventory.DefaultMaxAge
+	}
+
+	m, err := inventory.Load(ctx, be.openInventory, bucket, key, be.bucketName, maxAge)
+	if err != nil {
+		return errors.Wrap(err, "inventory")
+	}
+
+	inventory.MarkUsed(ctx)
+	return m.List(ctx, be.openInventory, be.bucketName, prefix, func(e inventory.Entry) error {
+		return fn(restic.FileInfo{
+			Name: path.Base(e.Key),
+			Size: e.Size,
+		})
+	})
+}
+
+func (be *Backend) openInventory(ctx context.Context, bucket, key string) (io.ReadCloser, error) {
+	be.sem.GetToken()
+	ctx, cancel := context.WithCancel(ctx)
+
+	r, err := be.gcsClient.Bucket(bucket).Object(key).NewReader(ctx)
+	if err != nil {
+		cancel()
+		be.sem.ReleaseToken()
+		return nil, err
+	}
+
+	return be.sem.ReleaseTokenOnClose(r, cancel), nil
+}
+
 // Remove keys for a specified backend type.
 func (be *Backend) removeKeys(ctx context.Context, t restic.FileType) error {
 	return be.List(ctx, t, func(fi restic.FileInfo) error {
@@ -0,0 +1,423 @@
+// Package inventory reads the object inventory reports generated by cloud
+// storage providers (S3 Inventory and GCS Storage Insights). Listing the
+// objects in a bucket via an inventory report is much faster than a live
+// listing for buckets with many millions of objects, at the cost of the
+// report being up to a day old.
+package inventory
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
+)
+
+// DefaultMaxAge is the maximum age of an inventory report used if none is
+// configured. Both S3 and GCS generate reports at most once per day.
+const DefaultMaxAge = 48 * time.Hour
+
+type allowKey struct{}
+
+// usage records whether a listing was served from an inventory report.
+type usage struct {
+	used int32
+}
+
+// Allow returns a context which permits backends to list pack files using an
+// inventory report. Reports can be outdated, so callers must tolerate pack
+// files which are missing from the report or no longer exist. Use Used to
+// find out whether a listing was actually served from a report.
+func Allow(ctx context.Context) context.Context {
+	return context.WithValue(ctx, allowKey{}, &usage{})
+}
+
+// Allowed reports whether the pack files may be listed using an inventory
+// report, see Allow.
+func Allowed(ctx context.Context) bool {
+	_, allowed := ctx.Value(allowKey{}).(*usage)
+	return allowed
+}
+
+// MarkUsed records that a listing with ctx is served from an inventory report.
+// Backends must call it before returning any entry from a report.
+func MarkUsed(ctx context.Context) {
+	if u, ok := ctx.Value(allowKey{}).(*usage); ok {
+		atomic.StoreInt32(&u.used, 1)
+	}
+}
+
+// Used reports whether a listing with ctx, as returned by Allow, was served
+// from an inventory report.
+func Used(ctx context.Context) bool {
+	u, ok := ctx.Value(allowKey{}).(*usage)
+	return ok && atomic.LoadInt32(&u.used) != 0
+}
+
+// OpenFunc opens the object key in the bucket for reading.
+type OpenFunc func(ctx context.Context, bucket, key string) (io.ReadCloser, error)
+
+// Entry describes an object contained in an inventory report.
+type Entry struct {
+	// Bucket is empty if the report does not include the bucket name.
+	Bucket string
+	Key    string
+	Size   int64
+}
+
+// Manifest describes an inventory report, which consists of several shards.
+type Manifest struct {
+	// Created is the point in time the list of objects was taken.
+	Created time.Time
+	// SourceBucket is the bucket the report was generated for, it is empty
+	// if the manifest does not include that information.
+	SourceBucket string
+	// Bucket contains the shards listed in Files.
+	Bucket string
+	Files  []string
+
+	// columns maps the column names to indexes, it is nil if the shards
+	// contain a header.
+	columns   map[string]int
+	delimiter rune
+	// urlEncoded is true if the object keys in the shards are URL-encoded.
+	urlEncoded bool
+}
+
+type s3Manifest struct {
+	SourceBucket      string `json:"sourceBucket"`
+	DestinationBucket string `json:"destinationBucket"`
+	FileFormat        string `json:"fileFormat"`
+	FileSchema        string `json:"fileSchema"`
+	CreationTimestamp string `json:"creationTimestamp"`
+	Files             []struct {
+		Key string `json:"key"`
+	} `json:"files"`
+}
+
+type gcsManifest struct {
+	SnapshotTime   *time.Time `json:"snapshot_time"`
+	ShardFileNames []string   `json:"report_shards_file_names"`
+	ReportConfig   struct {
+		CSVOptions *struct {
+			Delimiter string `json:"delimiter"`
+		} `json:"csv_options"`
+		ParquetOptions *json.RawMessage `json:"parquet_options"`
+	} `json:"report_config"`
+}
+
+// ParseManifest parses the manifest of an inventory report, which was loaded
+// from key in bucket. Both S3 Inventory and GCS Storage Insights manifests
+// are supported.
+func ParseManifest(buf []byte, bucket, key string) (*Manifest, error) {
+	var probe map[string]json.RawMessage
+	if err := json.Unmarshal(buf, &probe); err != nil {
+		return nil, errors.Wrap(err, "Unmarshal")
+	}
+
+	switch {
+	case probe["sourceBucket"] != nil:
+		return parseS3Manifest(buf, bucket)
+	case probe["report_shards_file_names"] != nil:
+		return parseGCSManifest(buf, bucket, key)
+	default:
+		return nil, errors.New("unknown inventory manifest format")
+	}
+}
+
+func parseS3Manifest(buf []byte, bucket string) (*Manifest, error) {
+	var sm s3Manifest
+	if err := json.Unmarshal(buf, &sm); err != nil {
+		return nil, errors.Wrap(err, "Unmarshal")
+	}
+
+	if sm.FileFormat != "CSV" {
+		return nil, errors.Errorf("unsupported inventory file format %q, only CSV is supported", sm.FileFormat)
+	}
+
+	ms, err := strconv.ParseInt(sm.CreationTimestamp, 10, 64)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid creationTimestamp")
+	}
+
+	m := &Manifest{
+		Created:      time.UnixMilli(ms),
+		SourceBucket: sm.SourceBucket,
+		Bucket:       bucket,
+		columns:      make(map[string]int),
+		delimiter:    ',',
+		urlEncoded:   true,
+	}
+
+	// the destination bucket is specified as an ARN, e.g. "arn:aws:s3:::bucket"
+	if sm.DestinationBucket != "" {
+		m.Bucket = sm.DestinationBucket[strings.LastIndex(sm.DestinationBucket, ":")+1:]
+	}
+
+	for i, name := range strings.Split(sm.FileSchema, ",") {
+		m.columns[strings.TrimSpace(name)] = i
+	}
+	if _, ok := m.columns["Key"]; !ok {
+		return nil, errors.New("inventory does not contain the Key field")
+	}
+	if _, ok := m.columns["Size"]; !ok {
+		return nil, errors.New("inventory does not contain the Size field")
+	}
+
+	for _, f := range sm.Files {
+		m.Files = append(m.Files, f.Key)
+	}
+
+	return m, nil
+}
+
+func parseGCSManifest(buf []byte, bucket, key string) (*Manifest, error) {
+	var gm gcsManifest
+	if err := json.Unmarshal(buf, &gm); err != nil {
+		return nil, errors.Wrap(err, "Unmarshal")
+	}
+
+	if gm.ReportConfig.ParquetOptions != nil {
+		return nil, errors.New("unsupported inventory file format Parquet, only CSV is supported")
+	}
+	if gm.SnapshotTime == nil {
+		return nil, errors.New("inventory manifest does not contain snapshot_time")
+	}
+
+	m := &Manifest{
+		Created:   *gm.SnapshotTime,
+		Bucket:    bucket,
+		delimiter: ',',
+	}
+
+	if opts := gm.ReportConfig.CSVOptions; opts != nil && opts.Delimiter != "" {
+		if len([]rune(opts.Delimiter)) != 1 {
+			return nil, errors.Errorf("unsupported CSV delimiter %q", opts.Delimiter)
+		}
+		m.delimiter = []rune(opts.Delimiter)[0]
+	}
+
+	// the shards are stored next to the manifest
+	dir := path.Dir(key)
+	for _, name := range gm.ShardFileNames {
+		if dir != "." {
+			name = path.Join(dir, name)
+		}
+		m.Files = append(m.Files, name)
+	}
+
+	return m, nil
+}
+
+// Load loads the manifest stored at key in bucket and verifies that it is
+// not older than maxAge. If the manifest names the bucket the report was
+// generated for, it must match sourceBucket.
+func Load(ctx context.Context, open OpenFunc, bucket, key, sourceBucket string, maxAge time.Duration) (*Manifest, error) {
+	rd, err := open(ctx, bucket, key)
+	if err != nil {
+		return nil, err
+	}
+	buf, err := io.ReadAll(rd)
+	_ = rd.Close()
+	if err != nil {
+		return nil, errors.Wrap(err, "ReadAll")
+	}
+
+	m, err := ParseManifest(buf, bucket, key)
+	if err != nil {
+		return nil, err
+	}
+
+	if m.SourceBucket != "" && m.SourceBucket != sourceBucket {
+		return nil, errors.Errorf("inventory report is for bucket %q, not %q", m.SourceBucket, sourceBucket)
+	}
+
+	if err := m.CheckFresh(maxAge, time.Now()); err != nil {
+		return nil, err
+	}
+
+	debug.Log("using inventory report from %v with %d shards", m.Created, len(m.Files))
+	return m, nil
+}
+
+// ParseLocation splits the location of a manifest in the form
+// "bucket/path/to/manifest.json" into bucket and key.
+func ParseLocation(s string) (bucket, key string, err error) {
+	bucket, key, ok := strings.Cut(s, "/")
+	if !ok || bucket == "" || key == "" {
+		return "", "", errors.Errorf("invalid inventory location %q, expected bucket/path/to/manifest.json", s)
+	}
+	return bucket, key, nil
+}
+
+// CheckFresh returns an error if the report is older than maxAge.
+func (m *Manifest) CheckFresh(maxAge time.Duration, now time.Time) error {
+	age := now.Sub(m.Created)
+	if age > maxAge {
+		return errors.Errorf("inventory report from %v is older than the maximum age %v", m.Created.Format(time.RFC3339), maxAge)
+	}
+	return nil
+}
+
+// List calls fn for each object in the report which is contained in bucket
+// and whose key starts with prefix. Objects of other buckets are only
+// skipped if the report includes the bucket name.
+func (m *Manifest) List(ctx context.Context, open OpenFunc, bucket, prefix string, fn func(Entry) error) error {
+	for _, file := range m.Files {
+		debug.Log("reading inventory shard %v", file)
+		err := m.listShard(ctx, open, file, func(e Entry) error {
+			if e.Bucket != "" && e.Bucket != bucket {
+				return nil
+			}
+			// skip placeholder objects for directories
+			if !strings.HasPrefix(e.Key, prefix) || strings.HasSuffix(e.Key, "/") {
+				return nil
+			}
+			return fn(e)
+		})
+		if err != nil {
+			return errors.Wrapf(err, "inventory shard %v", file)
+		}
+	}
+
+	return ctx.Err()
+}
+
+func (m *Manifest) listShard(ctx context.Context, open OpenFunc, file string, fn func(Entry) error) error {
+	rd, err := open(ctx, m.Bucket, file)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = rd.Close()
+	}()
+
+	var src io.Reader = rd
+	if strings.HasSuffix(file, ".gz") {
+		gz, err := gzip.NewReader(rd)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			_ = gz.Close()
+		}()
+		src = gz
+	}
+
+	r := csv.NewReader(src)
+	r.Comma = m.delimiter
+	r.FieldsPerRecord = -1
+	r.ReuseRecord = true
+
+	columns := m.columns
+	if columns == nil {
+		header, err := r.Read()
+		if err != nil {
+			return errors.Wrap(err, "reading header")
+		}
+		columns = make(map[string]int)
+		for i, name := range header {
+			columns[name] = i
+		}
+		if _, ok := columns["name"]; !ok {
+			return errors.New("inventory does not contain the name field")
+		}
+		if _, ok := columns["size"]; !ok {
+			return errors.New("inventory does not contain the size field")
+		}
+	}
+
+	fields := newFieldIndex(columns)
+
+	for {
+		record, err := r.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		e, skip, err := fields.entry(record, m.urlEncoded)
+		if err != nil {
+			return err
+		}
+		if skip {
+			continue
+		}
+
+		if err := fn(e); err != nil {
+			return err
+		}
+	}
+}
+
+// fieldIndex contains the indexes of the relevant columns, -1 means the
+// column is not present.
+type fieldIndex struct {
+	bucket, key, size   int
+	isLatest, isDeleted int
+}
+
+func newFieldIndex(columns map[string]int) fieldIndex {
+	get := func(names ...string) int {
+		for _, name := range names {
+			if i, ok := columns[name]; ok {
+				return i
+			}
+		}
+		return -1
+	}
+
+	return fieldIndex{
+		bucket:    get("Bucket", "bucket"),
+		key:       get("Key", "name"),
+		size:      get("Size", "size"),
+		isLatest:  get("IsLatest"),
+		isDeleted: get("IsDeleteMarker"),
+	}
+}
+
+// entry extracts the entry from record. Reports for versioned buckets also
+// contain noncurrent versions and delete markers, these are skipped.
+func (f fieldIndex) entry(record []string, urlEncoded bool) (e Entry, skip bool, err error) {
+	field := func(i int) string {
+		if i < 0 || i >= len(record) {
+			return ""
+		}
+		return record[i]
+	}
+
+	if field(f.isLatest) == "false" || field(f.isDeleted) == "true" {
+		return Entry{}, true, nil
+	}
+
+	e.Bucket = field(f.bucket)
+	e.Key = field(f.key)
+	if urlEncoded {
+		e.Key, err = url.QueryUnescape(e.Key)
+		if err != nil {
+			return Entry{}, false, errors.Wrap(err, "invalid key")
+		}
+	}
+
+	e.Size, err = strconv.ParseInt(field(f.size), 10, 64)
+	if err != nil {
+		return Entry{}, false, errors.Wrapf(err, "invalid size for %v", e.Key)
+	}
+
+	return e, false, nil
+}
@@ -0,0 +1,179 @@
+package inventory
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	rtest "github.com/restic/restic/internal/test"
+)
+
+type memBucket map[string][]byte
+
+func (b memBucket) open(ctx context.Context, bucket, key string) (io.ReadCloser, error) {
+	buf, ok := b[bucket+"/"+key]
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+	return io.NopCloser(bytes.NewReader(buf)), nil
+}
+
+func gzipData(t testing.TB, s string) []byte {
+	var buf bytes.Buffer
+	wr := gzip.NewWriter(&buf)
+	_, err := wr.Write([]byte(s))
+	rtest.OK(t, err)
+	rtest.OK(t, wr.Close())
+	return buf.Bytes()
+}
+
+func listAll(t testing.TB, m *Manifest, b memBucket, bucket, prefix string) []Entry {
+	var entries []Entry
+	err := m.List(context.TODO(), b.open, bucket, prefix, func(e Entry) error {
+		entries = append(entries, e)
+		return nil
+	})
+	rtest.OK(t, err)
+	return entries
+}
+
+const testS3Manifest = `{
+  "sourceBucket": "repo",
+  "destinationBucket": "arn:aws:s3:::inventory",
+  "version": "2016-11-30",
+  "creationTimestamp": "1682899200000",
+  "fileFormat": "CSV",
+  "fileSchema": "Bucket, Key, VersionId, IsLatest, IsDeleteMarker, Size",
+  "files": [
+    {"key": "repo/daily/data/1.csv.gz", "size": 100, "MD5checksum": "x"},
+    {"key": "repo/daily/data/2.csv.gz", "size": 100, "MD5checksum": "x"}
+  ]
+}`
+
+func TestS3Inventory(t *testing.T) {
+	b := memBucket{
+		"inventory/repo/daily/manifest.json": []byte(testS3Manifest),
+		"inventory/repo/daily/data/1.csv.gz": gzipData(t, strings.Join([]string{
+			`"repo","restic/data/00/00aa","v1","true","false","123"`,
+			`"repo","restic/data/00/00bb","v1","false","false","456"`,
+			`"repo","restic/data/00/00cc","v2","true","true",""`,
+		}, "\n")),
+		"inventory/repo/daily/data/2.csv.gz": gzipData(t, strings.Join([]string{
+			`"repo","restic/data/01/01aa%2Bx","v1","true","false","789"`,
+			`"repo","restic/index/aa","v1","true","false","1"`,
+			`"other","restic/data/02/02aa","v1","true","false","1"`,
+		}, "\n")),
+	}
+
+	buf := b["inventory/repo/daily/manifest.json"]
+	m, err := ParseManifest(buf, "inventory", "repo/daily/manifest.json")
+	rtest.OK(t, err)
+	rtest.Equals(t, time.UnixMilli(1682899200000), m.Created)
+	rtest.Equals(t, "repo", m.SourceBucket)
+	rtest.Equals(t, "inventory", m.Bucket)
+
+	entries := listAll(t, m, b, "repo", "restic/data/")
+	rtest.Equals(t, []Entry{
+		{Bucket: "repo", Key: "restic/data/00/00aa", Size: 123},
+		{Bucket: "repo", Key: "restic/data/01/01aa+x", Size: 789},
+	}, entries)
+}
+
+const testGCSManifest = `{
+  "report_config": {
+    "csv_options": {"record_separator": "\n", "delimiter": ";", "header_required": true}
+  },
+  "records_processed": 3,
+  "snapshot_time": "2023-05-01T00:00:00Z",
+  "shard_count": 1,
+  "report_shards_file_names": ["report_0.csv"]
+}`
+
+func TestGCSInventory(t *testing.T) {
+	b := memBucket{
+		"inventory/reports/manifest.json": []byte(testGCSManifest),
+		"inventory/reports/report_0.csv": []byte(strings.Join([]string{
+			`bucket;name;size`,
+			`repo;restic/data/00/00aa;123`,
+			`repo;restic/keys/aa;1`,
+			`other;restic/data/00/00bb;1`,
+		}, "\n")),
+	}
+
+	m, err := ParseManifest(b["inventory/reports/manifest.json"], "inventory", "reports/manifest.json")
+	rtest.OK(t, err)
+	rtest.Equals(t, time.Date(2023, 5, 1, 0, 0, 0, 0, time.UTC), m.Created.UTC())
+	rtest.Equals(t, []string{"reports/report_0.csv"}, m.Files)
+
+	entries := listAll(t, m, b, "repo", "restic/data/")
+	rtest.Equals(t, []Entry{
+		{Bucket: "repo", Key: "restic/data/00/00aa", Size: 123},
+	}, entries)
+}
+
+func TestLoad(t *testing.T) {
+	b := memBucket{
+		"inventory/repo/daily/manifest.json": []byte(testS3Manifest),
+	}
+
+	// the manifest is from 2023, far older than any sensible maximum age
+	_, err := Load(context.TODO(), b.open, "inventory", "repo/daily/manifest.json", "repo", 48*time.Hour)
+	rtest.Assert(t, err != nil && strings.Contains(err.Error(), "older than"), "expected error for stale report, got %v", err)
+
+	_, err = Load(context.TODO(), b.open, "inventory", "repo/daily/manifest.json", "other", 100*365*24*time.Hour)
+	rtest.Assert(t, err != nil && strings.Contains(err.Error(), "for bucket"), "expected error for wrong bucket, got %v", err)
+
+	m, err := Load(context.TODO(), b.open, "inventory", "repo/daily/manifest.json", "repo", 100*365*24*time.Hour)
+	rtest.OK(t, err)
+	rtest.Equals(t, 2, len(m.Files))
+}
+
+func TestCheckFresh(t *testing.T) {
+	now := time.Date(2023, 5, 2, 12, 0, 0, 0, time.UTC)
+	m := &Manifest{Created: now.Add(-36 * time.Hour)}
+
+	rtest.OK(t, m.CheckFresh(48*time.Hour, now))
+	rtest.Assert(t, m.CheckFresh(24*time.Hour, now) != nil, "expected error for stale report")
+}
+
+func TestParseLocation(t *testing.T) {
+	bucket, key, err := ParseLocation("inventory/repo/daily/manifest.json")
+	rtest.OK(t, err)
+	rtest.Equals(t, "inventory", bucket)
+	rtest.Equals(t, "repo/daily/manifest.json", key)
+
+	for _, s := range []string{"", "inventory", "inventory/", "/manifest.json"} {
+		_, _, err := ParseLocation(s)
+		rtest.Assert(t, err != nil, "expected error for %q", s)
+	}
+}
+
+func TestParseManifestUnknown(t *testing.T) {
+	_, err := ParseManifest([]byte(`{"foo": "bar"}`), "inventory", "manifest.json")
+	rtest.Assert(t, err != nil, "expected error for unknown manifest")
+
+	_, err = ParseManifest([]byte(strings.Replace(testS3Manifest, `"CSV"`, `"Parquet"`, 1)), "inventory", "manifest.json")
+	rtest.Assert(t, err != nil, "expected error for unsupported file format")
+}
+
+func TestAllow(t *testing.T) {
+	ctx := context.Background()
+	rtest.Assert(t, !Allowed(ctx), "inventory allowed without opt-in")
+	rtest.Assert(t, Allowed(Allow(ctx)), "inventory not allowed after opt-in")
+}
+
+func TestUsed(t *testing.T) {
+	ctx := context.Background()
+	MarkUsed(ctx)
+	rtest.Assert(t, !Used(ctx), "inventory used without opt-in")
+
+	ctx = Allow(ctx)
+	rtest.Assert(t, !Used(ctx), "inventory used before listing")
+	MarkUsed(ctx)
+	rtest.Assert(t, Used(ctx), "inventory not used after listing")
+}
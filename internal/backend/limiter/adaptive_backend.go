@@ -0,0 +1,192 @@
+package limiter
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/restic"
+)
+
+// AdaptiveConcurrencyBackend wraps a Backend and limits the number of
+// concurrent Save() calls. The limit is tuned automatically between one and
+// the number of connections of the backend, using an additive increase /
+// multiplicative decrease (AIMD) scheme: it grows while uploads succeed and
+// shrinks when uploads fail or their latency rises well above the best
+// latency observed so far.
+func AdaptiveConcurrencyBackend(be restic.Backend) restic.Backend {
+	return &adaptiveBackend{
+		Backend: be,
+		ctrl:    newAIMDController(be.Connections()),
+	}
+}
+
+type adaptiveBackend struct {
+	restic.Backend
+	ctrl *aimdController
+}
+
+func (b *adaptiveBackend) Save(ctx context.Context, h restic.Handle, rd restic.RewindReader) error {
+	if err := b.ctrl.acquire(ctx); err != nil {
+		return err
+	}
+
+	start := time.Now()
+	err := b.Backend.Save(ctx, h, rd)
+	if ctx.Err() != nil {
+		// the operation was cancelled, its outcome says nothing about the backend
+		b.ctrl.release()
+		return err
+	}
+
+	b.ctrl.observe(time.Since(start), rd.Length(), err)
+	return err
+}
+
+const (
+	// latencyThreshold is the factor by which the latency of an upload must
+	// exceed the baseline latency to be considered a sign of congestion.
+	latencyThreshold = 2.0
+	// decreaseFactor is applied to the limit on congestion.
+	decreaseFactor = 0.5
+	// baselineDecay lets the baseline latency slowly follow the observed
+	// latency, so that a single exceptionally fast upload does not count
+	// as baseline forever. As this also applies to slow uploads, a
+	// persistent slowdown becomes the new baseline after a while and the
+	// limit grows again.
+	baselineDecay = 0.02
+	// requestOverhead is added to the size of each upload when computing
+	// the latency, such that tiny uploads are not dominated by the round
+	// trip time.
+	requestOverhead = 256 * 1024
+)
+
+// aimdController limits the number of concurrent operations and adapts the
+// limit based on the observed outcome of each operation.
+type aimdController struct {
+	m        sync.Mutex
+	limit    float64
+	max      float64
+	inFlight int
+	changed  chan struct{}
+
+	// slowStart is true until the first congestion event, the limit grows
+	// exponentially during that phase.
+	slowStart bool
+	// baseline is the best observed latency in seconds per byte.
+	baseline float64
+	// sinceDecrease counts the operations which completed since the last
+	// decrease of the limit.
+	sinceDecrease int
+}
+
+func newAIMDController(max uint) *aimdController {
+	if max == 0 {
+		max = 1
+	}
+
+	return &aimdController{
+		limit:     math.Min(2, float64(max)),
+		max:       float64(max),
+		changed:   make(chan struct{}),
+		slowStart: true,
+	}
+}
+
+// Limit returns the current number of allowed concurrent operations.
+func (c *aimdController) Limit() int {
+	c.m.Lock()
+	defer c.m.Unlock()
+	return int(c.limit)
+}
+
+// acquire blocks until the operation may start or ctx is cancelled.
+func (c *aimdController) acquire(ctx context.Context) error {
+	for {
+		c.m.Lock()
+		if c.inFlight < int(c.limit) {
+			c.inFlight++
+			c.m.Unlock()
+			return nil
+		}
+		ch := c.changed
+		c.m.Unlock()
+
+		select {
+		case <-ch:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// release marks an operation as finished without adapting the limit.
+func (c *aimdController) release() {
+	c.m.Lock()
+	defer c.m.Unlock()
+	c.done()
+}
+
+// observe marks an operation, which took d to process size bytes, as
+// finished and adapts the limit according to its outcome.
+func (c *aimdController) observe(d time.Duration, size int64, err error) {
+	c.m.Lock()
+	defer c.m.Unlock()
+	defer c.done()
+
+	c.sinceDecrease++
+
+	if err != nil {
+		if !errors.Is(err, context.Canceled) {
+			c.decrease("error")
+		}
+		return
+	}
+
+	latency := d.Seconds() / float64(size+requestOverhead)
+	congested := c.baseline != 0 && latency > c.baseline*latencyThreshold
+	if c.baseline == 0 || latency < c.baseline {
+		c.baseline = latency
+	} else {
+		c.baseline += (latency - c.baseline) * baselineDecay
+	}
+
+	if congested {
+		c.decrease("latency")
+		return
+	}
+	c.increase()
+}
+
+func (c *aimdController) increase() {
+	if c.slowStart {
+		c.limit++
+	} else {
+		c.limit += 1 / c.limit
+	}
+	c.limit = math.Min(c.limit, c.max)
+}
+
+func (c *aimdController) decrease(reason string) {
+	// only decrease the limit once per window of concurrent operations,
+	// operations started before the last decrease still see the congestion
+	if !c.slowStart && c.sinceDecrease < int(c.limit) {
+		return
+	}
+	c.slowStart = false
+	c.sinceDecrease = 0
+
+	c.limit = math.Max(math.Floor(c.limit*decreaseFactor), 1)
+	debug.Log("decreased concurrency limit to %v due to %v", int(c.limit), reason)
+}
+
+// done decrements the number of operations in flight and wakes up waiting
+// operations. The caller must hold c.m.
+func (c *aimdController) done() {
+	c.inFlight--
+	close(c.changed)
+	c.changed = make(chan struct{})
+}
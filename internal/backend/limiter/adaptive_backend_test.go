@@ -0,0 +1,142 @@
+package limiter
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/restic/restic/internal/backend/mock"
+	"github.com/restic/restic/internal/restic"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func TestAIMDControllerSlowStart(t *testing.T) {
+	c := newAIMDController(8)
+	rtest.Equals(t, 2, c.Limit())
+
+	for i := 0; i < 10; i++ {
+		rtest.OK(t, c.acquire(context.TODO()))
+		c.observe(time.Second, 1024*1024, nil)
+	}
+	rtest.Equals(t, 8, c.Limit())
+}
+
+func TestAIMDControllerDecrease(t *testing.T) {
+	c := newAIMDController(16)
+	for i := 0; i < 20; i++ {
+		rtest.OK(t, c.acquire(context.TODO()))
+		c.observe(time.Second, 1024*1024, nil)
+	}
+	rtest.Equals(t, 16, c.Limit())
+
+	// an error halves the limit
+	rtest.OK(t, c.acquire(context.TODO()))
+	c.observe(time.Second, 1024*1024, errors.New("throttled"))
+	rtest.Equals(t, 8, c.Limit())
+
+	// further errors within the same window are ignored
+	for i := 0; i < 7; i++ {
+		rtest.OK(t, c.acquire(context.TODO()))
+		c.observe(time.Second, 1024*1024, errors.New("throttled"))
+	}
+	rtest.Equals(t, 8, c.Limit())
+
+	// a sharp increase of the latency halves the limit once the window is over
+	rtest.OK(t, c.acquire(context.TODO()))
+	c.observe(5*time.Second, 1024*1024, nil)
+	rtest.Equals(t, 4, c.Limit())
+
+	// the limit now grows by about one per window
+	for i := 0; i < 5; i++ {
+		rtest.OK(t, c.acquire(context.TODO()))
+		c.observe(time.Second, 1024*1024, nil)
+	}
+	rtest.Equals(t, 5, c.Limit())
+
+	// cancelled operations do not change the limit
+	rtest.OK(t, c.acquire(context.TODO()))
+	c.observe(time.Second, 1024*1024, context.Canceled)
+	rtest.Equals(t, 5, c.Limit())
+}
+
+func TestAIMDControllerPersistentSlowdown(t *testing.T) {
+	c := newAIMDController(8)
+	for i := 0; i < 10; i++ {
+		rtest.OK(t, c.acquire(context.TODO()))
+		c.observe(time.Second, 1024*1024, nil)
+	}
+	rtest.Equals(t, 8, c.Limit())
+
+	// the latency rises and stays high, the limit first collapses
+	for i := 0; i < 20; i++ {
+		rtest.OK(t, c.acquire(context.TODO()))
+		c.observe(5*time.Second, 1024*1024, nil)
+	}
+	rtest.Equals(t, 1, c.Limit())
+
+	// but the baseline follows the latency, such that the limit grows again
+	for i := 0; i < 200; i++ {
+		rtest.OK(t, c.acquire(context.TODO()))
+		c.observe(5*time.Second, 1024*1024, nil)
+	}
+	rtest.Assert(t, c.Limit() >= 4, "limit did not recover after a persistent slowdown, got %d", c.Limit())
+}
+
+func TestAIMDControllerMinimum(t *testing.T) {
+	c := newAIMDController(4)
+	for i := 0; i < 20; i++ {
+		rtest.OK(t, c.acquire(context.TODO()))
+		c.observe(time.Second, 1024*1024, errors.New("throttled"))
+	}
+	rtest.Equals(t, 1, c.Limit())
+}
+
+func TestAIMDControllerAcquireCancel(t *testing.T) {
+	c := newAIMDController(1)
+	rtest.OK(t, c.acquire(context.TODO()))
+
+	ctx, cancel := context.WithCancel(context.TODO())
+	cancel()
+	rtest.Equals(t, context.Canceled, c.acquire(ctx))
+
+	c.release()
+	rtest.OK(t, c.acquire(context.TODO()))
+}
+
+func TestAdaptiveConcurrencyBackend(t *testing.T) {
+	be := mock.NewBackend()
+	be.ConnectionsFn = func() uint { return 4 }
+
+	var inFlight, maxInFlight int32
+	be.SaveFn = func(ctx context.Context, h restic.Handle, rd restic.RewindReader) error {
+		n := atomic.AddInt32(&inFlight, 1)
+		defer atomic.AddInt32(&inFlight, -1)
+		for {
+			old := atomic.LoadInt32(&maxInFlight)
+			if n <= old || atomic.CompareAndSwapInt32(&maxInFlight, old, n) {
+				break
+			}
+		}
+		time.Sleep(time.Millisecond)
+		return errors.New("throttled")
+	}
+
+	adaptive := AdaptiveConcurrencyBackend(be)
+	rtest.Equals(t, uint(4), adaptive.Connections())
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_ = adaptive.Save(context.TODO(), restic.Handle{Type: restic.PackFile, Name: "test"}, restic.NewByteReader(nil, nil))
+		}()
+	}
+	wg.Wait()
+
+	rtest.Assert(t, maxInFlight <= 2, "too many concurrent uploads: %v", maxInFlight)
+	rtest.Equals(t, 1, adaptive.(*adaptiveBackend).ctrl.Limit())
+}
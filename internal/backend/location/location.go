@@ -8,6 +8,7 @@ import (
 	"github.com/restic/restic/internal/backend/b2"
 	"github.com/restic/restic/internal/backend/gs"
 	"github.com/restic/restic/internal/backend/local"
+	"github.com/restic/restic/internal/backend/media"
 	"github.com/restic/restic/internal/backend/rclone"
 	"github.com/restic/restic/internal/backend/rest"
 	"github.com/restic/restic/internal/backend/s3"
@@ -35,6 +36,7 @@ var parsers = []parser{
 	{"b2", b2.ParseConfig, noPassword},
 	{"local", local.ParseConfig, noPassword},
 	{"sftp", sftp.ParseConfig, noPassword},
+	{"media", media.ParseConfig, noPassword},
 	{"s3", s3.ParseConfig, noPassword},
 	{"gs", gs.ParseConfig, noPassword},
 	{"azure", azure.ParseConfig, noPassword},
@@ -7,6 +7,7 @@ import (
 
 	"github.com/restic/restic/internal/backend/b2"
 	"github.com/restic/restic/internal/backend/local"
+	"github.com/restic/restic/internal/backend/media"
 	"github.com/restic/restic/internal/backend/rest"
 	"github.com/restic/restic/internal/backend/s3"
 	"github.com/restic/restic/internal/backend/sftp"
@@ -134,6 +135,15 @@ var parseTests = []struct {
 			},
 		},
 	},
+	{
+		"media:/srv/catalog",
+		Location{Scheme: "media",
+			Config: media.Config{
+				Path:        "/srv/catalog",
+				Connections: 2,
+			},
+		},
+	},
 	{
 		"sftp:user@host:/srv/repo",
 		Location{Scheme: "sftp",
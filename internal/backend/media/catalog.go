@@ -0,0 +1,388 @@
+package media
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/fs"
+)
+
+// CatalogFilename is the name of the catalog file in the catalog directory.
+const CatalogFilename = "media-catalog"
+
+// packInfo describes where a pack file is stored.
+type packInfo struct {
+	label string
+	size  int64
+}
+
+// Catalog records which pack file is stored on which disk. It is stored as
+// an append-only log of changes in the catalog directory, each line
+// describes one change:
+//
+//	label <label>                disk with this label was used
+//	add <label> <name> <size>    pack file was saved
+//	remove <label> <name>        pack file was removed from the repository
+//	purged <label> <name>        pack file was deleted from the disk
+//	full <label>                 disk has no space left
+//
+// Several processes may use the catalog at the same time, e.g. check and
+// backup. Changes are only written while holding a lock on a separate lock
+// file, after applying the changes appended by other processes.
+type Catalog struct {
+	m        sync.Mutex
+	filename string
+	lock     *os.File
+	f        *os.File
+	offset   int64
+	lines    int
+
+	labels  map[string]struct{}
+	packs   map[string]packInfo
+	pending map[string]map[string]struct{}
+	full    map[string]struct{}
+}
+
+// LoadCatalog loads the catalog from dir. If it does not exist yet, an empty
+// catalog is created.
+func LoadCatalog(dir string) (*Catalog, error) {
+	c := &Catalog{
+		filename: filepath.Join(dir, CatalogFilename),
+	}
+
+	var err error
+	c.lock, err = fs.OpenFile(c.filename+".lock", os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	err = c.update(func() error {
+		if c.lines <= 2*c.entries()+1000 {
+			return nil
+		}
+		if err := c.compact(); err != nil {
+			// the catalog is still valid, only larger than necessary
+			debug.Log("compacting catalog %v failed: %v", c.filename, err)
+		}
+		return c.refresh()
+	})
+	if err != nil {
+		_ = c.Close()
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// update runs fn while holding the lock on the catalog file, after the
+// changes made by other processes have been applied.
+func (c *Catalog) update(fn func() error) error {
+	if c.lock == nil {
+		return errors.New("catalog is closed")
+	}
+	if err := lockFile(c.lock); err != nil {
+		return errors.Wrap(err, "lock catalog")
+	}
+
+	err := c.refresh()
+	if err == nil {
+		err = fn()
+	}
+
+	if uerr := unlockFile(c.lock); err == nil && uerr != nil {
+		err = errors.Wrap(uerr, "unlock catalog")
+	}
+	return err
+}
+
+// refresh applies the lines which were appended to the catalog file since it
+// was last read. If the file was replaced by compact, it is read again from
+// the start. The caller must hold the lock on the catalog file.
+func (c *Catalog) refresh() error {
+	if c.f != nil {
+		fi, err := fs.Stat(c.filename)
+		cur, cerr := c.f.Stat()
+		if err != nil || cerr != nil || !os.SameFile(fi, cur) {
+			debug.Log("catalog %v was replaced, reloading", c.filename)
+			_ = c.f.Close()
+			c.f = nil
+		}
+	}
+
+	if c.f == nil {
+		f, err := fs.OpenFile(c.filename, os.O_RDWR|os.O_APPEND|os.O_CREATE, 0600)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		c.f = f
+		c.offset = 0
+		c.lines = 0
+		c.labels = make(map[string]struct{})
+		c.packs = make(map[string]packInfo)
+		c.pending = make(map[string]map[string]struct{})
+		c.full = make(map[string]struct{})
+	}
+
+	if _, err := c.f.Seek(c.offset, io.SeekStart); err != nil {
+		return errors.WithStack(err)
+	}
+
+	rd := bufio.NewReader(c.f)
+	for {
+		line, err := rd.ReadString('\n')
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return errors.WithStack(err)
+		}
+
+		c.lines++
+		c.offset += int64(len(line))
+		if err := c.apply(strings.TrimSuffix(line, "\n")); err != nil {
+			return errors.Wrapf(err, "%v line %d", c.filename, c.lines)
+		}
+	}
+}
+
+func (c *Catalog) apply(line string) error {
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return nil
+	}
+
+	switch {
+	case fields[0] == "label" && len(fields) == 2:
+		c.labels[fields[1]] = struct{}{}
+	case fields[0] == "add" && len(fields) == 4:
+		size, err := strconv.ParseInt(fields[3], 10, 64)
+		if err != nil {
+			return err
+		}
+		c.labels[fields[1]] = struct{}{}
+		c.packs[fields[2]] = packInfo{label: fields[1], size: size}
+		// the file was saved again, it must not be deleted later
+		delete(c.pending[fields[1]], fields[2])
+	case fields[0] == "remove" && len(fields) == 3:
+		if c.packs[fields[2]].label == fields[1] {
+			delete(c.packs, fields[2])
+		}
+		if c.pending[fields[1]] == nil {
+			c.pending[fields[1]] = make(map[string]struct{})
+		}
+		c.pending[fields[1]][fields[2]] = struct{}{}
+	case fields[0] == "purged" && len(fields) == 3:
+		delete(c.pending[fields[1]], fields[2])
+	case fields[0] == "full" && len(fields) == 2:
+		c.full[fields[1]] = struct{}{}
+	default:
+		return errors.Errorf("invalid catalog entry %q", line)
+	}
+	return nil
+}
+
+// entries returns the number of lines needed to describe the catalog.
+func (c *Catalog) entries() int {
+	n := len(c.labels) + len(c.packs) + len(c.full)
+	for _, names := range c.pending {
+		n += len(names)
+	}
+	return n
+}
+
+// compact rewrites the catalog file without the entries which have been
+// superseded by later ones. The caller must hold the lock on the catalog
+// file and call refresh afterwards.
+func (c *Catalog) compact() error {
+	debug.Log("compacting catalog %v, %d lines for %d entries", c.filename, c.lines, c.entries())
+
+	tmpname := c.filename + ".tmp"
+	f, err := fs.OpenFile(tmpname, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	wr := bufio.NewWriter(f)
+	for _, label := range sortedKeys(c.labels) {
+		fmt.Fprintf(wr, "label %s\n", label)
+	}
+	for name, pi := range c.packs {
+		fmt.Fprintf(wr, "add %s %s %d\n", pi.label, name, pi.size)
+	}
+	for label, names := range c.pending {
+		for name := range names {
+			fmt.Fprintf(wr, "remove %s %s\n", label, name)
+		}
+	}
+	for _, label := range sortedKeys(c.full) {
+		fmt.Fprintf(wr, "full %s\n", label)
+	}
+
+	err = wr.Flush()
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		_ = fs.Remove(tmpname)
+		return errors.WithStack(err)
+	}
+
+	// Windows cannot replace a file which is still open
+	_ = c.f.Close()
+	c.f = nil
+	return errors.WithStack(fs.Rename(tmpname, c.filename))
+}
+
+// record applies and persists the change described by line. The caller must
+// hold the lock on the catalog file.
+func (c *Catalog) record(format string, args ...interface{}) error {
+	line := fmt.Sprintf(format, args...)
+	if err := c.apply(line); err != nil {
+		return err
+	}
+
+	n, err := c.f.WriteString(line + "\n")
+	c.offset += int64(n)
+	c.lines++
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	return errors.WithStack(c.f.Sync())
+}
+
+// Close closes the catalog file.
+func (c *Catalog) Close() error {
+	c.m.Lock()
+	defer c.m.Unlock()
+	if c.lock == nil {
+		return nil
+	}
+
+	var err error
+	if c.f != nil {
+		err = c.f.Close()
+		c.f = nil
+	}
+	if lerr := c.lock.Close(); err == nil {
+		err = lerr
+	}
+	c.lock = nil
+	return errors.WithStack(err)
+}
+
+func (c *Catalog) addLabel(label string) error {
+	c.m.Lock()
+	defer c.m.Unlock()
+	return c.update(func() error {
+		if _, ok := c.labels[label]; ok {
+			return nil
+		}
+		return c.record("label %s", label)
+	})
+}
+
+func (c *Catalog) hasLabel(label string) bool {
+	c.m.Lock()
+	defer c.m.Unlock()
+	_, ok := c.labels[label]
+	return ok
+}
+
+func (c *Catalog) add(label, name string, size int64) error {
+	c.m.Lock()
+	defer c.m.Unlock()
+	return c.update(func() error {
+		return c.record("add %s %s %d", label, name, size)
+	})
+}
+
+func (c *Catalog) lookup(name string) (packInfo, bool) {
+	c.m.Lock()
+	defer c.m.Unlock()
+	pi, ok := c.packs[name]
+	return pi, ok
+}
+
+func (c *Catalog) remove(name string) (label string, err error) {
+	c.m.Lock()
+	defer c.m.Unlock()
+	err = c.update(func() error {
+		pi, ok := c.packs[name]
+		if !ok {
+			return errors.WithStack(os.ErrNotExist)
+		}
+		label = pi.label
+		return c.record("remove %s %s", pi.label, name)
+	})
+	return label, err
+}
+
+func (c *Catalog) purged(label, name string) error {
+	c.m.Lock()
+	defer c.m.Unlock()
+	return c.update(func() error {
+		return c.record("purged %s %s", label, name)
+	})
+}
+
+func (c *Catalog) pendingFor(label string) []string {
+	c.m.Lock()
+	defer c.m.Unlock()
+	return sortedKeys(c.pending[label])
+}
+
+func (c *Catalog) markFull(label string) error {
+	c.m.Lock()
+	defer c.m.Unlock()
+	return c.update(func() error {
+		if _, ok := c.full[label]; ok {
+			return nil
+		}
+		return c.record("full %s", label)
+	})
+}
+
+func (c *Catalog) isFull(label string) bool {
+	c.m.Lock()
+	defer c.m.Unlock()
+	_, ok := c.full[label]
+	return ok
+}
+
+// each calls fn for all pack files in the catalog.
+func (c *Catalog) each(fn func(name string, size int64) error) error {
+	c.m.Lock()
+	names := make(map[string]int64, len(c.packs))
+	for name, pi := range c.packs {
+		names[name] = pi.size
+	}
+	c.m.Unlock()
+
+	for name, size := range names {
+		if err := fn(name, size); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func sortedKeys(m map[string]struct{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,65 @@
+package media
+
+import (
+	"runtime"
+	"testing"
+
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func TestCatalogConcurrentCompact(t *testing.T) {
+	dir := rtest.TempDir(t)
+
+	c1, err := LoadCatalog(dir)
+	rtest.OK(t, err)
+	defer func() {
+		rtest.OK(t, c1.Close())
+	}()
+
+	// another process fills the catalog with superseded entries
+	c2, err := LoadCatalog(dir)
+	rtest.OK(t, err)
+	for i := 0; i < 600; i++ {
+		rtest.OK(t, c2.add("disk1", "tmp", 1))
+		_, err := c2.remove("tmp")
+		rtest.OK(t, err)
+		rtest.OK(t, c2.purged("disk1", "tmp"))
+	}
+	rtest.OK(t, c2.add("disk1", "pack1", 10))
+	rtest.OK(t, c2.Close())
+
+	// the changes of the other process are visible before writing
+	rtest.OK(t, c1.add("disk2", "pack2", 20))
+	_, ok := c1.lookup("pack1")
+	rtest.Assert(t, ok, "pack1 missing after adding pack2")
+
+	// loading the catalog compacts it while c1 still uses it
+	c3, err := LoadCatalog(dir)
+	rtest.OK(t, err)
+	// Windows cannot replace the catalog while c1 has it open
+	if runtime.GOOS != "windows" {
+		rtest.Assert(t, c3.lines < 100, "catalog was not compacted, %d lines", c3.lines)
+	}
+	rtest.OK(t, c3.Close())
+
+	rtest.OK(t, c1.add("disk2", "pack3", 30))
+
+	c4, err := LoadCatalog(dir)
+	rtest.OK(t, err)
+	defer func() {
+		rtest.OK(t, c4.Close())
+	}()
+
+	for name, want := range map[string]packInfo{
+		"pack1": {label: "disk1", size: 10},
+		"pack2": {label: "disk2", size: 20},
+		"pack3": {label: "disk2", size: 30},
+	} {
+		pi, ok := c4.lookup(name)
+		rtest.Assert(t, ok, "%v missing from catalog", name)
+		rtest.Equals(t, want, pi)
+	}
+	_, ok = c4.lookup("tmp")
+	rtest.Assert(t, !ok, "removed pack file still in catalog")
+	rtest.Equals(t, []string{"disk1", "disk2"}, sortedKeys(c4.labels))
+}
@@ -0,0 +1,46 @@
+package media
+
+import (
+	"strings"
+
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/options"
+)
+
+// Config holds all information needed to open a repository whose pack files
+// are stored on removable disks.
+type Config struct {
+	// Path is the catalog directory, which contains all files except the
+	// pack files.
+	Path  string
+	Mount string `option:"mount" help:"directory at which the removable disks are mounted (required)"`
+	Label string `option:"label" help:"label an unlabeled disk with this name when it is used for the first time"`
+
+	Connections uint `option:"connections" help:"set a limit for the number of concurrent operations (default: 2)"`
+}
+
+// NewConfig returns a new config with default options applied.
+func NewConfig() Config {
+	return Config{
+		Connections: 2,
+	}
+}
+
+func init() {
+	options.Register("media", Config{})
+}
+
+// ParseConfig parses a media backend config. The supported configuration
+// format is media:/path/to/catalog.
+func ParseConfig(s string) (interface{}, error) {
+	if !strings.HasPrefix(s, "media:") {
+		return nil, errors.New(`invalid format, prefix "media" not found`)
+	}
+
+	cfg := NewConfig()
+	cfg.Path = s[6:]
+	if cfg.Path == "" {
+		return nil, errors.New("media: catalog directory not specified")
+	}
+	return cfg, nil
+}
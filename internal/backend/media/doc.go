@@ -0,0 +1,6 @@
+// Package media implements repository storage on removable disks. All files
+// except the pack files are stored in a catalog directory on the local
+// machine, the pack files are stored on whichever labeled disk is currently
+// mounted. A catalog records on which disk each pack file is stored, so that
+// the user can be asked to mount the right disk when a pack file is needed.
+package media
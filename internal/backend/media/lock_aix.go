@@ -0,0 +1,29 @@
+package media
+
+import (
+	"io"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// lockFile waits for an exclusive lock on f. AIX does not support flock,
+// fcntl locks are used instead.
+func lockFile(f *os.File) error {
+	return fcntlLock(f, unix.F_WRLCK)
+}
+
+// unlockFile releases the lock on f.
+func unlockFile(f *os.File) error {
+	return fcntlLock(f, unix.F_UNLCK)
+}
+
+func fcntlLock(f *os.File, typ int16) error {
+	lk := unix.Flock_t{Type: typ, Whence: io.SeekStart}
+	for {
+		err := unix.FcntlFlock(f.Fd(), unix.F_SETLKW, &lk)
+		if err != unix.EINTR {
+			return err
+		}
+	}
+}
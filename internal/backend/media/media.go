@@ -0,0 +1,402 @@
+package media
+
+import (
+	"context"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+
+	"github.com/restic/restic/internal/backend/local"
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/restic"
+
+	"github.com/cenkalti/backoff/v4"
+)
+
+// LabelFilename is the name of the file in the root directory of a disk
+// which contains the label of the disk.
+const LabelFilename = "restic-media-label"
+
+// PromptFunc is called when a different disk must be mounted. It returns
+// once the user has mounted the disk with the given label, or any other disk
+// with free space if label is empty. It returns an error if the user
+// cannot be asked or refuses to change the disk.
+type PromptFunc func(label, mount string) error
+
+// Backend stores pack files on removable disks.
+type Backend struct {
+	*local.Local
+	cfg     Config
+	catalog *Catalog
+	prompt  PromptFunc
+
+	// diskMu protects disk and diskLabel. It is held for reading while the
+	// disk is in use, and for writing while the disk is changed.
+	diskMu    sync.RWMutex
+	disk      *local.Local
+	diskLabel string
+}
+
+// ensure statically that *Backend implements restic.Backend.
+var _ restic.Backend = &Backend{}
+
+func open(ctx context.Context, cfg Config, prompt PromptFunc, create bool) (*Backend, error) {
+	if cfg.Mount == "" {
+		return nil, errors.New("media: the mount point must be specified using -o media.mount=/path")
+	}
+	if cfg.Label != "" && !validLabel(cfg.Label) {
+		return nil, errors.Errorf("media: invalid label %q, it must not be empty or contain whitespace", cfg.Label)
+	}
+
+	localCfg := local.Config{Path: cfg.Path, Connections: cfg.Connections}
+
+	var l *local.Local
+	var err error
+	if create {
+		l, err = local.Create(ctx, localCfg)
+	} else {
+		l, err = local.Open(ctx, localCfg)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	catalog, err := LoadCatalog(cfg.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Backend{
+		Local:   l,
+		cfg:     cfg,
+		catalog: catalog,
+		prompt:  prompt,
+	}, nil
+}
+
+// Open opens the media backend with the catalog directory at cfg.Path.
+// prompt is called whenever a different disk must be mounted.
+func Open(ctx context.Context, cfg Config, prompt PromptFunc) (*Backend, error) {
+	debug.Log("open media backend at %v with disks at %v", cfg.Path, cfg.Mount)
+	return open(ctx, cfg, prompt, false)
+}
+
+// Create creates a new media backend with the catalog directory at cfg.Path.
+// Afterwards a new config blob should be created.
+func Create(ctx context.Context, cfg Config, prompt PromptFunc) (*Backend, error) {
+	debug.Log("create media backend at %v with disks at %v", cfg.Path, cfg.Mount)
+	return open(ctx, cfg, prompt, true)
+}
+
+func validLabel(label string) bool {
+	return label != "" && !strings.ContainsAny(label, " \t\r\n")
+}
+
+// Location returns this backend's location.
+func (b *Backend) Location() string {
+	return b.cfg.Path
+}
+
+// Hasher may return a hash function for calculating a content hash for the backend
+func (b *Backend) Hasher() hash.Hash {
+	return nil
+}
+
+// IsNotExist returns true if the error is caused by a non existing file.
+func (b *Backend) IsNotExist(err error) bool {
+	return errors.Is(err, os.ErrNotExist)
+}
+
+// readLabel returns the label of the disk which is currently mounted. It
+// returns an empty label if the disk has not been labeled yet.
+func (b *Backend) readLabel() (string, error) {
+	buf, err := os.ReadFile(filepath.Join(b.cfg.Mount, LabelFilename))
+	if errors.Is(err, os.ErrNotExist) {
+		return "", nil
+	}
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+
+	label := strings.TrimSpace(string(buf))
+	if !validLabel(label) {
+		return "", errors.Errorf("invalid label %q in %v", label, filepath.Join(b.cfg.Mount, LabelFilename))
+	}
+	return label, nil
+}
+
+// writeLabel labels the disk which is currently mounted.
+func (b *Backend) writeLabel(label string) error {
+	if b.catalog.hasLabel(label) {
+		return errors.Errorf("media: a disk labeled %q is already known, refusing to label another disk with the same name", label)
+	}
+
+	debug.Log("labeling disk at %v as %v", b.cfg.Mount, label)
+	err := os.WriteFile(filepath.Join(b.cfg.Mount, LabelFilename), []byte(label+"\n"), 0644)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	return b.catalog.addLabel(label)
+}
+
+// acceptable returns true if the disk with the given label can be used for
+// an operation which requires the disk want. An empty want means any disk
+// which has not run out of space.
+func (b *Backend) acceptable(label, want string) bool {
+	if want == "" {
+		return label != "" && !b.catalog.isFull(label)
+	}
+	return label == want
+}
+
+// mountDisk makes sure that the disk want is used, prompting the user to
+// change the disk if necessary. The caller must hold diskMu for writing.
+func (b *Backend) mountDisk(ctx context.Context, want string) error {
+	for {
+		if b.disk != nil && b.acceptable(b.diskLabel, want) {
+			return nil
+		}
+
+		b.disk = nil
+		b.diskLabel = ""
+
+		label, err := b.readLabel()
+		if err != nil {
+			return err
+		}
+
+		if label == "" && want == "" {
+			if _, err := os.Stat(b.cfg.Mount); err == nil {
+				if b.cfg.Label == "" {
+					return errors.Errorf("media: the disk at %v is not labeled, specify a label using -o media.label=name", b.cfg.Mount)
+				}
+				err = b.writeLabel(b.cfg.Label)
+				if err != nil {
+					return err
+				}
+				label = b.cfg.Label
+			}
+		}
+
+		if label != "" && b.acceptable(label, want) {
+			return b.useDisk(ctx, label)
+		}
+
+		if b.prompt == nil {
+			return errors.Errorf("media: disk %q is not mounted at %v", want, b.cfg.Mount)
+		}
+
+		err = b.prompt(want, b.cfg.Mount)
+		if err != nil {
+			return err
+		}
+
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+	}
+}
+
+// useDisk opens the disk which is mounted and has the given label, then
+// deletes all pack files which were removed from the repository while the
+// disk was not mounted.
+func (b *Backend) useDisk(ctx context.Context, label string) error {
+	debug.Log("using disk %v at %v", label, b.cfg.Mount)
+	if err := b.catalog.addLabel(label); err != nil {
+		return err
+	}
+
+	disk, err := local.Open(ctx, local.Config{Path: b.cfg.Mount, Connections: b.cfg.Connections})
+	if err != nil {
+		return err
+	}
+
+	for _, name := range b.catalog.pendingFor(label) {
+		err := disk.Remove(ctx, restic.Handle{Type: restic.PackFile, Name: name})
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		if err := b.catalog.purged(label, name); err != nil {
+			return err
+		}
+	}
+
+	b.disk = disk
+	b.diskLabel = label
+	return nil
+}
+
+// withDisk runs fn with the disk want, see acceptable.
+func (b *Backend) withDisk(ctx context.Context, want string, fn func(disk *local.Local, label string) error) error {
+	for {
+		b.diskMu.RLock()
+		if b.disk != nil && b.acceptable(b.diskLabel, want) {
+			err := fn(b.disk, b.diskLabel)
+			b.diskMu.RUnlock()
+			return err
+		}
+		b.diskMu.RUnlock()
+
+		b.diskMu.Lock()
+		err := b.mountDisk(ctx, want)
+		b.diskMu.Unlock()
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// Save stores data in the backend at the handle. Pack files are stored on
+// the disk which is currently mounted. If that disk runs out of space, the
+// user is asked to mount a different disk.
+func (b *Backend) Save(ctx context.Context, h restic.Handle, rd restic.RewindReader) error {
+	if h.Type != restic.PackFile {
+		return b.Local.Save(ctx, h, rd)
+	}
+	if err := h.Valid(); err != nil {
+		return backoff.Permanent(err)
+	}
+
+	for {
+		var full bool
+		err := b.withDisk(ctx, "", func(disk *local.Local, label string) error {
+			err := disk.Save(ctx, h, rd)
+			if errors.Is(err, syscall.ENOSPC) {
+				debug.Log("disk %v is full", label)
+				full = true
+				return b.catalog.markFull(label)
+			}
+			if err != nil {
+				return err
+			}
+			return b.catalog.add(label, h.Name, rd.Length())
+		})
+		if err != nil || !full {
+			return err
+		}
+
+		if err := rd.Rewind(); err != nil {
+			return err
+		}
+	}
+}
+
+// Load runs fn with a reader that yields the contents of the file at h at the
+// given offset.
+func (b *Backend) Load(ctx context.Context, h restic.Handle, length int, offset int64, fn func(rd io.Reader) error) error {
+	if h.Type != restic.PackFile {
+		return b.Local.Load(ctx, h, length, offset, fn)
+	}
+
+	pi, ok := b.catalog.lookup(h.Name)
+	if !ok {
+		return errors.Wrapf(os.ErrNotExist, "pack %v not found in media catalog", h.Name)
+	}
+
+	return b.withDisk(ctx, pi.label, func(disk *local.Local, _ string) error {
+		return disk.Load(ctx, h, length, offset, fn)
+	})
+}
+
+// Stat returns information about a file in the backend. For pack files, the
+// information is taken from the catalog.
+func (b *Backend) Stat(ctx context.Context, h restic.Handle) (restic.FileInfo, error) {
+	if h.Type != restic.PackFile {
+		return b.Local.Stat(ctx, h)
+	}
+
+	pi, ok := b.catalog.lookup(h.Name)
+	if !ok {
+		return restic.FileInfo{}, errors.Wrapf(os.ErrNotExist, "pack %v not found in media catalog", h.Name)
+	}
+	return restic.FileInfo{Name: h.Name, Size: pi.size}, nil
+}
+
+// Remove removes the file with the given name and type. Pack files stored on
+// a disk which is not mounted are removed from the catalog immediately and
+// deleted once the disk is mounted the next time.
+func (b *Backend) Remove(ctx context.Context, h restic.Handle) error {
+	if h.Type != restic.PackFile {
+		return b.Local.Remove(ctx, h)
+	}
+
+	label, err := b.catalog.remove(h.Name)
+	if err != nil {
+		return err
+	}
+
+	b.diskMu.RLock()
+	defer b.diskMu.RUnlock()
+	if b.disk == nil || b.diskLabel != label {
+		debug.Log("deferring removal of %v until disk %v is mounted", h.Name, label)
+		return nil
+	}
+
+	err = b.disk.Remove(ctx, h)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return b.catalog.purged(label, h.Name)
+}
+
+// List runs fn for each file in the backend which has the type t. Pack files
+// are listed from the catalog, no disk needs to be mounted.
+func (b *Backend) List(ctx context.Context, t restic.FileType, fn func(restic.FileInfo) error) error {
+	if t != restic.PackFile {
+		return b.Local.List(ctx, t, fn)
+	}
+
+	err := b.catalog.each(func(name string, size int64) error {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return fn(restic.FileInfo{Name: name, Size: size})
+	})
+	if err != nil {
+		return err
+	}
+	return ctx.Err()
+}
+
+// Delete removes the catalog directory. The pack files on the disks are not
+// deleted.
+func (b *Backend) Delete(ctx context.Context) error {
+	if err := b.catalog.Close(); err != nil {
+		return err
+	}
+	return b.Local.Delete(ctx)
+}
+
+// Close closes the catalog.
+func (b *Backend) Close() error {
+	err := b.catalog.Close()
+	if lerr := b.Local.Close(); err == nil {
+		err = lerr
+	}
+	return err
+}
+
+// PackLabels returns the label of the disk on which each pack file in the
+// catalog at dir is stored, indexed by the name of the pack file.
+func PackLabels(dir string) (map[string]string, error) {
+	c, err := LoadCatalog(dir)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = c.Close()
+	}()
+
+	c.m.Lock()
+	defer c.m.Unlock()
+	labels := make(map[string]string, len(c.packs))
+	for name, pi := range c.packs {
+		labels[name] = pi.label
+	}
+	return labels, nil
+}
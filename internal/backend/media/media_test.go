@@ -0,0 +1,164 @@
+package media_test
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/restic/restic/internal/backend/media"
+	"github.com/restic/restic/internal/backend/test"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/restic"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func newTestSuite(t testing.TB) *test.Suite {
+	return &test.Suite{
+		// NewConfig returns a config for a new temporary backend that will be used in tests.
+		NewConfig: func() (interface{}, error) {
+			dir, err := os.MkdirTemp(rtest.TestTempDir, "restic-test-media-")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			t.Logf("create new backend at %v", dir)
+
+			cfg := media.NewConfig()
+			cfg.Path = filepath.Join(dir, "catalog")
+			cfg.Mount = filepath.Join(dir, "disk")
+			cfg.Label = "disk1"
+			if err := os.Mkdir(cfg.Mount, 0700); err != nil {
+				t.Fatal(err)
+			}
+			return cfg, nil
+		},
+
+		// CreateFn is a function that creates a temporary repository for the tests.
+		Create: func(config interface{}) (restic.Backend, error) {
+			cfg := config.(media.Config)
+			return media.Create(context.TODO(), cfg, nil)
+		},
+
+		// OpenFn is a function that opens a previously created temporary repository.
+		Open: func(config interface{}) (restic.Backend, error) {
+			cfg := config.(media.Config)
+			return media.Open(context.TODO(), cfg, nil)
+		},
+
+		// CleanupFn removes data created during the tests.
+		Cleanup: func(config interface{}) error {
+			cfg := config.(media.Config)
+			if !rtest.TestCleanupTempDirs {
+				t.Logf("leaving test backend dir at %v", cfg.Path)
+			}
+
+			rtest.RemoveAll(t, filepath.Dir(cfg.Path))
+			return nil
+		},
+	}
+}
+
+func TestBackend(t *testing.T) {
+	newTestSuite(t).RunTests(t)
+}
+
+func BenchmarkBackend(t *testing.B) {
+	newTestSuite(t).RunBenchmarks(t)
+}
+
+func TestDiskRotation(t *testing.T) {
+	ctx := context.TODO()
+	dir := rtest.TempDir(t)
+
+	disks := []string{filepath.Join(dir, "disk1"), filepath.Join(dir, "disk2")}
+	for _, d := range disks {
+		rtest.OK(t, os.Mkdir(d, 0700))
+	}
+	mount := filepath.Join(dir, "mnt")
+	if err := os.Symlink(disks[0], mount); err != nil {
+		t.Skipf("unable to create symlink: %v", err)
+	}
+
+	cfg := media.NewConfig()
+	cfg.Path = filepath.Join(dir, "catalog")
+	cfg.Mount = mount
+	cfg.Label = "first"
+
+	be, err := media.Create(ctx, cfg, nil)
+	rtest.OK(t, err)
+
+	data := []byte("pack file on the first disk")
+	h := restic.Handle{Type: restic.PackFile, Name: restic.Hash(data).String()}
+	rtest.OK(t, be.Save(ctx, h, restic.NewByteReader(data, nil)))
+	rtest.OK(t, be.Close())
+
+	// switch to the second disk, which must be labeled separately
+	rtest.OK(t, os.Remove(mount))
+	rtest.OK(t, os.Symlink(disks[1], mount))
+	cfg.Label = "second"
+
+	var prompts []string
+	prompt := func(label, _ string) error {
+		prompts = append(prompts, label)
+		rtest.OK(t, os.Remove(mount))
+		rtest.OK(t, os.Symlink(disks[0], mount))
+		return nil
+	}
+
+	be, err = media.Open(ctx, cfg, prompt)
+	rtest.OK(t, err)
+
+	data2 := []byte("pack file on the second disk")
+	h2 := restic.Handle{Type: restic.PackFile, Name: restic.Hash(data2).String()}
+	rtest.OK(t, be.Save(ctx, h2, restic.NewByteReader(data2, nil)))
+
+	label, err := os.ReadFile(filepath.Join(mount, media.LabelFilename))
+	rtest.OK(t, err)
+	rtest.Equals(t, "second\n", string(label))
+
+	buf, err := backendLoad(ctx, be, h)
+	rtest.OK(t, err)
+	rtest.Equals(t, data, buf)
+	rtest.Equals(t, []string{"first"}, prompts)
+
+	// the second disk is not mounted, the pack file is deleted later
+	rtest.OK(t, be.Remove(ctx, h2))
+	_, err = be.Stat(ctx, h2)
+	rtest.Assert(t, be.IsNotExist(err), "unexpected error for removed pack file: %v", err)
+	rtest.OK(t, be.Close())
+
+	packOnDisk2 := filepath.Join(disks[1], "data", h2.Name[:2], h2.Name)
+	_, err = os.Stat(packOnDisk2)
+	rtest.OK(t, err)
+
+	labels, err := media.PackLabels(cfg.Path)
+	rtest.OK(t, err)
+	rtest.Equals(t, map[string]string{h.Name: "first"}, labels)
+
+	// mounting the second disk again deletes the pack file
+	rtest.OK(t, os.Remove(mount))
+	rtest.OK(t, os.Symlink(disks[1], mount))
+	cfg.Label = ""
+
+	be, err = media.Open(ctx, cfg, nil)
+	rtest.OK(t, err)
+	data3 := []byte("another pack file")
+	h3 := restic.Handle{Type: restic.PackFile, Name: restic.Hash(data3).String()}
+	rtest.OK(t, be.Save(ctx, h3, restic.NewByteReader(data3, nil)))
+	rtest.OK(t, be.Close())
+
+	_, err = os.Stat(packOnDisk2)
+	rtest.Assert(t, errors.Is(err, os.ErrNotExist), "pack file was not deleted: %v", err)
+}
+
+func backendLoad(ctx context.Context, be restic.Backend, h restic.Handle) ([]byte, error) {
+	var buf []byte
+	err := be.Load(ctx, h, 0, 0, func(rd io.Reader) error {
+		var err error
+		buf, err = io.ReadAll(rd)
+		return err
+	})
+	return buf, err
+}
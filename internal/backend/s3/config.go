@@ -4,6 +4,7 @@ import (
 	"net/url"
 	"path"
 	"strings"
+	"time"
 
 	"github.com/restic/restic/internal/errors"
 	"github.com/restic/restic/internal/options"
@@ -26,6 +27,13 @@ type Config struct {
 	Region        string `option:"region" help:"set region"`
 	BucketLookup  string `option:"bucket-lookup" help:"bucket lookup style: 'auto', 'dns', or 'path'"`
 	ListObjectsV1 bool   `option:"list-objects-v1" help:"use deprecated V1 api for ListObjects calls"`
+
+	PartSize        uint   `option:"part-size" help:"upload files larger than this size in MiB in multiple parts of this size (default: 200)"`
+	PartConcurrency uint   `option:"part-concurrency" help:"set the number of parts of a file which are uploaded concurrently, requires checksum crc32c (default: 4)"`
+	Checksum        string `option:"checksum" help:"checksum verified by the server for uploads: md5, crc32c or sha256, with sha256 files are uploaded in a single part (default: md5)"`
+
+	Inventory       string        `option:"inventory" help:"list pack files using the S3 Inventory report with the manifest at bucket/path/manifest.json"`
+	InventoryMaxAge time.Duration `option:"inventory-max-age" help:"refuse to use inventory reports older than this (default: 48h)"`
 }
 
 // NewConfig returns a new Config with the default values filled in.
@@ -2,8 +2,10 @@ package s3
 
 import (
 	"context"
+	"encoding/base64"
 	"fmt"
 	"hash"
+	"hash/crc32"
 	"io"
 	"net/http"
 	"os"
@@ -12,6 +14,7 @@ import (
 	"time"
 
 	"github.com/restic/restic/internal/backend"
+	"github.com/restic/restic/internal/backend/inventory"
 	"github.com/restic/restic/internal/backend/layout"
 	"github.com/restic/restic/internal/backend/sema"
 	"github.com/restic/restic/internal/debug"
@@ -21,6 +24,7 @@ import (
 	"github.com/cenkalti/backoff/v4"
 	"github.com/minio/minio-go/v7"
 	"github.com/minio/minio-go/v7/pkg/credentials"
+	"github.com/minio/sha256-simd"
 )
 
 // Backend stores data on an S3 endpoint.
@@ -39,6 +43,10 @@ const defaultLayout = "default"
 func open(ctx context.Context, cfg Config, rt http.RoundTripper) (*Backend, error) {
 	debug.Log("open, config %#v", cfg)
 
+	if err := validateUploadOptions(cfg); err != nil {
+		return nil, err
+	}
+
 	if cfg.MaxRetries > 0 {
 		minio.MaxRetry = int(cfg.MaxRetries)
 	}
@@ -84,6 +92,9 @@ func open(ctx context.Context, cfg Config, rt http.RoundTripper) (*Backend, erro
 		Secure:    !cfg.UseHTTP,
 		Region:    cfg.Region,
 		Transport: rt,
+		// checksums for the parts of concurrent multipart uploads are sent
+		// as trailing headers
+		TrailingHeaders: cfg.Checksum == checksumCRC32C,
 	}
 
 	switch strings.ToLower(cfg.BucketLookup) {
@@ -286,13 +297,45 @@ func (be *Backend) Save(ctx context.Context, h restic.Handle, rd restic.RewindRe
 
 	opts := minio.PutObjectOptions{StorageClass: be.cfg.StorageClass}
 	opts.ContentType = "application/octet-stream"
-	// the only option with the high-level api is to let the library handle the checksum computation
-	opts.SendContentMd5 = true
 	// only use multipart uploads for very large files
-	opts.PartSize = 200 * 1024 * 1024
+	opts.PartSize = uint64(defaultPartSize) * 1024 * 1024
+	if be.cfg.PartSize != 0 {
+		opts.PartSize = uint64(be.cfg.PartSize) * 1024 * 1024
+	}
+	opts.NumThreads = be.cfg.PartConcurrency
+	multipart := rd.Length() >= int64(opts.PartSize)
+	if be.cfg.Checksum == checksumSHA256 {
+		// the library only sends CRC32C checksums for the parts of
+		// multipart uploads, upload the file in one piece instead
+		opts.DisableMultipart = true
+		multipart = false
+	}
+
+	var rdr io.Reader = io.NopCloser(rd)
+	switch be.cfg.Checksum {
+	case "", checksumMD5:
+		// the only option with the high-level api is to let the library
+		// handle the checksum computation, multipart uploads are then
+		// uploaded one part after the other
+		opts.SendContentMd5 = true
+	default:
+		if !multipart {
+			header, sum, err := uploadChecksum(be.cfg.Checksum, rd)
+			if err != nil {
+				return err
+			}
+			opts.UserMetadata = map[string]string{header: sum}
+		} else if ra, ok := readerAt(rd); ok {
+			// the library uploads parts concurrently and sends a CRC32C
+			// checksum for each of them if it can read at arbitrary offsets,
+			// otherwise it uploads one part after the other and sends the
+			// checksum of each part in a header
+			rdr = io.NewSectionReader(ra, 0, rd.Length())
+		}
+	}
 
 	debug.Log("PutObject(%v, %v, %v)", be.cfg.Bucket, objName, rd.Length())
-	info, err := be.client.PutObject(ctx, be.cfg.Bucket, objName, io.NopCloser(rd), int64(rd.Length()), opts)
+	info, err := be.client.PutObject(ctx, be.cfg.Bucket, objName, rdr, int64(rd.Length()), opts)
 
 	debug.Log("%v -> %v bytes, err %#v: %v", objName, info.Size, err, err)
 
@@ -304,6 +347,70 @@ func (be *Backend) Save(ctx context.Context, h restic.Handle, rd restic.RewindRe
 	return errors.Wrap(err, "client.PutObject")
 }
 
+const (
+	checksumMD5    = "md5"
+	checksumCRC32C = "crc32c"
+	checksumSHA256 = "sha256"
+
+	// defaultPartSize and minPartSize are in MiB
+	defaultPartSize = 200
+	minPartSize     = 5
+)
+
+// validateUploadOptions checks the options for uploading files.
+func validateUploadOptions(cfg Config) error {
+	switch cfg.Checksum {
+	case "", checksumMD5, checksumCRC32C, checksumSHA256:
+	default:
+		return errors.Fatalf("s3: invalid checksum %q, must be one of md5, crc32c or sha256", cfg.Checksum)
+	}
+	if cfg.PartSize != 0 && cfg.PartSize < minPartSize {
+		return errors.Fatalf("s3: part size %v MiB is too small, the minimum is %v MiB", cfg.PartSize, minPartSize)
+	}
+	if cfg.PartConcurrency != 0 && cfg.Checksum != checksumCRC32C {
+		return errors.Fatal("s3: part-concurrency requires checksum crc32c")
+	}
+	if cfg.PartSize != 0 && cfg.Checksum == checksumSHA256 {
+		return errors.Fatal("s3: part-size cannot be used with checksum sha256, files are uploaded in a single part")
+	}
+	return nil
+}
+
+// uploadChecksum computes the checksum of the data in rd and returns the
+// header which passes it to the server. rd is rewound afterwards.
+func uploadChecksum(algorithm string, rd restic.RewindReader) (header, sum string, err error) {
+	var h hash.Hash
+	switch algorithm {
+	case checksumCRC32C:
+		h = crc32.New(crc32.MakeTable(crc32.Castagnoli))
+	case checksumSHA256:
+		h = sha256.New()
+	default:
+		return "", "", errors.Errorf("unknown checksum %q", algorithm)
+	}
+
+	if _, err := io.Copy(h, rd); err != nil {
+		return "", "", errors.Wrap(err, "Copy")
+	}
+	if err := rd.Rewind(); err != nil {
+		return "", "", err
+	}
+
+	return "x-amz-checksum-" + algorithm, base64.StdEncoding.EncodeToString(h.Sum(nil)), nil
+}
+
+// readerAt returns the io.ReaderAt underlying rd, if there is one.
+func readerAt(rd restic.RewindReader) (io.ReaderAt, bool) {
+	switch r := rd.(type) {
+	case *restic.ByteReader:
+		return r.Reader, true
+	case *restic.FileReader:
+		ra, ok := r.ReadSeeker.(io.ReaderAt)
+		return ra, ok
+	}
+	return nil, false
+}
+
 // Load runs fn with a reader that yields the contents of the file at h at the
 // given offset.
 func (be *Backend) Load(ctx context.Context, h restic.Handle, length int, offset int64, fn func(rd io.Reader) error) error {
@@ -418,6 +525,10 @@ func (be *Backend) List(ctx context.Context, t restic.FileType, fn func(restic.F
 		prefix += "/"
 	}
 
+	if t == restic.PackFile && be.cfg.Inventory != "" && inventory.Allowed(ctx) {
+		return be.listInventory(ctx, prefix, fn)
+	}
+
 	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
 
@@ -464,6 +575,48 @@ func (be *Backend) List(ctx context.Context, t restic.FileType, fn func(restic.F
 	return ctx.Err()
 }
 
+// listInventory lists the pack files below prefix using the configured
+// inventory report instead of listing the bucket.
+func (be *Backend) listInventory(ctx context.Context, prefix string, fn func(restic.FileInfo) error) error {
+	bucket, key, err := inventory.ParseLocation(be.cfg.Inventory)
+	if err != nil {
+		return err
+	}
+
+	maxAge := be.cfg.InventoryMaxAge
+	if maxAge == 0 {
+		maxAge = inventory.DefaultMaxAge
+	}
+
+	m, err := inventory.Load(ctx, be.openInventory, bucket, key, be.cfg.Bucket, maxAge)
+	if err != nil {
+		return errors.Wrap(err, "inventory")
+	}
+
+	inventory.MarkUsed(ctx)
+	return m.List(ctx, be.openInventory, be.cfg.Bucket, prefix, func(e inventory.Entry) error {
+		return fn(restic.FileInfo{
+			Name: path.Base(e.Key),
+			Size: e.Size,
+		})
+	})
+}
+
+func (be *Backend) openInventory(ctx context.Context, bucket, key string) (io.ReadCloser, error) {
+	be.sem.GetToken()
+	ctx, cancel := context.WithCancel(ctx)
+
+	coreClient := minio.Core{Client: be.client}
+	rd, _, _, err := coreClient.GetObject(ctx, bucket, key, minio.GetObjectOptions{})
+	if err != nil {
+		cancel()
+		be.sem.ReleaseToken()
+		return nil, err
+	}
+
+	return be.sem.ReleaseTokenOnClose(rd, cancel), nil
+}
+
 // Remove keys for a specified backend type.
 func (be *Backend) removeKeys(ctx context.Context, t restic.FileType) error {
 	return be.List(ctx, restic.PackFile, func(fi restic.FileInfo) error {
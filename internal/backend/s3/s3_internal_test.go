@@ -0,0 +1,73 @@
+package s3
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/restic/restic/internal/restic"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func TestUploadChecksum(t *testing.T) {
+	for _, test := range []struct {
+		algorithm, header, sum string
+	}{
+		// checksums of "restic" computed with other tools
+		{checksumCRC32C, "x-amz-checksum-crc32c", "cNNgng=="},
+		{checksumSHA256, "x-amz-checksum-sha256", "av/oeBTv3X94/HfoWjMFuc1vTe34xQouoOcgaE0lok4="},
+	} {
+		t.Run(test.algorithm, func(t *testing.T) {
+			rd := restic.NewByteReader([]byte("restic"), nil)
+			header, sum, err := uploadChecksum(test.algorithm, rd)
+			rtest.OK(t, err)
+			rtest.Equals(t, test.header, header)
+			rtest.Equals(t, test.sum, sum)
+
+			// the reader must have been rewound
+			buf, err := io.ReadAll(rd)
+			rtest.OK(t, err)
+			rtest.Equals(t, []byte("restic"), buf)
+		})
+	}
+
+	_, _, err := uploadChecksum("md4", restic.NewByteReader(nil, nil))
+	rtest.Assert(t, err != nil, "expected error for unknown checksum")
+}
+
+func TestReaderAt(t *testing.T) {
+	ra, ok := readerAt(restic.NewByteReader([]byte("foobar"), nil))
+	rtest.Assert(t, ok, "ByteReader has no ReaderAt")
+	buf := make([]byte, 3)
+	_, err := ra.ReadAt(buf, 3)
+	rtest.OK(t, err)
+	rtest.Equals(t, []byte("bar"), buf)
+
+	fr := &restic.FileReader{ReadSeeker: bytes.NewReader([]byte("foobar")), Len: 6}
+	_, ok = readerAt(fr)
+	rtest.Assert(t, ok, "FileReader with ReaderAt not detected")
+
+	fr = &restic.FileReader{ReadSeeker: io.NewSectionReader(nil, 0, 0), Len: 0}
+	_, ok = readerAt(fr)
+	rtest.Assert(t, ok, "FileReader with ReaderAt not detected")
+}
+
+func TestValidateUploadOptions(t *testing.T) {
+	for _, test := range []struct {
+		cfg Config
+		ok  bool
+	}{
+		{Config{}, true},
+		{Config{Checksum: checksumCRC32C, PartSize: 64, PartConcurrency: 8}, true},
+		{Config{Checksum: checksumSHA256}, true},
+		{Config{Checksum: "md4"}, false},
+		{Config{PartSize: 1}, false},
+		{Config{PartConcurrency: 8}, false},
+		{Config{Checksum: checksumMD5, PartConcurrency: 8}, false},
+		{Config{Checksum: checksumSHA256, PartConcurrency: 8}, false},
+		{Config{Checksum: checksumSHA256, PartSize: 64}, false},
+	} {
+		err := validateUploadOptions(test.cfg)
+		rtest.Assert(t, (err == nil) == test.ok, "unexpected result %v for %#v", err, test.cfg)
+	}
+}
@@ -248,3 +248,8 @@ func (c *Cache) Wrap(be restic.Backend) restic.Backend {
 func (c *Cache) BaseDir() string {
 	return c.Base
 }
+
+// Path returns the cache directory of the repository.
+func (c *Cache) Path() string {
+	return c.path
+}
@@ -12,6 +12,7 @@ import (
 
 	"github.com/minio/sha256-simd"
 	"github.com/restic/restic/internal/backend"
+	"github.com/restic/restic/internal/backend/inventory"
 	"github.com/restic/restic/internal/backend/s3"
 	"github.com/restic/restic/internal/cache"
 	"github.com/restic/restic/internal/debug"
@@ -41,6 +42,9 @@ type Checker struct {
 	masterIndex *index.MasterIndex
 	snapshots   restic.Lister
 
+	// packChecked is called for each pack which was checked without errors
+	packChecked func(id restic.ID)
+
 	repo restic.Repository
 }
 
@@ -235,7 +239,10 @@ func (c *Checker) Packs(ctx context.Context, errChan chan<- error) {
 	debug.Log("listing repository packs")
 	repoPacks := make(map[restic.ID]int64)
 
-	err := c.repo.List(ctx, restic.PackFile, func(id restic.ID, size int64) error {
+	// an inventory report may be outdated, the packs it reports as missing
+	// or orphaned are checked against the backend below
+	listCtx := inventory.Allow(ctx)
+	err := c.repo.List(listCtx, restic.PackFile, func(id restic.ID, size int64) error {
 		repoPacks[id] = size
 		return nil
 	})
@@ -244,11 +251,22 @@ func (c *Checker) Packs(ctx context.Context, errChan chan<- error) {
 		errChan <- err
 	}
 
+	// packs may have been deleted after the inventory report was generated,
+	// so the referenced packs it lists must be checked against the backend
+	var gone restic.IDSet
+	if err == nil && inventory.Used(listCtx) {
+		gone = c.statListedPacks(ctx, repoPacks)
+	}
+
 	for id, size := range c.packs {
 		reposize, ok := repoPacks[id]
 		// remove from repoPacks so we can find orphaned packs
 		delete(repoPacks, id)
 
+		if !ok && !gone.Has(id) {
+			reposize, ok = c.statPack(ctx, id)
+		}
+
 		// missing: present in c.packs but not in the repo
 		if !ok {
 			select {
@@ -271,6 +289,9 @@ func (c *Checker) Packs(ctx context.Context, errChan chan<- error) {
 
 	// orphaned: present in the repo but not in c.packs
 	for orphanID := range repoPacks {
+		if _, ok := c.statPack(ctx, orphanID); !ok {
+			continue
+		}
 		select {
 		case <-ctx.Done():
 			return
@@ -279,6 +300,69 @@ func (c *Checker) Packs(ctx context.Context, errChan chan<- error) {
 	}
 }
 
+// statListedPacks checks the packs referenced by the index which are listed
+// in repoPacks against the backend. It updates their size in repoPacks and
+// removes the packs which no longer exist, the latter are returned.
+func (c *Checker) statListedPacks(ctx context.Context, repoPacks map[restic.ID]int64) restic.IDSet {
+	debug.Log("checking listed packs against the backend")
+
+	var ids restic.IDs
+	for id := range c.packs {
+		if _, ok := repoPacks[id]; ok {
+			ids = append(ids, id)
+		}
+	}
+
+	var mu sync.Mutex
+	gone := restic.NewIDSet()
+	ch := make(chan restic.ID)
+
+	wg, wgCtx := errgroup.WithContext(ctx)
+	wg.Go(func() error {
+		defer close(ch)
+		for _, id := range ids {
+			select {
+			case <-wgCtx.Done():
+				return nil
+			case ch <- id:
+			}
+		}
+		return nil
+	})
+
+	for i := 0; i < int(c.repo.Connections()); i++ {
+		wg.Go(func() error {
+			for id := range ch {
+				size, ok := c.statPack(wgCtx, id)
+
+				mu.Lock()
+				if ok {
+					repoPacks[id] = size
+				} else {
+					delete(repoPacks, id)
+					gone.Insert(id)
+				}
+				mu.Unlock()
+			}
+			return nil
+		})
+	}
+	_ = wg.Wait()
+
+	return gone
+}
+
+// statPack returns the size of the pack file id as reported by the backend,
+// ok is false if the file does not exist or cannot be accessed.
+func (c *Checker) statPack(ctx context.Context, id restic.ID) (size int64, ok bool) {
+	fi, err := c.repo.Backend().Stat(ctx, restic.Handle{Type: restic.PackFile, Name: id.String()})
+	if err != nil {
+		debug.Log("stat pack %v: %v", id, err)
+		return 0, false
+	}
+	return fi.Size, true
+}
+
 // Error is an error that occurred while checking a repository.
 type Error struct {
 	TreeID restic.ID
@@ -500,26 +584,7 @@ func checkPack(ctx context.Context, r restic.Repository, id restic.ID, blobs []r
 		return errors.Errorf("pack %v is empty or not indexed", id)
 	}
 
-	// sanity check blobs in index
-	sort.Slice(blobs, func(i, j int) bool {
-		return blobs[i].Offset < blobs[j].Offset
-	})
-	idxHdrSize := pack.CalculateHeaderSize(blobs)
-	lastBlobEnd := 0
-	nonContinuousPack := false
-	for _, blob := range blobs {
-		if lastBlobEnd != int(blob.Offset) {
-			nonContinuousPack = true
-		}
-		lastBlobEnd = int(blob.Offset + blob.Length)
-	}
-	// size was calculated by masterindex.PackSize, thus there's no need to recalculate it here
-
-	var errs []error
-	if nonContinuousPack {
-		debug.Log("Index for pack contains gaps / overlaps, blobs: %v", blobs)
-		errs = append(errs, errors.New("Index for pack contains gaps / overlapping blobs"))
-	}
+	errs := checkIndexedBlobs(blobs)
 
 	// calculate hash on-the-fly while reading the pack and capture pack header
 	var hash restic.ID
@@ -579,18 +644,81 @@ func checkPack(ctx context.Context, r restic.Repository, id restic.ID, blobs []r
 		return errors.Errorf("Pack ID does not match, want %v, got %v", id, hash)
 	}
 
-	blobs, hdrSize, err := pack.List(r.Key(), bytes.NewReader(hdrBuf), int64(len(hdrBuf)))
+	hdrBlobs, hdrSize, err := pack.List(r.Key(), bytes.NewReader(hdrBuf), int64(len(hdrBuf)))
 	if err != nil {
 		return err
 	}
 
+	errs = append(errs, checkHeaderBlobs(r.Index(), id, blobs, hdrBlobs, hdrSize)...)
+	if len(errs) > 0 {
+		return errors.Errorf("pack %v contains %v errors: %v", id, len(errs), errs)
+	}
+
+	return nil
+}
+
+// checkPackHeader loads only the header of the pack id and compares it to
+// the blobs listed in the index. The blob data is neither downloaded nor
+// verified.
+func checkPackHeader(ctx context.Context, r restic.Repository, id restic.ID, blobs []restic.Blob, size int64) error {
+	debug.Log("checking header of pack %v", id.String())
+
+	if len(blobs) == 0 {
+		return errors.Errorf("pack %v is empty or not indexed", id)
+	}
+
+	errs := checkIndexedBlobs(blobs)
+
+	hdrBlobs, hdrSize, err := r.ListPack(ctx, id, size)
+	if err != nil {
+		debug.Log("  error loading pack header: %v", err)
+		return errors.Errorf("pack %v: unable to load header: %v", id, err)
+	}
+
+	errs = append(errs, checkHeaderBlobs(r.Index(), id, blobs, hdrBlobs, hdrSize)...)
+	if len(errs) > 0 {
+		return errors.Errorf("pack %v contains %v errors: %v", id, len(errs), errs)
+	}
+
+	return nil
+}
+
+// checkIndexedBlobs sorts the blobs of a pack listed in the index by offset
+// and checks that the blobs are stored contiguously.
+func checkIndexedBlobs(blobs []restic.Blob) []error {
+	sort.Slice(blobs, func(i, j int) bool {
+		return blobs[i].Offset < blobs[j].Offset
+	})
+	lastBlobEnd := 0
+	nonContinuousPack := false
+	for _, blob := range blobs {
+		if lastBlobEnd != int(blob.Offset) {
+			nonContinuousPack = true
+		}
+		lastBlobEnd = int(blob.Offset + blob.Length)
+	}
+	// size was calculated by masterindex.PackSize, thus there's no need to recalculate it here
+
+	if nonContinuousPack {
+		debug.Log("Index for pack contains gaps / overlaps, blobs: %v", blobs)
+		return []error{errors.New("Index for pack contains gaps / overlapping blobs")}
+	}
+	return nil
+}
+
+// checkHeaderBlobs compares the blobs listed in the header of pack id with
+// the blobs listed in the index for that pack.
+func checkHeaderBlobs(idx restic.MasterIndex, id restic.ID, indexBlobs, hdrBlobs []restic.Blob, hdrSize uint32) (errs []error) {
+	idxHdrSize := pack.CalculateHeaderSize(indexBlobs)
 	if uint32(idxHdrSize) != hdrSize {
 		debug.Log("Pack header size does not match, want %v, got %v", idxHdrSize, hdrSize)
 		errs = append(errs, errors.Errorf("Pack header size does not match, want %v, got %v", idxHdrSize, hdrSize))
 	}
 
-	idx := r.Index()
-	for _, blob := range blobs {
+	inHeader := make(map[restic.Blob]struct{}, len(hdrBlobs))
+	for _, blob := range hdrBlobs {
+		inHeader[blob] = struct{}{}
+
 		// Check if blob is contained in index and position is correct
 		idxHas := false
 		for _, pb := range idx.Lookup(blob.BlobHandle) {
@@ -605,11 +733,13 @@ func checkPack(ctx context.Context, r restic.Repository, id restic.ID, blobs []r
 		}
 	}
 
-	if len(errs) > 0 {
-		return errors.Errorf("pack %v contains %v errors: %v", id, len(errs), errs)
+	for _, blob := range indexBlobs {
+		if _, ok := inHeader[blob]; !ok {
+			errs = append(errs, errors.Errorf("Blob %v is listed in the index but not contained in the pack header", blob.ID))
+		}
 	}
 
-	return nil
+	return errs
 }
 
 // ReadData loads all data from the repository and checks the integrity.
@@ -617,8 +747,43 @@ func (c *Checker) ReadData(ctx context.Context, errChan chan<- error) {
 	c.ReadPacks(ctx, c.packs, nil, errChan)
 }
 
+// OnPackChecked registers fn, which is called by ReadPacks and ReadPackHeaders
+// for each pack that was checked without errors. It may be called
+// concurrently.
+func (c *Checker) OnPackChecked(fn func(id restic.ID)) {
+	c.packChecked = fn
+}
+
 // ReadPacks loads data from specified packs and checks the integrity.
 func (c *Checker) ReadPacks(ctx context.Context, packs map[restic.ID]int64, p *progress.Counter, errChan chan<- error) {
+	c.checkPacks(ctx, packs, p, errChan, func() packCheckFunc {
+		// create a buffer that is large enough to be reused by repository.StreamPack
+		// this ensures that we can read the pack header later on
+		bufRd := bufio.NewReaderSize(nil, repository.MaxStreamBufferSize)
+		return func(ctx context.Context, id restic.ID, blobs []restic.Blob, size int64) error {
+			return checkPack(ctx, c.repo, id, blobs, size, bufRd)
+		}
+	})
+}
+
+// ReadPackHeaders loads only the headers of the specified packs and checks
+// that they match the index. This is much faster than ReadPacks, but neither
+// verifies the blob data nor the pack ID.
+func (c *Checker) ReadPackHeaders(ctx context.Context, packs map[restic.ID]int64, p *progress.Counter, errChan chan<- error) {
+	c.checkPacks(ctx, packs, p, errChan, func() packCheckFunc {
+		return func(ctx context.Context, id restic.ID, blobs []restic.Blob, size int64) error {
+			return checkPackHeader(ctx, c.repo, id, blobs, size)
+		}
+	})
+}
+
+// packCheckFunc checks the pack id which contains blobs according to the
+// index.
+type packCheckFunc func(ctx context.Context, id restic.ID, blobs []restic.Blob, size int64) error
+
+// checkPacks runs the check returned by newCheck for all packs, each worker
+// calls newCheck once.
+func (c *Checker) checkPacks(ctx context.Context, packs map[restic.ID]int64, p *progress.Counter, errChan chan<- error, newCheck func() packCheckFunc) {
 	defer close(errChan)
 
 	g, ctx := errgroup.WithContext(ctx)
@@ -634,9 +799,7 @@ func (c *Checker) ReadPacks(ctx context.Context, packs map[restic.ID]int64, p *p
 	// run workers
 	for i := 0; i < workerCount; i++ {
 		g.Go(func() error {
-			// create a buffer that is large enough to be reused by repository.StreamPack
-			// this ensures that we can read the pack header later on
-			bufRd := bufio.NewReaderSize(nil, repository.MaxStreamBufferSize)
+			check := newCheck()
 			for {
 				var ps checkTask
 				var ok bool
@@ -650,9 +813,12 @@ func (c *Checker) ReadPacks(ctx context.Context, packs map[restic.ID]int64, p *p
 					}
 				}
 
-				err := checkPack(ctx, c.repo, ps.id, ps.blobs, ps.size, bufRd)
+				err := check(ctx, ps.id, ps.blobs, ps.size)
 				p.Add(1)
 				if err == nil {
+					if c.packChecked != nil {
+						c.packChecked(ps.id)
+					}
 					continue
 				}
 
@@ -13,6 +13,7 @@ import (
 	"time"
 
 	"github.com/restic/restic/internal/archiver"
+	"github.com/restic/restic/internal/backend/inventory"
 	"github.com/restic/restic/internal/checker"
 	"github.com/restic/restic/internal/errors"
 	"github.com/restic/restic/internal/hashing"
@@ -62,6 +63,15 @@ func checkData(chkr *checker.Checker) []error {
 	)
 }
 
+func checkPackHeaders(chkr *checker.Checker) []error {
+	return collectErrors(
+		context.TODO(),
+		func(ctx context.Context, errCh chan<- error) {
+			chkr.ReadPackHeaders(ctx, chkr.GetPacks(), nil, errCh)
+		},
+	)
+}
+
 func assertOnlyMixedPackHints(t *testing.T, hints []error) {
 	for _, err := range hints {
 		if _, ok := err.(*checker.ErrMixedPack); !ok {
@@ -88,6 +98,7 @@ func TestCheckRepo(t *testing.T) {
 
 	test.OKs(t, checkPacks(chkr))
 	test.OKs(t, checkStruct(chkr))
+	test.OKs(t, checkPackHeaders(chkr))
 }
 
 func TestMissingPack(t *testing.T) {
@@ -154,6 +165,100 @@ func TestUnreferencedPack(t *testing.T) {
 	}
 }
 
+// staleListBackend lists pack files like an outdated inventory report: it
+// omits a pack file and still lists a deleted one.
+type staleListBackend struct {
+	restic.Backend
+	omit    string
+	deleted restic.FileInfo
+}
+
+func (b staleListBackend) List(ctx context.Context, t restic.FileType, fn func(restic.FileInfo) error) error {
+	if t != restic.PackFile {
+		return b.Backend.List(ctx, t, fn)
+	}
+
+	inventory.MarkUsed(ctx)
+	err := b.Backend.List(ctx, t, func(fi restic.FileInfo) error {
+		if fi.Name == b.omit {
+			return nil
+		}
+		return fn(fi)
+	})
+	if err != nil || b.deleted.Name == "" {
+		return err
+	}
+	return fn(b.deleted)
+}
+
+func TestStalePackList(t *testing.T) {
+	repodir, cleanup := test.Env(t, checkerTestData)
+	defer cleanup()
+
+	repo := repository.TestOpenLocal(t, repodir)
+	be := staleListBackend{
+		Backend: repo.Backend(),
+		omit:    "657f7fb64f6a854fff6fe9279998ee09034901eded4e6db9bcee0e59745bbce6",
+	}
+	checkRepo, err := repository.New(be, repository.Options{})
+	test.OK(t, err)
+	test.OK(t, checkRepo.SearchKey(context.TODO(), test.TestPassword, 5, ""))
+
+	chkr := checker.New(checkRepo, false)
+	hints, errs := chkr.LoadIndex(context.TODO())
+	if len(errs) > 0 {
+		t.Fatalf("expected no errors, got %v: %v", len(errs), errs)
+	}
+	assertOnlyMixedPackHints(t, hints)
+
+	// the pack still exists and must not be reported as missing
+	errs = checkPacks(chkr)
+	if len(errs) > 0 {
+		t.Errorf("expected no errors, got %v: %v", len(errs), errs)
+	}
+}
+
+func TestStalePackListDeleted(t *testing.T) {
+	repodir, cleanup := test.Env(t, checkerTestData)
+	defer cleanup()
+
+	repo := repository.TestOpenLocal(t, repodir)
+	packHandle := restic.Handle{
+		Type: restic.PackFile,
+		Name: "657f7fb64f6a854fff6fe9279998ee09034901eded4e6db9bcee0e59745bbce6",
+	}
+	fi, err := repo.Backend().Stat(context.TODO(), packHandle)
+	test.OK(t, err)
+	test.OK(t, repo.Backend().Remove(context.TODO(), packHandle))
+
+	be := staleListBackend{
+		Backend: repo.Backend(),
+		deleted: restic.FileInfo{Name: packHandle.Name, Size: fi.Size},
+	}
+	checkRepo, err := repository.New(be, repository.Options{})
+	test.OK(t, err)
+	test.OK(t, checkRepo.SearchKey(context.TODO(), test.TestPassword, 5, ""))
+
+	chkr := checker.New(checkRepo, false)
+	hints, errs := chkr.LoadIndex(context.TODO())
+	if len(errs) > 0 {
+		t.Fatalf("expected no errors, got %v: %v", len(errs), errs)
+	}
+	assertOnlyMixedPackHints(t, hints)
+
+	// the pack is still listed but was deleted and must be reported as missing
+	errs = checkPacks(chkr)
+	test.Assert(t, len(errs) == 1,
+		"expected exactly one error, got %v", len(errs))
+
+	if err, ok := errs[0].(*checker.PackError); ok {
+		test.Equals(t, packHandle.Name, err.ID.String())
+		test.Assert(t, !err.Orphaned, "expected missing pack, got orphaned pack")
+	} else {
+		t.Errorf("expected error returned by checker.Packs() to be PackError, got %v", err)
+	}
+}
+
 func TestUnreferencedBlobs(t *testing.T) {
 	repodir, cleanup := test.Env(t, checkerTestData)
 	defer cleanup()
@@ -380,6 +485,40 @@ func TestCheckerModifiedData(t *testing.T) {
 	}
 }
 
+// truncatedHeaderRepository drops the last blob from all pack headers
+type truncatedHeaderRepository struct {
+	restic.Repository
+}
+
+func (r truncatedHeaderRepository) ListPack(ctx context.Context, id restic.ID, size int64) ([]restic.Blob, uint32, error) {
+	blobs, hdrSize, err := r.Repository.ListPack(ctx, id, size)
+	if err != nil || len(blobs) == 0 {
+		return blobs, hdrSize, err
+	}
+	return blobs[:len(blobs)-1], hdrSize, nil
+}
+
+func TestCheckerPackHeaders(t *testing.T) {
+	repo := repository.TestRepository(t)
+	archiver.TestSnapshot(t, repo, ".", nil)
+
+	chkr := checker.New(repo, false)
+	_, errs := chkr.LoadIndex(context.TODO())
+	test.OKs(t, errs)
+	test.OKs(t, checkPackHeaders(chkr))
+
+	chkr = checker.New(truncatedHeaderRepository{repo}, false)
+	_, errs = chkr.LoadIndex(context.TODO())
+	test.OKs(t, errs)
+
+	errs = checkPackHeaders(chkr)
+	test.Assert(t, len(errs) == int(chkr.CountPacks()),
+		"expected one error per pack, got %v errors for %v packs", len(errs), chkr.CountPacks())
+	for _, err := range errs {
+		t.Logf("pack header error: %v", err)
+	}
+}
+
 // loadTreesOnceRepository allows each tree to be loaded only once
 type loadTreesOnceRepository struct {
 	restic.Repository
@@ -0,0 +1,59 @@
+package fs
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+
+	"github.com/restic/restic/internal/errors"
+)
+
+// WriteFileAtomic writes data to filename. The data is written to a temporary
+// file in the same directory first, which then replaces filename. Readers
+// therefore either see the previous or the new content, but never a partially
+// written file. Missing parent directories are created.
+func WriteFileAtomic(filename string, data []byte) error {
+	dir := filepath.Dir(filename)
+	if err := MkdirAll(dir, 0700); err != nil {
+		return errors.WithStack(err)
+	}
+
+	f, err := os.CreateTemp(fixpath(dir), filepath.Base(filename)+"-tmp-")
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	_, err = f.Write(data)
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), fixpath(filename))
+	}
+	if err != nil {
+		_ = os.Remove(f.Name())
+		return errors.WithStack(err)
+	}
+	return nil
+}
+
+// ReadJSONFile decodes the JSON document stored in filename into v. It
+// returns false if the file does not exist or is damaged, v must not be used
+// in that case. Other errors reading the file are returned.
+func ReadJSONFile(filename string, v interface{}) (bool, error) {
+	buf, err := os.ReadFile(fixpath(filename))
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, errors.WithStack(err)
+	}
+
+	if err := json.Unmarshal(buf, v); err != nil {
+		return false, nil
+	}
+	return true, nil
+}
@@ -0,0 +1,44 @@
+package fs
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func TestWriteFileAtomic(t *testing.T) {
+	dir := rtest.TempDir(t)
+	filename := filepath.Join(dir, "subdir", "state.json")
+
+	rtest.OK(t, WriteFileAtomic(filename, []byte(`{"value":1}`)))
+	rtest.OK(t, WriteFileAtomic(filename, []byte(`{"value":2}`)))
+
+	entries, err := os.ReadDir(filepath.Dir(filename))
+	rtest.OK(t, err)
+	rtest.Equals(t, 1, len(entries))
+
+	var state struct {
+		Value int `json:"value"`
+	}
+	ok, err := ReadJSONFile(filename, &state)
+	rtest.OK(t, err)
+	rtest.Assert(t, ok, "file was not found")
+	rtest.Equals(t, 2, state.Value)
+}
+
+func TestReadJSONFileMissingOrDamaged(t *testing.T) {
+	dir := rtest.TempDir(t)
+	var v map[string]int
+
+	ok, err := ReadJSONFile(filepath.Join(dir, "missing.json"), &v)
+	rtest.OK(t, err)
+	rtest.Assert(t, !ok, "missing file was reported as found")
+
+	filename := filepath.Join(dir, "damaged.json")
+	rtest.OK(t, os.WriteFile(filename, []byte(`{"value":`), 0600))
+	ok, err = ReadJSONFile(filename, &v)
+	rtest.OK(t, err)
+	rtest.Assert(t, !ok, "damaged file was reported as found")
+}
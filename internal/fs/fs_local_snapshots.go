@@ -0,0 +1,311 @@
+package fs
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/restic/restic/internal/errors"
+)
+
+// ErrorHandler is used to report errors via callback
+type ErrorHandler func(item string, err error) error
+
+// MessageHandler is used to report errors/messages via callbacks.
+type MessageHandler func(msg string, args ...interface{})
+
+// SnapshotProgress is notified when the creation of a filesystem snapshot for
+// a volume starts and when it has finished. Creating a snapshot may take a
+// long time, during which no files can be accessed.
+type SnapshotProgress interface {
+	StartSnapshot(volume string)
+	CompleteSnapshot(volume string, err error)
+	// Warning reports a problem which does not affect the backup, e.g.
+	// snapshots left behind by an earlier run.
+	Warning(item string, msg string)
+}
+
+// SnapshotProvider creates filesystem snapshots for one type of file system,
+// e.g. VSS for NTFS volumes on Windows or ZFS datasets.
+type SnapshotProvider interface {
+	// Name returns a short name of the provider, e.g. "vss" or "zfs".
+	Name() string
+	// Volume returns the root of the unit which is snapshotted as a whole
+	// and contains the absolute path, e.g. the mount point of a ZFS dataset.
+	// If the path is not located on a file system supported by the
+	// provider, ok is false.
+	Volume(path string) (volume string, ok bool)
+	// Create creates a snapshot of the volume.
+	Create(volume string) (ProviderSnapshot, error)
+}
+
+// danglingSnapshotFinder is implemented by providers which can find the
+// snapshots created by restic which still exist, e.g. because an earlier
+// backup was killed before it could delete them.
+type danglingSnapshotFinder interface {
+	// Dangling returns the names of the snapshots of the volume created by
+	// restic.
+	Dangling(volume string) ([]string, error)
+}
+
+// ProviderSnapshot is a snapshot created by a SnapshotProvider.
+type ProviderSnapshot interface {
+	// Path returns the location within the snapshot of the absolute path,
+	// which is located on the snapshotted volume. An empty string means that
+	// the path is not contained in the snapshot and must be read directly.
+	Path(path string) string
+	// Verify returns an error if the snapshot has been deleted or replaced.
+	Verify() error
+	// Delete removes the snapshot.
+	Delete() error
+}
+
+// snapshotMapping is an entry of the mapping table of LocalSnapshots.
+type snapshotMapping struct {
+	provider SnapshotProvider
+	volume   string
+	snapshot ProviderSnapshot
+}
+
+// LocalSnapshots is a wrapper around the local file system which reads files
+// from filesystem snapshots. Each path is mapped to the provider which
+// supports the most specific volume containing it, so that a single backup
+// can read from snapshots of different file systems. Snapshots are created
+// when the first file on a volume is accessed. Paths which no provider
+// supports, or for which no snapshot could be created, are read directly.
+type LocalSnapshots struct {
+	FS
+	providers []SnapshotProvider
+
+	mutex sync.RWMutex
+	// snapshots lists the snapshots in the order they were created
+	snapshots []snapshotMapping
+	// volumes contains the index in snapshots for each provider and volume,
+	// or -1 if the snapshot could not be created
+	volumes map[snapshotKey]int
+	// limit contains the only volumes which are snapshotted, if it is set
+	limit map[snapshotKey]struct{}
+
+	msgError ErrorHandler
+	progress SnapshotProgress
+}
+
+type snapshotKey struct {
+	provider string
+	volume   string
+}
+
+// statically ensure that LocalSnapshots implements FS and SnapshotVerifier.
+var _ FS = &LocalSnapshots{}
+var _ SnapshotVerifier = &LocalSnapshots{}
+
+// NewLocalSnapshots creates a new wrapper around the local filesystem which
+// uses the given providers to create filesystem snapshots.
+func NewLocalSnapshots(msgError ErrorHandler, progress SnapshotProgress, providers ...SnapshotProvider) *LocalSnapshots {
+	return &LocalSnapshots{
+		FS:        Local{},
+		providers: providers,
+		volumes:   make(map[snapshotKey]int),
+		msgError:  msgError,
+		progress:  progress,
+	}
+}
+
+// LimitVolumes restricts the snapshots to the volumes containing one of the
+// paths, e.g. for --one-file-system. Files on other volumes, like child
+// datasets mounted below a path, are read directly. LimitVolumes must be
+// called before any file is accessed.
+func (fs *LocalSnapshots) LimitVolumes(paths []string) {
+	fs.mutex.Lock()
+	defer fs.mutex.Unlock()
+
+	fs.limit = make(map[snapshotKey]struct{})
+	for _, path := range paths {
+		abs, err := filepath.Abs(path)
+		if err != nil {
+			continue
+		}
+		if provider, volume, ok := fs.providerFor(abs); ok {
+			fs.limit[snapshotKey{provider.Name(), volume}] = struct{}{}
+		}
+	}
+}
+
+// SnapshotVolume returns the volume containing path if the path is read from a
+// snapshot which has already been created successfully.
+func (fs *LocalSnapshots) SnapshotVolume(path string) (string, bool) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", false
+	}
+	provider, volume, ok := fs.providerFor(abs)
+	if !ok {
+		return "", false
+	}
+
+	fs.mutex.RLock()
+	defer fs.mutex.RUnlock()
+	idx, ok := fs.volumes[snapshotKey{provider.Name(), volume}]
+	return volume, ok && idx >= 0
+}
+
+// DeleteSnapshots deletes all snapshots in the reverse order of their
+// creation, so that snapshots which depend on an earlier one, e.g. of a file
+// system mounted within another snapshotted volume, are removed first.
+// Snapshots which could not be deleted are kept for a later call.
+func (fs *LocalSnapshots) DeleteSnapshots() {
+	fs.mutex.Lock()
+	defer fs.mutex.Unlock()
+
+	var remaining []snapshotMapping
+	for i := len(fs.snapshots) - 1; i >= 0; i-- {
+		m := fs.snapshots[i]
+		if err := m.snapshot.Delete(); err != nil {
+			_ = fs.msgError(m.volume, errors.Errorf("failed to delete %v snapshot: %s", m.provider.Name(), err))
+			remaining = append(remaining, m)
+		}
+	}
+
+	// restore the creation order
+	for i, j := 0, len(remaining)-1; i < j; i, j = i+1, j-1 {
+		remaining[i], remaining[j] = remaining[j], remaining[i]
+	}
+
+	fs.snapshots = remaining
+	fs.volumes = make(map[snapshotKey]int)
+	for i, m := range remaining {
+		fs.volumes[snapshotKey{m.provider.Name(), m.volume}] = i
+	}
+}
+
+// VerifySnapshots checks that all snapshots created so far still exist and
+// were not replaced, e.g. by a cleanup job which deleted them while the backup
+// was reading from them.
+func (fs *LocalSnapshots) VerifySnapshots() error {
+	fs.mutex.RLock()
+	defer fs.mutex.RUnlock()
+
+	for _, m := range fs.snapshots {
+		if err := m.snapshot.Verify(); err != nil {
+			return errors.Errorf("%v snapshot of %v: %v", m.provider.Name(), m.volume, err)
+		}
+	}
+	return nil
+}
+
+// Open wraps the Open method of the underlying file system.
+func (fs *LocalSnapshots) Open(name string) (File, error) {
+	return os.Open(fs.snapshotPath(name))
+}
+
+// OpenFile wraps the OpenFile method of the underlying file system.
+func (fs *LocalSnapshots) OpenFile(name string, flag int, perm os.FileMode) (File, error) {
+	return os.OpenFile(fs.snapshotPath(name), flag, perm)
+}
+
+// Stat wraps the Stat method of the underlying file system.
+func (fs *LocalSnapshots) Stat(name string) (os.FileInfo, error) {
+	return os.Stat(fs.snapshotPath(name))
+}
+
+// Lstat wraps the Lstat method of the underlying file system.
+func (fs *LocalSnapshots) Lstat(name string) (os.FileInfo, error) {
+	return os.Lstat(fs.snapshotPath(name))
+}
+
+// providerFor returns the provider which supports the most specific volume
+// containing path.
+func (fs *LocalSnapshots) providerFor(path string) (SnapshotProvider, string, bool) {
+	var provider SnapshotProvider
+	var volume string
+	for _, p := range fs.providers {
+		v, ok := p.Volume(path)
+		if ok && (provider == nil || len(v) > len(volume)) {
+			provider, volume = p, v
+		}
+	}
+	return provider, volume, provider != nil
+}
+
+// snapshotPath returns the path within the snapshot of the volume containing
+// path, the snapshot is created if it does not exist yet. If no snapshot is
+// available, the original path is returned.
+func (fs *LocalSnapshots) snapshotPath(path string) string {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return path
+	}
+
+	provider, volume, ok := fs.providerFor(abs)
+	if !ok {
+		return path
+	}
+	key := snapshotKey{provider.Name(), volume}
+
+	fs.mutex.RLock()
+	_, allowed := fs.limit[key]
+	if fs.limit == nil {
+		allowed = true
+	}
+	idx, exists := fs.volumes[key]
+	var snapshot ProviderSnapshot
+	if exists && idx >= 0 {
+		snapshot = fs.snapshots[idx].snapshot
+	}
+	fs.mutex.RUnlock()
+
+	if !allowed {
+		return path
+	}
+	if !exists {
+		snapshot = fs.createSnapshot(key, provider)
+	}
+	if snapshot == nil {
+		return path
+	}
+
+	if p := snapshot.Path(abs); p != "" {
+		return p
+	}
+	return path
+}
+
+// createSnapshot creates the snapshot for key unless another goroutine
+// already did. Nil is returned if the snapshot could not be created.
+func (fs *LocalSnapshots) createSnapshot(key snapshotKey, provider SnapshotProvider) ProviderSnapshot {
+	fs.mutex.Lock()
+	defer fs.mutex.Unlock()
+
+	if idx, ok := fs.volumes[key]; ok {
+		if idx < 0 {
+			return nil
+		}
+		return fs.snapshots[idx].snapshot
+	}
+
+	if finder, ok := provider.(danglingSnapshotFinder); ok {
+		// errors are ignored, the snapshot is then likely not created either
+		dangling, err := finder.Dangling(key.volume)
+		if err == nil && len(dangling) > 0 {
+			fs.progress.Warning(key.volume, fmt.Sprintf("found %d %v snapshots left behind by an earlier backup, remove them unless another backup is running: %v",
+				len(dangling), provider.Name(), strings.Join(dangling, ", ")))
+		}
+	}
+
+	fs.progress.StartSnapshot(key.volume)
+	snapshot, err := provider.Create(key.volume)
+	if err != nil {
+		err = errors.Errorf("failed to create %v snapshot for [%s]: %s", provider.Name(), key.volume, err)
+		fs.progress.CompleteSnapshot(key.volume, err)
+		_ = fs.msgError(key.volume, err)
+		fs.volumes[key] = -1
+		return nil
+	}
+	fs.progress.CompleteSnapshot(key.volume, nil)
+
+	fs.volumes[key] = len(fs.snapshots)
+	fs.snapshots = append(fs.snapshots, snapshotMapping{provider: provider, volume: key.volume, snapshot: snapshot})
+	return snapshot
+}
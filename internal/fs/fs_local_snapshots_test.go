@@ -0,0 +1,195 @@
+package fs
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/restic/restic/internal/errors"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+// testProvider supports all paths below its volumes, snapshots are
+// directories below root named after the provider and the volume.
+type testProvider struct {
+	name    string
+	root    string
+	volumes []string
+	fail    bool
+	log     *[]string
+	// dangling are the snapshots returned by Dangling
+	dangling []string
+}
+
+func (p *testProvider) Name() string {
+	return p.name
+}
+
+func (p *testProvider) Volume(path string) (string, bool) {
+	for _, v := range p.volumes {
+		if HasPathPrefix(v, path) {
+			return v, true
+		}
+	}
+	return "", false
+}
+
+func (p *testProvider) Dangling(volume string) ([]string, error) {
+	return p.dangling, nil
+}
+
+func (p *testProvider) Create(volume string) (ProviderSnapshot, error) {
+	*p.log = append(*p.log, "create "+p.name+" "+volume)
+	if p.fail {
+		return nil, errors.New("create failed")
+	}
+	dir := filepath.Join(p.root, p.name+strings.ReplaceAll(volume, string(filepath.Separator), "_"))
+	return &testProviderSnapshot{provider: p, volume: volume, dir: dir}, nil
+}
+
+type testProviderSnapshot struct {
+	provider *testProvider
+	volume   string
+	dir      string
+	invalid  bool
+}
+
+func (s *testProviderSnapshot) Path(path string) string {
+	rel, err := filepath.Rel(s.volume, path)
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(s.dir, rel)
+}
+
+func (s *testProviderSnapshot) Verify() error {
+	if s.invalid {
+		return errors.New("snapshot is gone")
+	}
+	return nil
+}
+
+func (s *testProviderSnapshot) Delete() error {
+	*s.provider.log = append(*s.provider.log, "delete "+s.provider.name+" "+s.volume)
+	return nil
+}
+
+type testSnapshotProgress struct {
+	started  []string
+	warnings []string
+}
+
+func (p *testSnapshotProgress) StartSnapshot(volume string) {
+	p.started = append(p.started, volume)
+}
+
+func (p *testSnapshotProgress) CompleteSnapshot(volume string, err error) {}
+
+func (p *testSnapshotProgress) Warning(item string, msg string) {
+	p.warnings = append(p.warnings, item)
+}
+
+func TestLocalSnapshots(t *testing.T) {
+	root := t.TempDir()
+	src := filepath.Join(root, "src")
+	nested := filepath.Join(src, "nested")
+	plain := filepath.Join(root, "plain")
+	broken := filepath.Join(root, "broken")
+
+	var log []string
+	outer := &testProvider{name: "outer", root: root, volumes: []string{src}, log: &log}
+	inner := &testProvider{name: "inner", root: root, volumes: []string{nested}, log: &log,
+		dangling: []string{"left-behind"}}
+	failing := &testProvider{name: "failing", root: root, volumes: []string{broken}, fail: true, log: &log}
+
+	var errs []string
+	progress := &testSnapshotProgress{}
+	fs := NewLocalSnapshots(func(item string, err error) error {
+		errs = append(errs, item)
+		return nil
+	}, progress, outer, inner, failing)
+
+	outerDir := filepath.Join(root, "outer"+strings.ReplaceAll(src, string(filepath.Separator), "_"))
+	innerDir := filepath.Join(root, "inner"+strings.ReplaceAll(nested, string(filepath.Separator), "_"))
+	for _, dir := range []string{outerDir, innerDir, plain, broken} {
+		rtest.OK(t, os.MkdirAll(dir, 0700))
+	}
+	rtest.OK(t, os.WriteFile(filepath.Join(outerDir, "file"), []byte("outer"), 0600))
+	rtest.OK(t, os.WriteFile(filepath.Join(innerDir, "file"), []byte("inner"), 0600))
+	rtest.OK(t, os.WriteFile(filepath.Join(plain, "file"), []byte("plain"), 0600))
+	rtest.OK(t, os.WriteFile(filepath.Join(broken, "file"), []byte("broken"), 0600))
+
+	// each path is read from the snapshot of the most specific volume
+	for _, test := range []struct {
+		path, content string
+	}{
+		{filepath.Join(src, "file"), "outer"},
+		{filepath.Join(nested, "file"), "inner"},
+		{filepath.Join(src, "file"), "outer"},
+		{filepath.Join(plain, "file"), "plain"},
+		{filepath.Join(broken, "file"), "broken"},
+		{filepath.Join(broken, "file"), "broken"},
+	} {
+		f, err := fs.Open(test.path)
+		rtest.OK(t, err)
+		buf := make([]byte, 100)
+		n, _ := f.Read(buf)
+		rtest.OK(t, f.Close())
+		rtest.Equals(t, test.content, string(buf[:n]))
+	}
+
+	// the snapshots are created once, a failed snapshot is not retried
+	rtest.Equals(t, []string{"create outer " + src, "create inner " + nested, "create failing " + broken}, log)
+	rtest.Equals(t, []string{src, nested, broken}, progress.started)
+	rtest.Equals(t, []string{broken}, errs)
+	// snapshots left behind by an earlier backup are reported as warnings
+	rtest.Equals(t, []string{nested}, progress.warnings)
+
+	rtest.OK(t, fs.VerifySnapshots())
+	fs.snapshots[1].snapshot.(*testProviderSnapshot).invalid = true
+	err := fs.VerifySnapshots()
+	rtest.Assert(t, err != nil && strings.Contains(err.Error(), "inner snapshot of "+nested), "unexpected error %v", err)
+
+	// snapshots are deleted in the reverse order of their creation
+	log = nil
+	fs.DeleteSnapshots()
+	rtest.Equals(t, []string{"delete inner " + nested, "delete outer " + src}, log)
+}
+
+func TestLocalSnapshotsLimitVolumes(t *testing.T) {
+	root := t.TempDir()
+	src := filepath.Join(root, "src")
+	nested := filepath.Join(src, "nested")
+	rtest.OK(t, os.MkdirAll(nested, 0700))
+
+	var log []string
+	outer := &testProvider{name: "outer", root: root, volumes: []string{src}, log: &log}
+	inner := &testProvider{name: "inner", root: root, volumes: []string{nested}, log: &log}
+
+	fs := NewLocalSnapshots(func(item string, err error) error {
+		t.Errorf("unexpected error for %v: %v", item, err)
+		return nil
+	}, &testSnapshotProgress{}, outer, inner)
+	fs.LimitVolumes([]string{filepath.Join(src, "file")})
+
+	outerDir := filepath.Join(root, "outer"+strings.ReplaceAll(src, string(filepath.Separator), "_"))
+	rtest.OK(t, os.MkdirAll(outerDir, 0700))
+
+	// the nested volume is not snapshotted and read directly
+	fi, err := fs.Lstat(nested)
+	rtest.OK(t, err)
+	rtest.Assert(t, fi.IsDir(), "nested volume is not a directory")
+	rtest.Equals(t, 0, len(log))
+	_, err = fs.Lstat(src)
+	rtest.OK(t, err)
+	rtest.Equals(t, []string{"create outer " + src}, log)
+
+	volume, ok := fs.SnapshotVolume(filepath.Join(src, "dir"))
+	rtest.Assert(t, ok, "no snapshot found for %v", src)
+	rtest.Equals(t, src, volume)
+	_, ok = fs.SnapshotVolume(nested)
+	rtest.Assert(t, !ok, "nested volume was snapshotted")
+
+	fs.DeleteSnapshots()
+}
@@ -23,6 +23,14 @@ type FS interface {
 	Base(path string) string
 }
 
+// SnapshotVerifier is implemented by file systems which read from filesystem
+// snapshots. VerifySnapshots returns an error if one of the snapshots was
+// deleted or replaced since it was created, in which case the data read from
+// it may be inconsistent.
+type SnapshotVerifier interface {
+	VerifySnapshots() error
+}
+
 // File is an open file on a file system.
 type File interface {
 	io.Reader
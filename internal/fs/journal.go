@@ -0,0 +1,40 @@
+package fs
+
+import (
+	"context"
+
+	"github.com/restic/restic/internal/errors"
+)
+
+// JournalPosition is a position in the change journal of a volume.
+type JournalPosition struct {
+	// Volume is the root directory of the volume, e.g. `C:\` or "/".
+	Volume string `json:"volume"`
+	// JournalID identifies the instance of the journal, positions of
+	// different instances cannot be compared.
+	JournalID string `json:"journal_id"`
+	Position  uint64 `json:"position"`
+}
+
+// ChangeJournal lists the files which changed on a volume, using a journal
+// maintained by the operating system, e.g. the USN journal of NTFS on Windows
+// or the fseventsd archives on macOS.
+type ChangeJournal interface {
+	// Position returns the current position of the journal of the volume
+	// which contains the absolute path.
+	Position(path string) (JournalPosition, error)
+	// Changes returns the absolute paths of all files and directories on the
+	// volume of pos which were created, modified, renamed or removed since
+	// pos. ErrJournalIncomplete is returned if the journal no longer
+	// contains all changes since pos.
+	Changes(ctx context.Context, pos JournalPosition) ([]string, error)
+}
+
+// ErrJournalUnsupported is returned by NewChangeJournal if no change journal
+// is available on the current platform.
+var ErrJournalUnsupported = errors.New("change journal is not supported on this platform")
+
+// ErrJournalIncomplete is returned by ChangeJournal.Changes if some changes
+// since the position are no longer available, e.g. because the journal was
+// recreated or old entries were purged.
+var ErrJournalIncomplete = errors.New("change journal does not contain all changes")
@@ -0,0 +1,31 @@
+package fs
+
+import (
+	"golang.org/x/sys/unix"
+
+	"github.com/restic/restic/internal/errors"
+)
+
+// dataVolume is the mount point of the data volume of macOS, its content is
+// visible in the root directory via firmlinks.
+const dataVolume = "/System/Volumes/Data"
+
+// NewChangeJournal returns the change journal of the platform, which reads the
+// archives of fseventsd.
+func NewChangeJournal() (ChangeJournal, error) {
+	return fseventsdJournal{
+		mountPoint: func(path string) (string, error) {
+			var st unix.Statfs_t
+			if err := unix.Statfs(path, &st); err != nil {
+				return "", errors.Wrap(err, "statfs")
+			}
+			return unix.ByteSliceToString(st.Mntonname[:]), nil
+		},
+		visibleRoot: func(mountPoint string) string {
+			if mountPoint == dataVolume {
+				return "/"
+			}
+			return mountPoint
+		},
+	}, nil
+}
@@ -0,0 +1,221 @@
+package fs
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/binary"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/restic/restic/internal/errors"
+)
+
+// fseventsdRecord is a single entry of an fseventsd archive.
+type fseventsdRecord struct {
+	// Path is relative to the root of the volume.
+	Path  string
+	ID    uint64
+	Flags uint32
+}
+
+// parseFseventsdArchive parses the decompressed content of an fseventsd
+// archive. It consists of pages, each starting with a magic value which
+// determines the version of the records, followed by the size of the page.
+func parseFseventsdArchive(buf []byte) ([]fseventsdRecord, error) {
+	var records []fseventsdRecord
+
+	for len(buf) > 0 {
+		if len(buf) < 12 {
+			return nil, errors.New("truncated page header")
+		}
+
+		// the size of the fields following the event ID and flags
+		var extra int
+		switch string(buf[:4]) {
+		case "1SLD":
+			extra = 0
+		case "2SLD":
+			extra = 8 // node ID
+		case "3SLD":
+			extra = 12 // node ID and an unknown field
+		default:
+			return nil, errors.Errorf("invalid page magic %q", buf[:4])
+		}
+
+		size := int(binary.LittleEndian.Uint32(buf[8:12]))
+		if size < 12 || size > len(buf) {
+			return nil, errors.Errorf("invalid page size %d", size)
+		}
+		page := buf[12:size]
+		buf = buf[size:]
+
+		for len(page) > 0 {
+			end := bytes.IndexByte(page, 0)
+			if end < 0 || len(page) < end+1+12+extra {
+				return nil, errors.New("truncated record")
+			}
+			rec := fseventsdRecord{Path: string(page[:end])}
+			page = page[end+1:]
+			rec.ID = binary.LittleEndian.Uint64(page[:8])
+			rec.Flags = binary.LittleEndian.Uint32(page[8:12])
+			page = page[12+extra:]
+
+			records = append(records, rec)
+		}
+	}
+
+	return records, nil
+}
+
+// fseventsdArchives returns the names of all archives in dir, which are
+// named after an event ID in hexadecimal, sorted from oldest to newest.
+func fseventsdArchives(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	var names []string
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() {
+			continue
+		}
+		if _, err := strconv.ParseUint(entry.Name(), 16, 64); err != nil {
+			continue
+		}
+		names = append(names, entry.Name())
+	}
+	// the names all have the same length, so this also sorts by event ID
+	sort.Strings(names)
+	return names, nil
+}
+
+// readFseventsdArchive reads and parses the archive in filename.
+func readFseventsdArchive(filename string) ([]fseventsdRecord, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+
+	rd, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, errors.Wrapf(err, "archive %v", filename)
+	}
+	buf, err := io.ReadAll(rd)
+	if err != nil {
+		return nil, errors.Wrapf(err, "archive %v", filename)
+	}
+
+	records, err := parseFseventsdArchive(buf)
+	if err != nil {
+		return nil, errors.Wrapf(err, "archive %v", filename)
+	}
+	return records, nil
+}
+
+// fseventsdJournal reads the change records which fseventsd stores in the
+// directory .fseventsd at the root of each volume on macOS. Records are only
+// written to disk from time to time, so the current position is the highest
+// event ID contained in the newest archive and all later events are
+// returned by the next call to Changes.
+type fseventsdJournal struct {
+	// mountPoint returns the root directory of the volume containing path.
+	mountPoint func(path string) (string, error)
+	// visibleRoot returns the directory below which the files of the volume
+	// are visible, it differs from the mount point for the data volume of
+	// macOS, which is linked into the root directory via firmlinks.
+	visibleRoot func(mountPoint string) string
+}
+
+func (j fseventsdJournal) journalID(volume string) (string, error) {
+	buf, err := os.ReadFile(filepath.Join(volume, ".fseventsd", "fseventsd-uuid"))
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	return strings.TrimSpace(string(buf)), nil
+}
+
+func (j fseventsdJournal) Position(path string) (JournalPosition, error) {
+	volume, err := j.mountPoint(path)
+	if err != nil {
+		return JournalPosition{}, err
+	}
+
+	id, err := j.journalID(volume)
+	if err != nil {
+		return JournalPosition{}, err
+	}
+	pos := JournalPosition{Volume: volume, JournalID: id}
+
+	dir := filepath.Join(volume, ".fseventsd")
+	names, err := fseventsdArchives(dir)
+	if err != nil {
+		return JournalPosition{}, err
+	}
+	if len(names) == 0 {
+		return pos, nil
+	}
+
+	records, err := readFseventsdArchive(filepath.Join(dir, names[len(names)-1]))
+	if err != nil {
+		return JournalPosition{}, err
+	}
+	for _, rec := range records {
+		if rec.ID > pos.Position {
+			pos.Position = rec.ID
+		}
+	}
+	return pos, nil
+}
+
+func (j fseventsdJournal) Changes(ctx context.Context, pos JournalPosition) ([]string, error) {
+	id, err := j.journalID(pos.Volume)
+	if err != nil {
+		return nil, err
+	}
+	if id != pos.JournalID {
+		return nil, ErrJournalIncomplete
+	}
+
+	dir := filepath.Join(pos.Volume, ".fseventsd")
+	names, err := fseventsdArchives(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	root := j.visibleRoot(pos.Volume)
+	var changed []string
+	// the archive containing the event at pos must still exist, otherwise
+	// events may have been purged
+	complete := pos.Position == 0
+	for _, name := range names {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+
+		records, err := readFseventsdArchive(filepath.Join(dir, name))
+		if err != nil {
+			return nil, err
+		}
+		for _, rec := range records {
+			if rec.ID <= pos.Position {
+				complete = true
+				continue
+			}
+			changed = append(changed, filepath.Join(root, strings.TrimPrefix(rec.Path, "/")))
+		}
+	}
+
+	if !complete {
+		return nil, ErrJournalIncomplete
+	}
+	return changed, nil
+}
@@ -0,0 +1,139 @@
+package fs
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+// fseventsdPage encodes records as a page with the given magic.
+func fseventsdPage(magic string, records []fseventsdRecord) []byte {
+	var extra int
+	switch magic {
+	case "2SLD":
+		extra = 8
+	case "3SLD":
+		extra = 12
+	}
+
+	var body []byte
+	for _, rec := range records {
+		body = append(body, rec.Path...)
+		body = append(body, 0)
+		fields := make([]byte, 12+extra)
+		binary.LittleEndian.PutUint64(fields[0:8], rec.ID)
+		binary.LittleEndian.PutUint32(fields[8:12], rec.Flags)
+		body = append(body, fields...)
+	}
+
+	page := make([]byte, 12, 12+len(body))
+	copy(page, magic)
+	binary.LittleEndian.PutUint32(page[8:12], uint32(12+len(body)))
+	return append(page, body...)
+}
+
+func writeFseventsdArchive(t testing.TB, dir string, name string, pages ...[]byte) {
+	var buf bytes.Buffer
+	wr := gzip.NewWriter(&buf)
+	for _, page := range pages {
+		_, err := wr.Write(page)
+		rtest.OK(t, err)
+	}
+	rtest.OK(t, wr.Close())
+	rtest.OK(t, os.WriteFile(filepath.Join(dir, name), buf.Bytes(), 0600))
+}
+
+func TestParseFseventsdArchive(t *testing.T) {
+	v1 := []fseventsdRecord{
+		{Path: "Users/foo/file", ID: 10, Flags: 0x1},
+		{Path: "Users/foo", ID: 11, Flags: 0x2},
+	}
+	v2 := []fseventsdRecord{
+		{Path: "tmp/x", ID: 20, Flags: 0x4},
+	}
+	v3 := []fseventsdRecord{
+		{Path: "private/var/y", ID: 30, Flags: 0x8},
+	}
+
+	buf := append(fseventsdPage("1SLD", v1), fseventsdPage("2SLD", v2)...)
+	buf = append(buf, fseventsdPage("3SLD", v3)...)
+
+	records, err := parseFseventsdArchive(buf)
+	rtest.OK(t, err)
+
+	want := append(append(append([]fseventsdRecord{}, v1...), v2...), v3...)
+	if !cmp.Equal(want, records) {
+		t.Error(cmp.Diff(want, records))
+	}
+
+	for _, buf := range [][]byte{
+		[]byte("XSLD\x00\x00\x00\x00\x0c\x00\x00\x00"),
+		fseventsdPage("2SLD", v2)[:20],
+		[]byte("1SLD"),
+	} {
+		_, err := parseFseventsdArchive(buf)
+		rtest.Assert(t, err != nil, "expected error for invalid archive %q", buf)
+	}
+}
+
+func TestFseventsdJournal(t *testing.T) {
+	volume := t.TempDir()
+	dir := filepath.Join(volume, ".fseventsd")
+	rtest.OK(t, os.Mkdir(dir, 0700))
+	rtest.OK(t, os.WriteFile(filepath.Join(dir, "fseventsd-uuid"), []byte("uuid-1\n"), 0600))
+
+	root := t.TempDir()
+	j := fseventsdJournal{
+		mountPoint: func(string) (string, error) {
+			return volume, nil
+		},
+		visibleRoot: func(mountPoint string) string {
+			rtest.Equals(t, volume, mountPoint)
+			return root
+		},
+	}
+	ctx := context.TODO()
+
+	writeFseventsdArchive(t, dir, "0000000000000010", fseventsdPage("1SLD", []fseventsdRecord{
+		{Path: "a", ID: 0x8},
+		{Path: "b", ID: 0x10},
+	}))
+
+	pos, err := j.Position(filepath.Join(volume, "a"))
+	rtest.OK(t, err)
+	rtest.Equals(t, JournalPosition{Volume: volume, JournalID: "uuid-1", Position: 0x10}, pos)
+
+	writeFseventsdArchive(t, dir, "0000000000000020", fseventsdPage("2SLD", []fseventsdRecord{
+		{Path: "c/d", ID: 0x18},
+		{Path: "/e", ID: 0x20},
+	}))
+
+	changes, err := j.Changes(ctx, pos)
+	rtest.OK(t, err)
+	rtest.Equals(t, []string{filepath.Join(root, "c", "d"), filepath.Join(root, "e")}, changes)
+
+	next, err := j.Position(volume)
+	rtest.OK(t, err)
+	rtest.Equals(t, uint64(0x20), next.Position)
+
+	changes, err = j.Changes(ctx, next)
+	rtest.OK(t, err)
+	rtest.Equals(t, 0, len(changes))
+
+	// events before the position have been purged
+	rtest.OK(t, os.Remove(filepath.Join(dir, "0000000000000010")))
+	_, err = j.Changes(ctx, JournalPosition{Volume: volume, JournalID: "uuid-1", Position: 0x4})
+	rtest.Assert(t, err == ErrJournalIncomplete, "expected ErrJournalIncomplete, got %v", err)
+
+	// the journal has been recreated
+	rtest.OK(t, os.WriteFile(filepath.Join(dir, "fseventsd-uuid"), []byte("uuid-2\n"), 0600))
+	_, err = j.Changes(ctx, next)
+	rtest.Assert(t, err == ErrJournalIncomplete, "expected ErrJournalIncomplete, got %v", err)
+}
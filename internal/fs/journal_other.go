@@ -0,0 +1,9 @@
+//go:build !windows && !darwin
+// +build !windows,!darwin
+
+package fs
+
+// NewChangeJournal returns the change journal of the platform.
+func NewChangeJournal() (ChangeJournal, error) {
+	return nil, ErrJournalUnsupported
+}
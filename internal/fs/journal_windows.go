@@ -0,0 +1,270 @@
+package fs
+
+import (
+	"context"
+	"encoding/binary"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"unsafe"
+
+	"github.com/restic/restic/internal/errors"
+	"golang.org/x/sys/windows"
+)
+
+const (
+	fsctlQueryUsnJournal = 0x000900f4
+	fsctlReadUsnJournal  = 0x000900bb
+
+	// usnReasonAny selects all records regardless of the reason.
+	usnReasonAny = 0xffffffff
+
+	volumeNameDOS = 0x0
+)
+
+var (
+	modkernel32      = windows.NewLazySystemDLL("kernel32.dll")
+	procOpenFileByID = modkernel32.NewProc("OpenFileById")
+)
+
+// usnJournalData is the USN_JOURNAL_DATA_V0 structure.
+type usnJournalData struct {
+	UsnJournalID    uint64
+	FirstUsn        int64
+	NextUsn         int64
+	LowestValidUsn  int64
+	MaxUsn          int64
+	MaximumSize     uint64
+	AllocationDelta uint64
+}
+
+// readUsnJournalData is the READ_USN_JOURNAL_DATA_V0 structure.
+type readUsnJournalData struct {
+	StartUsn          int64
+	ReasonMask        uint32
+	ReturnOnlyOnClose uint32
+	Timeout           uint64
+	BytesToWaitFor    uint64
+	UsnJournalID      uint64
+}
+
+// fileIDDescriptor is the FILE_ID_DESCRIPTOR structure for a 64 bit file ID.
+type fileIDDescriptor struct {
+	Size   uint32
+	Type   uint32
+	FileID uint64
+	_      uint64 // the union also contains a 128 bit ID
+}
+
+// usnJournal reads the USN journal of NTFS volumes. Accessing the journal
+// requires administrator privileges.
+type usnJournal struct{}
+
+// NewChangeJournal returns the change journal of the platform, which reads the
+// USN journal.
+func NewChangeJournal() (ChangeJournal, error) {
+	return usnJournal{}, nil
+}
+
+// openVolume opens the volume with the root directory volume, e.g. `C:\`.
+func openVolume(volume string) (windows.Handle, error) {
+	name, err := windows.UTF16PtrFromString(`\\.\` + strings.TrimSuffix(volume, `\`))
+	if err != nil {
+		return 0, err
+	}
+	h, err := windows.CreateFile(name, windows.GENERIC_READ,
+		windows.FILE_SHARE_READ|windows.FILE_SHARE_WRITE|windows.FILE_SHARE_DELETE,
+		nil, windows.OPEN_EXISTING, windows.FILE_FLAG_BACKUP_SEMANTICS, 0)
+	if err != nil {
+		return 0, errors.Wrapf(err, "open volume %v", volume)
+	}
+	return h, nil
+}
+
+func queryUsnJournal(h windows.Handle) (usnJournalData, error) {
+	var data usnJournalData
+	var n uint32
+	err := windows.DeviceIoControl(h, fsctlQueryUsnJournal, nil, 0,
+		(*byte)(unsafe.Pointer(&data)), uint32(unsafe.Sizeof(data)), &n, nil)
+	if err != nil {
+		return usnJournalData{}, errors.Wrap(err, "FSCTL_QUERY_USN_JOURNAL")
+	}
+	return data, nil
+}
+
+func (usnJournal) Position(path string) (JournalPosition, error) {
+	volume := filepath.VolumeName(path) + `\`
+	h, err := openVolume(volume)
+	if err != nil {
+		return JournalPosition{}, err
+	}
+	defer func() {
+		_ = windows.CloseHandle(h)
+	}()
+
+	data, err := queryUsnJournal(h)
+	if err != nil {
+		return JournalPosition{}, err
+	}
+	return JournalPosition{
+		Volume:    volume,
+		JournalID: strconv.FormatUint(data.UsnJournalID, 16),
+		Position:  uint64(data.NextUsn),
+	}, nil
+}
+
+func (usnJournal) Changes(ctx context.Context, pos JournalPosition) ([]string, error) {
+	h, err := openVolume(pos.Volume)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = windows.CloseHandle(h)
+	}()
+
+	data, err := queryUsnJournal(h)
+	if err != nil {
+		return nil, err
+	}
+	if strconv.FormatUint(data.UsnJournalID, 16) != pos.JournalID || int64(pos.Position) < data.LowestValidUsn {
+		return nil, ErrJournalIncomplete
+	}
+
+	paths := &usnPathResolver{volume: pos.Volume, handle: h, dirs: make(map[uint64]string)}
+	var changed []string
+
+	req := readUsnJournalData{
+		StartUsn:     int64(pos.Position),
+		ReasonMask:   usnReasonAny,
+		UsnJournalID: data.UsnJournalID,
+	}
+	buf := make([]byte, 64*1024)
+	for req.StartUsn < data.NextUsn {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+
+		var n uint32
+		err := windows.DeviceIoControl(h, fsctlReadUsnJournal,
+			(*byte)(unsafe.Pointer(&req)), uint32(unsafe.Sizeof(req)),
+			&buf[0], uint32(len(buf)), &n, nil)
+		if err != nil {
+			return nil, errors.Wrap(err, "FSCTL_READ_USN_JOURNAL")
+		}
+		if n < 8 {
+			return nil, errors.New("FSCTL_READ_USN_JOURNAL returned no data")
+		}
+
+		// the output starts with the USN to continue from
+		next := int64(binary.LittleEndian.Uint64(buf[:8]))
+		records := buf[8:n]
+		for len(records) > 0 {
+			path, length, err := paths.parseRecord(records)
+			if err != nil {
+				return nil, err
+			}
+			if path != "" {
+				changed = append(changed, path)
+			}
+			records = records[length:]
+		}
+
+		if next <= req.StartUsn {
+			break
+		}
+		req.StartUsn = next
+	}
+
+	return changed, nil
+}
+
+// usnPathResolver determines the paths of the files referenced by USN
+// records. The records only contain the name of the file and the reference
+// number of the directory containing it, the paths of the directories are
+// cached.
+type usnPathResolver struct {
+	volume string
+	handle windows.Handle
+	dirs   map[uint64]string
+}
+
+// parseRecord parses the USN_RECORD_V2 at the start of buf and returns the
+// path of the file and the length of the record. The path is empty if the
+// directory containing the file no longer exists, its removal is contained
+// in a later record. All other errors resolving the directory are returned,
+// the record would be lost otherwise.
+func (r *usnPathResolver) parseRecord(buf []byte) (string, int, error) {
+	if len(buf) < 60 {
+		return "", 0, errors.New("truncated USN record")
+	}
+	length := int(binary.LittleEndian.Uint32(buf[0:4]))
+	major := binary.LittleEndian.Uint16(buf[4:6])
+	if length < 60 || length > len(buf) {
+		return "", 0, errors.Errorf("invalid USN record length %d", length)
+	}
+	if major != 2 {
+		return "", 0, errors.Errorf("unsupported USN record version %d", major)
+	}
+
+	parent := binary.LittleEndian.Uint64(buf[16:24])
+	nameLength := int(binary.LittleEndian.Uint16(buf[56:58]))
+	nameOffset := int(binary.LittleEndian.Uint16(buf[58:60]))
+	if nameOffset+nameLength > length {
+		return "", 0, errors.New("invalid file name in USN record")
+	}
+	name := make([]uint16, nameLength/2)
+	for i := range name {
+		name[i] = binary.LittleEndian.Uint16(buf[nameOffset+2*i:])
+	}
+
+	dir, err := r.dirPath(parent)
+	if isFileIDNotFound(err) {
+		return "", length, nil
+	}
+	if err != nil {
+		return "", 0, err
+	}
+	return filepath.Join(dir, syscall.UTF16ToString(name)), length, nil
+}
+
+// isFileIDNotFound returns true if err reports that the file with the
+// reference number passed to OpenFileById does not exist. A stale reference
+// number is reported as an invalid parameter.
+func isFileIDNotFound(err error) bool {
+	return errors.Is(err, windows.ERROR_FILE_NOT_FOUND) ||
+		errors.Is(err, windows.ERROR_PATH_NOT_FOUND) ||
+		errors.Is(err, windows.ERROR_INVALID_PARAMETER) ||
+		errors.Is(err, windows.ERROR_DELETE_PENDING)
+}
+
+// dirPath returns the path of the directory with the given file reference
+// number.
+func (r *usnPathResolver) dirPath(ref uint64) (string, error) {
+	if path, ok := r.dirs[ref]; ok {
+		return path, nil
+	}
+
+	desc := fileIDDescriptor{FileID: ref}
+	desc.Size = uint32(unsafe.Sizeof(desc))
+	res, _, err := procOpenFileByID.Call(uintptr(r.handle), uintptr(unsafe.Pointer(&desc)), 0,
+		uintptr(windows.FILE_SHARE_READ|windows.FILE_SHARE_WRITE|windows.FILE_SHARE_DELETE),
+		0, uintptr(windows.FILE_FLAG_BACKUP_SEMANTICS))
+	h := windows.Handle(res)
+	if h == windows.InvalidHandle {
+		return "", errors.Wrap(err, "OpenFileById")
+	}
+	defer func() {
+		_ = windows.CloseHandle(h)
+	}()
+
+	buf := make([]uint16, windows.MAX_LONG_PATH)
+	n, err := windows.GetFinalPathNameByHandle(h, &buf[0], uint32(len(buf)), volumeNameDOS)
+	if err != nil {
+		return "", errors.Wrap(err, "GetFinalPathNameByHandle")
+	}
+	path := strings.TrimPrefix(syscall.UTF16ToString(buf[:n]), `\\?\`)
+
+	r.dirs[ref] = path
+	return path, nil
+}
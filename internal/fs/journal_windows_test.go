@@ -0,0 +1,24 @@
+package fs
+
+import (
+	"testing"
+
+	"github.com/restic/restic/internal/errors"
+	rtest "github.com/restic/restic/internal/test"
+	"golang.org/x/sys/windows"
+)
+
+func TestIsFileIDNotFound(t *testing.T) {
+	for _, test := range []struct {
+		err      error
+		notFound bool
+	}{
+		{nil, false},
+		{errors.Wrap(windows.ERROR_INVALID_PARAMETER, "OpenFileById"), true},
+		{errors.Wrap(windows.ERROR_FILE_NOT_FOUND, "OpenFileById"), true},
+		{errors.Wrap(windows.ERROR_ACCESS_DENIED, "OpenFileById"), false},
+		{errors.Wrap(windows.ERROR_NOT_READY, "GetFinalPathNameByHandle"), false},
+	} {
+		rtest.Equals(t, test.notFound, isFileIDNotFound(test.err))
+	}
+}
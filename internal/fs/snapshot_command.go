@@ -0,0 +1,40 @@
+package fs
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"os/exec"
+	"strings"
+
+	"github.com/restic/restic/internal/errors"
+)
+
+// commandRunner runs an external program and returns its standard output.
+type commandRunner func(name string, args ...string) ([]byte, error)
+
+// runCommand runs the program, the error includes the output on stderr.
+func runCommand(name string, args ...string) ([]byte, error) {
+	cmd := exec.Command(name, args...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	out, err := cmd.Output()
+	if err != nil {
+		msg := strings.TrimSpace(stderr.String())
+		if msg != "" {
+			return nil, errors.Errorf("%v %v: %v: %v", name, strings.Join(args, " "), err, msg)
+		}
+		return nil, errors.Errorf("%v %v: %v", name, strings.Join(args, " "), err)
+	}
+	return out, nil
+}
+
+// newSnapshotName returns a random name for a snapshot created by restic.
+func newSnapshotName() (string, error) {
+	buf := make([]byte, 8)
+	if _, err := rand.Read(buf); err != nil {
+		return "", errors.WithStack(err)
+	}
+	return "restic-" + hex.EncodeToString(buf), nil
+}
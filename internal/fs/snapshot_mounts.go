@@ -0,0 +1,112 @@
+package fs
+
+import (
+	"bufio"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/restic/restic/internal/errors"
+)
+
+// mountEntry describes a mounted file system.
+type mountEntry struct {
+	// Dir is the mount point.
+	Dir string
+	// Type is the type of the file system, e.g. "zfs" or "ufs".
+	Type string
+	// Source is the mounted device or dataset.
+	Source string
+}
+
+// findMount returns the entry with the longest mount point containing the
+// absolute path.
+func findMount(mounts []mountEntry, path string) (mountEntry, bool) {
+	var best mountEntry
+	found := false
+	for _, m := range mounts {
+		if !HasPathPrefix(m.Dir, path) {
+			continue
+		}
+		// later entries are mounted over earlier ones with the same mount point
+		if !found || len(m.Dir) >= len(best.Dir) {
+			best = m
+			found = true
+		}
+	}
+	return best, found
+}
+
+// mountTable loads the list of mounted file systems on first use.
+type mountTable struct {
+	load func() ([]mountEntry, error)
+
+	once   sync.Once
+	mounts []mountEntry
+	err    error
+}
+
+// find returns the mount entry which contains the absolute path. If the list
+// of mounts cannot be loaded, no path is found.
+func (t *mountTable) find(path string) (mountEntry, bool) {
+	t.once.Do(func() {
+		t.mounts, t.err = t.load()
+	})
+	if t.err != nil {
+		return mountEntry{}, false
+	}
+	return findMount(t.mounts, path)
+}
+
+// parseMountInfo parses the format of /proc/self/mountinfo on Linux.
+func parseMountInfo(rd io.Reader) ([]mountEntry, error) {
+	var mounts []mountEntry
+
+	sc := bufio.NewScanner(rd)
+	for sc.Scan() {
+		// 36 35 98:0 /mnt1 /mnt2 rw,noatime master:1 - ext3 /dev/root rw,errors=continue
+		fields := strings.Fields(sc.Text())
+		sep := -1
+		for i, f := range fields {
+			if f == "-" {
+				sep = i
+				break
+			}
+		}
+		if sep < 5 || len(fields) < sep+3 {
+			return nil, errors.Errorf("invalid mountinfo line %q", sc.Text())
+		}
+
+		mounts = append(mounts, mountEntry{
+			Dir:    unescapeMountInfo(fields[4]),
+			Type:   fields[sep+1],
+			Source: unescapeMountInfo(fields[sep+2]),
+		})
+	}
+	if err := sc.Err(); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return mounts, nil
+}
+
+// unescapeMountInfo replaces the octal escapes used for spaces and other
+// special characters in mountinfo.
+func unescapeMountInfo(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+4 <= len(s) {
+			if c, err := strconv.ParseUint(s[i+1:i+4], 8, 8); err == nil {
+				b.WriteByte(byte(c))
+				i += 3
+				continue
+			}
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
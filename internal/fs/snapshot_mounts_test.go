@@ -0,0 +1,41 @@
+package fs
+
+import (
+	"strings"
+	"testing"
+
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func TestParseMountInfo(t *testing.T) {
+	mountinfo := `22 1 0:21 / / rw,relatime shared:1 - ext4 /dev/sda1 rw
+36 22 0:30 / /tank rw,noatime shared:12 - zfs tank rw,xattr
+37 36 0:31 / /tank/data\040dir rw,noatime shared:13 master:2 - zfs tank/data rw,xattr
+38 37 0:32 / /tank/data\040dir/tmp rw - tmpfs tmpfs rw
+`
+	mounts, err := parseMountInfo(strings.NewReader(mountinfo))
+	rtest.OK(t, err)
+	rtest.Equals(t, []mountEntry{
+		{Dir: "/", Type: "ext4", Source: "/dev/sda1"},
+		{Dir: "/tank", Type: "zfs", Source: "tank"},
+		{Dir: "/tank/data dir", Type: "zfs", Source: "tank/data"},
+		{Dir: "/tank/data dir/tmp", Type: "tmpfs", Source: "tmpfs"},
+	}, mounts)
+
+	for _, test := range []struct {
+		path, dir string
+	}{
+		{"/etc/passwd", "/"},
+		{"/tank", "/tank"},
+		{"/tank/other", "/tank"},
+		{"/tank/data dir/file", "/tank/data dir"},
+		{"/tank/data dir/tmp/x", "/tank/data dir/tmp"},
+	} {
+		m, ok := findMount(mounts, test.path)
+		rtest.Assert(t, ok, "no mount found for %v", test.path)
+		rtest.Equals(t, test.dir, m.Dir)
+	}
+
+	_, err = parseMountInfo(strings.NewReader("invalid line\n"))
+	rtest.Assert(t, err != nil, "expected error for invalid mountinfo")
+}
@@ -0,0 +1,39 @@
+package fs
+
+import (
+	"golang.org/x/sys/unix"
+
+	"github.com/restic/restic/internal/errors"
+)
+
+// SnapshotProviders returns the providers for filesystem snapshots which are
+// available on this platform.
+func SnapshotProviders(msgError ErrorHandler, msgMessage MessageHandler) ([]SnapshotProvider, error) {
+	mounts := &mountTable{load: loadMounts}
+	return []SnapshotProvider{
+		&zfsProvider{mounts: mounts, run: runCommand},
+		&ufsProvider{mounts: mounts, run: runCommand},
+	}, nil
+}
+
+func loadMounts() ([]mountEntry, error) {
+	n, err := unix.Getfsstat(nil, unix.MNT_NOWAIT)
+	if err != nil {
+		return nil, errors.Wrap(err, "getfsstat")
+	}
+	buf := make([]unix.Statfs_t, n)
+	n, err = unix.Getfsstat(buf, unix.MNT_NOWAIT)
+	if err != nil {
+		return nil, errors.Wrap(err, "getfsstat")
+	}
+
+	mounts := make([]mountEntry, 0, n)
+	for _, st := range buf[:n] {
+		mounts = append(mounts, mountEntry{
+			Dir:    unix.ByteSliceToString(st.Mntonname[:]),
+			Type:   unix.ByteSliceToString(st.Fstypename[:]),
+			Source: unix.ByteSliceToString(st.Mntfromname[:]),
+		})
+	}
+	return mounts, nil
+}
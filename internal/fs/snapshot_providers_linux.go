@@ -0,0 +1,27 @@
+package fs
+
+import (
+	"os"
+
+	"github.com/restic/restic/internal/errors"
+)
+
+// SnapshotProviders returns the providers for filesystem snapshots which are
+// available on this platform.
+func SnapshotProviders(msgError ErrorHandler, msgMessage MessageHandler) ([]SnapshotProvider, error) {
+	mounts := &mountTable{load: loadMountInfo}
+	return []SnapshotProvider{
+		&zfsProvider{mounts: mounts, run: runCommand},
+	}, nil
+}
+
+func loadMountInfo() ([]mountEntry, error) {
+	f, err := os.Open("/proc/self/mountinfo")
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+	return parseMountInfo(f)
+}
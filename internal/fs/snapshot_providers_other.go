@@ -0,0 +1,12 @@
+//go:build !linux && !freebsd && !windows
+// +build !linux,!freebsd,!windows
+
+package fs
+
+import "github.com/restic/restic/internal/errors"
+
+// SnapshotProviders returns the providers for filesystem snapshots which are
+// available on this platform.
+func SnapshotProviders(msgError ErrorHandler, msgMessage MessageHandler) ([]SnapshotProvider, error) {
+	return nil, errors.New("filesystem snapshots are not supported on this platform")
+}
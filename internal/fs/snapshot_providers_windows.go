@@ -0,0 +1,10 @@
+package fs
+
+// SnapshotProviders returns the providers for filesystem snapshots which are
+// available on this platform.
+func SnapshotProviders(msgError ErrorHandler, msgMessage MessageHandler) ([]SnapshotProvider, error) {
+	if err := HasSufficientPrivilegesForVSS(); err != nil {
+		return nil, err
+	}
+	return []SnapshotProvider{NewVssProvider(msgError, msgMessage)}, nil
+}
@@ -0,0 +1,154 @@
+package fs
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/restic/restic/internal/errors"
+)
+
+// ufsProvider creates snapshots of UFS file systems on FreeBSD. A snapshot is
+// created with mksnap_ffs in the .snap directory of the file system, attached
+// as a memory disk and mounted read-only in a temporary directory.
+type ufsProvider struct {
+	mounts *mountTable
+	run    commandRunner
+}
+
+// statically ensure that ufsProvider implements SnapshotProvider and
+// danglingSnapshotFinder.
+var _ SnapshotProvider = &ufsProvider{}
+var _ danglingSnapshotFinder = &ufsProvider{}
+
+func (p *ufsProvider) Name() string {
+	return "ufs"
+}
+
+func (p *ufsProvider) Volume(path string) (string, bool) {
+	m, ok := p.mounts.find(path)
+	if !ok || m.Type != "ufs" {
+		return "", false
+	}
+	return m.Dir, true
+}
+
+func (p *ufsProvider) Create(volume string) (ProviderSnapshot, error) {
+	name, err := newSnapshotName()
+	if err != nil {
+		return nil, err
+	}
+	s := &ufsSnapshot{run: p.run, volume: volume, file: filepath.Join(volume, ".snap", name)}
+
+	// every step is undone by Delete in the reverse order
+	err = s.create()
+	if err != nil {
+		if derr := s.Delete(); derr != nil {
+			return nil, errors.Errorf("%v, cleanup failed: %v", err, derr)
+		}
+		return nil, err
+	}
+	return s, nil
+}
+
+func (p *ufsProvider) Dangling(volume string) ([]string, error) {
+	entries, err := os.ReadDir(filepath.Join(volume, ".snap"))
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	var names []string
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Name(), "restic-") {
+			names = append(names, filepath.Join(volume, ".snap", entry.Name()))
+		}
+	}
+	return names, nil
+}
+
+// ufsSnapshot is a snapshot created by ufsProvider.
+type ufsSnapshot struct {
+	run    commandRunner
+	volume string
+	// file is the snapshot file created by mksnap_ffs
+	file string
+	fi   os.FileInfo
+	// md is the name of the memory disk device, e.g. md0
+	md string
+	// mnt is the directory the snapshot is mounted at
+	mnt string
+}
+
+func (s *ufsSnapshot) create() error {
+	if _, err := s.run("mksnap_ffs", s.file); err != nil {
+		return err
+	}
+	fi, err := os.Lstat(s.file)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	s.fi = fi
+
+	out, err := s.run("mdconfig", "-a", "-t", "vnode", "-o", "readonly", "-f", s.file)
+	if err != nil {
+		return err
+	}
+	s.md = strings.TrimSpace(string(out))
+
+	mnt, err := os.MkdirTemp("", "restic-ufs-")
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if _, err := s.run("mount", "-t", "ufs", "-o", "ro", "/dev/"+s.md, mnt); err != nil {
+		_ = os.Remove(mnt)
+		return err
+	}
+	s.mnt = mnt
+	return nil
+}
+
+func (s *ufsSnapshot) Path(path string) string {
+	rel, err := filepath.Rel(s.volume, path)
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(s.mnt, rel)
+}
+
+func (s *ufsSnapshot) Verify() error {
+	fi, err := os.Lstat(s.file)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if !os.SameFile(fi, s.fi) {
+		return errors.Errorf("snapshot %v was replaced", s.file)
+	}
+	return nil
+}
+
+// Delete unmounts the snapshot, detaches the memory disk and removes the
+// snapshot file. The steps which succeeded are not repeated by later calls.
+func (s *ufsSnapshot) Delete() error {
+	if s.mnt != "" {
+		if _, err := s.run("umount", s.mnt); err != nil {
+			return err
+		}
+		if err := os.Remove(s.mnt); err != nil {
+			return errors.WithStack(err)
+		}
+		s.mnt = ""
+	}
+	if s.md != "" {
+		if _, err := s.run("mdconfig", "-d", "-u", s.md); err != nil {
+			return err
+		}
+		s.md = ""
+	}
+	if s.file != "" {
+		err := os.Remove(s.file)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return errors.WithStack(err)
+		}
+		s.file = ""
+	}
+	return nil
+}
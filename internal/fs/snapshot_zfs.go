@@ -0,0 +1,117 @@
+package fs
+
+import (
+	"path/filepath"
+	"strings"
+
+	"github.com/restic/restic/internal/errors"
+)
+
+// zfsProvider creates snapshots of ZFS datasets, which are accessed via the
+// .zfs/snapshot directory at the mount point of each dataset.
+type zfsProvider struct {
+	mounts *mountTable
+	run    commandRunner
+}
+
+// statically ensure that zfsProvider implements SnapshotProvider and
+// danglingSnapshotFinder.
+var _ SnapshotProvider = &zfsProvider{}
+var _ danglingSnapshotFinder = &zfsProvider{}
+
+func (p *zfsProvider) Name() string {
+	return "zfs"
+}
+
+func (p *zfsProvider) Volume(path string) (string, bool) {
+	m, ok := p.mounts.find(path)
+	if !ok || m.Type != "zfs" {
+		return "", false
+	}
+	return m.Dir, true
+}
+
+func (p *zfsProvider) Create(volume string) (ProviderSnapshot, error) {
+	m, ok := p.mounts.find(volume)
+	if !ok || m.Dir != volume {
+		return nil, errors.Errorf("%v is not the mount point of a ZFS dataset", volume)
+	}
+
+	name, err := newSnapshotName()
+	if err != nil {
+		return nil, err
+	}
+	s := &zfsSnapshot{run: p.run, volume: volume, snapshot: m.Source + "@" + name, name: name}
+
+	if _, err := p.run("zfs", "snapshot", s.snapshot); err != nil {
+		return nil, err
+	}
+	s.guid, err = s.readGUID()
+	if err != nil {
+		_ = s.Delete()
+		return nil, err
+	}
+	return s, nil
+}
+
+func (p *zfsProvider) Dangling(volume string) ([]string, error) {
+	m, ok := p.mounts.find(volume)
+	if !ok || m.Dir != volume {
+		return nil, errors.Errorf("%v is not the mount point of a ZFS dataset", volume)
+	}
+
+	out, err := p.run("zfs", "list", "-H", "-t", "snapshot", "-o", "name", "-d", "1", m.Source)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, name := range strings.Split(string(out), "\n") {
+		if strings.HasPrefix(name, m.Source+"@restic-") {
+			names = append(names, name)
+		}
+	}
+	return names, nil
+}
+
+// zfsSnapshot is a snapshot of a dataset created by zfsProvider.
+type zfsSnapshot struct {
+	run commandRunner
+	// volume is the mount point of the dataset
+	volume string
+	// snapshot is the full name of the snapshot, dataset@name
+	snapshot string
+	name     string
+	guid     string
+}
+
+func (s *zfsSnapshot) readGUID() (string, error) {
+	out, err := s.run("zfs", "get", "-H", "-p", "-o", "value", "guid", s.snapshot)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+func (s *zfsSnapshot) Path(path string) string {
+	rel, err := filepath.Rel(s.volume, path)
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(s.volume, ".zfs", "snapshot", s.name, rel)
+}
+
+func (s *zfsSnapshot) Verify() error {
+	guid, err := s.readGUID()
+	if err != nil {
+		return err
+	}
+	if guid != s.guid {
+		return errors.Errorf("snapshot %v was replaced", s.snapshot)
+	}
+	return nil
+}
+
+func (s *zfsSnapshot) Delete() error {
+	_, err := s.run("zfs", "destroy", s.snapshot)
+	return err
+}
@@ -0,0 +1,69 @@
+package fs
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func TestZFSProvider(t *testing.T) {
+	var commands []string
+	guid := "1234"
+	run := func(name string, args ...string) ([]byte, error) {
+		commands = append(commands, name+" "+strings.Join(args[:len(args)-1], " "))
+		if args[0] == "get" {
+			return []byte(guid + "\n"), nil
+		}
+		return nil, nil
+	}
+
+	mounts := &mountTable{load: func() ([]mountEntry, error) {
+		return []mountEntry{
+			{Dir: "/", Type: "ext4", Source: "/dev/sda1"},
+			{Dir: "/tank", Type: "zfs", Source: "tank/data"},
+		}, nil
+	}}
+	p := &zfsProvider{mounts: mounts, run: run}
+
+	_, ok := p.Volume("/etc/passwd")
+	rtest.Assert(t, !ok, "path on ext4 claimed by zfs provider")
+	volume, ok := p.Volume("/tank/dir/file")
+	rtest.Assert(t, ok, "path on zfs not claimed")
+	rtest.Equals(t, "/tank", volume)
+
+	s, err := p.Create(volume)
+	rtest.OK(t, err)
+	snapshot := s.(*zfsSnapshot)
+	rtest.Assert(t, strings.HasPrefix(snapshot.snapshot, "tank/data@restic-"), "unexpected snapshot name %v", snapshot.snapshot)
+	rtest.Equals(t, filepath.FromSlash("/tank/.zfs/snapshot/"+snapshot.name+"/dir/file"), s.Path("/tank/dir/file"))
+
+	rtest.OK(t, s.Verify())
+	guid = "5678"
+	rtest.Assert(t, s.Verify() != nil, "replaced snapshot not detected")
+
+	rtest.OK(t, s.Delete())
+	rtest.Equals(t, []string{
+		"zfs snapshot",
+		"zfs get -H -p -o value guid",
+		"zfs get -H -p -o value guid",
+		"zfs get -H -p -o value guid",
+		"zfs destroy",
+	}, commands)
+}
+
+func TestZFSProviderDangling(t *testing.T) {
+	run := func(name string, args ...string) ([]byte, error) {
+		rtest.Equals(t, "zfs list -H -t snapshot -o name -d 1 tank/data", name+" "+strings.Join(args, " "))
+		return []byte("tank/data@daily\ntank/data@restic-0123456789abcdef\n"), nil
+	}
+	mounts := &mountTable{load: func() ([]mountEntry, error) {
+		return []mountEntry{{Dir: "/tank", Type: "zfs", Source: "tank/data"}}, nil
+	}}
+	p := &zfsProvider{mounts: mounts, run: run}
+
+	names, err := p.Dangling("/tank")
+	rtest.OK(t, err)
+	rtest.Equals(t, []string{"tank/data@restic-0123456789abcdef"}, names)
+}
@@ -43,6 +43,11 @@ func (p *VssSnapshot) Delete() error {
 	return nil
 }
 
+// Verify checks that the snapshot still exists unchanged.
+func (p *VssSnapshot) Verify() error {
+	return nil
+}
+
 // GetSnapshotDeviceObject returns root path to access the snapshot files
 // and folders.
 func (p *VssSnapshot) GetSnapshotDeviceObject() string {
@@ -940,6 +940,44 @@ func (p *VssSnapshot) Delete() error {
 	return nil
 }
 
+// Verify checks that the snapshot and the snapshots of all mount points still
+// exist and were not replaced by different snapshots since they were created.
+func (p *VssSnapshot) Verify() error {
+	if err := verifySnapshotProperties(p.iVssBackupComponents, p.snapshotID, &p.snapshotProperties); err != nil {
+		return err
+	}
+
+	for mountPoint, info := range p.mountPointInfo {
+		if !info.isSnapshotted {
+			continue
+		}
+		err := verifySnapshotProperties(p.iVssBackupComponents, info.snapshotSetID, &info.snapshotProperties)
+		if err != nil {
+			return errors.Errorf("mount point %s: %v", mountPoint, err)
+		}
+	}
+
+	return nil
+}
+
+// verifySnapshotProperties queries the properties of the snapshot with the
+// given id and compares them to the properties queried after creating it.
+func verifySnapshotProperties(vss *IVssBackupComponents, id ole.GUID, created *VssSnapshotProperties) error {
+	var properties VssSnapshotProperties
+	if err := vss.GetSnapshotProperties(id, &properties); err != nil {
+		return errors.Errorf("snapshot no longer exists: %v", err)
+	}
+	defer func() {
+		_ = vssFreeSnapshotProperties(&properties)
+	}()
+
+	if !ole.IsEqualGUID(&properties.snapshotID, &created.snapshotID) ||
+		properties.creationTimestamp != created.creationTimestamp {
+		return errors.New("snapshot was replaced by a different snapshot")
+	}
+	return nil
+}
+
 // asyncCallFunc is the callback type for callAsyncFunctionAndWait.
 type asyncCallFunc func() (*IVSSAsync, error)
 
@@ -8,6 +8,7 @@ import (
 	"context"
 	"math/rand"
 	"os"
+	"syscall"
 	"testing"
 	"time"
 
@@ -176,6 +177,61 @@ func TestFuseDir(t *testing.T) {
 	rtest.Equals(t, node.ModTime, attr.Mtime)
 }
 
+func TestFuseXattr(t *testing.T) {
+	ctx := context.TODO()
+	root := &Root{}
+	acl := []byte{2, 0, 0, 0, 1, 0, 6, 0, 0xff, 0xff, 0xff, 0xff}
+	node := &restic.Node{
+		Name: "foo",
+		ExtendedAttributes: []restic.ExtendedAttribute{
+			{Name: "user.comment", Value: []byte("hello")},
+			{Name: "system.posix_acl_access", Value: acl},
+			{Name: "user.empty", Value: []byte{}},
+		},
+	}
+
+	type xattrNode interface {
+		fs.NodeListxattrer
+		fs.NodeGetxattrer
+	}
+
+	f, err := newFile(root, 1, node)
+	rtest.OK(t, err)
+	d, err := newDir(root, 2, 1, node)
+	rtest.OK(t, err)
+	l, err := newLink(root, 3, node)
+	rtest.OK(t, err)
+	o, err := newOther(root, 4, node)
+	rtest.OK(t, err)
+
+	for _, n := range []xattrNode{f, d, l, o} {
+		listResp := &fuse.ListxattrResponse{}
+		rtest.OK(t, n.Listxattr(ctx, &fuse.ListxattrRequest{}, listResp))
+		rtest.Equals(t, []byte("user.comment\x00system.posix_acl_access\x00user.empty\x00"), listResp.Xattr)
+
+		err = n.Listxattr(ctx, &fuse.ListxattrRequest{Size: 10}, &fuse.ListxattrResponse{})
+		rtest.Equals(t, fuse.Errno(syscall.ERANGE), err)
+
+		getResp := &fuse.GetxattrResponse{}
+		rtest.OK(t, n.Getxattr(ctx, &fuse.GetxattrRequest{Name: "system.posix_acl_access", Size: 100}, getResp))
+		rtest.Equals(t, acl, getResp.Xattr)
+
+		getResp = &fuse.GetxattrResponse{}
+		rtest.OK(t, n.Getxattr(ctx, &fuse.GetxattrRequest{Name: "user.comment", Position: 2}, getResp))
+		rtest.Equals(t, []byte("llo"), getResp.Xattr)
+
+		getResp = &fuse.GetxattrResponse{}
+		rtest.OK(t, n.Getxattr(ctx, &fuse.GetxattrRequest{Name: "user.empty"}, getResp))
+		rtest.Equals(t, 0, len(getResp.Xattr))
+
+		err = n.Getxattr(ctx, &fuse.GetxattrRequest{Name: "user.comment", Size: 2}, &fuse.GetxattrResponse{})
+		rtest.Equals(t, fuse.Errno(syscall.ERANGE), err)
+
+		err = n.Getxattr(ctx, &fuse.GetxattrRequest{Name: "user.missing"}, &fuse.GetxattrResponse{})
+		rtest.Equals(t, fuse.ErrNoXattr, err)
+	}
+}
+
 // Test top-level directories for their UID and GID.
 func TestTopUIDGID(t *testing.T) {
 	repo := repository.TestRepository(t)
@@ -7,9 +7,14 @@ import (
 	"context"
 
 	"github.com/anacrolix/fuse"
+	"github.com/anacrolix/fuse/fs"
 	"github.com/restic/restic/internal/restic"
 )
 
+// Statically ensure that *other implements the given interfaces
+var _ = fs.NodeListxattrer(&other{})
+var _ = fs.NodeGetxattrer(&other{})
+
 type other struct {
 	root  *Root
 	node  *restic.Node
@@ -40,3 +45,11 @@ func (l *other) Attr(ctx context.Context, a *fuse.Attr) error {
 
 	return nil
 }
+
+func (l *other) Listxattr(ctx context.Context, req *fuse.ListxattrRequest, resp *fuse.ListxattrResponse) error {
+	return nodeListxattr(l.node, req, resp)
+}
+
+func (l *other) Getxattr(ctx context.Context, req *fuse.GetxattrRequest, resp *fuse.GetxattrResponse) error {
+	return nodeGetxattr(l.node, req, resp)
+}
@@ -19,6 +19,7 @@ type Config struct {
 	Hosts         []string
 	Tags          []restic.TagList
 	Paths         []string
+	TimeRange     restic.TimeRange
 	TimeTemplate  string
 	PathTemplates []string
 }
@@ -0,0 +1,56 @@
+//go:build darwin || freebsd || linux
+// +build darwin freebsd linux
+
+package fuse
+
+import (
+	"syscall"
+
+	"github.com/anacrolix/fuse"
+
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/restic"
+)
+
+// nodeListxattr returns the names of the extended attributes stored for node.
+// This includes POSIX ACLs, which are stored as the extended attributes
+// system.posix_acl_access and system.posix_acl_default on Linux.
+func nodeListxattr(node *restic.Node, req *fuse.ListxattrRequest, resp *fuse.ListxattrResponse) error {
+	debug.Log("Listxattr(%v, %v)", node.Name, req.Size)
+	for _, attr := range node.ExtendedAttributes {
+		resp.Append(attr.Name)
+	}
+
+	// a size of zero only queries the size of the list
+	if req.Size != 0 && len(resp.Xattr) > int(req.Size) {
+		return fuse.Errno(syscall.ERANGE)
+	}
+	return nil
+}
+
+// nodeGetxattr returns the value of the extended attribute req.Name of node.
+func nodeGetxattr(node *restic.Node, req *fuse.GetxattrRequest, resp *fuse.GetxattrResponse) error {
+	debug.Log("Getxattr(%v, %v, %v)", node.Name, req.Name, req.Size)
+	for _, attr := range node.ExtendedAttributes {
+		if attr.Name != req.Name {
+			continue
+		}
+
+		value := attr.Value
+		// macOS reads resource forks in chunks starting at the position
+		if req.Position > 0 {
+			if int(req.Position) > len(value) {
+				return fuse.Errno(syscall.EINVAL)
+			}
+			value = value[req.Position:]
+		}
+
+		// a size of zero only queries the size of the value
+		if req.Size != 0 && len(value) > int(req.Size) {
+			return fuse.Errno(syscall.ERANGE)
+		}
+		resp.Xattr = value
+		return nil
+	}
+	return fuse.ErrNoXattr
+}
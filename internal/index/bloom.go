@@ -0,0 +1,63 @@
+package index
+
+import (
+	"encoding/binary"
+
+	"github.com/restic/restic/internal/restic"
+)
+
+// The parameters of blobFilter yield a false positive rate of about 1e-5.
+// For a blob which is not contained in the repository, each index file with a
+// filter has this chance of being loaded unnecessarily, so the rate must be
+// low enough even for repositories with thousands of index files.
+const (
+	filterBitsPerBlob = 24
+	filterHashes      = 16
+)
+
+// blobFilter is a bloom filter for blob IDs. As blob IDs are SHA-256 hashes,
+// the positions of the bits are derived directly from the ID.
+type blobFilter struct {
+	bits []uint64
+}
+
+// newBlobFilter returns a filter for n blobs.
+func newBlobFilter(n uint) *blobFilter {
+	words := (n*filterBitsPerBlob + 63) / 64
+	if words == 0 {
+		words = 1
+	}
+	return &blobFilter{bits: make([]uint64, words)}
+}
+
+func (f *blobFilter) positions(id restic.ID, fn func(word int, mask uint64) bool) {
+	// double hashing, h2 must be odd so that all positions are distinct
+	h1 := binary.LittleEndian.Uint64(id[0:8])
+	h2 := binary.LittleEndian.Uint64(id[8:16]) | 1
+	size := uint64(len(f.bits)) * 64
+
+	for i := uint64(0); i < filterHashes; i++ {
+		pos := (h1 + i*h2) % size
+		if !fn(int(pos/64), 1<<(pos%64)) {
+			return
+		}
+	}
+}
+
+// add inserts id into the filter.
+func (f *blobFilter) add(id restic.ID) {
+	f.positions(id, func(word int, mask uint64) bool {
+		f.bits[word] |= mask
+		return true
+	})
+}
+
+// mayContain returns false if id was definitely not added to the filter.
+func (f *blobFilter) mayContain(id restic.ID) bool {
+	found := true
+	f.positions(id, func(word int, mask uint64) bool {
+		found = f.bits[word]&mask != 0
+		return found
+	})
+	return found
+}
@@ -0,0 +1,43 @@
+package index
+
+import (
+	"testing"
+
+	"github.com/restic/restic/internal/restic"
+)
+
+func TestBlobFilter(t *testing.T) {
+	const n = 10000
+
+	ids := make(restic.IDs, 0, n)
+	f := newBlobFilter(n)
+	for i := 0; i < n; i++ {
+		id := restic.NewRandomID()
+		ids = append(ids, id)
+		f.add(id)
+	}
+
+	for _, id := range ids {
+		if !f.mayContain(id) {
+			t.Fatalf("filter does not contain %v", id)
+		}
+	}
+
+	falsePositives := 0
+	for i := 0; i < 10*n; i++ {
+		if f.mayContain(restic.NewRandomID()) {
+			falsePositives++
+		}
+	}
+	// the expected number of false positives is about one
+	if falsePositives > 10 {
+		t.Fatalf("too many false positives: %v", falsePositives)
+	}
+}
+
+func TestBlobFilterEmpty(t *testing.T) {
+	f := newBlobFilter(0)
+	if f.mayContain(restic.NewRandomID()) {
+		t.Fatal("empty filter contains an ID")
+	}
+}
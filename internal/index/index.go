@@ -51,6 +51,39 @@ type Index struct {
 	ids        restic.IDs // set to the IDs of the contained finalized indexes
 	supersedes restic.IDs
 	created    time.Time
+
+	// dataFilter is only set if the data blobs of the index were removed by
+	// dropDataBlobs, it contains all removed data blobs.
+	dataFilter *blobFilter
+	dataCount  uint
+}
+
+// BlobTotals describes the number and size of the blobs of one type.
+type BlobTotals struct {
+	Count uint
+	// Size is the size of the blobs as stored in the repository.
+	Size uint64
+	// UncompressedSize is the size of the blobs before compression.
+	UncompressedSize uint64
+}
+
+func (t *BlobTotals) add(length, uncompressedLength uint32) {
+	t.Count++
+	t.Size += uint64(length)
+	t.UncompressedSize += plaintextSize(length, uncompressedLength)
+}
+
+func (t *BlobTotals) sub(length, uncompressedLength uint32) {
+	t.Count--
+	t.Size -= uint64(length)
+	t.UncompressedSize -= plaintextSize(length, uncompressedLength)
+}
+
+func plaintextSize(length, uncompressedLength uint32) uint64 {
+	if uncompressedLength != 0 {
+		return uint64(uncompressedLength)
+	}
+	return uint64(crypto.PlaintextLength(int(length)))
 }
 
 // NewIndex returns a new index.
@@ -79,6 +112,34 @@ func (idx *Index) store(packIndex int, blob restic.Blob) {
 	m.add(blob.ID, packIndex, uint32(blob.Offset), uint32(blob.Length), uint32(blob.UncompressedLength))
 }
 
+// blobCount returns the number of blobs of type t in the index, including the
+// data blobs removed by dropDataBlobs.
+func (idx *Index) blobCount(t restic.BlobType) uint {
+	idx.m.Lock()
+	defer idx.m.Unlock()
+
+	n := idx.byType[t].len()
+	if t == restic.DataBlob {
+		n += idx.dataCount
+	}
+	return n
+}
+
+// eachEntry calls fn for all blobs of type t kept in memory which are not
+// stored in one of the packs in ignorePacks. fn must not call any method of
+// the index.
+func (idx *Index) eachEntry(t restic.BlobType, ignorePacks restic.IDSet, fn func(e *indexEntry)) {
+	idx.m.Lock()
+	defer idx.m.Unlock()
+
+	idx.byType[t].foreach(func(e *indexEntry) bool {
+		if !ignorePacks.Has(idx.packs[e.packIndex]) {
+			fn(e)
+		}
+		return true
+	})
+}
+
 // Final returns true iff the index is already written to the repository, it is
 // finalized.
 func (idx *Index) Final() bool {
@@ -196,6 +257,46 @@ func (idx *Index) LookupSize(bh restic.BlobHandle) (plaintextLength uint, found
 	return uint(crypto.PlaintextLength(int(e.length))), true
 }
 
+// dropDataBlobs removes the data blobs of the final index from memory and only
+// keeps a filter of them. Packs which only contain data blobs are still
+// returned by Packs.
+func (idx *Index) dropDataBlobs() {
+	idx.m.Lock()
+	defer idx.m.Unlock()
+
+	if !idx.final {
+		panic("drop data blobs of index which is not final")
+	}
+
+	m := &idx.byType[restic.DataBlob]
+	filter := newBlobFilter(m.len())
+	m.foreach(func(e *indexEntry) bool {
+		filter.add(e.id)
+		return true
+	})
+
+	idx.dataCount = m.len()
+	idx.byType[restic.DataBlob] = indexMap{}
+	idx.dataFilter = filter
+}
+
+// lazy returns true if the data blobs of the index were dropped.
+func (idx *Index) lazy() bool {
+	idx.m.Lock()
+	defer idx.m.Unlock()
+
+	return idx.dataFilter != nil
+}
+
+// mayContainData returns true if the data blobs of the index were dropped
+// and the blob with the given id may have been one of them.
+func (idx *Index) mayContainData(id restic.ID) bool {
+	idx.m.Lock()
+	defer idx.m.Unlock()
+
+	return idx.dataFilter != nil && idx.dataFilter.mayContain(id)
+}
+
 // Supersedes returns the list of indexes this index supersedes, if any.
 func (idx *Index) Supersedes() restic.IDs {
 	return idx.supersedes
@@ -8,6 +8,7 @@ import (
 	"sync"
 
 	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
 	"github.com/restic/restic/internal/restic"
 	"github.com/restic/restic/internal/ui/progress"
 	"golang.org/x/sync/errgroup"
@@ -19,8 +20,35 @@ type MasterIndex struct {
 	pendingBlobs restic.BlobSet
 	idxMutex     sync.RWMutex
 	compress     bool
+
+	// loadIndex is only set if the data blobs of final indexes are not kept
+	// in memory, see UseLazyDataBlobs. loadCtx is the context used for
+	// loading them.
+	loadIndex  LoadIndexFn
+	loadCtx    context.Context
+	shardMutex sync.Mutex
+	// shards caches the most recently loaded lazy indexes, most recent first
+	shards []*lazyShard
+	// loadErr is the first error which occurred while loading a lazy index
+	loadErr error
+}
+
+// LoadIndexFn loads and decodes the index file with the given ID.
+type LoadIndexFn func(ctx context.Context, id restic.ID) (*Index, error)
+
+// lazyShard is the complete index loaded for an index whose data blobs were
+// dropped. full and err are only valid after done is closed.
+type lazyShard struct {
+	lazy, full *Index
+	err        error
+	done       chan struct{}
 }
 
+// lazyShardCacheSize is the number of loaded lazy indexes kept in memory.
+// Blobs saved by the same backup are usually contained in the same index
+// files, so a few indexes suffice to avoid loading them again and again.
+const lazyShardCacheSize = 4
+
 // NewMasterIndex creates a new master index.
 func NewMasterIndex() *MasterIndex {
 	// Always add an empty final index, such that MergeFinalIndexes can merge into this.
@@ -35,14 +63,147 @@ func (mi *MasterIndex) MarkCompressed() {
 	mi.compress = true
 }
 
+// UseLazyDataBlobs configures the master index to only keep a filter of the
+// data blobs of all indexes inserted afterwards which were loaded from the
+// repository. If such an index may contain a data blob, its index file is
+// loaded again using load with the context ctx.
+//
+// This reduces the memory usage for large repositories considerably, in
+// exchange for repeatedly loading index files. It is intended for backups.
+// The master index cannot be saved using Save afterwards. Errors which occur
+// while loading an index file are returned by LazyError.
+func (mi *MasterIndex) UseLazyDataBlobs(ctx context.Context, load LoadIndexFn) {
+	mi.idxMutex.Lock()
+	defer mi.idxMutex.Unlock()
+
+	mi.loadIndex = load
+	mi.loadCtx = ctx
+}
+
+// LazyError returns the first error which occurred while loading an index
+// file for a lazy index. Until it returns nil, the results of Has, Lookup,
+// LookupSize and AddPending may miss data blobs.
+func (mi *MasterIndex) LazyError() error {
+	mi.shardMutex.Lock()
+	defer mi.shardMutex.Unlock()
+
+	return mi.loadErr
+}
+
+// loadShard returns the complete index for the lazy index idx. The index file
+// is loaded without holding any lock, concurrent calls for the same index
+// wait for the first one.
+func (mi *MasterIndex) loadShard(idx *Index) (*Index, error) {
+	mi.shardMutex.Lock()
+	for i, shard := range mi.shards {
+		if shard.lazy == idx {
+			copy(mi.shards[1:i+1], mi.shards[:i])
+			mi.shards[0] = shard
+			mi.shardMutex.Unlock()
+
+			<-shard.done
+			return shard.full, shard.err
+		}
+	}
+
+	shard := &lazyShard{lazy: idx, done: make(chan struct{})}
+	mi.shards = append([]*lazyShard{shard}, mi.shards...)
+	if len(mi.shards) > lazyShardCacheSize {
+		mi.shards = mi.shards[:lazyShardCacheSize]
+	}
+	mi.shardMutex.Unlock()
+
+	ids, err := idx.IDs()
+	if err == nil {
+		debug.Log("loading index %v", ids[0])
+		shard.full, err = mi.loadIndex(mi.loadCtx, ids[0])
+	}
+	shard.err = err
+	close(shard.done)
+
+	if err != nil {
+		mi.shardMutex.Lock()
+		// do not cache the error, so that the index is loaded again
+		for i, s := range mi.shards {
+			if s == shard {
+				mi.shards = append(mi.shards[:i], mi.shards[i+1:]...)
+				break
+			}
+		}
+		mi.shardMutex.Unlock()
+		mi.setLazyError(err)
+	}
+	return shard.full, err
+}
+
+// setLazyError records err as the result of LazyError, unless an error was
+// already recorded.
+func (mi *MasterIndex) setLazyError(err error) {
+	mi.shardMutex.Lock()
+	defer mi.shardMutex.Unlock()
+
+	if mi.loadErr == nil {
+		mi.loadErr = err
+	}
+}
+
+// shardCandidates returns the lazy indexes which may contain the data blob.
+// The caller must hold idxMutex, the indexes must be loaded using eachShard
+// after releasing it.
+func (mi *MasterIndex) shardCandidates(bh restic.BlobHandle) []*Index {
+	if bh.Type != restic.DataBlob {
+		return nil
+	}
+
+	var candidates []*Index
+	for _, idx := range mi.idx {
+		if idx.mayContainData(bh.ID) {
+			candidates = append(candidates, idx)
+		}
+	}
+	return candidates
+}
+
+// eachShard calls fn with the complete index for each of the lazy indexes
+// until fn returns false. The caller must not hold idxMutex. Indexes which
+// cannot be loaded are skipped, the error is returned by LazyError.
+func (mi *MasterIndex) eachShard(candidates []*Index, fn func(*Index) bool) {
+	for _, idx := range candidates {
+		full, err := mi.loadShard(idx)
+		if err != nil {
+			debug.Log("unable to load index: %v", err)
+			continue
+		}
+		if !fn(full) {
+			return
+		}
+	}
+}
+
+// hasShard returns true if the data blob is contained in one of the lazy
+// indexes. The caller must not hold idxMutex.
+func (mi *MasterIndex) hasShard(candidates []*Index, bh restic.BlobHandle) bool {
+	found := false
+	mi.eachShard(candidates, func(idx *Index) bool {
+		found = idx.Has(bh)
+		return !found
+	})
+	return found
+}
+
 // Lookup queries all known Indexes for the ID and returns all matches.
 func (mi *MasterIndex) Lookup(bh restic.BlobHandle) (pbs []restic.PackedBlob) {
 	mi.idxMutex.RLock()
-	defer mi.idxMutex.RUnlock()
-
 	for _, idx := range mi.idx {
 		pbs = idx.Lookup(bh, pbs)
 	}
+	candidates := mi.shardCandidates(bh)
+	mi.idxMutex.RUnlock()
+
+	mi.eachShard(candidates, func(idx *Index) bool {
+		pbs = idx.Lookup(bh, pbs)
+		return true
+	})
 
 	return pbs
 }
@@ -50,15 +211,23 @@ func (mi *MasterIndex) Lookup(bh restic.BlobHandle) (pbs []restic.PackedBlob) {
 // LookupSize queries all known Indexes for the ID and returns the first match.
 func (mi *MasterIndex) LookupSize(bh restic.BlobHandle) (uint, bool) {
 	mi.idxMutex.RLock()
-	defer mi.idxMutex.RUnlock()
-
 	for _, idx := range mi.idx {
 		if size, found := idx.LookupSize(bh); found {
+			mi.idxMutex.RUnlock()
 			return size, found
 		}
 	}
+	candidates := mi.shardCandidates(bh)
+	mi.idxMutex.RUnlock()
+
+	var size uint
+	var found bool
+	mi.eachShard(candidates, func(idx *Index) bool {
+		size, found = idx.LookupSize(bh)
+		return !found
+	})
 
-	return 0, false
+	return size, found
 }
 
 // AddPending adds a given blob to list of pending Blobs
@@ -66,44 +235,64 @@ func (mi *MasterIndex) LookupSize(bh restic.BlobHandle) (uint, bool) {
 // Returns true if adding was successful and false if the blob
 // was already known
 func (mi *MasterIndex) AddPending(bh restic.BlobHandle) bool {
+	mi.idxMutex.Lock()
+	known, candidates := mi.knownInMemory(bh)
+	if known {
+		mi.idxMutex.Unlock()
+		return false
+	}
+	if len(candidates) == 0 {
+		mi.pendingBlobs.Insert(bh)
+		mi.idxMutex.Unlock()
+		return true
+	}
+	mi.idxMutex.Unlock()
+
+	if mi.hasShard(candidates, bh) {
+		return false
+	}
 
 	mi.idxMutex.Lock()
 	defer mi.idxMutex.Unlock()
 
-	// Check if blob is pending or in index
-	if mi.pendingBlobs.Has(bh) {
+	// the blob may have been added while the lazy indexes were loaded
+	if known, _ := mi.knownInMemory(bh); known {
 		return false
 	}
 
+	// really not known -> insert
+	mi.pendingBlobs.Insert(bh)
+	return true
+}
+
+// knownInMemory returns true if the blob is pending or contained in one of the
+// indexes kept in memory. Otherwise, it returns the lazy indexes which may
+// contain it. The caller must hold idxMutex.
+func (mi *MasterIndex) knownInMemory(bh restic.BlobHandle) (bool, []*Index) {
+	if mi.pendingBlobs.Has(bh) {
+		return true, nil
+	}
+
 	for _, idx := range mi.idx {
 		if idx.Has(bh) {
-			return false
+			return true, nil
 		}
 	}
 
-	// really not known -> insert
-	mi.pendingBlobs.Insert(bh)
-	return true
+	return false, mi.shardCandidates(bh)
 }
 
 // Has queries all known Indexes for the ID and returns the first match.
 // Also returns true if the ID is pending.
 func (mi *MasterIndex) Has(bh restic.BlobHandle) bool {
 	mi.idxMutex.RLock()
-	defer mi.idxMutex.RUnlock()
+	known, candidates := mi.knownInMemory(bh)
+	mi.idxMutex.RUnlock()
 
-	// also return true if blob is pending
-	if mi.pendingBlobs.Has(bh) {
+	if known {
 		return true
 	}
-
-	for _, idx := range mi.idx {
-		if idx.Has(bh) {
-			return true
-		}
-	}
-
-	return false
+	return mi.hasShard(candidates, bh)
 }
 
 // IDs returns the IDs of all indexes contained in the index.
@@ -152,6 +341,10 @@ func (mi *MasterIndex) Insert(idx *Index) {
 	mi.idxMutex.Lock()
 	defer mi.idxMutex.Unlock()
 
+	if ids, _ := idx.IDs(); mi.loadIndex != nil && len(ids) == 1 {
+		idx.dropDataBlobs()
+	}
+
 	mi.idx = append(mi.idx, idx)
 }
 
@@ -230,7 +423,96 @@ func (mi *MasterIndex) Each(ctx context.Context, fn func(restic.PackedBlob)) {
 
 	for _, idx := range mi.idx {
 		idx.Each(ctx, fn)
+
+		if !idx.lazy() {
+			continue
+		}
+		// the index is loaded only temporarily, to not replace the
+		// cached indexes used for lookups
+		ids, err := idx.IDs()
+		if err == nil {
+			var full *Index
+			full, err = mi.loadIndex(ctx, ids[0])
+			if err == nil {
+				full.Each(ctx, func(pb restic.PackedBlob) {
+					if pb.Type == restic.DataBlob {
+						fn(pb)
+					}
+				})
+			}
+		}
+		if err != nil {
+			debug.Log("unable to load index: %v", err)
+			mi.setLazyError(err)
+		}
+	}
+}
+
+// Totals returns the number and size of the blobs of type t in all indexes.
+// Each blob is counted once, even if it is contained in several indexes or
+// packs. Blobs stored in one of the packs in ignorePacks are not counted.
+// Lazily loaded indexes have to be loaded to iterate over their data blobs.
+func (mi *MasterIndex) Totals(t restic.BlobType, ignorePacks restic.IDSet) BlobTotals {
+	mi.idxMutex.RLock()
+	indexes := append([]*Index(nil), mi.idx...)
+	mi.idxMutex.RUnlock()
+
+	each := func(fn func(e *indexEntry)) {
+		for _, idx := range indexes {
+			idx.eachEntry(t, ignorePacks, fn)
+			if t != restic.DataBlob || !idx.lazy() {
+				continue
+			}
+			// like in Each, the index is loaded only temporarily
+			ids, err := idx.IDs()
+			if err == nil {
+				var full *Index
+				full, err = mi.loadIndex(mi.loadCtx, ids[0])
+				if err == nil {
+					full.eachEntry(t, ignorePacks, fn)
+				}
+			}
+			if err != nil {
+				debug.Log("unable to load index: %v", err)
+				mi.setLazyError(err)
+			}
+		}
 	}
+
+	var n uint
+	for _, idx := range indexes {
+		n += idx.blobCount(t)
+	}
+
+	// blobs which may have been seen before are collected and checked
+	// exactly in a second pass
+	filter := newBlobFilter(n)
+	duplicates := restic.NewIDSet()
+	var totals BlobTotals
+	each(func(e *indexEntry) {
+		if filter.mayContain(e.id) {
+			duplicates.Insert(e.id)
+		} else {
+			filter.add(e.id)
+		}
+		totals.add(e.length, e.uncompressedLength)
+	})
+	if len(duplicates) == 0 {
+		return totals
+	}
+
+	seen := restic.NewIDSet()
+	each(func(e *indexEntry) {
+		if !duplicates.Has(e.id) {
+			return
+		}
+		if seen.Has(e.id) {
+			totals.sub(e.length, e.uncompressedLength)
+		} else {
+			seen.Insert(e.id)
+		}
+	})
+	return totals
 }
 
 // MergeFinalIndexes merges all final indexes together.
@@ -249,9 +531,9 @@ func (mi *MasterIndex) MergeFinalIndexes() error {
 		idx := mi.idx[i]
 		// clear reference in masterindex as it may become stale
 		mi.idx[i] = nil
-		// do not merge indexes that have no id set
+		// do not merge indexes that have no id set or which are loaded lazily
 		ids, _ := idx.IDs()
-		if !idx.Final() || len(ids) == 0 {
+		if !idx.Final() || len(ids) == 0 || idx.lazy() {
 			newIdx = append(newIdx, idx)
 		} else {
 			err := mi.idx[0].merge(idx)
@@ -271,6 +553,10 @@ func (mi *MasterIndex) MergeFinalIndexes() error {
 // field. The IDs are also returned in the IDSet obsolete.
 // After calling this function, you should remove the obsolete index files.
 func (mi *MasterIndex) Save(ctx context.Context, repo restic.SaverUnpacked, packBlacklist restic.IDSet, extraObsolete restic.IDs, p *progress.Counter) (obsolete restic.IDSet, err error) {
+	if mi.loadIndex != nil {
+		return nil, errors.New("cannot save an index whose data blobs are loaded lazily")
+	}
+
 	p.SetMax(uint64(len(mi.Packs(packBlacklist))))
 
 	mi.idxMutex.Lock()
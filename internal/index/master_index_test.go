@@ -1,6 +1,7 @@
 package index_test
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 	"math/rand"
@@ -9,6 +10,7 @@ import (
 
 	"github.com/restic/restic/internal/checker"
 	"github.com/restic/restic/internal/crypto"
+	"github.com/restic/restic/internal/errors"
 	"github.com/restic/restic/internal/index"
 	"github.com/restic/restic/internal/repository"
 	"github.com/restic/restic/internal/restic"
@@ -126,6 +128,121 @@ func TestMasterIndex(t *testing.T) {
 	rtest.Assert(t, !found, "Expected no blobs when fetching with a random id")
 }
 
+func TestMasterIndexLazyDataBlobs(t *testing.T) {
+	dataBlob := restic.PackedBlob{
+		PackID: restic.NewRandomID(),
+		Blob: restic.Blob{
+			BlobHandle:         restic.NewRandomBlobHandle(),
+			Length:             uint(crypto.CiphertextLength(100)),
+			UncompressedLength: 200,
+		},
+	}
+	treeBlob := restic.PackedBlob{
+		PackID: restic.NewRandomID(),
+		Blob: restic.Blob{
+			BlobHandle: restic.BlobHandle{ID: restic.NewRandomID(), Type: restic.TreeBlob},
+			Length:     uint(crypto.CiphertextLength(123)),
+		},
+	}
+
+	idx := index.NewIndex()
+	idx.StorePack(dataBlob.PackID, []restic.Blob{dataBlob.Blob})
+	idx.StorePack(treeBlob.PackID, []restic.Blob{treeBlob.Blob})
+	buf := new(bytes.Buffer)
+	rtest.OK(t, idx.Encode(buf))
+
+	id := restic.NewRandomID()
+	loads := 0
+	load := func(ctx context.Context, loadID restic.ID) (*index.Index, error) {
+		rtest.Equals(t, id, loadID)
+		loads++
+		idx, _, err := index.DecodeIndex(buf.Bytes(), loadID)
+		return idx, err
+	}
+
+	decoded, _, err := index.DecodeIndex(buf.Bytes(), id)
+	rtest.OK(t, err)
+
+	mIdx := index.NewMasterIndex()
+	mIdx.UseLazyDataBlobs(context.TODO(), load)
+	mIdx.Insert(decoded)
+	rtest.OK(t, mIdx.MergeFinalIndexes())
+
+	// tree blobs are kept in memory
+	rtest.Equals(t, true, mIdx.Has(treeBlob.BlobHandle))
+	rtest.Equals(t, []restic.PackedBlob{treeBlob}, mIdx.Lookup(treeBlob.BlobHandle))
+	rtest.Equals(t, 0, loads)
+
+	rtest.Equals(t, index.BlobTotals{Count: 1, Size: uint64(treeBlob.Length), UncompressedSize: 123},
+		mIdx.Totals(restic.TreeBlob, nil))
+	rtest.Equals(t, index.BlobTotals{}, mIdx.Totals(restic.TreeBlob, restic.NewIDSet(treeBlob.PackID)))
+	rtest.Equals(t, 0, loads)
+
+	// the filter rules out unknown blobs
+	rtest.Equals(t, false, mIdx.Has(restic.NewRandomBlobHandle()))
+	rtest.Equals(t, 0, loads)
+
+	rtest.Equals(t, true, mIdx.Has(dataBlob.BlobHandle))
+	rtest.Equals(t, []restic.PackedBlob{dataBlob}, mIdx.Lookup(dataBlob.BlobHandle))
+	size, found := mIdx.LookupSize(dataBlob.BlobHandle)
+	rtest.Equals(t, true, found)
+	rtest.Equals(t, uint(200), size)
+	rtest.Equals(t, false, mIdx.AddPending(dataBlob.BlobHandle))
+	// the loaded index is cached
+	rtest.Equals(t, 1, loads)
+
+	blobs := restic.NewBlobSet()
+	mIdx.Each(context.TODO(), func(pb restic.PackedBlob) {
+		blobs.Insert(pb.BlobHandle)
+	})
+	rtest.Equals(t, restic.NewBlobSet(dataBlob.BlobHandle, treeBlob.BlobHandle), blobs)
+
+	// the totals include the dropped data blobs
+	rtest.Equals(t, index.BlobTotals{Count: 1, Size: uint64(dataBlob.Length), UncompressedSize: 200},
+		mIdx.Totals(restic.DataBlob, nil))
+	rtest.Equals(t, index.BlobTotals{}, mIdx.Totals(restic.DataBlob, restic.NewIDSet(dataBlob.PackID)))
+	// like Each, the totals load the index temporarily
+	rtest.Equals(t, 4, loads)
+
+	_, err = mIdx.Save(context.TODO(), nil, nil, nil, nil)
+	rtest.Assert(t, err != nil, "saving an index with lazy data blobs did not fail")
+}
+
+func TestMasterIndexLazyDataBlobsError(t *testing.T) {
+	dataBlob := restic.PackedBlob{
+		PackID: restic.NewRandomID(),
+		Blob: restic.Blob{
+			BlobHandle: restic.NewRandomBlobHandle(),
+			Length:     uint(crypto.CiphertextLength(100)),
+		},
+	}
+
+	idx := index.NewIndex()
+	idx.StorePack(dataBlob.PackID, []restic.Blob{dataBlob.Blob})
+	buf := new(bytes.Buffer)
+	rtest.OK(t, idx.Encode(buf))
+	decoded, _, err := index.DecodeIndex(buf.Bytes(), restic.NewRandomID())
+	rtest.OK(t, err)
+
+	type ctxKey struct{}
+	ctx := context.WithValue(context.TODO(), ctxKey{}, "backup")
+	loadErr := errors.New("load failed")
+	load := func(loadCtx context.Context, id restic.ID) (*index.Index, error) {
+		// the index is loaded using the context passed to UseLazyDataBlobs
+		rtest.Equals(t, "backup", loadCtx.Value(ctxKey{}))
+		return nil, loadErr
+	}
+
+	mIdx := index.NewMasterIndex()
+	mIdx.UseLazyDataBlobs(ctx, load)
+	mIdx.Insert(decoded)
+	rtest.OK(t, mIdx.MergeFinalIndexes())
+	rtest.OK(t, mIdx.LazyError())
+
+	rtest.Equals(t, false, mIdx.Has(dataBlob.BlobHandle))
+	rtest.Assert(t, errors.Is(mIdx.LazyError(), loadErr), "unexpected error %v", mIdx.LazyError())
+}
+
 func TestMasterMergeFinalIndexes(t *testing.T) {
 	bhInIdx1 := restic.NewRandomBlobHandle()
 	bhInIdx2 := restic.NewRandomBlobHandle()
@@ -200,6 +317,38 @@ func TestMasterMergeFinalIndexes(t *testing.T) {
 		blobCount++
 	})
 	rtest.Equals(t, 2, blobCount)
+	// identical blobs are only counted once
+	totals := mIdx.Totals(restic.DataBlob, nil)
+	rtest.Equals(t, uint(2), totals.Count)
+	rtest.Equals(t, uint64(110), totals.Size)
+}
+
+func TestMasterIndexTotalsDuplicates(t *testing.T) {
+	blob := restic.Blob{
+		BlobHandle: restic.NewRandomBlobHandle(),
+		Length:     uint(crypto.CiphertextLength(10)),
+	}
+	other := restic.Blob{
+		BlobHandle: restic.NewRandomBlobHandle(),
+		Length:     uint(crypto.CiphertextLength(20)),
+	}
+	pack1, pack2 := restic.NewRandomID(), restic.NewRandomID()
+
+	idx1 := index.NewIndex()
+	idx1.StorePack(pack1, []restic.Blob{blob, other})
+	// the blob is also stored in a second pack listed in another index
+	idx2 := index.NewIndex()
+	idx2.StorePack(pack2, []restic.Blob{blob})
+
+	mIdx := index.NewMasterIndex()
+	mIdx.Insert(idx1)
+	mIdx.Insert(idx2)
+
+	both := index.BlobTotals{Count: 2, Size: uint64(blob.Length + other.Length), UncompressedSize: 30}
+	rtest.Equals(t, both, mIdx.Totals(blob.Type, nil))
+	rtest.Equals(t, both, mIdx.Totals(blob.Type, restic.NewIDSet(pack2)))
+	rtest.Equals(t, index.BlobTotals{Count: 1, Size: uint64(blob.Length), UncompressedSize: 10},
+		mIdx.Totals(blob.Type, restic.NewIDSet(pack1)))
 }
 
 func createRandomMasterIndex(t testing.TB, rng *rand.Rand, num, size int) (*index.MasterIndex, restic.BlobHandle) {
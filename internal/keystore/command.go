@@ -0,0 +1,32 @@
+package keystore
+
+import (
+	"bytes"
+	"context"
+	"os/exec"
+	"strings"
+
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
+)
+
+// run executes the program name with args, passes stdin to it and returns the
+// output.
+func run(ctx context.Context, stdin []byte, name string, args ...string) ([]byte, error) {
+	debug.Log("running %v %v", name, args)
+
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Stdin = bytes.NewReader(stdin)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	out, err := cmd.Output()
+	if err != nil {
+		msg := strings.TrimSpace(stderr.String())
+		if msg != "" {
+			return nil, errors.Errorf("%v failed: %v: %v", name, err, msg)
+		}
+		return nil, errors.Errorf("%v failed: %v", name, err)
+	}
+	return out, nil
+}
@@ -0,0 +1,50 @@
+package keystore
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/restic"
+)
+
+// keyring stores secrets in the keychain of the user. The sealed secret is
+// the account name of the keychain item.
+type keyring struct{}
+
+func init() {
+	Register("keyring", keyring{})
+}
+
+const keychainService = "restic"
+
+func (keyring) Seal(ctx context.Context, secret []byte) ([]byte, error) {
+	id := restic.NewRandomID().String()
+	// pass the command on stdin so that the secret does not show up in the
+	// list of processes
+	cmd := fmt.Sprintf("add-generic-password -a %s -s %s -X %s\n", id, keychainService, hex.EncodeToString(secret))
+	_, err := run(ctx, []byte(cmd), "security", "-i")
+	if err != nil {
+		return nil, err
+	}
+	return []byte(id), nil
+}
+
+func (keyring) Unseal(ctx context.Context, sealed []byte) ([]byte, error) {
+	out, err := run(ctx, nil, "security", "find-generic-password", "-a", string(sealed), "-s", keychainService, "-w")
+	if err != nil {
+		return nil, err
+	}
+	secret, err := hex.DecodeString(strings.TrimSpace(string(out)))
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid keychain item")
+	}
+	return secret, nil
+}
+
+func (keyring) Remove(ctx context.Context, sealed []byte) error {
+	_, err := run(ctx, nil, "security", "delete-generic-password", "-a", string(sealed), "-s", keychainService)
+	return err
+}
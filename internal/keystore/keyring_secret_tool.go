@@ -0,0 +1,49 @@
+//go:build !windows && !darwin
+// +build !windows,!darwin
+
+package keystore
+
+import (
+	"context"
+	"encoding/hex"
+	"strings"
+
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/restic"
+)
+
+// keyring stores secrets in the secret service of the desktop session (e.g.
+// GNOME Keyring or KWallet) using secret-tool. The sealed secret is the ID of
+// the item in the keyring.
+type keyring struct{}
+
+func init() {
+	Register("keyring", keyring{})
+}
+
+func (keyring) Seal(ctx context.Context, secret []byte) ([]byte, error) {
+	id := restic.NewRandomID().String()
+	_, err := run(ctx, []byte(hex.EncodeToString(secret)), "secret-tool", "store",
+		"--label=restic secret "+id[:8], "application", "restic", "id", id)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(id), nil
+}
+
+func (keyring) Unseal(ctx context.Context, sealed []byte) ([]byte, error) {
+	out, err := run(ctx, nil, "secret-tool", "lookup", "application", "restic", "id", string(sealed))
+	if err != nil {
+		return nil, err
+	}
+	secret, err := hex.DecodeString(strings.TrimSpace(string(out)))
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid keyring item")
+	}
+	return secret, nil
+}
+
+func (keyring) Remove(ctx context.Context, sealed []byte) error {
+	_, err := run(ctx, nil, "secret-tool", "clear", "application", "restic", "id", string(sealed))
+	return err
+}
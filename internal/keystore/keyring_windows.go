@@ -0,0 +1,58 @@
+package keystore
+
+import (
+	"context"
+	"unsafe"
+
+	"github.com/restic/restic/internal/errors"
+	"golang.org/x/sys/windows"
+)
+
+// keyring protects secrets with the data protection API of Windows, which
+// ties them to the current user account. With CRYPTPROTECT_LOCAL_MACHINE in
+// flags, all accounts of the machine can unseal them instead, including
+// services running as LocalSystem.
+type keyring struct {
+	flags uint32
+}
+
+func init() {
+	Register("keyring", keyring{})
+	Register("machine", keyring{flags: windows.CRYPTPROTECT_LOCAL_MACHINE})
+}
+
+func newBlob(data []byte) *windows.DataBlob {
+	if len(data) == 0 {
+		return &windows.DataBlob{}
+	}
+	return &windows.DataBlob{
+		Size: uint32(len(data)),
+		Data: &data[0],
+	}
+}
+
+// blobBytes copies the data of the blob allocated by Windows and frees it.
+func blobBytes(blob *windows.DataBlob) []byte {
+	defer func() {
+		_, _ = windows.LocalFree(windows.Handle(unsafe.Pointer(blob.Data)))
+	}()
+	return append([]byte(nil), unsafe.Slice(blob.Data, blob.Size)...)
+}
+
+func (k keyring) Seal(_ context.Context, secret []byte) ([]byte, error) {
+	var out windows.DataBlob
+	err := windows.CryptProtectData(newBlob(secret), nil, nil, 0, nil, windows.CRYPTPROTECT_UI_FORBIDDEN|k.flags, &out)
+	if err != nil {
+		return nil, errors.Wrap(err, "CryptProtectData")
+	}
+	return blobBytes(&out), nil
+}
+
+func (keyring) Unseal(_ context.Context, sealed []byte) ([]byte, error) {
+	var out windows.DataBlob
+	err := windows.CryptUnprotectData(newBlob(sealed), nil, nil, 0, nil, windows.CRYPTPROTECT_UI_FORBIDDEN, &out)
+	if err != nil {
+		return nil, errors.Wrap(err, "CryptUnprotectData")
+	}
+	return blobBytes(&out), nil
+}
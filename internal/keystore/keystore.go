@@ -0,0 +1,93 @@
+// Package keystore protects secrets with keys which are only available on the
+// local machine, for example from a TPM or the keyring of the operating
+// system.
+package keystore
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"github.com/restic/restic/internal/errors"
+)
+
+// Sealer protects a secret using a key which only exists on the local machine.
+// The sealed secret returned by Seal can be stored anywhere, it can only be
+// unsealed on the same machine.
+type Sealer interface {
+	Seal(ctx context.Context, secret []byte) (sealed []byte, err error)
+	Unseal(ctx context.Context, sealed []byte) (secret []byte, err error)
+}
+
+// PCRBinder is implemented by sealers which can additionally bind a secret to
+// the state of the platform configuration registers (PCRs) of a TPM. Such a
+// secret can only be unsealed if the machine booted with the same firmware,
+// boot loader and so on.
+type PCRBinder interface {
+	WithPCRs(pcrs []uint) Sealer
+}
+
+// Remover is implemented by sealers which keep the secret in a store of the
+// operating system and only return a reference to it as the sealed secret.
+// Remove deletes the secret from the store.
+type Remover interface {
+	Remove(ctx context.Context, sealed []byte) error
+}
+
+var (
+	sealersMu sync.Mutex
+	sealers   = make(map[string]Sealer)
+)
+
+// Register makes a sealer available under the given name. It panics if a
+// sealer with the same name has already been registered.
+func Register(name string, s Sealer) {
+	sealersMu.Lock()
+	defer sealersMu.Unlock()
+
+	if _, ok := sealers[name]; ok {
+		panic("keystore " + name + " registered twice")
+	}
+	sealers[name] = s
+}
+
+// Lookup returns the sealer registered under name.
+func Lookup(name string) (Sealer, error) {
+	sealersMu.Lock()
+	defer sealersMu.Unlock()
+
+	s, ok := sealers[name]
+	if !ok {
+		return nil, errors.Fatalf("keystore %q is not available on this system, available are: %v", name, names())
+	}
+	return s, nil
+}
+
+// Default returns the name of the sealer to use if none was specified. The
+// "machine" sealer is preferred if available, as it does not require a user
+// session, so that services and scheduled jobs can unseal the secrets.
+func Default() string {
+	sealersMu.Lock()
+	defer sealersMu.Unlock()
+
+	if _, ok := sealers["machine"]; ok {
+		return "machine"
+	}
+	return "keyring"
+}
+
+// Names returns the names of all registered sealers, sorted alphabetically.
+func Names() []string {
+	sealersMu.Lock()
+	defer sealersMu.Unlock()
+	return names()
+}
+
+func names() []string {
+	list := make([]string, 0, len(sealers))
+	for name := range sealers {
+		list = append(list, name)
+	}
+	sort.Strings(list)
+	return list
+}
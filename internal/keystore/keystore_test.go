@@ -0,0 +1,40 @@
+package keystore
+
+import (
+	"context"
+	"testing"
+
+	rtest "github.com/restic/restic/internal/test"
+)
+
+type nullSealer struct{}
+
+func (nullSealer) Seal(_ context.Context, secret []byte) ([]byte, error)   { return secret, nil }
+func (nullSealer) Unseal(_ context.Context, sealed []byte) ([]byte, error) { return sealed, nil }
+
+func TestRegister(t *testing.T) {
+	Register("null-test", nullSealer{})
+
+	s, err := Lookup("null-test")
+	rtest.OK(t, err)
+	rtest.Equals(t, nullSealer{}, s)
+
+	found := false
+	for _, name := range Names() {
+		found = found || name == "null-test"
+	}
+	rtest.Assert(t, found, "sealer missing from %v", Names())
+
+	_, err = Lookup("invalid")
+	rtest.Assert(t, err != nil, "expected error for unknown sealer")
+
+	defer func() {
+		rtest.Assert(t, recover() != nil, "registering a sealer twice did not panic")
+	}()
+	Register("null-test", nullSealer{})
+}
+
+func TestDefault(t *testing.T) {
+	_, err := Lookup(Default())
+	rtest.OK(t, err)
+}
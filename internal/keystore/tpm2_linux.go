@@ -0,0 +1,60 @@
+package keystore
+
+import (
+	"context"
+	"strconv"
+	"strings"
+)
+
+// tpm2 seals secrets to the TPM of the machine using systemd-creds.
+type tpm2 struct {
+	// pcrs optionally binds the secret to the state of these PCRs.
+	pcrs []uint
+}
+
+// machine seals secrets using systemd-creds with the credential secret of
+// the host, which is combined with the TPM if the machine has one. Unsealing
+// requires root privileges, but no user session.
+type machine struct{}
+
+func init() {
+	Register("tpm2", tpm2{})
+	Register("machine", machine{})
+}
+
+// credentialName is embedded into the sealed secret and verified during
+// unsealing, so that credentials of other programs cannot be passed to
+// restic.
+const credentialName = "restic"
+
+// WithPCRs returns a sealer which binds secrets to the given PCRs in addition
+// to the TPM. The PCR policy is stored in the sealed secret, so Unseal works
+// the same for either sealer.
+func (t tpm2) WithPCRs(pcrs []uint) Sealer {
+	t.pcrs = pcrs
+	return t
+}
+
+func (t tpm2) Seal(ctx context.Context, secret []byte) ([]byte, error) {
+	args := []string{"encrypt", "--with-key=tpm2", "--name=" + credentialName}
+	if len(t.pcrs) > 0 {
+		list := make([]string, 0, len(t.pcrs))
+		for _, pcr := range t.pcrs {
+			list = append(list, strconv.FormatUint(uint64(pcr), 10))
+		}
+		args = append(args, "--tpm2-pcrs="+strings.Join(list, "+"))
+	}
+	return run(ctx, secret, "systemd-creds", append(args, "-", "-")...)
+}
+
+func (tpm2) Unseal(ctx context.Context, sealed []byte) ([]byte, error) {
+	return run(ctx, sealed, "systemd-creds", "decrypt", "--name="+credentialName, "-", "-")
+}
+
+func (machine) Seal(ctx context.Context, secret []byte) ([]byte, error) {
+	return run(ctx, secret, "systemd-creds", "encrypt", "--with-key=auto", "--name="+credentialName, "-", "-")
+}
+
+func (machine) Unseal(ctx context.Context, sealed []byte) ([]byte, error) {
+	return run(ctx, sealed, "systemd-creds", "decrypt", "--name="+credentialName, "-", "-")
+}
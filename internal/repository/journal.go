@@ -0,0 +1,269 @@
+package repository
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/restic"
+)
+
+// journalSaveInterval is the minimum time between two saves of the journal
+// triggered by MarkDone.
+var journalSaveInterval = 10 * time.Second
+
+// OperationJournal persists the progress of a long-running operation, e.g.
+// "check --read-data", in the local cache of the repository. If the operation
+// is interrupted, running it again with the same parameters resumes from the
+// recorded progress instead of starting from zero. A journal recorded with
+// different parameters is discarded. Without a local cache, the progress is
+// only kept in memory.
+//
+// The progress consists of the IDs of the items completed in each phase of the
+// operation, e.g. the checked packs, and of values which the operation stores
+// to continue deterministically, e.g. a randomly selected set of packs.
+type OperationJournal struct {
+	filename string
+	resumed  bool
+
+	m        sync.Mutex
+	state    operationState
+	done     map[string]restic.IDSet
+	dirty    bool
+	lastSave time.Time
+}
+
+// operationState is the content of a journal file.
+type operationState struct {
+	Operation string                     `json:"operation"`
+	Params    string                     `json:"params"`
+	Started   time.Time                  `json:"started"`
+	Done      map[string]restic.IDs      `json:"done,omitempty"`
+	Values    map[string]json.RawMessage `json:"values,omitempty"`
+}
+
+// OpenOperationJournal returns the journal of the operation for repo. The
+// params must contain everything which influences the result of the
+// operation, they are JSON encoded to detect whether a recorded journal can
+// be resumed.
+func OpenOperationJournal(repo *Repository, operation string, params interface{}) (*OperationJournal, error) {
+	var dir string
+	if repo.Cache != nil {
+		dir = repo.Cache.Path()
+	}
+	return OpenOperationJournalDir(dir, operation, params)
+}
+
+// OpenOperationJournalDir returns the journal of the operation stored in the
+// cache directory dir of a repository. This is used by commands which do not
+// use the regular cache of the repository, an empty dir keeps the journal in
+// memory.
+func OpenOperationJournalDir(dir string, operation string, params interface{}) (*OperationJournal, error) {
+	buf, err := json.Marshal(params)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	hash := sha256.Sum256(buf)
+
+	j := &OperationJournal{
+		state: operationState{
+			Operation: operation,
+			Params:    hex.EncodeToString(hash[:]),
+			Started:   time.Now(),
+		},
+		done: make(map[string]restic.IDSet),
+	}
+
+	if dir == "" {
+		return j, nil
+	}
+	j.filename = filepath.Join(dir, "operations", operation+".json")
+
+	buf, err = os.ReadFile(j.filename)
+	if errors.Is(err, os.ErrNotExist) {
+		return j, nil
+	}
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	var state operationState
+	if err := json.Unmarshal(buf, &state); err != nil {
+		debug.Log("unable to parse journal %v, ignoring it: %v", j.filename, err)
+		return j, nil
+	}
+	if state.Operation != operation || state.Params != j.state.Params {
+		debug.Log("journal %v was recorded with different parameters, ignoring it", j.filename)
+		return j, nil
+	}
+
+	j.state = state
+	j.resumed = true
+	for phase, ids := range state.Done {
+		j.done[phase] = restic.NewIDSet(ids...)
+	}
+	return j, nil
+}
+
+// Resumed returns true if the progress of an interrupted run was loaded.
+func (j *OperationJournal) Resumed() bool {
+	return j.resumed
+}
+
+// Started returns the time when the operation was started initially.
+func (j *OperationJournal) Started() time.Time {
+	return j.state.Started
+}
+
+// IsDone returns true if the item id was completed in phase.
+func (j *OperationJournal) IsDone(phase string, id restic.ID) bool {
+	j.m.Lock()
+	defer j.m.Unlock()
+	return j.done[phase].Has(id)
+}
+
+// DoneCount returns the number of items completed in phase.
+func (j *OperationJournal) DoneCount(phase string) int {
+	j.m.Lock()
+	defer j.m.Unlock()
+	return len(j.done[phase])
+}
+
+// DoneIDs returns the items completed in phase.
+func (j *OperationJournal) DoneIDs(phase string) restic.IDs {
+	j.m.Lock()
+	defer j.m.Unlock()
+	return j.done[phase].List()
+}
+
+// MarkDone records that the item id was completed in phase. To limit the
+// overhead, the journal is only saved if it was not saved recently, so a few
+// items may be processed again after an interruption.
+func (j *OperationJournal) MarkDone(phase string, id restic.ID) error {
+	j.m.Lock()
+	defer j.m.Unlock()
+
+	set, ok := j.done[phase]
+	if !ok {
+		set = restic.NewIDSet()
+		j.done[phase] = set
+	}
+	set.Insert(id)
+	j.dirty = true
+
+	if time.Since(j.lastSave) < journalSaveInterval {
+		return nil
+	}
+	// MarkDone is called concurrently by the workers of an operation, a
+	// failed save is only retried after the interval so that the error is
+	// not reported for every item
+	j.lastSave = time.Now()
+	return j.save()
+}
+
+// Get decodes the value stored for key into v, it returns false if no value
+// was stored.
+func (j *OperationJournal) Get(key string, v interface{}) (bool, error) {
+	j.m.Lock()
+	defer j.m.Unlock()
+
+	buf, ok := j.state.Values[key]
+	if !ok {
+		return false, nil
+	}
+	if err := json.Unmarshal(buf, v); err != nil {
+		return false, errors.Wrapf(err, "decoding journal value %v", key)
+	}
+	return true, nil
+}
+
+// Set stores v for key and saves the journal.
+func (j *OperationJournal) Set(key string, v interface{}) error {
+	buf, err := json.Marshal(v)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	j.m.Lock()
+	defer j.m.Unlock()
+
+	if j.state.Values == nil {
+		j.state.Values = make(map[string]json.RawMessage)
+	}
+	j.state.Values[key] = buf
+	j.dirty = true
+	return j.save()
+}
+
+// Save writes all recorded progress to disk.
+func (j *OperationJournal) Save() error {
+	j.m.Lock()
+	defer j.m.Unlock()
+	return j.save()
+}
+
+func (j *OperationJournal) save() error {
+	if j.filename == "" || !j.dirty {
+		return nil
+	}
+
+	j.state.Done = make(map[string]restic.IDs, len(j.done))
+	for phase, set := range j.done {
+		j.state.Done[phase] = set.List()
+	}
+	buf, err := json.Marshal(j.state)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	dir := filepath.Dir(j.filename)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return errors.WithStack(err)
+	}
+
+	f, err := os.CreateTemp(dir, filepath.Base(j.filename)+"-tmp-")
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	_, err = f.Write(buf)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), j.filename)
+	}
+	if err != nil {
+		_ = os.Remove(f.Name())
+		return errors.WithStack(err)
+	}
+
+	j.dirty = false
+	j.lastSave = time.Now()
+	return nil
+}
+
+// Finish removes the journal after the operation has completed.
+func (j *OperationJournal) Finish() error {
+	j.m.Lock()
+	defer j.m.Unlock()
+
+	j.done = make(map[string]restic.IDSet)
+	j.state.Values = nil
+	j.dirty = false
+	if j.filename == "" {
+		return nil
+	}
+
+	err := os.Remove(j.filename)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return errors.WithStack(err)
+	}
+	return nil
+}
@@ -0,0 +1,98 @@
+package repository
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/restic/restic/internal/cache"
+	"github.com/restic/restic/internal/restic"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+type testJournalParams struct {
+	Subset string
+}
+
+func TestOperationJournal(t *testing.T) {
+	repo := TestRepository(t).(*Repository)
+	repo.UseCache(cache.TestNewCache(t))
+
+	params := testJournalParams{Subset: "1/5"}
+	j, err := OpenOperationJournal(repo, "check", params)
+	rtest.OK(t, err)
+	rtest.Assert(t, !j.Resumed(), "new journal is resumed")
+
+	ids := restic.IDs{restic.NewRandomID(), restic.NewRandomID(), restic.NewRandomID()}
+	rtest.OK(t, j.Set("packs", ids))
+	rtest.OK(t, j.MarkDone("read", ids[0]))
+	rtest.Equals(t, 1, j.DoneCount("read"))
+	rtest.Assert(t, j.IsDone("read", ids[0]), "completed item missing")
+
+	// the interrupted run is resumed with the same parameters
+	resumed, err := OpenOperationJournal(repo, "check", params)
+	rtest.OK(t, err)
+	rtest.Assert(t, resumed.Resumed(), "journal was not resumed")
+	rtest.Equals(t, j.Started().Unix(), resumed.Started().Unix())
+	// the journal was saved by Set, completed items are saved only
+	// periodically
+	rtest.Equals(t, 0, resumed.DoneCount("read"))
+
+	var packs restic.IDs
+	ok, err := resumed.Get("packs", &packs)
+	rtest.OK(t, err)
+	rtest.Assert(t, ok, "value missing")
+	rtest.Equals(t, ids, packs)
+
+	rtest.OK(t, j.Save())
+	resumed, err = OpenOperationJournal(repo, "check", params)
+	rtest.OK(t, err)
+	rtest.Equals(t, 1, resumed.DoneCount("read"))
+	rtest.Assert(t, resumed.IsDone("read", ids[0]), "completed item missing")
+	rtest.Equals(t, restic.IDs{ids[0]}, resumed.DoneIDs("read"))
+
+	// other parameters or operations start from zero
+	other, err := OpenOperationJournal(repo, "check", testJournalParams{Subset: "2/5"})
+	rtest.OK(t, err)
+	rtest.Assert(t, !other.Resumed(), "journal with other parameters was resumed")
+	other, err = OpenOperationJournal(repo, "copy", params)
+	rtest.OK(t, err)
+	rtest.Assert(t, !other.Resumed(), "journal of other operation was resumed")
+
+	rtest.OK(t, resumed.Finish())
+	rtest.Equals(t, 0, resumed.DoneCount("read"))
+	j, err = OpenOperationJournal(repo, "check", params)
+	rtest.OK(t, err)
+	rtest.Assert(t, !j.Resumed(), "finished journal was resumed")
+}
+
+func TestOperationJournalWithoutCache(t *testing.T) {
+	repo := TestRepository(t).(*Repository)
+
+	j, err := OpenOperationJournal(repo, "check", nil)
+	rtest.OK(t, err)
+	id := restic.NewRandomID()
+	rtest.OK(t, j.MarkDone("read", id))
+	rtest.Assert(t, j.IsDone("read", id), "item not recorded")
+	rtest.OK(t, j.Finish())
+}
+
+func TestOperationJournalSaveError(t *testing.T) {
+	dir := rtest.TempDir(t)
+	j, err := OpenOperationJournalDir(dir, "check", testJournalParams{})
+	rtest.OK(t, err)
+	// a file where the journal directory should be created
+	rtest.OK(t, os.WriteFile(filepath.Join(dir, "operations"), nil, 0600))
+
+	defer func(interval time.Duration) {
+		journalSaveInterval = interval
+	}(journalSaveInterval)
+	journalSaveInterval = time.Hour
+
+	rtest.Assert(t, j.MarkDone("read", restic.NewRandomID()) != nil, "expected error saving the journal")
+	// the save is only retried after journalSaveInterval
+	rtest.OK(t, j.MarkDone("read", restic.NewRandomID()))
+	rtest.Equals(t, 2, j.DoneCount("read"))
+	rtest.Assert(t, j.Save() != nil, "expected error saving the journal")
+}
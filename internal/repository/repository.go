@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"path/filepath"
 	"sort"
 	"sync"
 
@@ -170,6 +171,21 @@ func (r *Repository) SetDryRun() {
 	r.be = dryrun.New(r.be)
 }
 
+// SetLazyIndex configures the repository to only keep a filter of the data
+// blobs in memory when loading the index, see
+// index.MasterIndex.UseLazyDataBlobs. It must be called before LoadIndex.
+// Index files are loaded using ctx.
+func (r *Repository) SetLazyIndex(ctx context.Context) {
+	r.idx.UseLazyDataBlobs(ctx, func(ctx context.Context, id restic.ID) (*index.Index, error) {
+		buf, err := r.LoadUnpacked(ctx, restic.IndexFile, id, nil)
+		if err != nil {
+			return nil, err
+		}
+		idx, _, err := index.DecodeIndex(buf, id)
+		return idx, err
+	})
+}
+
 // LoadUnpacked loads and decrypts the file with the given type and ID, using
 // the supplied buffer (which must be empty). If the buffer is nil, a new
 // buffer will be allocated and returned.
@@ -262,6 +278,9 @@ func (r *Repository) LoadBlob(ctx context.Context, t restic.BlobType, id restic.
 	// lookup packs
 	blobs := r.idx.Lookup(restic.BlobHandle{ID: id, Type: t})
 	if len(blobs) == 0 {
+		if err := r.idx.LazyError(); err != nil {
+			return nil, errors.Wrap(err, "load index")
+		}
 		debug.Log("id %v not found in index", id)
 		return nil, errors.Errorf("id %v not found in repository", id)
 	}
@@ -579,10 +598,21 @@ func (r *Repository) SetIndex(i restic.MasterIndex) error {
 func (r *Repository) LoadIndex(ctx context.Context) error {
 	debug.Log("Loading index")
 
+	invalidIndex := false
 	err := index.ForAllIndexes(ctx, r, func(id restic.ID, idx *index.Index, oldFormat bool, err error) error {
 		if err != nil {
 			return err
 		}
+
+		if r.cfg.Version < 2 {
+			// sanity check, before the data blobs are possibly dropped from memory
+			idx.Each(ctx, func(blob restic.PackedBlob) {
+				if blob.IsCompressed() {
+					invalidIndex = true
+				}
+			})
+		}
+
 		r.idx.Insert(idx)
 		return nil
 	})
@@ -591,27 +621,15 @@ func (r *Repository) LoadIndex(ctx context.Context) error {
 		return errors.Fatal(err.Error())
 	}
 
+	if invalidIndex {
+		return errors.Fatal("index uses feature not supported by repository version 1")
+	}
+
 	err = r.idx.MergeFinalIndexes()
 	if err != nil {
 		return err
 	}
 
-	if r.cfg.Version < 2 {
-		// sanity check
-		ctx, cancel := context.WithCancel(ctx)
-		defer cancel()
-
-		invalidIndex := false
-		r.idx.Each(ctx, func(blob restic.PackedBlob) {
-			if blob.IsCompressed() {
-				invalidIndex = true
-			}
-		})
-		if invalidIndex {
-			return errors.Fatal("index uses feature not supported by repository version 1")
-		}
-	}
-
 	// remove index files from the cache which have been removed in the repo
 	return r.prepareCache()
 }
@@ -771,6 +789,84 @@ func (r *Repository) init(ctx context.Context, password string, cfg restic.Confi
 	return restic.SaveConfig(ctx, r, cfg)
 }
 
+// UpdateConfigError is returned by UpdateConfig if saving the new config
+// failed and restoring the previous config failed as well. A copy of the
+// previous config file is stored in BackupFilePath.
+type UpdateConfigError struct {
+	SaveError      error
+	RestoreError   error
+	BackupFilePath string
+}
+
+func (err *UpdateConfigError) Error() string {
+	return fmt.Sprintf("save config failed (%v), restoring the previous config failed as well (%v), a copy of the previous config file is stored in %v",
+		err.SaveError, err.RestoreError, err.BackupFilePath)
+}
+
+func (err *UpdateConfigError) Unwrap() error {
+	return err.SaveError
+}
+
+// UpdateConfig replaces the repository config with cfg. The version, ID and
+// chunker polynomial must not be changed. Backends which cannot replace files
+// atomically require removing the config before saving the new one. For
+// these, a copy of the previous config file is written to a temporary
+// directory first, which is only removed once the new config was saved or the
+// previous config was restored. If restic is interrupted in between, the copy
+// remains available.
+func (r *Repository) UpdateConfig(ctx context.Context, cfg restic.Config) error {
+	if cfg.Version != r.cfg.Version || cfg.ID != r.cfg.ID || cfg.ChunkerPolynomial != r.cfg.ChunkerPolynomial {
+		return errors.New("UpdateConfig cannot change the repository version, ID or chunker polynomial")
+	}
+
+	if r.be.HasAtomicReplace() {
+		if err := restic.SaveConfig(ctx, r, cfg); err != nil {
+			return errors.Wrap(err, "save config")
+		}
+		r.setConfig(cfg)
+		return nil
+	}
+
+	h := restic.Handle{Type: restic.ConfigFile}
+	var oldConfig []byte
+	err := r.be.Load(ctx, h, 0, 0, func(rd io.Reader) (err error) {
+		oldConfig, err = io.ReadAll(rd)
+		return err
+	})
+	if err != nil {
+		return errors.Wrap(err, "load config")
+	}
+
+	tempdir, err := os.MkdirTemp("", "restic-config-backup-")
+	if err != nil {
+		return errors.Wrap(err, "create temp dir")
+	}
+	backupFileName := filepath.Join(tempdir, "config")
+	err = os.WriteFile(backupFileName, oldConfig, 0600)
+	if err != nil {
+		_ = os.RemoveAll(tempdir)
+		return errors.Wrap(err, "write config backup")
+	}
+	debug.Log("saved a copy of the config to %v", backupFileName)
+
+	err = r.be.Remove(ctx, h)
+	if err == nil {
+		err = restic.SaveConfig(ctx, r, cfg)
+	}
+	if err != nil {
+		_ = r.be.Remove(ctx, h)
+		if rerr := r.be.Save(ctx, h, restic.NewByteReader(oldConfig, r.be.Hasher())); rerr != nil {
+			return &UpdateConfigError{SaveError: err, RestoreError: rerr, BackupFilePath: backupFileName}
+		}
+		_ = os.RemoveAll(tempdir)
+		return errors.Wrap(err, "save config")
+	}
+
+	_ = os.RemoveAll(tempdir)
+	r.setConfig(cfg)
+	return nil
+}
+
 // Key returns the current master key.
 func (r *Repository) Key() *crypto.Key {
 	return r.key
@@ -837,6 +933,10 @@ func (r *Repository) SaveBlob(ctx context.Context, t restic.BlobType, buf []byte
 
 	// first try to add to pending blobs; if not successful, this blob is already known
 	known = !r.idx.AddPending(restic.BlobHandle{ID: newID, Type: t})
+	// the blob may be known to an index which could not be loaded
+	if err := r.idx.LazyError(); err != nil {
+		return restic.ID{}, false, 0, errors.Wrap(err, "load index")
+	}
 
 	// only save when needed or explicitly told
 	if !known || storeDuplicate {
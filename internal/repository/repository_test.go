@@ -18,6 +18,7 @@ import (
 	"github.com/klauspost/compress/zstd"
 	"github.com/restic/restic/internal/backend/local"
 	"github.com/restic/restic/internal/crypto"
+	"github.com/restic/restic/internal/errors"
 	"github.com/restic/restic/internal/index"
 	"github.com/restic/restic/internal/repository"
 	"github.com/restic/restic/internal/restic"
@@ -674,3 +675,54 @@ func TestInvalidCompression(t *testing.T) {
 	_, err = repository.New(nil, repository.Options{Compression: comp})
 	rtest.Assert(t, err != nil, "missing error")
 }
+
+// failConfigBackend fails the next saves of the config file.
+type failConfigBackend struct {
+	restic.Backend
+	failures int
+}
+
+func (be *failConfigBackend) Save(ctx context.Context, h restic.Handle, rd restic.RewindReader) error {
+	if h.Type == restic.ConfigFile && be.failures > 0 {
+		be.failures--
+		return errors.New("injected save error")
+	}
+	return be.Backend.Save(ctx, h, rd)
+}
+
+func TestUpdateConfigRestore(t *testing.T) {
+	t.Setenv("TMPDIR", rtest.TempDir(t))
+	be := &failConfigBackend{Backend: repository.TestBackend(t)}
+	rtest.Assert(t, !be.HasAtomicReplace(), "test requires a backend without atomic replace")
+	repo := repository.TestRepositoryWithBackend(t, be, 0).(*repository.Repository)
+
+	cfg := repo.Config()
+	cfg.MinSnapshotAge = "1d"
+
+	// the previous config is restored if saving the new one fails
+	be.failures = 1
+	err := repo.UpdateConfig(context.TODO(), cfg)
+	rtest.Assert(t, err != nil, "expected error saving the config")
+	loaded, err := restic.LoadConfig(context.TODO(), repo)
+	rtest.OK(t, err)
+	rtest.Equals(t, "", loaded.MinSnapshotAge)
+
+	// the copy of the previous config is kept if restoring it fails
+	be.failures = 2
+	err = repo.UpdateConfig(context.TODO(), cfg)
+	var uerr *repository.UpdateConfigError
+	rtest.Assert(t, errors.As(err, &uerr), "unexpected error %v", err)
+	be.failures = 0
+	buf, err := os.ReadFile(uerr.BackupFilePath)
+	rtest.OK(t, err)
+	rtest.OK(t, be.Save(context.TODO(), restic.Handle{Type: restic.ConfigFile}, restic.NewByteReader(buf, be.Hasher())))
+	loaded, err = restic.LoadConfig(context.TODO(), repo)
+	rtest.OK(t, err)
+	rtest.Equals(t, "", loaded.MinSnapshotAge)
+
+	rtest.OK(t, repo.UpdateConfig(context.TODO(), cfg))
+	loaded, err = restic.LoadConfig(context.TODO(), repo)
+	rtest.OK(t, err)
+	rtest.Equals(t, "1d", loaded.MinSnapshotAge)
+	rtest.Equals(t, "1d", repo.Config().MinSnapshotAge)
+}
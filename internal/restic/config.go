@@ -16,6 +16,14 @@ type Config struct {
 	Version           uint        `json:"version"`
 	ID                string      `json:"id"`
 	ChunkerPolynomial chunker.Pol `json:"chunker_polynomial"`
+
+	// MinSnapshotAge is the minimum age a snapshot must reach before forget
+	// is allowed to remove it, in the format accepted by ParseDuration.
+	MinSnapshotAge string `json:"min_snapshot_age,omitempty"`
+
+	// ExcludePolicies are the named sets of exclude patterns which backups
+	// apply with --use-repo-excludes, sorted by name.
+	ExcludePolicies []ExcludePolicy `json:"exclude_policies,omitempty"`
 }
 
 const MinRepoVersion = 1
@@ -96,9 +104,27 @@ func LoadConfig(ctx context.Context, r LoaderUnpacked) (Config, error) {
 		}
 	}
 
+	if _, err := cfg.SnapshotMinAge(); err != nil {
+		return Config{}, err
+	}
+
 	return cfg, nil
 }
 
+// SnapshotMinAge parses and returns MinSnapshotAge. The returned duration is
+// zero if snapshots are not protected from removal.
+func (cfg Config) SnapshotMinAge() (Duration, error) {
+	if cfg.MinSnapshotAge == "" {
+		return Duration{}, nil
+	}
+
+	d, err := ParseDuration(cfg.MinSnapshotAge)
+	if err != nil {
+		return Duration{}, errors.Errorf("invalid min_snapshot_age %q: %v", cfg.MinSnapshotAge, err)
+	}
+	return d, nil
+}
+
 func SaveConfig(ctx context.Context, r SaverUnpacked, cfg Config) error {
 	_, err := SaveJSONUnpacked(ctx, r, ConfigFile, cfg)
 	return err
@@ -2,8 +2,11 @@ package restic_test
 
 import (
 	"context"
+	"reflect"
 	"testing"
+	"time"
 
+	"github.com/restic/restic/internal/errors"
 	"github.com/restic/restic/internal/restic"
 	rtest "github.com/restic/restic/internal/test"
 )
@@ -60,6 +63,31 @@ func TestConfig(t *testing.T) {
 	cfg2, err := restic.LoadConfig(context.TODO(), loader{load})
 	rtest.OK(t, err)
 
-	rtest.Assert(t, cfg1 == cfg2,
+	rtest.Assert(t, reflect.DeepEqual(cfg1, cfg2),
 		"configs aren't equal: %v != %v", cfg1, cfg2)
 }
+
+func TestConfigExcludePolicies(t *testing.T) {
+	var cfg restic.Config
+	now := time.Unix(1600000000, 0)
+	cfg.SetExcludePolicy(restic.NewExcludePolicy("servers", []string{"/var/cache"}, nil, now))
+	cfg.SetExcludePolicy(restic.NewExcludePolicy("laptops", []string{"*.iso"}, nil, now))
+
+	// copies of the config are not modified
+	saved := cfg
+	cfg.SetExcludePolicy(restic.NewExcludePolicy("laptops", []string{"node_modules"}, []string{"thumbs.db"}, now))
+	rtest.Equals(t, []string{"*.iso"}, saved.ExcludePolicies[0].Excludes)
+
+	rtest.Equals(t, 2, len(cfg.ExcludePolicies))
+	rtest.Equals(t, "laptops", cfg.ExcludePolicies[0].Name)
+	p, err := cfg.ExcludePolicy("laptops")
+	rtest.OK(t, err)
+	rtest.Equals(t, []string{"node_modules"}, p.Excludes)
+	rtest.Equals(t, []string{"thumbs.db"}, p.InsensitiveExcludes)
+
+	rtest.Assert(t, cfg.RemoveExcludePolicy("servers"), "policy was not removed")
+	rtest.Assert(t, !cfg.RemoveExcludePolicy("servers"), "missing policy was removed")
+	_, err = cfg.ExcludePolicy("servers")
+	rtest.Assert(t, errors.Is(err, restic.ErrNoExcludePolicyFound), "unexpected error %v", err)
+	rtest.Equals(t, 2, len(saved.ExcludePolicies))
+}
@@ -0,0 +1,80 @@
+package restic
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/restic/restic/internal/errors"
+)
+
+// ExcludePolicy is a named set of exclude patterns stored in the repository
+// config. It allows managing the excludes for all hosts which back up to the
+// same repository in a central place.
+type ExcludePolicy struct {
+	Name                string    `json:"name"`
+	Time                time.Time `json:"time"`
+	Excludes            []string  `json:"excludes,omitempty"`
+	InsensitiveExcludes []string  `json:"iexcludes,omitempty"`
+}
+
+// ErrNoExcludePolicyFound is returned when no exclude policy with the given
+// name is stored in the repository.
+var ErrNoExcludePolicyFound = errors.New("no exclude policy found")
+
+// NewExcludePolicy returns an exclude policy with the given name and patterns.
+func NewExcludePolicy(name string, excludes, insensitiveExcludes []string, t time.Time) ExcludePolicy {
+	return ExcludePolicy{
+		Name:                name,
+		Time:                t,
+		Excludes:            excludes,
+		InsensitiveExcludes: insensitiveExcludes,
+	}
+}
+
+// ExcludePolicy returns the exclude policy with the given name.
+func (cfg Config) ExcludePolicy(name string) (ExcludePolicy, error) {
+	for _, p := range cfg.ExcludePolicies {
+		if p.Name == name {
+			return p, nil
+		}
+	}
+	return ExcludePolicy{}, fmt.Errorf("%w named %q", ErrNoExcludePolicyFound, name)
+}
+
+// SetExcludePolicy adds p to the config, replacing an existing policy with the
+// same name. The policies are kept sorted by name.
+func (cfg *Config) SetExcludePolicy(p ExcludePolicy) {
+	cfg.ExcludePolicies = append(cfg.withoutExcludePolicy(p.Name), p)
+	sort.Slice(cfg.ExcludePolicies, func(i, j int) bool {
+		return cfg.ExcludePolicies[i].Name < cfg.ExcludePolicies[j].Name
+	})
+}
+
+// RemoveExcludePolicy removes the exclude policy with the given name from the
+// config. It returns false if no such policy exists.
+func (cfg *Config) RemoveExcludePolicy(name string) bool {
+	policies := cfg.withoutExcludePolicy(name)
+	if len(policies) == len(cfg.ExcludePolicies) {
+		return false
+	}
+	cfg.ExcludePolicies = policies
+	return true
+}
+
+// withoutExcludePolicy returns a copy of the exclude policies except for the
+// one with the given name. The slice is copied as copies of the config share
+// it.
+func (cfg Config) withoutExcludePolicy(name string) []ExcludePolicy {
+	policies := make([]ExcludePolicy, 0, len(cfg.ExcludePolicies)+1)
+	for _, p := range cfg.ExcludePolicies {
+		if p.Name != name {
+			policies = append(policies, p)
+		}
+	}
+	return policies
+}
+
+func (p ExcludePolicy) String() string {
+	return fmt.Sprintf("<ExcludePolicy %q at %s>", p.Name, p.Time)
+}
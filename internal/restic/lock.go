@@ -171,6 +171,24 @@ func (l *Lock) checkForOtherLocks(ctx context.Context) error {
 	return err
 }
 
+// OtherLocks returns the number of locks held by other processes which are not
+// stale. Locks which cannot be loaded are counted as well.
+func (l *Lock) OtherLocks(ctx context.Context) (uint, error) {
+	var n uint
+	err := ForAllLocks(ctx, l.repo, l.lockID, func(id ID, lock *Lock, err error) error {
+		if err != nil {
+			debug.Log("unable to load lock %v: %v", id, err)
+			n++
+			return nil
+		}
+		if !lock.Stale() {
+			n++
+		}
+		return nil
+	})
+	return n, err
+}
+
 // createLock acquires the lock by creating a file in the repository.
 func (l *Lock) createLock(ctx context.Context) (ID, error) {
 	id, err := SaveJSONUnpacked(ctx, l.repo, LockFile, l)
@@ -113,6 +113,32 @@ func TestExclusiveLockOnLockedRepo(t *testing.T) {
 	rtest.OK(t, elock.Unlock())
 }
 
+func TestOtherLocks(t *testing.T) {
+	repo := repository.TestRepository(t)
+
+	lock, err := restic.NewLock(context.TODO(), repo)
+	rtest.OK(t, err)
+
+	n, err := lock.OtherLocks(context.TODO())
+	rtest.OK(t, err)
+	rtest.Equals(t, uint(0), n)
+
+	other, err := restic.NewLock(context.TODO(), repo)
+	rtest.OK(t, err)
+
+	// stale locks are ignored
+	staleID, err := createFakeLock(repo, time.Now().Add(-time.Hour), os.Getpid())
+	rtest.OK(t, err)
+
+	n, err = lock.OtherLocks(context.TODO())
+	rtest.OK(t, err)
+	rtest.Equals(t, uint(1), n)
+
+	rtest.OK(t, removeLock(repo, staleID))
+	rtest.OK(t, other.Unlock())
+	rtest.OK(t, lock.Unlock())
+}
+
 func createFakeLock(repo restic.Repository, t time.Time, pid int) (restic.ID, error) {
 	hostname, err := os.Hostname()
 	if err != nil {
@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"net"
 	"os"
 	"os/user"
 	"strconv"
@@ -44,6 +45,7 @@ type Node struct {
 	LinkTarget         string              `json:"linktarget,omitempty"`
 	ExtendedAttributes []ExtendedAttribute `json:"extended_attributes,omitempty"`
 	Device             uint64              `json:"device,omitempty"` // in case of Type == "dev", stat.st_rdev
+	Flags              uint32              `json:"flags,omitempty"`  // file flags (chflags) on macOS and FreeBSD, stat.st_flags
 	Content            IDs                 `json:"content"`
 	Subtree            *ID                 `json:"subtree,omitempty"`
 
@@ -163,7 +165,9 @@ func (node *Node) CreateAt(ctx context.Context, path string, repo Repository) er
 			return err
 		}
 	case "socket":
-		return nil
+		if err := node.createSocketAt(path); err != nil {
+			return err
+		}
 	default:
 		return errors.Errorf("filetype %q not implemented", node.Type)
 	}
@@ -217,6 +221,14 @@ func (node Node) restoreMetadata(path string) error {
 		}
 	}
 
+	// flags like "user immutable" prevent further changes, restore them last
+	if err := node.restoreFlags(path); err != nil {
+		debug.Log("error restoring flags for %v: %v", path, err)
+		if firsterr == nil {
+			firsterr = err
+		}
+	}
+
 	return firsterr
 }
 
@@ -318,6 +330,28 @@ func (node *Node) createFifoAt(path string) error {
 	return mkfifo(path, 0600)
 }
 
+// createSocketAt creates a placeholder for a unix socket. No process listens
+// on the socket, it only preserves the file and its metadata. An existing file
+// at path is replaced, callers must check whether this is permitted.
+func (node *Node) createSocketAt(path string) error {
+	// the path must fit into sun_path including the terminating null byte
+	if max := len(syscall.RawSockaddrUnix{}.Path); len(path) >= max {
+		return errors.Errorf("Socket: path is too long (%d bytes, at most %d allowed)", len(path), max-1)
+	}
+
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return errors.Wrap(err, "Socket")
+	}
+
+	l, err := net.ListenUnix("unix", &net.UnixAddr{Name: path, Net: "unix"})
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	// keep the socket file after closing the listener
+	l.SetUnlinkOnClose(false)
+	return errors.WithStack(l.Close())
+}
+
 // FixTime returns a time.Time which can safely be used to marshal as JSON. If
 // the timestamp is earlier than year zero, the year is set to zero. In the same
 // way, if the year is larger than 9999, the year is set to 9999. Other than
@@ -410,6 +444,9 @@ func (node Node) Equals(other Node) bool {
 	if node.Device != other.Device {
 		return false
 	}
+	if node.Flags != other.Flags {
+		return false
+	}
 	if !node.sameContent(other) {
 		return false
 	}
@@ -581,6 +618,8 @@ func (node *Node) fillExtra(path string, fi os.FileInfo) error {
 
 	node.fillUser(stat)
 
+	node.fillFlags(stat)
+
 	switch node.Type {
 	case "file":
 		node.Size = uint64(stat.size())
@@ -0,0 +1,16 @@
+//go:build !windows && !solaris
+// +build !windows,!solaris
+
+package restic
+
+import "golang.org/x/sys/unix"
+
+// DeviceNumbers returns the major and minor number of a device node. ok is
+// false if the node is not a device node or the numbers cannot be decoded on
+// this platform.
+func (node Node) DeviceNumbers() (major, minor uint32, ok bool) {
+	if node.Type != "dev" && node.Type != "chardev" {
+		return 0, 0, false
+	}
+	return unix.Major(node.Device), unix.Minor(node.Device), true
+}
@@ -0,0 +1,9 @@
+//go:build windows || solaris
+// +build windows solaris
+
+package restic
+
+// DeviceNumbers is not supported on this platform, ok is always false.
+func (node Node) DeviceNumbers() (major, minor uint32, ok bool) {
+	return 0, 0, false
+}
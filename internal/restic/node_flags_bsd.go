@@ -0,0 +1,39 @@
+//go:build darwin || freebsd
+// +build darwin freebsd
+
+package restic
+
+import (
+	"syscall"
+
+	"github.com/restic/restic/internal/errors"
+)
+
+// The values of these flags from sys/stat.h are the same on macOS and
+// FreeBSD.
+const (
+	ufNodump    = 0x00000001
+	ufImmutable = 0x00000002
+	ufAppend    = 0x00000004
+	ufOpaque    = 0x00000008
+	ufHidden    = 0x00008000
+)
+
+// userFlags are the flags which are restored, e.g. the "hidden" flag set by
+// the Finder. Other flags which can be changed by the owner of a file, like
+// UF_COMPRESSED on macOS, describe how the file system stores the content and
+// would make the restored file unreadable. Flags which can only be changed by
+// the super-user are not restored either.
+const userFlags = ufNodump | ufImmutable | ufAppend | ufOpaque | ufHidden
+
+func (node *Node) fillFlags(stat *statT) {
+	node.Flags = stat.Flags
+}
+
+func (node Node) restoreFlags(path string) error {
+	// chflags follows symlinks
+	if node.Flags&userFlags == 0 || node.Type == "symlink" {
+		return nil
+	}
+	return errors.Wrap(syscall.Chflags(path, int(node.Flags&userFlags)), "Chflags")
+}
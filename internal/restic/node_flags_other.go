@@ -0,0 +1,10 @@
+//go:build !darwin && !freebsd
+// +build !darwin,!freebsd
+
+package restic
+
+func (node *Node) fillFlags(stat *statT) {}
+
+func (node Node) restoreFlags(path string) error {
+	return nil
+}
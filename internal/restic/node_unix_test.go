@@ -5,7 +5,9 @@ package restic
 
 import (
 	"os"
+	"path/filepath"
 	"runtime"
+	"strings"
 	"syscall"
 	"testing"
 	"time"
@@ -136,3 +138,19 @@ func TestNodeFromFileInfo(t *testing.T) {
 		})
 	}
 }
+
+func TestCreateSocketAtLongPath(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, strings.Repeat("s", len(syscall.RawSockaddrUnix{}.Path)))
+
+	node := &Node{Name: filepath.Base(path), Type: "socket"}
+	err := node.createSocketAt(path)
+	if err == nil || !strings.Contains(err.Error(), "path is too long") {
+		t.Fatalf("expected error for long path, got %v", err)
+	}
+
+	// nothing must have been created
+	if _, ok := stat(t, path); ok {
+		t.Fatalf("socket %v was created", path)
+	}
+}
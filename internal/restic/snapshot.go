@@ -24,10 +24,45 @@ type Snapshot struct {
 	Excludes []string  `json:"excludes,omitempty"`
 	Tags     []string  `json:"tags,omitempty"`
 	Original *ID       `json:"original,omitempty"`
+	// Suspect describes why the content of the snapshot may be inconsistent,
+	// e.g. because the filesystem snapshot it was read from was deleted
+	// during the backup. It is empty for regular snapshots.
+	Suspect string `json:"suspect,omitempty"`
+
+	Summary *SnapshotSummary `json:"summary,omitempty"`
 
 	id *ID // plaintext ID, used during restore
 }
 
+// SnapshotSummary contains statistics about the backup which created a
+// snapshot.
+type SnapshotSummary struct {
+	BackupStart time.Time `json:"backup_start"`
+	BackupEnd   time.Time `json:"backup_end"`
+
+	FilesNew        uint   `json:"files_new"`
+	FilesChanged    uint   `json:"files_changed"`
+	FilesUnmodified uint   `json:"files_unmodified"`
+	DirsNew         uint   `json:"dirs_new"`
+	DirsChanged     uint   `json:"dirs_changed"`
+	DirsUnmodified  uint   `json:"dirs_unmodified"`
+	DataBlobs       int    `json:"data_blobs"`
+	TreeBlobs       int    `json:"tree_blobs"`
+	DataAdded       uint64 `json:"data_added"`
+	DataAddedPacked uint64 `json:"data_added_packed"`
+
+	TotalFilesProcessed uint   `json:"total_files_processed"`
+	TotalBytesProcessed uint64 `json:"total_bytes_processed"`
+	// Errors is the number of files and directories which could not be
+	// read and are missing or incomplete in the snapshot.
+	Errors uint `json:"errors"`
+}
+
+// Duration returns how long the backup took.
+func (s *SnapshotSummary) Duration() time.Duration {
+	return s.BackupEnd.Sub(s.BackupStart)
+}
+
 // NewSnapshot returns an initialized snapshot struct for the current user and
 // time.
 func NewSnapshot(paths []string, tags []string, hostname string, time time.Time) (*Snapshot, error) {
@@ -115,6 +150,17 @@ func (sn *Snapshot) fillUserInfo() error {
 	return err
 }
 
+// Protected returns true if the snapshot is younger than minAge at the time
+// now and thus must not be removed.
+func (sn *Snapshot) Protected(minAge Duration, now time.Time) bool {
+	if minAge.Zero() {
+		return false
+	}
+
+	t := now.AddDate(-minAge.Years, -minAge.Months, -minAge.Days).Add(time.Hour * time.Duration(-minAge.Hours))
+	return sn.Time.After(t)
+}
+
 // AddTags adds the given tags to the snapshots tags, preventing duplicates.
 // It returns true if any changes were made.
 func (sn *Snapshot) AddTags(addTags []string) (changed bool) {
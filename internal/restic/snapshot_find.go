@@ -4,6 +4,9 @@ import (
 	"context"
 	"fmt"
 	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/restic/restic/internal/errors"
@@ -12,9 +15,80 @@ import (
 // ErrNoSnapshotFound is returned when no snapshot for the given criteria could be found.
 var ErrNoSnapshotFound = errors.New("no snapshot found")
 
-// findLatestSnapshot finds latest snapshot with optional target/directory, tags, hostname, and timestamp filters.
+// ErrFiltersNotUsed is passed to the callback of FindFilteredSnapshots if
+// filters were given together with explicit snapshot IDs.
+var ErrFiltersNotUsed = errors.New("explicit snapshot ids are given")
+
+// TimeRange selects snapshots by the time at which they were created. A zero
+// After or Before means that the range is not limited in that direction.
+type TimeRange struct {
+	// After is the earliest time contained in the range.
+	After time.Time
+	// Before is the first time after the range.
+	Before time.Time
+}
+
+// Contains returns true if t is contained in the range.
+func (r TimeRange) Contains(t time.Time) bool {
+	if !r.After.IsZero() && t.Before(r.After) {
+		return false
+	}
+	if !r.Before.IsZero() && !t.Before(r.Before) {
+		return false
+	}
+	return true
+}
+
+// IsZero returns true if the range does not exclude any time.
+func (r TimeRange) IsZero() bool {
+	return r.After.IsZero() && r.Before.IsZero()
+}
+
+// Intersect returns the range of times contained in both r and other.
+func (r TimeRange) Intersect(other TimeRange) TimeRange {
+	if r.After.IsZero() || other.After.After(r.After) {
+		r.After = other.After
+	}
+	if r.Before.IsZero() || (!other.Before.IsZero() && other.Before.Before(r.Before)) {
+		r.Before = other.Before
+	}
+	return r
+}
+
+func (r TimeRange) String() string {
+	var after, before string
+	if !r.After.IsZero() {
+		after = r.After.Format("2006-01-02 15:04:05")
+	}
+	if !r.Before.IsZero() {
+		before = r.Before.Format("2006-01-02 15:04:05")
+	}
+	return after + ".." + before
+}
+
+// parseLatest returns the offset n if s is "latest" (n = 0) or "latest~n",
+// which refers to the n-th snapshot before the latest one.
+func parseLatest(s string) (n int, ok bool, err error) {
+	if s == "latest" {
+		return 0, true, nil
+	}
+
+	if !strings.HasPrefix(s, "latest~") {
+		return 0, false, nil
+	}
+
+	n, err = strconv.Atoi(strings.TrimPrefix(s, "latest~"))
+	if err != nil || n < 0 {
+		return 0, true, errors.Errorf("invalid snapshot %q, the offset must be a non-negative number", s)
+	}
+	return n, true, nil
+}
+
+// findLatestSnapshot finds the latest snapshot with optional target/directory,
+// tags, hostname, and time range filters. If offset is not zero, the snapshot
+// offset snapshots before the latest one is returned instead.
 func findLatestSnapshot(ctx context.Context, be Lister, loader LoaderUnpacked, hosts []string,
-	tags []TagList, paths []string, timeStampLimit *time.Time) (*Snapshot, error) {
+	tags []TagList, paths []string, timeRange TimeRange, offset int) (*Snapshot, error) {
 
 	var err error
 	absTargets := make([]string, 0, len(paths))
@@ -28,18 +102,14 @@ func findLatestSnapshot(ctx context.Context, be Lister, loader LoaderUnpacked, h
 		absTargets = append(absTargets, filepath.Clean(target))
 	}
 
-	var latest *Snapshot
+	var matches Snapshots
 
 	err = ForAllSnapshots(ctx, be, loader, nil, func(id ID, snapshot *Snapshot, err error) error {
 		if err != nil {
 			return errors.Errorf("Error loading snapshot %v: %v", id.Str(), err)
 		}
 
-		if timeStampLimit != nil && snapshot.Time.After(*timeStampLimit) {
-			return nil
-		}
-
-		if latest != nil && snapshot.Time.Before(latest.Time) {
+		if !timeRange.Contains(snapshot.Time) {
 			return nil
 		}
 
@@ -55,7 +125,7 @@ func findLatestSnapshot(ctx context.Context, be Lister, loader LoaderUnpacked, h
 			return nil
 		}
 
-		latest = snapshot
+		matches = append(matches, snapshot)
 		return nil
 	})
 
@@ -63,11 +133,19 @@ func findLatestSnapshot(ctx context.Context, be Lister, loader LoaderUnpacked, h
 		return nil, err
 	}
 
-	if latest == nil {
+	if offset >= len(matches) {
 		return nil, ErrNoSnapshotFound
 	}
 
-	return latest, nil
+	// newest snapshot first, use the id to break ties
+	sort.Slice(matches, func(i, j int) bool {
+		if !matches[i].Time.Equal(matches[j].Time) {
+			return matches[i].Time.After(matches[j].Time)
+		}
+		return matches[i].ID().String() < matches[j].ID().String()
+	})
+
+	return matches[offset], nil
 }
 
 // FindSnapshot takes a string and tries to find a snapshot whose ID matches
@@ -85,22 +163,30 @@ func FindSnapshot(ctx context.Context, be Lister, loader LoaderUnpacked, s strin
 	return LoadSnapshot(ctx, loader, id)
 }
 
-// FindFilteredSnapshot returns either the latests from a filtered list of all snapshots or a snapshot specified by `snapshotID`.
-func FindFilteredSnapshot(ctx context.Context, be Lister, loader LoaderUnpacked, hosts []string, tags []TagList, paths []string, timeStampLimit *time.Time, snapshotID string) (*Snapshot, error) {
-	if snapshotID == "latest" {
-		sn, err := findLatestSnapshot(ctx, be, loader, hosts, tags, paths, timeStampLimit)
+// FindFilteredSnapshot returns either the latest from a filtered list of all
+// snapshots or a snapshot specified by `snapshotID`. The snapshot ID
+// "latest~n" selects the n-th snapshot before the latest one.
+func FindFilteredSnapshot(ctx context.Context, be Lister, loader LoaderUnpacked, hosts []string, tags []TagList, paths []string, timeRange TimeRange, snapshotID string) (*Snapshot, error) {
+	offset, isLatest, err := parseLatest(snapshotID)
+	if err != nil {
+		return nil, err
+	}
+	if isLatest {
+		sn, err := findLatestSnapshot(ctx, be, loader, hosts, tags, paths, timeRange, offset)
 		if err == ErrNoSnapshotFound {
-			err = fmt.Errorf("snapshot filter (Paths:%v Tags:%v Hosts:%v): %w", paths, tags, hosts, err)
+			err = fmt.Errorf("snapshot filter (Paths:%v Tags:%v Hosts:%v Time:%v): %w", paths, tags, hosts, timeRange, err)
 		}
 		return sn, err
 	}
 	return FindSnapshot(ctx, be, loader, snapshotID)
 }
 
+// SnapshotFindCb is called for every snapshot found by FindFilteredSnapshots
+// with the snapshot ID as given by the user, or with ErrFiltersNotUsed.
 type SnapshotFindCb func(string, *Snapshot, error) error
 
 // FindFilteredSnapshots yields Snapshots, either given explicitly by `snapshotIDs` or filtered from the list of all snapshots.
-func FindFilteredSnapshots(ctx context.Context, be Lister, loader LoaderUnpacked, hosts []string, tags []TagList, paths []string, snapshotIDs []string, fn SnapshotFindCb) error {
+func FindFilteredSnapshots(ctx context.Context, be Lister, loader LoaderUnpacked, hosts []string, tags []TagList, paths []string, timeRange TimeRange, snapshotIDs []string, fn SnapshotFindCb) error {
 	if len(snapshotIDs) != 0 {
 		var err error
 		usedFilter := false
@@ -109,18 +195,20 @@ func FindFilteredSnapshots(ctx context.Context, be Lister, loader LoaderUnpacked
 		// Process all snapshot IDs given as arguments.
 		for _, s := range snapshotIDs {
 			var sn *Snapshot
-			if s == "latest" {
-				if usedFilter {
-					continue
-				}
-
+			offset, isLatest, perr := parseLatest(s)
+			if perr != nil {
+				err = perr
+			} else if isLatest {
 				usedFilter = true
 
-				sn, err = findLatestSnapshot(ctx, be, loader, hosts, tags, paths, nil)
+				sn, err = findLatestSnapshot(ctx, be, loader, hosts, tags, paths, timeRange, offset)
 				if err == ErrNoSnapshotFound {
-					err = errors.Errorf("no snapshot matched given filter (Paths:%v Tags:%v Hosts:%v)", paths, tags, hosts)
+					err = errors.Errorf("no snapshot matched given filter (Paths:%v Tags:%v Hosts:%v Time:%v)", paths, tags, hosts, timeRange)
 				}
 				if sn != nil {
+					if ids.Has(*sn.ID()) {
+						continue
+					}
 					ids.Insert(*sn.ID())
 				}
 			} else {
@@ -141,8 +229,8 @@ func FindFilteredSnapshots(ctx context.Context, be Lister, loader LoaderUnpacked
 		}
 
 		// Give the user some indication their filters are not used.
-		if !usedFilter && (len(hosts) != 0 || len(tags) != 0 || len(paths) != 0) {
-			return fn("filters", nil, errors.Errorf("explicit snapshot ids are given"))
+		if !usedFilter && (len(hosts) != 0 || len(tags) != 0 || len(paths) != 0 || !timeRange.IsZero()) {
+			return fn("", nil, ErrFiltersNotUsed)
 		}
 		return nil
 	}
@@ -152,7 +240,7 @@ func FindFilteredSnapshots(ctx context.Context, be Lister, loader LoaderUnpacked
 			return fn(id.String(), sn, err)
 		}
 
-		if !sn.HasHostname(hosts) || !sn.HasTagList(tags) || !sn.HasPaths(paths) {
+		if !sn.HasHostname(hosts) || !sn.HasTagList(tags) || !sn.HasPaths(paths) || !timeRange.Contains(sn.Time) {
 			return nil
 		}
 
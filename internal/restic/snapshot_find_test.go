@@ -2,6 +2,7 @@ package restic_test
 
 import (
 	"context"
+	"errors"
 	"testing"
 
 	"github.com/restic/restic/internal/repository"
@@ -14,7 +15,7 @@ func TestFindLatestSnapshot(t *testing.T) {
 	restic.TestCreateSnapshot(t, repo, parseTimeUTC("2017-07-07 07:07:07"), 1, 0)
 	latestSnapshot := restic.TestCreateSnapshot(t, repo, parseTimeUTC("2019-09-09 09:09:09"), 1, 0)
 
-	sn, err := restic.FindFilteredSnapshot(context.TODO(), repo.Backend(), repo, []string{"foo"}, []restic.TagList{}, []string{}, nil, "latest")
+	sn, err := restic.FindFilteredSnapshot(context.TODO(), repo.Backend(), repo, []string{"foo"}, []restic.TagList{}, []string{}, restic.TimeRange{}, "latest")
 	if err != nil {
 		t.Fatalf("FindLatestSnapshot returned error: %v", err)
 	}
@@ -32,7 +33,7 @@ func TestFindLatestSnapshotWithMaxTimestamp(t *testing.T) {
 
 	maxTimestamp := parseTimeUTC("2018-08-08 08:08:08")
 
-	sn, err := restic.FindFilteredSnapshot(context.TODO(), repo.Backend(), repo, []string{"foo"}, []restic.TagList{}, []string{}, &maxTimestamp, "latest")
+	sn, err := restic.FindFilteredSnapshot(context.TODO(), repo.Backend(), repo, []string{"foo"}, []restic.TagList{}, []string{}, restic.TimeRange{Before: maxTimestamp}, "latest")
 	if err != nil {
 		t.Fatalf("FindLatestSnapshot returned error: %v", err)
 	}
@@ -41,3 +42,70 @@ func TestFindLatestSnapshotWithMaxTimestamp(t *testing.T) {
 		t.Errorf("FindLatestSnapshot returned wrong snapshot ID: %v", *sn.ID())
 	}
 }
+
+func TestFindLatestSnapshotWithOffset(t *testing.T) {
+	repo := repository.TestRepository(t)
+	desiredSnapshot := restic.TestCreateSnapshot(t, repo, parseTimeUTC("2015-05-05 05:05:05"), 1, 0)
+	restic.TestCreateSnapshot(t, repo, parseTimeUTC("2017-07-07 07:07:07"), 1, 0)
+	restic.TestCreateSnapshot(t, repo, parseTimeUTC("2019-09-09 09:09:09"), 1, 0)
+
+	sn, err := restic.FindFilteredSnapshot(context.TODO(), repo.Backend(), repo, []string{"foo"}, []restic.TagList{}, []string{}, restic.TimeRange{}, "latest~2")
+	if err != nil {
+		t.Fatalf("FindLatestSnapshot returned error: %v", err)
+	}
+
+	if *sn.ID() != *desiredSnapshot.ID() {
+		t.Errorf("FindLatestSnapshot returned wrong snapshot ID: %v", *sn.ID())
+	}
+
+	_, err = restic.FindFilteredSnapshot(context.TODO(), repo.Backend(), repo, []string{"foo"}, []restic.TagList{}, []string{}, restic.TimeRange{}, "latest~3")
+	if !errors.Is(err, restic.ErrNoSnapshotFound) {
+		t.Errorf("expected ErrNoSnapshotFound, got %v", err)
+	}
+
+	_, err = restic.FindFilteredSnapshot(context.TODO(), repo.Backend(), repo, []string{"foo"}, []restic.TagList{}, []string{}, restic.TimeRange{}, "latest~x")
+	if err == nil {
+		t.Errorf("expected error for invalid offset")
+	}
+}
+
+func TestFindFilteredSnapshotsTimeRange(t *testing.T) {
+	repo := repository.TestRepository(t)
+	restic.TestCreateSnapshot(t, repo, parseTimeUTC("2015-05-05 05:05:05"), 1, 0)
+	desiredSnapshot := restic.TestCreateSnapshot(t, repo, parseTimeUTC("2017-07-07 07:07:07"), 1, 0)
+	restic.TestCreateSnapshot(t, repo, parseTimeUTC("2019-09-09 09:09:09"), 1, 0)
+
+	timeRange := restic.TimeRange{After: parseTimeUTC("2016-01-01 00:00:00"), Before: parseTimeUTC("2019-09-09 09:09:09")}
+
+	var found restic.IDs
+	err := restic.FindFilteredSnapshots(context.TODO(), repo.Backend(), repo, nil, nil, nil, timeRange, nil, func(id string, sn *restic.Snapshot, err error) error {
+		if err != nil {
+			return err
+		}
+		found = append(found, *sn.ID())
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(found) != 1 || found[0] != *desiredSnapshot.ID() {
+		t.Errorf("FindFilteredSnapshots returned wrong snapshots: %v", found)
+	}
+}
+
+func TestTimeRangeIntersect(t *testing.T) {
+	t1 := parseTimeUTC("2015-05-05 05:05:05")
+	t2 := parseTimeUTC("2017-07-07 07:07:07")
+	t3 := parseTimeUTC("2019-09-09 09:09:09")
+
+	r := restic.TimeRange{After: t1, Before: t3}.Intersect(restic.TimeRange{After: t2})
+	if !r.After.Equal(t2) || !r.Before.Equal(t3) {
+		t.Errorf("wrong intersection %v", r)
+	}
+
+	r = restic.TimeRange{}.Intersect(restic.TimeRange{Before: t2})
+	if !r.After.IsZero() || !r.Before.Equal(t2) {
+		t.Errorf("wrong intersection %v", r)
+	}
+}
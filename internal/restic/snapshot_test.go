@@ -27,6 +27,31 @@ func TestTagList(t *testing.T) {
 	rtest.Assert(t, r, "Failed to match untagged snapshot")
 }
 
+func TestSnapshotProtected(t *testing.T) {
+	now := time.Date(2023, 3, 15, 12, 0, 0, 0, time.UTC)
+	sn, err := restic.NewSnapshot([]string{"/home/foobar"}, nil, "foo", now.Add(-36*time.Hour))
+	rtest.OK(t, err)
+
+	for _, test := range []struct {
+		minAge    string
+		protected bool
+	}{
+		{"", false},
+		{"1d", false},
+		{"1d12h", false},
+		{"1d13h", true},
+		{"2d", true},
+		{"1m", true},
+	} {
+		var minAge restic.Duration
+		if test.minAge != "" {
+			minAge, err = restic.ParseDuration(test.minAge)
+			rtest.OK(t, err)
+		}
+		rtest.Equals(t, test.protected, sn.Protected(minAge, now))
+	}
+}
+
 func TestLoadJSONUnpacked(t *testing.T) {
 	repository.TestAllVersions(t, testLoadJSONUnpacked)
 }
@@ -0,0 +1,100 @@
+package restorer
+
+import (
+	"sync"
+	"unsafe"
+)
+
+// directIOAlignment is the alignment of the offset, the length and the buffer
+// of writes using direct I/O.
+const directIOAlignment = 4096
+
+// alignedBuffer returns a buffer of the given size which is aligned to
+// directIOAlignment in memory.
+func alignedBuffer(size int) []byte {
+	buf := make([]byte, size+directIOAlignment)
+	skip := 0
+	if rem := int(uintptr(unsafe.Pointer(&buf[0])) % directIOAlignment); rem != 0 {
+		skip = directIOAlignment - rem
+	}
+	return buf[skip : skip+size]
+}
+
+// bufferPool holds the unused aligned buffers for direct I/O. It is shared by
+// all files of a filesWriter, as a partialFile only exists while blobs are
+// written to it.
+type bufferPool struct {
+	lock    sync.Mutex
+	buffers [][]byte
+}
+
+// get returns an aligned buffer of the given size. It reuses the buffers
+// passed to put, so each concurrent write allocates at most one buffer.
+func (p *bufferPool) get(size int) []byte {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if n := len(p.buffers); n > 0 {
+		buf := p.buffers[n-1]
+		p.buffers = p.buffers[:n-1]
+		if cap(buf) >= size {
+			return buf[:size]
+		}
+	}
+	return alignedBuffer(size)
+}
+
+// put makes buf available to get again.
+func (p *bufferPool) put(buf []byte) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.buffers = append(p.buffers, buf)
+}
+
+// writeAt writes p to the file at offset. If the file was opened for direct
+// I/O, all complete blocks of p are written bypassing the page cache, only
+// the unaligned start and end of p are written via the regular file.
+func (f *partialFile) writeAt(p []byte, offset int64) (int, error) {
+	if f.direct == nil {
+		return f.File.WriteAt(p, offset)
+	}
+
+	start := (offset + directIOAlignment - 1) / directIOAlignment * directIOAlignment
+	end := (offset + int64(len(p))) / directIOAlignment * directIOAlignment
+	if end <= start {
+		return f.File.WriteAt(p, offset)
+	}
+
+	head := p[:start-offset]
+	body := p[start-offset : end-offset]
+	tail := p[end-offset:]
+
+	n, err := f.File.WriteAt(head, offset)
+	if err != nil {
+		return n, err
+	}
+
+	buf := f.buffers.get(len(body))
+	defer f.buffers.put(buf)
+	copy(buf, body)
+	n2, err := f.direct.WriteAt(buf, start)
+	n += n2
+	if err != nil {
+		return n, err
+	}
+
+	n2, err = f.File.WriteAt(tail, end)
+	return n + n2, err
+}
+
+// Close closes the file and the file used for direct I/O.
+func (f *partialFile) Close() error {
+	var err error
+	if f.direct != nil {
+		err = f.direct.Close()
+	}
+	if cerr := f.File.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
@@ -0,0 +1,15 @@
+//go:build !linux
+// +build !linux
+
+package restorer
+
+import (
+	"os"
+
+	"github.com/restic/restic/internal/errors"
+)
+
+// openDirect returns an error, direct I/O is only supported on Linux.
+func openDirect(path string) (*os.File, error) {
+	return nil, errors.New("direct I/O is not supported on this platform")
+}
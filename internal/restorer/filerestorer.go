@@ -3,6 +3,7 @@ package restorer
 import (
 	"context"
 	"path/filepath"
+	"sort"
 	"sync"
 
 	"golang.org/x/sync/errgroup"
@@ -50,10 +51,11 @@ type fileRestorer struct {
 	idx        func(restic.BlobHandle) []restic.PackedBlob
 	packLoader repository.BackendLoadFn
 
-	workerCount int
-	filesWriter *filesWriter
-	zeroChunk   restic.ID
-	sparse      bool
+	workerCount  int
+	filesWriter  *filesWriter
+	zeroChunk    restic.ID
+	sparse       bool
+	packLocation func(restic.ID) string
 
 	dst   string
 	files []*fileInfo
@@ -158,6 +160,17 @@ func (r *fileRestorer) restoreFiles(ctx context.Context) error {
 		}
 	}
 
+	if r.packLocation != nil {
+		// keep the order of first access within each location
+		locations := make(map[restic.ID]string, len(packOrder))
+		for _, id := range packOrder {
+			locations[id] = r.packLocation(id)
+		}
+		sort.SliceStable(packOrder, func(i, j int) bool {
+			return locations[packOrder[i]] < locations[packOrder[j]]
+		})
+	}
+
 	wg, ctx := errgroup.WithContext(ctx)
 	downloadCh := make(chan *packInfo)
 
@@ -268,7 +281,7 @@ func (r *fileRestorer) downloadPack(ctx context.Context, pack *packInfo) error {
 						file.inProgress = true
 						createSize = file.size
 					}
-					return r.filesWriter.writeToFile(r.targetPath(file.location), blobData, offset, createSize, file.sparse)
+					return r.filesWriter.writeToFile(ctx, r.targetPath(file.location), blobData, offset, createSize, file.sparse)
 				}
 				err := sanitizeError(file, writeToFile())
 				if err != nil {
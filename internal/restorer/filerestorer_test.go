@@ -247,6 +247,42 @@ func TestFileRestorerPackSkip(t *testing.T) {
 	}
 }
 
+func TestFileRestorerPackLocation(t *testing.T) {
+	tempdir := rtest.TempDir(t)
+
+	repo := newTestRepo([]TestFile{
+		{
+			name: "file1",
+			blobs: []TestBlob{
+				{"data1-1", "pack1"},
+				{"data2-1", "pack2"},
+				{"data3-1", "pack3"},
+				{"data4-1", "pack4"},
+			},
+		},
+	})
+	disks := map[string]string{"pack1": "b", "pack2": "a", "pack3": "b", "pack4": "a"}
+
+	var loaded []string
+	loader := func(ctx context.Context, h restic.Handle, length int, offset int64, fn func(rd io.Reader) error) error {
+		packID, err := restic.ParseID(h.Name)
+		rtest.OK(t, err)
+		loaded = append(loaded, repo.packsIDToName[packID])
+		return repo.loader(ctx, h, length, offset, fn)
+	}
+
+	// a single worker loads the pack files in order
+	r := newFileRestorer(tempdir, loader, repo.key, repo.Lookup, 1, false)
+	r.files = repo.files
+	r.packLocation = func(id restic.ID) string {
+		return disks[repo.packsIDToName[id]]
+	}
+
+	rtest.OK(t, r.restoreFiles(context.TODO()))
+	verifyRestore(t, r, repo)
+	rtest.Equals(t, []string{"pack2", "pack4", "pack1", "pack3"}, loaded)
+}
+
 func TestErrorRestoreFiles(t *testing.T) {
 	tempdir := rtest.TempDir(t)
 	content := []TestFile{
@@ -1,10 +1,13 @@
 package restorer
 
 import (
+	"context"
 	"os"
 	"sync"
+	"time"
 
 	"github.com/cespare/xxhash/v2"
+	"github.com/juju/ratelimit"
 	"github.com/restic/restic/internal/debug"
 )
 
@@ -15,6 +18,14 @@ import (
 // to use multiple os.File to write to the same target file
 type filesWriter struct {
 	buckets []filesWriterBucket
+	// limit paces the writes to all files, nil means unlimited
+	limit *ratelimit.Bucket
+	// directIO writes the files bypassing the page cache, if possible
+	directIO bool
+	// validData marks preallocated files as valid data, if possible
+	validData bool
+	// buffers holds the aligned buffers for direct I/O
+	buffers bufferPool
 }
 
 type filesWriterBucket struct {
@@ -26,6 +37,10 @@ type partialFile struct {
 	*os.File
 	users  int // Reference count.
 	sparse bool
+	// direct is the file opened for direct I/O, nil if direct I/O is not used
+	direct *os.File
+	// buffers is the pool of the filesWriter used for direct I/O
+	buffers *bufferPool
 }
 
 func newFilesWriter(count int) *filesWriter {
@@ -38,7 +53,18 @@ func newFilesWriter(count int) *filesWriter {
 	}
 }
 
-func (w *filesWriter) writeToFile(path string, blob []byte, offset int64, createSize int64, sparse bool) error {
+// setWriteLimit limits the writes to a maximum rate in KiB/s, zero means
+// unlimited.
+func (w *filesWriter) setWriteLimit(kb int) {
+	if kb <= 0 {
+		w.limit = nil
+		return
+	}
+	rate := float64(kb) * 1024
+	w.limit = ratelimit.NewBucketWithRate(rate, int64(rate))
+}
+
+func (w *filesWriter) writeToFile(ctx context.Context, path string, blob []byte, offset int64, createSize int64, sparse bool) error {
 	bucket := &w.buckets[uint(xxhash.Sum64String(path))%uint(len(w.buckets))]
 
 	acquireWriter := func() (*partialFile, error) {
@@ -62,9 +88,18 @@ func (w *filesWriter) writeToFile(path string, blob []byte, offset int64, create
 			return nil, err
 		}
 
-		wr := &partialFile{File: f, users: 1, sparse: sparse}
+		wr := &partialFile{File: f, users: 1, sparse: sparse, buffers: &w.buffers}
 		bucket.files[path] = wr
 
+		if w.directIO {
+			wr.direct, err = openDirect(path)
+			if err != nil {
+				// not all filesystems support direct I/O, fall back to the page cache
+				debug.Log("unable to open %v for direct I/O: %v", path, err)
+				wr.direct = nil
+			}
+		}
+
 		if createSize >= 0 {
 			if sparse {
 				err = truncateSparse(f, createSize)
@@ -80,6 +115,10 @@ func (w *filesWriter) writeToFile(path string, blob []byte, offset int64, create
 					// This should yield a syscall.ENOTSUP error, but some other errors might also
 					// show up.
 					debug.Log("Failed to preallocate %v with size %v: %v", path, createSize, err)
+				} else if w.validData {
+					if err := markValidData(wr.File, createSize); err != nil {
+						debug.Log("unable to mark %v as valid data: %v", path, err)
+					}
 				}
 			}
 		}
@@ -99,6 +138,20 @@ func (w *filesWriter) writeToFile(path string, blob []byte, offset int64, create
 		return nil
 	}
 
+	if w.limit != nil {
+		// the tokens are also taken if the wait is interrupted, this does
+		// not matter as the restore is aborted then
+		if d := w.limit.Take(int64(len(blob))); d > 0 {
+			t := time.NewTimer(d)
+			select {
+			case <-t.C:
+			case <-ctx.Done():
+				t.Stop()
+				return ctx.Err()
+			}
+		}
+	}
+
 	wr, err := acquireWriter()
 	if err != nil {
 		return err
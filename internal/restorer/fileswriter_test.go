@@ -1,9 +1,12 @@
 package restorer
 
 import (
+	"context"
 	"os"
 	"testing"
+	"unsafe"
 
+	"github.com/restic/restic/internal/errors"
 	rtest "github.com/restic/restic/internal/test"
 )
 
@@ -14,16 +17,16 @@ func TestFilesWriterBasic(t *testing.T) {
 	f1 := dir + "/f1"
 	f2 := dir + "/f2"
 
-	rtest.OK(t, w.writeToFile(f1, []byte{1}, 0, 2, false))
+	rtest.OK(t, w.writeToFile(context.TODO(), f1, []byte{1}, 0, 2, false))
 	rtest.Equals(t, 0, len(w.buckets[0].files))
 
-	rtest.OK(t, w.writeToFile(f2, []byte{2}, 0, 2, false))
+	rtest.OK(t, w.writeToFile(context.TODO(), f2, []byte{2}, 0, 2, false))
 	rtest.Equals(t, 0, len(w.buckets[0].files))
 
-	rtest.OK(t, w.writeToFile(f1, []byte{1}, 1, -1, false))
+	rtest.OK(t, w.writeToFile(context.TODO(), f1, []byte{1}, 1, -1, false))
 	rtest.Equals(t, 0, len(w.buckets[0].files))
 
-	rtest.OK(t, w.writeToFile(f2, []byte{2}, 1, -1, false))
+	rtest.OK(t, w.writeToFile(context.TODO(), f2, []byte{2}, 1, -1, false))
 	rtest.Equals(t, 0, len(w.buckets[0].files))
 
 	buf, err := os.ReadFile(f1)
@@ -34,3 +37,87 @@ func TestFilesWriterBasic(t *testing.T) {
 	rtest.OK(t, err)
 	rtest.Equals(t, []byte{2, 2}, buf)
 }
+
+func TestFilesWriterLimit(t *testing.T) {
+	dir := rtest.TempDir(t)
+	w := newFilesWriter(1)
+	w.setWriteLimit(1)
+	rtest.Assert(t, w.limit != nil, "missing limit")
+
+	// the first KiB is available immediately
+	f := dir + "/f"
+	rtest.OK(t, w.writeToFile(context.TODO(), f, make([]byte, 1024), 0, 1024, false))
+	rtest.Assert(t, w.limit.Available() < 1024, "write did not take tokens from the limit")
+
+	// waiting for the limit is interrupted by cancelling the context
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err := w.writeToFile(ctx, f, make([]byte, 1024*1024), 1024, -1, false)
+	rtest.Assert(t, errors.Is(err, context.Canceled), "unexpected error %v", err)
+
+	w.setWriteLimit(0)
+	rtest.Assert(t, w.limit == nil, "limit not removed")
+}
+
+func TestFilesWriterDirectIO(t *testing.T) {
+	dir := rtest.TempDir(t)
+	w := newFilesWriter(1)
+	w.directIO = true
+
+	data := rtest.Random(23, 3*directIOAlignment+100)
+	f := dir + "/f"
+
+	// write unaligned blobs out of order
+	rtest.OK(t, w.writeToFile(context.TODO(), f, data[5000:], 5000, int64(len(data)), false))
+	rtest.OK(t, w.writeToFile(context.TODO(), f, data[:10], 0, -1, false))
+	rtest.OK(t, w.writeToFile(context.TODO(), f, data[10:5000], 10, -1, false))
+	rtest.Equals(t, 0, len(w.buckets[0].files))
+
+	buf, err := os.ReadFile(f)
+	rtest.OK(t, err)
+	rtest.Equals(t, data, buf)
+}
+
+func TestPartialFileWriteAtDirect(t *testing.T) {
+	dir := rtest.TempDir(t)
+	f := dir + "/f"
+	rtest.OK(t, os.WriteFile(f, make([]byte, 4*directIOAlignment), 0600))
+
+	file, err := os.OpenFile(f, os.O_WRONLY, 0)
+	rtest.OK(t, err)
+	// use a second regular file in place of direct I/O, which is not
+	// supported by all filesystems
+	direct, err := os.OpenFile(f, os.O_WRONLY, 0)
+	rtest.OK(t, err)
+	wr := &partialFile{File: file, direct: direct, buffers: &bufferPool{}}
+
+	data := rtest.Random(42, 4*directIOAlignment)
+	for _, r := range []struct{ start, end int }{
+		{0, 100},
+		{100, directIOAlignment + 10},
+		{directIOAlignment + 10, 3*directIOAlignment + 20},
+		{3*directIOAlignment + 20, 4 * directIOAlignment},
+	} {
+		n, err := wr.writeAt(data[r.start:r.end], int64(r.start))
+		rtest.OK(t, err)
+		rtest.Equals(t, r.end-r.start, n)
+	}
+	rtest.OK(t, wr.Close())
+
+	buf, err := os.ReadFile(f)
+	rtest.OK(t, err)
+	rtest.Equals(t, data, buf)
+}
+
+func TestBufferPool(t *testing.T) {
+	var pool bufferPool
+	buf := pool.get(2 * directIOAlignment)
+	rtest.Equals(t, 2*directIOAlignment, len(buf))
+	pool.put(buf)
+
+	// a smaller buffer reuses the released one, the start stays aligned
+	buf2 := pool.get(directIOAlignment)
+	rtest.Equals(t, directIOAlignment, len(buf2))
+	rtest.Equals(t, &buf[0], &buf2[0])
+	rtest.Equals(t, uintptr(0), uintptr(unsafe.Pointer(&buf2[0]))%directIOAlignment)
+}
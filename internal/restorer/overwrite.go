@@ -0,0 +1,165 @@
+package restorer
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/fs"
+	"github.com/restic/restic/internal/restic"
+)
+
+// OverwriteBehavior configures how the restorer handles files which already
+// exist in the target directory.
+type OverwriteBehavior int
+
+// Constants for the different overwrite behaviors.
+const (
+	// OverwriteAlways replaces existing files unconditionally.
+	OverwriteAlways OverwriteBehavior = iota
+	// OverwriteIfChanged replaces existing files whose content differs
+	// from the snapshot.
+	OverwriteIfChanged
+	// OverwriteIfNewer replaces existing files which are older than the
+	// file in the snapshot.
+	OverwriteIfNewer
+	// OverwriteNever keeps all existing files.
+	OverwriteNever
+	OverwriteInvalid
+)
+
+// Set implements the method needed for pflag command flag parsing.
+func (c *OverwriteBehavior) Set(s string) error {
+	switch s {
+	case "always":
+		*c = OverwriteAlways
+	case "if-changed":
+		*c = OverwriteIfChanged
+	case "if-newer":
+		*c = OverwriteIfNewer
+	case "never":
+		*c = OverwriteNever
+	default:
+		*c = OverwriteInvalid
+		return fmt.Errorf("invalid overwrite behavior %q, must be one of (always|if-changed|if-newer|never)", s)
+	}
+
+	return nil
+}
+
+func (c *OverwriteBehavior) String() string {
+	switch *c {
+	case OverwriteAlways:
+		return "always"
+	case OverwriteIfChanged:
+		return "if-changed"
+	case OverwriteIfNewer:
+		return "if-newer"
+	case OverwriteNever:
+		return "never"
+	default:
+		return "invalid"
+	}
+}
+
+func (c *OverwriteBehavior) Type() string {
+	return "behavior"
+}
+
+// keepBothSuffix is appended to the name of a restored file which must not
+// replace an existing file, see Options.KeepBoth.
+const keepBothSuffix = ".restored"
+
+// resolveConflict decides whether the file node is restored to target. It
+// returns the location the file must be restored to, which differs from
+// location if the file is restored next to an existing file. If restore is
+// false, the file at target is kept as is.
+func (res *Restorer) resolveConflict(node *restic.Node, target, location string) (newLocation string, restore bool, err error) {
+	fi, err := fs.Lstat(target)
+	if os.IsNotExist(err) {
+		return location, true, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+
+	replace, err := res.shouldReplace(node, target, fi)
+	if err != nil {
+		return "", false, err
+	}
+	if !replace {
+		return location, false, nil
+	}
+	if !res.opts.KeepBoth {
+		return location, true, nil
+	}
+
+	for i := 0; ; i++ {
+		suffix := keepBothSuffix
+		if i > 0 {
+			suffix = fmt.Sprintf("%s.%d", keepBothSuffix, i)
+		}
+
+		_, err := fs.Lstat(target + suffix)
+		if os.IsNotExist(err) {
+			return location + suffix, true, nil
+		}
+		if err != nil {
+			return "", false, err
+		}
+	}
+}
+
+// shouldReplace reports whether the existing file at target, described by fi,
+// should be replaced by node according to the configured overwrite behavior.
+func (res *Restorer) shouldReplace(node *restic.Node, target string, fi os.FileInfo) (bool, error) {
+	switch res.opts.Overwrite {
+	case OverwriteAlways:
+		return true, nil
+	case OverwriteNever:
+		return false, nil
+	case OverwriteIfNewer:
+		return node.ModTime.After(fi.ModTime()), nil
+	case OverwriteIfChanged:
+		if node.Type != "file" {
+			return specialChanged(node, target, fi), nil
+		}
+		if !fi.Mode().IsRegular() || uint64(fi.Size()) != node.Size {
+			return true, nil
+		}
+		_, err := res.verifyFile(target, node, nil)
+		if err != nil {
+			debug.Log("existing file %v differs: %v", filepath.Base(target), err)
+			return true, nil
+		}
+		return false, nil
+	default:
+		return false, fmt.Errorf("invalid overwrite behavior %v", res.opts.Overwrite)
+	}
+}
+
+// specialChanged reports whether the existing file at target, described by fi,
+// differs from the node, which is not a regular file. Such nodes have no
+// content, only their type and the target of symlinks are compared.
+func specialChanged(node *restic.Node, target string, fi os.FileInfo) bool {
+	mode := fi.Mode()
+	switch node.Type {
+	case "symlink":
+		if mode&os.ModeSymlink == 0 {
+			return true
+		}
+		linkTarget, err := fs.Readlink(target)
+		return err != nil || linkTarget != node.LinkTarget
+	case "dev":
+		return mode&os.ModeDevice == 0 || mode&os.ModeCharDevice != 0
+	case "chardev":
+		return mode&os.ModeDevice == 0 || mode&os.ModeCharDevice == 0
+	case "fifo":
+		return mode&os.ModeNamedPipe == 0
+	case "socket":
+		return mode&os.ModeSocket == 0
+	default:
+		return true
+	}
+}
@@ -1,5 +1,5 @@
-//go:build !linux && !darwin
-// +build !linux,!darwin
+//go:build !linux && !darwin && !windows
+// +build !linux,!darwin,!windows
 
 package restorer
 
@@ -7,6 +7,5 @@ import "os"
 
 func preallocateFile(wr *os.File, size int64) error {
 	// Maybe truncate can help?
-	// Windows: This calls SetEndOfFile which preallocates space on disk
 	return wr.Truncate(size)
 }
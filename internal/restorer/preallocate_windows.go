@@ -0,0 +1,78 @@
+package restorer
+
+import (
+	"os"
+	"sync"
+	"unsafe"
+
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
+	"golang.org/x/sys/windows"
+)
+
+var (
+	modkernel32          = windows.NewLazySystemDLL("kernel32.dll")
+	procSetFileValidData = modkernel32.NewProc("SetFileValidData")
+
+	enableManageVolumeOnce sync.Once
+)
+
+// enableManageVolumePrivilege tries to enable the SeManageVolumePrivilege,
+// which is required for SetFileValidData. It is only available to
+// administrators.
+func enableManageVolumePrivilege() {
+	var token windows.Token
+	err := windows.OpenProcessToken(windows.CurrentProcess(), windows.TOKEN_ADJUST_PRIVILEGES|windows.TOKEN_QUERY, &token)
+	if err != nil {
+		debug.Log("OpenProcessToken failed: %v", err)
+		return
+	}
+	defer func() {
+		_ = token.Close()
+	}()
+
+	var luid windows.LUID
+	err = windows.LookupPrivilegeValue(nil, windows.StringToUTF16Ptr("SeManageVolumePrivilege"), &luid)
+	if err != nil {
+		debug.Log("LookupPrivilegeValue failed: %v", err)
+		return
+	}
+
+	privileges := windows.Tokenprivileges{PrivilegeCount: 1}
+	privileges.Privileges[0].Luid = luid
+	privileges.Privileges[0].Attributes = windows.SE_PRIVILEGE_ENABLED
+	err = windows.AdjustTokenPrivileges(token, false, &privileges, 0, nil, nil)
+	if err != nil {
+		debug.Log("AdjustTokenPrivileges failed: %v", err)
+	}
+}
+
+func preallocateFile(wr *os.File, size int64) error {
+	// This calls SetEndOfFile which preallocates space on disk
+	return wr.Truncate(size)
+}
+
+// markValidData marks the first size bytes of the preallocated file as valid
+// data. Blobs are not written in order, without this windows fills the file
+// with zeros up to the offset of each write, which doubles the amount of data
+// written. The parts of the file which are never written then contain the
+// previous contents of the disk. This requires the SeManageVolumePrivilege.
+func markValidData(wr *os.File, size int64) error {
+	if size <= 0 {
+		return nil
+	}
+
+	enableManageVolumeOnce.Do(enableManageVolumePrivilege)
+
+	var r1 uintptr
+	var err error
+	if unsafe.Sizeof(uintptr(0)) == 8 {
+		r1, _, err = procSetFileValidData.Call(wr.Fd(), uintptr(size))
+	} else {
+		r1, _, err = procSetFileValidData.Call(wr.Fd(), uintptr(size), uintptr(size>>32))
+	}
+	if r1 == 0 {
+		return errors.Wrap(err, "SetFileValidData")
+	}
+	return nil
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"os"
 	"path/filepath"
+	"strings"
 	"sync/atomic"
 
 	"github.com/restic/restic/internal/debug"
@@ -16,9 +17,16 @@ import (
 
 // Restorer is used to restore a snapshot to a directory.
 type Restorer struct {
-	repo   restic.Repository
-	sn     *restic.Snapshot
-	sparse bool
+	repo restic.Repository
+	sn   *restic.Snapshot
+	opts Options
+
+	skippedSpecial uint64
+	// skipped contains the files which already existed and were kept as is,
+	// renamed the new location of files restored next to an existing file,
+	// see Options.KeepBoth. Both are filled by RestoreTo for VerifyFiles.
+	skipped map[string]struct{}
+	renamed map[string]string
 
 	Error        func(location string, err error) error
 	SelectFilter func(item string, dstpath string, node *restic.Node) (selectedForRestore bool, childMayBeSelected bool)
@@ -26,11 +34,40 @@ type Restorer struct {
 
 var restorerAbortOnAllErrors = func(location string, err error) error { return err }
 
+// Options collect the settings of a restore run.
+type Options struct {
+	// Sparse restores files as sparse files if possible.
+	Sparse bool
+	// Overwrite configures how files already present in the target
+	// directory are handled.
+	Overwrite OverwriteBehavior
+	// KeepBoth restores files that would replace an existing file next to
+	// it under a new name instead.
+	KeepBoth bool
+	// AllowSpecial restores device nodes and placeholders for unix sockets.
+	// Otherwise such nodes are skipped and counted, see SkippedSpecial.
+	AllowSpecial bool
+	// WriteLimitKb limits the writes to restored files to a maximum rate in
+	// KiB/s. Zero means unlimited.
+	WriteLimitKb int
+	// DirectIO writes restored files bypassing the page cache, if supported
+	// by the platform and the filesystem.
+	DirectIO bool
+	// ValidData marks preallocated files as valid data on Windows, so that
+	// they are not filled with zeros first. Parts of a file which are not
+	// restored, for example after an error, then expose stale disk contents.
+	ValidData bool
+	// PackLocation, if set, returns where a pack file is stored, for example
+	// the disk of the media backend. The pack files are then read grouped by
+	// location instead of switching between locations.
+	PackLocation func(id restic.ID) string
+}
+
 // NewRestorer creates a restorer preloaded with the content from the snapshot id.
-func NewRestorer(ctx context.Context, repo restic.Repository, sn *restic.Snapshot, sparse bool) *Restorer {
+func NewRestorer(ctx context.Context, repo restic.Repository, sn *restic.Snapshot, opts Options) *Restorer {
 	r := &Restorer{
 		repo:         repo,
-		sparse:       sparse,
+		opts:         opts,
 		Error:        restorerAbortOnAllErrors,
 		SelectFilter: func(string, string, *restic.Node) (bool, bool) { return true, true },
 		sn:           sn,
@@ -82,11 +119,6 @@ func (res *Restorer) traverseTree(ctx context.Context, target, location string,
 			continue
 		}
 
-		// sockets cannot be restored
-		if node.Type == "socket" {
-			continue
-		}
-
 		selectedForRestore, childMayBeSelected := res.SelectFilter(nodeLocation, nodeTarget, node)
 		debug.Log("SelectFilter returned %v %v for %q", selectedForRestore, childMayBeSelected, nodeLocation)
 
@@ -158,7 +190,29 @@ func (res *Restorer) traverseTree(ctx context.Context, target, location string,
 func (res *Restorer) restoreNodeTo(ctx context.Context, node *restic.Node, target, location string) error {
 	debug.Log("restoreNode %v %v %v", node.Name, target, location)
 
-	err := node.CreateAt(ctx, target, res.repo)
+	if !res.opts.AllowSpecial && isSpecial(node) {
+		debug.Log("skipping special file %v of type %v", location, node.Type)
+		atomic.AddUint64(&res.skippedSpecial, 1)
+		return nil
+	}
+
+	// the node replaces an existing file, respect the overwrite behavior
+	newLocation, restore, err := res.resolveConflict(node, target, location)
+	if err != nil {
+		return err
+	}
+	if !restore {
+		debug.Log("keeping existing file %q", location)
+		return nil
+	}
+	if newLocation != location {
+		target += strings.TrimPrefix(newLocation, location)
+		location = newLocation
+	} else if err := fs.Remove(target); err != nil && !os.IsNotExist(err) {
+		return errors.Wrap(err, "Remove")
+	}
+
+	err = node.CreateAt(ctx, target, res.repo)
 	if err != nil {
 		debug.Log("node.CreateAt(%s) error %v", target, err)
 	}
@@ -169,6 +223,17 @@ func (res *Restorer) restoreNodeTo(ctx context.Context, node *restic.Node, targe
 	return err
 }
 
+// isSpecial returns true for nodes which are only restored with
+// Options.AllowSpecial.
+func isSpecial(node *restic.Node) bool {
+	switch node.Type {
+	case "dev", "chardev", "socket":
+		return true
+	default:
+		return false
+	}
+}
+
 func (res *Restorer) restoreNodeMetadataTo(node *restic.Node, target, location string) error {
 	debug.Log("restoreNodeMetadata %v %v %v", node.Name, target, location)
 	err := node.RestoreMetadata(target)
@@ -215,8 +280,16 @@ func (res *Restorer) RestoreTo(ctx context.Context, dst string) error {
 	}
 
 	idx := NewHardlinkIndex()
-	filerestorer := newFileRestorer(dst, res.repo.Backend().Load, res.repo.Key(), res.repo.Index().Lookup, res.repo.Connections(), res.sparse)
+	skipped := make(map[string]struct{})
+	renamed := make(map[string]string)
+	res.skipped = skipped
+	res.renamed = renamed
+	filerestorer := newFileRestorer(dst, res.repo.Backend().Load, res.repo.Key(), res.repo.Index().Lookup, res.repo.Connections(), res.opts.Sparse)
 	filerestorer.Error = res.Error
+	filerestorer.filesWriter.setWriteLimit(res.opts.WriteLimitKb)
+	filerestorer.filesWriter.directIO = res.opts.DirectIO
+	filerestorer.filesWriter.validData = res.opts.ValidData
+	filerestorer.packLocation = res.opts.PackLocation
 
 	debug.Log("first pass for %q", dst)
 
@@ -242,6 +315,21 @@ func (res *Restorer) RestoreTo(ctx context.Context, dst string) error {
 				return nil
 			}
 
+			newLocation, restore, err := res.resolveConflict(node, target, location)
+			if err != nil {
+				return err
+			}
+			if !restore {
+				debug.Log("keeping existing file %q", location)
+				skipped[location] = struct{}{}
+				return nil
+			}
+			if newLocation != location {
+				debug.Log("restoring %q as %q", location, newLocation)
+				renamed[location] = newLocation
+				location = newLocation
+			}
+
 			if node.Size == 0 {
 				return nil // deal with empty files later
 			}
@@ -277,6 +365,14 @@ func (res *Restorer) RestoreTo(ctx context.Context, dst string) error {
 				return res.restoreNodeTo(ctx, node, target, location)
 			}
 
+			if _, ok := skipped[location]; ok {
+				return nil
+			}
+			if newLocation, ok := renamed[location]; ok {
+				location = newLocation
+				target = filerestorer.targetPath(newLocation)
+			}
+
 			// create empty files, but not hardlinks to empty files
 			if node.Size == 0 && (node.Links < 2 || !idx.Has(node.Inode, node.DeviceID)) {
 				if node.Links > 1 {
@@ -296,6 +392,12 @@ func (res *Restorer) RestoreTo(ctx context.Context, dst string) error {
 	return err
 }
 
+// SkippedSpecial returns the number of device nodes and sockets which were
+// not restored because Options.AllowSpecial is not set.
+func (res *Restorer) SkippedSpecial() uint64 {
+	return atomic.LoadUint64(&res.skippedSpecial)
+}
+
 // Snapshot returns the snapshot this restorer is configured to use.
 func (res *Restorer) Snapshot() *restic.Snapshot {
 	return res.sn
@@ -307,7 +409,9 @@ const nVerifyWorkers = 8
 // VerifyFiles checks whether all regular files in the snapshot res.sn
 // have been successfully written to dst. It stops when it encounters an
 // error. It returns that error and the number of files it has successfully
-// verified.
+// verified. Files which RestoreTo kept because they already existed are not
+// verified, files restored under a different name are verified at their new
+// location.
 func (res *Restorer) VerifyFiles(ctx context.Context, dst string) (int, error) {
 	type mustCheck struct {
 		node *restic.Node
@@ -330,6 +434,12 @@ func (res *Restorer) VerifyFiles(ctx context.Context, dst string) (int, error) {
 				if node.Type != "file" {
 					return nil
 				}
+				if _, ok := res.skipped[location]; ok {
+					return nil
+				}
+				if newLocation, ok := res.renamed[location]; ok {
+					target = filepath.Join(dst, newLocation)
+				}
 				select {
 				case <-ctx.Done():
 					return ctx.Err()
@@ -40,6 +40,12 @@ type Dir struct {
 	ModTime time.Time
 }
 
+// Special is a node of type "fifo", "socket", "dev" or "chardev".
+type Special struct {
+	Type   string
+	Device uint64
+}
+
 func saveFile(t testing.TB, repo restic.Repository, node File) restic.ID {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
@@ -108,6 +114,16 @@ func saveDir(t testing.TB, repo restic.Repository, nodes map[string]Node, inode
 				Subtree: &id,
 			})
 			rtest.OK(t, err)
+		case Special:
+			err := tree.Insert(&restic.Node{
+				Type:   node.Type,
+				Mode:   0600,
+				Name:   name,
+				UID:    uint32(os.Getuid()),
+				GID:    uint32(os.Getgid()),
+				Device: node.Device,
+			})
+			rtest.OK(t, err)
 		default:
 			t.Fatalf("unknown node type %T", node)
 		}
@@ -325,7 +341,7 @@ func TestRestorer(t *testing.T) {
 			sn, id := saveSnapshot(t, repo, test.Snapshot)
 			t.Logf("snapshot saved as %v", id.Str())
 
-			res := NewRestorer(context.TODO(), repo, sn, false)
+			res := NewRestorer(context.TODO(), repo, sn, Options{})
 
 			tempdir := rtest.TempDir(t)
 			// make sure we're creating a new subdir of the tempdir
@@ -442,7 +458,7 @@ func TestRestorerRelative(t *testing.T) {
 			sn, id := saveSnapshot(t, repo, test.Snapshot)
 			t.Logf("snapshot saved as %v", id.Str())
 
-			res := NewRestorer(context.TODO(), repo, sn, false)
+			res := NewRestorer(context.TODO(), repo, sn, Options{})
 
 			tempdir := rtest.TempDir(t)
 			cleanup := rtest.Chdir(t, tempdir)
@@ -671,7 +687,7 @@ func TestRestorerTraverseTree(t *testing.T) {
 			repo := repository.TestRepository(t)
 			sn, _ := saveSnapshot(t, repo, test.Snapshot)
 
-			res := NewRestorer(context.TODO(), repo, sn, false)
+			res := NewRestorer(context.TODO(), repo, sn, Options{})
 
 			res.SelectFilter = test.Select
 
@@ -747,7 +763,7 @@ func TestRestorerConsistentTimestampsAndPermissions(t *testing.T) {
 		},
 	})
 
-	res := NewRestorer(context.TODO(), repo, sn, false)
+	res := NewRestorer(context.TODO(), repo, sn, Options{})
 
 	res.SelectFilter = func(item string, dstpath string, node *restic.Node) (selectedForRestore bool, childMayBeSelected bool) {
 		switch filepath.ToSlash(item) {
@@ -802,7 +818,7 @@ func TestVerifyCancel(t *testing.T) {
 	repo := repository.TestRepository(t)
 	sn, _ := saveSnapshot(t, repo, snapshot)
 
-	res := NewRestorer(context.TODO(), repo, sn, false)
+	res := NewRestorer(context.TODO(), repo, sn, Options{})
 
 	tempdir := rtest.TempDir(t)
 	ctx, cancel := context.WithCancel(context.Background())
@@ -844,7 +860,7 @@ func TestRestorerSparseFiles(t *testing.T) {
 		archiver.SnapshotOptions{})
 	rtest.OK(t, err)
 
-	res := NewRestorer(context.TODO(), repo, sn, true)
+	res := NewRestorer(context.TODO(), repo, sn, Options{Sparse: true})
 
 	tempdir := rtest.TempDir(t)
 	ctx, cancel := context.WithCancel(context.Background())
@@ -875,3 +891,135 @@ func TestRestorerSparseFiles(t *testing.T) {
 	t.Logf("wrote %d zeros as %d blocks, %.1f%% sparse",
 		len(zeros), blocks, 100*sparsity)
 }
+
+func TestRestorerOverwrite(t *testing.T) {
+	baseTime := time.Date(2021, time.March, 4, 5, 6, 7, 0, time.UTC)
+	snapshot := Snapshot{
+		Nodes: map[string]Node{
+			"same":    File{Data: "content: same\n", ModTime: baseTime},
+			"changed": File{Data: "content: new\n", ModTime: baseTime},
+			"newer":   File{Data: "content: newer\n", ModTime: baseTime.Add(time.Hour)},
+			"missing": File{Data: "content: missing\n", ModTime: baseTime},
+		},
+	}
+
+	existing := map[string]string{
+		"same":    "content: same\n",
+		"changed": "content: old\n",
+		"newer":   "content: older\n",
+	}
+
+	var tests = []struct {
+		Overwrite OverwriteBehavior
+		KeepBoth  bool
+		Files     map[string]string
+		// Verified is the number of restored files checked by VerifyFiles
+		Verified int
+	}{
+		{
+			Overwrite: OverwriteAlways,
+			Files: map[string]string{
+				"same":    "content: same\n",
+				"changed": "content: new\n",
+				"newer":   "content: newer\n",
+				"missing": "content: missing\n",
+			},
+			Verified: 4,
+		},
+		{
+			Overwrite: OverwriteIfChanged,
+			Files: map[string]string{
+				"same":    "content: same\n",
+				"changed": "content: new\n",
+				"newer":   "content: newer\n",
+				"missing": "content: missing\n",
+			},
+			Verified: 3,
+		},
+		{
+			Overwrite: OverwriteIfNewer,
+			Files: map[string]string{
+				"same":    "content: same\n",
+				"changed": "content: old\n",
+				"newer":   "content: newer\n",
+				"missing": "content: missing\n",
+			},
+			Verified: 2,
+		},
+		{
+			Overwrite: OverwriteNever,
+			Files: map[string]string{
+				"same":    "content: same\n",
+				"changed": "content: old\n",
+				"newer":   "content: older\n",
+				"missing": "content: missing\n",
+			},
+			Verified: 1,
+		},
+		{
+			Overwrite: OverwriteIfChanged,
+			KeepBoth:  true,
+			Files: map[string]string{
+				"same":                     "content: same\n",
+				"changed":                  "content: old\n",
+				"changed" + keepBothSuffix: "content: new\n",
+				"newer":                    "content: older\n",
+				"newer" + keepBothSuffix:   "content: newer\n",
+				"missing":                  "content: missing\n",
+			},
+			Verified: 3,
+		},
+	}
+
+	repo := repository.TestRepository(t)
+	sn, _ := saveSnapshot(t, repo, snapshot)
+
+	for _, test := range tests {
+		name := test.Overwrite.String()
+		if test.KeepBoth {
+			name += "-keep-both"
+		}
+		t.Run(name, func(t *testing.T) {
+			tempdir := rtest.TempDir(t)
+			for name, data := range existing {
+				filename := filepath.Join(tempdir, name)
+				rtest.OK(t, os.WriteFile(filename, []byte(data), 0644))
+				rtest.OK(t, os.Chtimes(filename, baseTime, baseTime))
+			}
+
+			res := NewRestorer(context.TODO(), repo, sn, Options{Overwrite: test.Overwrite, KeepBoth: test.KeepBoth})
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			rtest.OK(t, res.RestoreTo(ctx, tempdir))
+
+			entries, err := os.ReadDir(tempdir)
+			rtest.OK(t, err)
+			rtest.Equals(t, len(test.Files), len(entries))
+
+			for name, data := range test.Files {
+				buf, err := os.ReadFile(filepath.Join(tempdir, name))
+				rtest.OK(t, err)
+				rtest.Equals(t, data, string(buf))
+			}
+
+			// existing files which were kept are not verified
+			count, err := res.VerifyFiles(ctx, tempdir)
+			rtest.OK(t, err)
+			rtest.Equals(t, test.Verified, count)
+		})
+	}
+}
+
+func TestOverwriteBehaviorSet(t *testing.T) {
+	for _, s := range []string{"always", "if-changed", "if-newer", "never"} {
+		var b OverwriteBehavior
+		rtest.OK(t, b.Set(s))
+		rtest.Equals(t, s, b.String())
+	}
+
+	var b OverwriteBehavior
+	err := b.Set("sometimes")
+	rtest.Assert(t, err != nil, "expected error for invalid behavior")
+	rtest.Equals(t, OverwriteInvalid, b)
+}
@@ -29,7 +29,7 @@ func TestRestorerRestoreEmptyHardlinkedFileds(t *testing.T) {
 		},
 	})
 
-	res := NewRestorer(context.TODO(), repo, sn, false)
+	res := NewRestorer(context.TODO(), repo, sn, Options{})
 
 	res.SelectFilter = func(item string, dstpath string, node *restic.Node) (selectedForRestore bool, childMayBeSelected bool) {
 		return true, true
@@ -66,3 +66,113 @@ func getBlockCount(t *testing.T, filename string) int64 {
 	}
 	return st.Blocks
 }
+
+func TestRestorerSpecialFiles(t *testing.T) {
+	repo := repository.TestRepository(t)
+
+	sn, _ := saveSnapshot(t, repo, Snapshot{
+		Nodes: map[string]Node{
+			"fifo":   Special{Type: "fifo"},
+			"socket": Special{Type: "socket"},
+			"file":   File{Data: "content"},
+		},
+	})
+
+	for _, allowSpecial := range []bool{false, true} {
+		res := NewRestorer(context.TODO(), repo, sn, Options{AllowSpecial: allowSpecial})
+
+		tempdir := rtest.TempDir(t)
+		rtest.OK(t, res.RestoreTo(context.TODO(), tempdir))
+
+		fi, err := os.Lstat(filepath.Join(tempdir, "fifo"))
+		rtest.OK(t, err)
+		rtest.Assert(t, fi.Mode()&os.ModeNamedPipe != 0, "expected fifo, got mode %v", fi.Mode())
+
+		fi, err = os.Lstat(filepath.Join(tempdir, "socket"))
+		if allowSpecial {
+			rtest.OK(t, err)
+			rtest.Assert(t, fi.Mode()&os.ModeSocket != 0, "expected socket, got mode %v", fi.Mode())
+			rtest.Equals(t, os.FileMode(0600), fi.Mode().Perm())
+			rtest.Equals(t, uint64(0), res.SkippedSpecial())
+		} else {
+			rtest.Assert(t, os.IsNotExist(err), "socket should not be restored, got %v", err)
+			rtest.Equals(t, uint64(1), res.SkippedSpecial())
+		}
+	}
+}
+
+func TestRestorerDeviceSkipped(t *testing.T) {
+	repo := repository.TestRepository(t)
+
+	sn, _ := saveSnapshot(t, repo, Snapshot{
+		Nodes: map[string]Node{
+			"dev":     Special{Type: "dev", Device: 0x0801},
+			"chardev": Special{Type: "chardev", Device: 0x0103},
+		},
+	})
+
+	res := NewRestorer(context.TODO(), repo, sn, Options{})
+	tempdir := rtest.TempDir(t)
+	rtest.OK(t, res.RestoreTo(context.TODO(), tempdir))
+
+	for _, name := range []string{"dev", "chardev"} {
+		_, err := os.Lstat(filepath.Join(tempdir, name))
+		rtest.Assert(t, os.IsNotExist(err), "%v should not be restored, got %v", name, err)
+	}
+	rtest.Equals(t, uint64(2), res.SkippedSpecial())
+}
+
+func TestRestorerSpecialOverwrite(t *testing.T) {
+	repo := repository.TestRepository(t)
+
+	sn, _ := saveSnapshot(t, repo, Snapshot{
+		Nodes: map[string]Node{
+			"fifo":   Special{Type: "fifo"},
+			"socket": Special{Type: "socket"},
+		},
+	})
+
+	modes := map[string]os.FileMode{
+		"fifo":   os.ModeNamedPipe,
+		"socket": os.ModeSocket,
+	}
+
+	for _, test := range []struct {
+		Overwrite OverwriteBehavior
+		KeepBoth  bool
+		Replaced  bool
+	}{
+		{OverwriteAlways, false, true},
+		{OverwriteIfChanged, false, true},
+		{OverwriteNever, false, false},
+		{OverwriteAlways, true, false},
+	} {
+		name := test.Overwrite.String()
+		if test.KeepBoth {
+			name += "-keep-both"
+		}
+		t.Run(name, func(t *testing.T) {
+			tempdir := rtest.TempDir(t)
+			for name := range modes {
+				rtest.OK(t, os.WriteFile(filepath.Join(tempdir, name), []byte("existing"), 0600))
+			}
+
+			res := NewRestorer(context.TODO(), repo, sn, Options{AllowSpecial: true, Overwrite: test.Overwrite, KeepBoth: test.KeepBoth})
+			rtest.OK(t, res.RestoreTo(context.TODO(), tempdir))
+
+			for name, mode := range modes {
+				fi, err := os.Lstat(filepath.Join(tempdir, name))
+				rtest.OK(t, err)
+				rtest.Equals(t, test.Replaced, fi.Mode()&mode != 0)
+
+				fi, err = os.Lstat(filepath.Join(tempdir, name+keepBothSuffix))
+				if test.KeepBoth {
+					rtest.OK(t, err)
+					rtest.Assert(t, fi.Mode()&mode != 0, "expected %v, got mode %v", name, fi.Mode())
+				} else {
+					rtest.Assert(t, os.IsNotExist(err), "unexpected file %v%v", name, keepBothSuffix)
+				}
+			}
+		})
+	}
+}
@@ -11,7 +11,7 @@ import (
 // and updates f.size.
 func (f *partialFile) WriteAt(p []byte, offset int64) (n int, err error) {
 	if !f.sparse {
-		return f.File.WriteAt(p, offset)
+		return f.writeAt(p, offset)
 	}
 
 	n = len(p)
@@ -29,7 +29,7 @@ func (f *partialFile) WriteAt(p []byte, offset int64) (n int, err error) {
 
 	default:
 		var n2 int
-		n2, err = f.File.WriteAt(p, offset)
+		n2, err = f.writeAt(p, offset)
 		n = skipped + n2
 	}
 
@@ -0,0 +1,16 @@
+//go:build !windows
+// +build !windows
+
+package restorer
+
+import (
+	"os"
+
+	"github.com/restic/restic/internal/errors"
+)
+
+// markValidData returns an error, marking files as valid data is only
+// supported on Windows.
+func markValidData(wr *os.File, size int64) error {
+	return errors.New("marking files as valid data is not supported on this platform")
+}
@@ -99,6 +99,15 @@ func (b *JSONProgress) Error(item string, err error) error {
 	return nil
 }
 
+// Warning prints the warning.
+func (b *JSONProgress) Warning(item string, msg string) {
+	b.error(warningUpdate{
+		MessageType: "warning",
+		Message:     msg,
+		Item:        item,
+	})
+}
+
 // CompleteItem is the status callback function for the archiver when a
 // file/dir has been saved successfully.
 func (b *JSONProgress) CompleteItem(messageType, item string, previous, current *restic.Node, s archiver.ItemStats, d time.Duration) {
@@ -175,6 +184,30 @@ func (b *JSONProgress) ReportTotal(item string, start time.Time, s archiver.Scan
 	}
 }
 
+// SnapshotStatus reports the volumes for which a filesystem snapshot is being
+// created.
+func (b *JSONProgress) SnapshotStatus(volumes []string, start time.Time) {
+	b.print(statusUpdate{
+		MessageType:      "status",
+		SecondsElapsed:   uint64(time.Since(start) / time.Second),
+		CurrentSnapshots: volumes,
+	})
+}
+
+// CompleteSnapshot reports that the creation of a filesystem snapshot has
+// finished or failed.
+func (b *JSONProgress) CompleteSnapshot(volume string, d time.Duration, err error) {
+	status := snapshotUpdate{
+		MessageType: "fs_snapshot",
+		Volume:      volume,
+		Duration:    d.Seconds(),
+	}
+	if err != nil {
+		status.Error = err.Error()
+	}
+	b.print(status)
+}
+
 // Finish prints the finishing messages.
 func (b *JSONProgress) Finish(snapshotID restic.ID, start time.Time, summary *Summary, dryRun bool) {
 	b.print(summaryOutput{
@@ -193,6 +226,10 @@ func (b *JSONProgress) Finish(snapshotID restic.ID, start time.Time, summary *Su
 		TotalDuration:       time.Since(start).Seconds(),
 		SnapshotID:          snapshotID.String(),
 		DryRun:              dryRun,
+		FsSnapshotsCreated:  summary.FsSnapshots.Created,
+		FsSnapshotsFailed:   summary.FsSnapshots.Failed,
+		FsSnapshotDuration:  summary.FsSnapshots.Duration.Seconds(),
+		TotalWarnings:       summary.Warnings,
 	})
 }
 
@@ -211,6 +248,14 @@ type statusUpdate struct {
 	BytesDone        uint64   `json:"bytes_done,omitempty"`
 	ErrorCount       uint     `json:"error_count,omitempty"`
 	CurrentFiles     []string `json:"current_files,omitempty"`
+	CurrentSnapshots []string `json:"current_fs_snapshots,omitempty"`
+}
+
+type snapshotUpdate struct {
+	MessageType string  `json:"message_type"` // "fs_snapshot"
+	Volume      string  `json:"volume"`
+	Duration    float64 `json:"duration"` // in seconds
+	Error       string  `json:"error,omitempty"`
 }
 
 type errorUpdate struct {
@@ -220,6 +265,12 @@ type errorUpdate struct {
 	Item        string `json:"item"`
 }
 
+type warningUpdate struct {
+	MessageType string `json:"message_type"` // "warning"
+	Message     string `json:"message"`
+	Item        string `json:"item,omitempty"`
+}
+
 type verboseUpdate struct {
 	MessageType        string  `json:"message_type"` // "verbose_status"
 	Action             string  `json:"action"`
@@ -248,4 +299,8 @@ type summaryOutput struct {
 	TotalDuration       float64 `json:"total_duration"` // in seconds
 	SnapshotID          string  `json:"snapshot_id"`
 	DryRun              bool    `json:"dry_run,omitempty"`
+	FsSnapshotsCreated  uint    `json:"fs_snapshots_created,omitempty"`
+	FsSnapshotsFailed   uint    `json:"fs_snapshots_failed,omitempty"`
+	FsSnapshotDuration  float64 `json:"fs_snapshot_duration,omitempty"` // in seconds
+	TotalWarnings       uint    `json:"total_warnings,omitempty"`
 }
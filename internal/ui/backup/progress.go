@@ -3,6 +3,7 @@ package backup
 import (
 	"context"
 	"io"
+	"sort"
 	"sync"
 	"time"
 
@@ -17,8 +18,15 @@ type ProgressPrinter interface {
 	Update(total, processed Counter, errors uint, currentFiles map[string]struct{}, start time.Time, secs uint64)
 	Error(item string, err error) error
 	ScannerError(item string, err error) error
+	// Warning reports a problem which did not prevent the backup from
+	// completing, item may be empty.
+	Warning(item string, msg string)
 	CompleteItem(messageType string, item string, previous, current *restic.Node, s archiver.ItemStats, d time.Duration)
 	ReportTotal(item string, start time.Time, s archiver.ScanStats)
+	// SnapshotStatus is called regularly while filesystem snapshots are
+	// created, volumes is sorted.
+	SnapshotStatus(volumes []string, start time.Time)
+	CompleteSnapshot(volume string, d time.Duration, err error)
 	Finish(snapshotID restic.ID, start time.Time, summary *Summary, dryRun bool)
 	Reset()
 
@@ -42,6 +50,14 @@ type Summary struct {
 	}
 	ProcessedBytes uint64
 	archiver.ItemStats
+	// FsSnapshots counts the filesystem snapshots created for the backup.
+	FsSnapshots struct {
+		Created  uint
+		Failed   uint
+		Duration time.Duration
+	}
+	// Warnings is the number of warnings reported via Progress.Warning.
+	Warnings uint
 }
 
 // Progress reports progress for the `backup` command.
@@ -57,6 +73,10 @@ type Progress struct {
 	processed, total Counter
 	errors           uint
 
+	// snapshots maps the volumes for which a filesystem snapshot is being
+	// created to the start time
+	snapshots map[string]time.Time
+
 	closed chan struct{}
 
 	summary Summary
@@ -69,6 +89,7 @@ func NewProgress(printer ProgressPrinter, interval time.Duration) *Progress {
 		start:    time.Now(),
 
 		currentFiles: make(map[string]struct{}),
+		snapshots:    make(map[string]time.Time),
 		closed:       make(chan struct{}),
 
 		printer: printer,
@@ -102,6 +123,18 @@ func (p *Progress) Run(ctx context.Context) {
 		}
 
 		p.mu.Lock()
+		if len(p.snapshots) > 0 {
+			// no files can be accessed until the snapshots are available
+			volumes := make([]string, 0, len(p.snapshots))
+			for volume := range p.snapshots {
+				volumes = append(volumes, volume)
+			}
+			sort.Strings(volumes)
+			p.printer.SnapshotStatus(volumes, p.start)
+			p.mu.Unlock()
+			continue
+		}
+
 		if !p.scanStarted {
 			p.mu.Unlock()
 			continue
@@ -129,6 +162,59 @@ func (p *Progress) Error(item string, err error) error {
 	return p.printer.Error(item, err)
 }
 
+// Warning reports a problem which did not prevent the backup from completing,
+// e.g. a skipped file or the fallback to a slower method.
+func (p *Progress) Warning(item string, msg string) {
+	p.mu.Lock()
+	p.summary.Warnings++
+	p.mu.Unlock()
+
+	p.printer.Warning(item, msg)
+}
+
+// AddWarnings adds n warnings which were reported by other means than
+// Warning to the summary.
+func (p *Progress) AddWarnings(n uint) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.summary.Warnings += n
+}
+
+// Warnings returns the number of warnings reported so far.
+func (p *Progress) Warnings() uint {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.summary.Warnings
+}
+
+// StartSnapshot is called when the creation of a filesystem snapshot for
+// volume starts.
+func (p *Progress) StartSnapshot(volume string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.snapshots[volume] = time.Now()
+}
+
+// CompleteSnapshot is called when the creation of the filesystem snapshot for
+// volume has finished or failed.
+func (p *Progress) CompleteSnapshot(volume string, err error) {
+	p.mu.Lock()
+	var d time.Duration
+	if start, ok := p.snapshots[volume]; ok {
+		d = time.Since(start)
+		delete(p.snapshots, volume)
+	}
+	if err != nil {
+		p.summary.FsSnapshots.Failed++
+	} else {
+		p.summary.FsSnapshots.Created++
+	}
+	p.summary.FsSnapshots.Duration += d
+	p.mu.Unlock()
+
+	p.printer.CompleteSnapshot(volume, d, err)
+}
+
 // StartFile is called when a file is being processed by a worker.
 func (p *Progress) StartFile(filename string) {
 	p.mu.Lock()
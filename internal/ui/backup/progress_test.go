@@ -8,19 +8,31 @@ import (
 	"time"
 
 	"github.com/restic/restic/internal/archiver"
+	"github.com/restic/restic/internal/errors"
 	"github.com/restic/restic/internal/restic"
+	rtest "github.com/restic/restic/internal/test"
 )
 
 type mockPrinter struct {
 	sync.Mutex
 	dirUnchanged, fileNew bool
 	id                    restic.ID
+
+	snapshotVolumes    []string
+	completedSnapshots []string
+	warnings           []string
 }
 
 func (p *mockPrinter) Update(total, processed Counter, errors uint, currentFiles map[string]struct{}, start time.Time, secs uint64) {
 }
 func (p *mockPrinter) Error(item string, err error) error        { return err }
 func (p *mockPrinter) ScannerError(item string, err error) error { return err }
+func (p *mockPrinter) Warning(item string, msg string) {
+	p.Lock()
+	defer p.Unlock()
+
+	p.warnings = append(p.warnings, item+": "+msg)
+}
 
 func (p *mockPrinter) CompleteItem(messageType string, item string, previous, current *restic.Node, s archiver.ItemStats, d time.Duration) {
 	p.Lock()
@@ -35,6 +47,18 @@ func (p *mockPrinter) CompleteItem(messageType string, item string, previous, cu
 }
 
 func (p *mockPrinter) ReportTotal(_ string, _ time.Time, _ archiver.ScanStats) {}
+func (p *mockPrinter) SnapshotStatus(volumes []string, _ time.Time) {
+	p.Lock()
+	defer p.Unlock()
+
+	p.snapshotVolumes = volumes
+}
+func (p *mockPrinter) CompleteSnapshot(volume string, _ time.Duration, err error) {
+	p.Lock()
+	defer p.Unlock()
+
+	p.completedSnapshots = append(p.completedSnapshots, volume)
+}
 func (p *mockPrinter) Finish(id restic.ID, _ time.Time, summary *Summary, dryRun bool) {
 	p.Lock()
 	defer p.Unlock()
@@ -85,3 +109,56 @@ func TestProgress(t *testing.T) {
 		t.Errorf("id not stored (has %v)", prnt.id)
 	}
 }
+
+func TestProgressSnapshot(t *testing.T) {
+	t.Parallel()
+
+	prnt := &mockPrinter{}
+	prog := NewProgress(prnt, time.Millisecond)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go prog.Run(ctx)
+
+	prog.StartSnapshot(`D:\`)
+	prog.StartSnapshot(`C:\`)
+	time.Sleep(10 * time.Millisecond)
+
+	prnt.Lock()
+	volumes := prnt.snapshotVolumes
+	prnt.Unlock()
+	rtest.Equals(t, []string{`C:\`, `D:\`}, volumes)
+
+	prog.CompleteSnapshot(`C:\`, nil)
+	prog.CompleteSnapshot(`D:\`, errors.New("failed"))
+
+	cancel()
+	prog.Finish(restic.NewRandomID(), false)
+
+	rtest.Equals(t, []string{`C:\`, `D:\`}, prnt.completedSnapshots)
+	rtest.Equals(t, uint(1), prog.summary.FsSnapshots.Created)
+	rtest.Equals(t, uint(1), prog.summary.FsSnapshots.Failed)
+	rtest.Equals(t, 0, len(prog.snapshots))
+}
+
+func TestProgressWarning(t *testing.T) {
+	t.Parallel()
+
+	prnt := &mockPrinter{}
+	prog := NewProgress(prnt, time.Millisecond)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go prog.Run(ctx)
+
+	prog.Warning("/foo", "skipped")
+	prog.Warning("", "fallback")
+	rtest.Equals(t, uint(2), prog.Warnings())
+	// warnings reported by other means are only counted
+	prog.AddWarnings(3)
+
+	cancel()
+	prog.Finish(restic.NewRandomID(), false)
+
+	rtest.Equals(t, []string{"/foo: skipped", ": fallback"}, prnt.warnings)
+	rtest.Equals(t, uint(5), prog.summary.Warnings)
+	rtest.Equals(t, uint(0), prog.errors)
+}
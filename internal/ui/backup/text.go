@@ -85,6 +85,15 @@ func (b *TextProgress) Error(item string, err error) error {
 	return nil
 }
 
+// Warning prints the warning.
+func (b *TextProgress) Warning(item string, msg string) {
+	if item == "" {
+		b.W("%v\n", msg)
+		return
+	}
+	b.W("%v: %v\n", item, msg)
+}
+
 // CompleteItem is the status callback function for the archiver when a
 // file/dir has been saved successfully.
 func (b *TextProgress) CompleteItem(messageType, item string, previous, current *restic.Node, s archiver.ItemStats, d time.Duration) {
@@ -118,6 +127,26 @@ func (b *TextProgress) ReportTotal(item string, start time.Time, s archiver.Scan
 	)
 }
 
+// SnapshotStatus shows the volumes for which a filesystem snapshot is being
+// created.
+func (b *TextProgress) SnapshotStatus(volumes []string, start time.Time) {
+	lines := make([]string, 0, len(volumes)+1)
+	lines = append(lines, fmt.Sprintf("[%s] creating filesystem snapshots",
+		ui.FormatDuration(time.Since(start))))
+	lines = append(lines, volumes...)
+
+	b.term.SetStatus(lines)
+}
+
+// CompleteSnapshot prints the time it took to create a filesystem snapshot.
+// Errors are reported separately via Error.
+func (b *TextProgress) CompleteSnapshot(volume string, d time.Duration, err error) {
+	if err != nil {
+		return
+	}
+	b.P("created filesystem snapshot for %v in %.3fs\n", volume, d.Seconds())
+}
+
 // Reset status
 func (b *TextProgress) Reset() {
 	if b.term.CanUpdateStatus() {
@@ -132,6 +161,13 @@ func (b *TextProgress) Finish(snapshotID restic.ID, start time.Time, summary *Su
 	b.P("Dirs:        %5d new, %5d changed, %5d unmodified\n", summary.Dirs.New, summary.Dirs.Changed, summary.Dirs.Unchanged)
 	b.V("Data Blobs:  %5d new\n", summary.ItemStats.DataBlobs)
 	b.V("Tree Blobs:  %5d new\n", summary.ItemStats.TreeBlobs)
+	if summary.FsSnapshots.Created+summary.FsSnapshots.Failed > 0 {
+		b.V("FS Snapshots: %4d created, %5d failed in %s\n", summary.FsSnapshots.Created,
+			summary.FsSnapshots.Failed, ui.FormatDuration(summary.FsSnapshots.Duration))
+	}
+	if summary.Warnings > 0 {
+		b.P("Warnings:    %5d\n", summary.Warnings)
+	}
 	verb := "Added"
 	if dryRun {
 		verb = "Would add"
@@ -22,6 +22,12 @@ func (m *Message) E(msg string, args ...interface{}) {
 	m.term.Errorf(msg, args...)
 }
 
+// W reports a warning, i.e. a problem which did not prevent the operation
+// from completing.
+func (m *Message) W(msg string, args ...interface{}) {
+	m.term.Errorf("warning: "+msg, args...)
+}
+
 // P prints a message if verbosity >= 1, this is used for normal messages which
 // are not errors.
 func (m *Message) P(msg string, args ...interface{}) {